@@ -0,0 +1,154 @@
+package answer
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+
+	"gitlab.cherkaoui.ch/quillium-ai/quillium/src/backend/internal/chats"
+	llmproviders "gitlab.cherkaoui.ch/quillium-ai/quillium/src/backend/internal/llm_providers"
+	"gitlab.cherkaoui.ch/quillium-ai/quillium/src/backend/internal/search"
+	"gitlab.cherkaoui.ch/quillium-ai/quillium/src/backend/internal/settings"
+)
+
+// Error returns the description of the invalid option
+func (e *OptionsError) Error() string {
+	return "invalid options: " + e.Message
+}
+
+// NewPipeline checks the quality profile and the options against its limits,
+// and selects the provider serving its model, decrypting the provider API key.
+// Invalid options are reported as an *OptionsError.
+func NewPipeline(adminSettings *settings.AdminSettings, options Options) (*Pipeline, error) {
+	qualityProfile := settings.QualityProfileBalanced // Default to balanced profile
+	switch options.QualityProfile {
+	case "":
+	case settings.QualityProfileSpeed, settings.QualityProfileBalanced, settings.QualityProfileQuality:
+		qualityProfile = options.QualityProfile
+	default:
+		return nil, &OptionsError{Message: "quality profile must be speed, balanced or quality"}
+	}
+
+	limits := adminSettings.GetGenerationLimits(qualityProfile)
+	if options.Temperature != nil {
+		if err := limits.CheckTemperature(*options.Temperature); err != nil {
+			return nil, &OptionsError{Message: err.Error()}
+		}
+	}
+	if options.MaxTokens != 0 {
+		if err := limits.CheckMaxTokens(options.MaxTokens); err != nil {
+			return nil, &OptionsError{Message: err.Error()}
+		}
+	}
+
+	// The previous turns are trimmed to what fits into the context window of the model
+	model := adminSettings.GetLLMProfile(qualityProfile)
+	metadata := adminSettings.GetModelMetadata(model)
+	contextBudget := metadata.ContextBudget()
+	if options.MaxTokens > 0 {
+		// Reserve exactly the requested completion length
+		contextBudget = metadata.ContextWindow - options.MaxTokens
+		if contextBudget <= 0 {
+			return nil, &OptionsError{Message: "maxTokens exceeds the context window of the model"}
+		}
+	}
+
+	registry, err := llmproviders.NewRegistryFromSettings(adminSettings)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load LLM providers: %w", err)
+	}
+	provider, err := registry.Get(model.Provider)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Pipeline{
+		adminSettings:    adminSettings,
+		options:          options,
+		qualityProfile:   qualityProfile,
+		model:            model,
+		retrievalProfile: adminSettings.GetRetrievalProfile(qualityProfile),
+		provider:         provider,
+		contextBudget:    contextBudget,
+	}, nil
+}
+
+// QualityProfile returns the quality profile the pipeline answers with
+func (p *Pipeline) QualityProfile() string {
+	return p.qualityProfile
+}
+
+// Generation returns how the answers of the pipeline are generated, stored with the assistant message
+func (p *Pipeline) Generation() *chats.Generation {
+	return &chats.Generation{
+		QualityProfile: p.qualityProfile,
+		Provider:       p.model.Provider,
+		Model:          p.model.Model,
+		Temperature:    p.options.Temperature,
+		MaxTokens:      p.options.MaxTokens,
+	}
+}
+
+// Retrieve searches the documents grounding the answer to query. It returns them as
+// the sources of message msgNum and as the numbered passages passed to the model.
+func (p *Pipeline) Retrieve(ctx context.Context, query string, msgNum int) ([]chats.Source, []string) {
+	// Query rewriting and expansion use the same model as the answer
+	generateQueries := func(ctx context.Context, question string, n int) ([]string, error) {
+		return llmproviders.GenerateSearchQueries(ctx, p.provider, p.model.Model, question, n)
+	}
+
+	// Search the index, and the live web when the index has too few results
+	results := retrieveResults(ctx, p.adminSettings, query, p.retrievalProfile, generateQueries)
+	log.Printf("Retrieved %d results for %s profile", len(results), p.qualityProfile)
+	return search.ToSources(results, msgNum), search.ToIndexResults(results)
+}
+
+// Generate answers query from the retrieved passages, following the previous turns of the conversation.
+// onChunk receives the answer as it is generated and may be nil. The content generated so far
+// is returned along with the error when the generation fails or ctx is cancelled.
+func (p *Pipeline) Generate(ctx context.Context, query string, indexResults []string, history []chats.Message, onChunk func(string)) (string, error) {
+	messages := make([]llmproviders.Message, 0, len(history))
+	for _, message := range history {
+		messages = append(messages, llmproviders.Message{Role: message.Role, Content: message.Content})
+	}
+
+	chatReq := llmproviders.ChatRequest{
+		Model:       p.model.Model,
+		Messages:    llmproviders.BuildMessages(query, indexResults, messages, p.contextBudget),
+		Temperature: p.options.Temperature,
+		MaxTokens:   p.options.MaxTokens,
+	}
+
+	if !p.provider.Capabilities().Streaming {
+		// Providers without streaming deliver the whole answer as a single chunk
+		content, err := p.provider.Complete(ctx, chatReq)
+		if err != nil {
+			return "", err
+		}
+		if onChunk != nil && content != "" {
+			onChunk(content)
+		}
+		return content, nil
+	}
+
+	var content strings.Builder
+	var streamErr error
+	err := p.provider.ChatStream(ctx, chatReq, func(streamResp llmproviders.StreamResponse) {
+		if streamResp.Error != nil {
+			streamErr = streamResp.Error
+			return
+		}
+		if streamResp.Content == "" {
+			return
+		}
+		content.WriteString(streamResp.Content)
+		if onChunk != nil {
+			onChunk(streamResp.Content)
+		}
+	})
+	if err == nil {
+		err = streamErr
+	}
+	return content.String(), err
+}
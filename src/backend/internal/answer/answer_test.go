@@ -0,0 +1,178 @@
+package answer
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"gitlab.cherkaoui.ch/quillium-ai/quillium/src/backend/internal/chats"
+	llmproviders "gitlab.cherkaoui.ch/quillium-ai/quillium/src/backend/internal/llm_providers"
+	"gitlab.cherkaoui.ch/quillium-ai/quillium/src/backend/internal/settings"
+)
+
+// fakeProvider answers with fixed chunks and records the last request
+type fakeProvider struct {
+	streaming bool
+	chunks    []string
+	err       error
+	request   llmproviders.ChatRequest
+}
+
+func (p *fakeProvider) Name() string { return "fake" }
+
+func (p *fakeProvider) Capabilities() llmproviders.Capabilities {
+	return llmproviders.Capabilities{Streaming: p.streaming}
+}
+
+func (p *fakeProvider) ChatStream(ctx context.Context, chatReq llmproviders.ChatRequest, callback func(llmproviders.StreamResponse)) error {
+	p.request = chatReq
+	for _, chunk := range p.chunks {
+		callback(llmproviders.StreamResponse{Content: chunk})
+	}
+	if p.err != nil {
+		callback(llmproviders.StreamResponse{Error: p.err})
+		return p.err
+	}
+	callback(llmproviders.StreamResponse{Done: true})
+	return nil
+}
+
+func (p *fakeProvider) Complete(ctx context.Context, chatReq llmproviders.ChatRequest) (string, error) {
+	p.request = chatReq
+	if p.err != nil {
+		return "", p.err
+	}
+	content := ""
+	for _, chunk := range p.chunks {
+		content += chunk
+	}
+	return content, nil
+}
+
+func (p *fakeProvider) ListModels(ctx context.Context) ([]llmproviders.Model, error) {
+	return nil, nil
+}
+
+// newTestSettings returns admin settings with an Ollama provider, which needs no API key
+func newTestSettings() *settings.AdminSettings {
+	return &settings.AdminSettings{
+		LLMProfileBalanced:  "llama3",
+		LLMProviderBalanced: "local",
+		LLMProviders: []settings.LLMProvider{
+			{Name: "local", Type: settings.ProviderTypeOllama, BaseURL: "http://localhost:11434"},
+		},
+	}
+}
+
+func TestNewPipeline(t *testing.T) {
+	tooHot := 5.0
+	testCases := []struct {
+		name         string
+		options      Options
+		optionsError bool
+	}{
+		{"Default options", Options{}, false},
+		{"Unknown quality profile", Options{QualityProfile: "fastest"}, true},
+		{"Temperature above the limit", Options{Temperature: &tooHot}, true},
+		{"Max tokens above the limit", Options{MaxTokens: 100000}, true},
+		{"Max tokens exceeding the context window", Options{MaxTokens: 4096}, true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			adminSettings := newTestSettings()
+			adminSettings.LLMModelMetadata = []settings.ModelMetadata{
+				{Provider: "local", Model: "llama3", ContextWindow: 4096},
+			}
+
+			pipeline, err := NewPipeline(adminSettings, tc.options)
+			var optionsErr *OptionsError
+			if tc.optionsError {
+				if !errors.As(err, &optionsErr) {
+					t.Fatalf("Expected an options error, got %v", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Failed to create pipeline: %v", err)
+			}
+			if pipeline.QualityProfile() != settings.QualityProfileBalanced {
+				t.Errorf("Expected the balanced profile, got %s", pipeline.QualityProfile())
+			}
+			if generation := pipeline.Generation(); generation.Provider != "local" || generation.Model != "llama3" {
+				t.Errorf("Unexpected generation: %+v", generation)
+			}
+		})
+	}
+}
+
+func TestNewPipelineWithoutProvider(t *testing.T) {
+	adminSettings := newTestSettings()
+	adminSettings.LLMProviders = nil
+
+	_, err := NewPipeline(adminSettings, Options{})
+	var optionsErr *OptionsError
+	if err == nil || errors.As(err, &optionsErr) {
+		t.Errorf("Expected a configuration error, got %v", err)
+	}
+}
+
+func TestGenerate(t *testing.T) {
+	temperature := 0.2
+	history := []chats.Message{
+		{Role: "user", Content: "What is Go?"},
+		{Role: "assistant", Content: "A programming language."},
+	}
+
+	for _, streaming := range []bool{true, false} {
+		provider := &fakeProvider{streaming: streaming, chunks: []string{"Go ", "", "is great [1]"}}
+		pipeline := &Pipeline{
+			options:       Options{Temperature: &temperature, MaxTokens: 100},
+			model:         settings.LLMModel{Provider: "fake", Model: "fake-model"},
+			provider:      provider,
+			contextBudget: 4096,
+		}
+
+		var received []string
+		content, err := pipeline.Generate(context.Background(), "Is Go great?", []string{"[1] Go (https://go.dev)"}, history, func(chunk string) {
+			received = append(received, chunk)
+		})
+		if err != nil {
+			t.Fatalf("Generate failed (streaming: %t): %v", streaming, err)
+		}
+		if content != "Go is great [1]" {
+			t.Errorf("Unexpected content (streaming: %t): %q", streaming, content)
+		}
+		if streaming && len(received) != 2 {
+			t.Errorf("Expected empty chunks to be skipped, got %q", received)
+		}
+		if !streaming && len(received) != 1 {
+			t.Errorf("Expected a single chunk without streaming, got %q", received)
+		}
+
+		request := provider.request
+		if request.Model != "fake-model" || request.MaxTokens != 100 || request.Temperature == nil || *request.Temperature != 0.2 {
+			t.Errorf("Options not passed to the provider: %+v", request)
+		}
+		// System prompt, both previous turns and the question
+		if len(request.Messages) != 4 {
+			t.Errorf("Expected 4 messages, got %d", len(request.Messages))
+		}
+	}
+}
+
+func TestGenerateKeepsPartialContent(t *testing.T) {
+	streamErr := errors.New("connection reset")
+	pipeline := &Pipeline{
+		provider:      &fakeProvider{streaming: true, chunks: []string{"Partial"}, err: streamErr},
+		contextBudget: 4096,
+	}
+
+	content, err := pipeline.Generate(context.Background(), "Question", nil, nil, nil)
+	if !errors.Is(err, streamErr) {
+		t.Errorf("Expected the stream error, got %v", err)
+	}
+	if content != "Partial" {
+		t.Errorf("Expected the content generated before the error, got %q", content)
+	}
+}
@@ -0,0 +1,70 @@
+package answer
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"gitlab.cherkaoui.ch/quillium-ai/quillium/src/backend/internal/crawler"
+	"gitlab.cherkaoui.ch/quillium-ai/quillium/src/backend/internal/search"
+	"gitlab.cherkaoui.ch/quillium-ai/quillium/src/backend/internal/settings"
+)
+
+// retrieveResults gathers the documents used to ground an answer.
+// The Elasticsearch index is searched first; when it returns fewer results than the
+// profile asks for, the missing ones are fetched live through the webcrawler.
+// Errors are logged and never fail the request, the answer is then given with fewer sources.
+func retrieveResults(ctx context.Context, adminSettings *settings.AdminSettings, query string, profile settings.RetrievalProfile, generate search.QueryGenerator) []search.Result {
+	var results []search.Result
+
+	searchClient, err := search.NewClientFromSettings(adminSettings)
+	if err != nil {
+		log.Printf("Skipping index search: %v", err)
+	} else {
+		results, err = search.Retrieve(ctx, searchClient, query, profile, generate)
+		if err != nil {
+			log.Printf("Error searching index: %v", err)
+		}
+	}
+
+	missing := profile.MaxResults - len(results)
+	if missing <= 0 {
+		return results
+	}
+
+	crawlerClient, err := crawler.NewClientFromSettings(adminSettings)
+	if err != nil {
+		log.Printf("Skipping live crawl: %v", err)
+		return results
+	}
+
+	pages, err := crawlerClient.FetchPages(ctx, search.KeywordQuery(query), missing)
+	if err != nil {
+		log.Printf("Error fetching pages from webcrawler: %v", err)
+		return results
+	}
+	log.Printf("Fetched %d live pages from webcrawler", len(pages))
+
+	// Store the pages so that the next similar question is answered from the index
+	if searchClient != nil && adminSettings.WebcrawlerIndexPages && len(pages) > 0 {
+		go indexPages(searchClient, pages)
+	}
+
+	results = search.Deduplicate(append(results, crawler.ToResults(pages)...))
+	if len(results) > profile.MaxResults {
+		results = results[:profile.MaxResults]
+	}
+	return results
+}
+
+// indexPages writes crawled pages back into Elasticsearch
+func indexPages(searchClient *search.Client, pages []crawler.Page) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	for _, page := range pages {
+		if err := searchClient.IndexDocument(ctx, crawler.DocumentID(page.URL), page.ToDocument()); err != nil {
+			log.Printf("Error indexing crawled page %s: %v", page.URL, err)
+		}
+	}
+}
@@ -0,0 +1,29 @@
+package answer
+
+import (
+	llmproviders "gitlab.cherkaoui.ch/quillium-ai/quillium/src/backend/internal/llm_providers"
+	"gitlab.cherkaoui.ch/quillium-ai/quillium/src/backend/internal/settings"
+)
+
+// Options are the generation options of a request
+type Options struct {
+	QualityProfile string   // Speed, balanced or quality, balanced when empty
+	Temperature    *float64 // Omitted to use the provider default
+	MaxTokens      int      // 0 to use the provider default
+}
+
+// Pipeline answers questions with the search backends and the model configured for a quality profile
+type Pipeline struct {
+	adminSettings    *settings.AdminSettings
+	options          Options
+	qualityProfile   string
+	model            settings.LLMModel
+	retrievalProfile settings.RetrievalProfile
+	provider         llmproviders.Provider
+	contextBudget    int
+}
+
+// OptionsError reports request options outside the limits configured for the quality profile
+type OptionsError struct {
+	Message string
+}
@@ -0,0 +1,88 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+
+	"gitlab.cherkaoui.ch/quillium-ai/quillium/src/backend/internal/answer"
+	"gitlab.cherkaoui.ch/quillium-ai/quillium/src/backend/internal/settings"
+)
+
+// Ask answers a question in a single response, for clients that cannot hold a connection open.
+// The sources cited in the answer are returned along with it.
+func Ask(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Method not allowed"})
+		return
+	}
+
+	var req AskRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Invalid request"})
+		return
+	}
+
+	req.Query = strings.TrimSpace(req.Query)
+	if req.Query == "" {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Query is required"})
+		return
+	}
+
+	switch req.Profile {
+	case "", settings.QualityProfileSpeed, settings.QualityProfileBalanced, settings.QualityProfileQuality:
+	default:
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Profile must be speed, balanced or quality"})
+		return
+	}
+
+	adminSettings, err := dbConn.GetAdminSettings(r.Context())
+	if err != nil {
+		log.Printf("Error getting admin settings: %v", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Failed to get admin settings"})
+		return
+	}
+
+	pipeline, err := answer.NewPipeline(adminSettings, answer.Options{
+		QualityProfile: req.Profile,
+		Temperature:    req.Temperature,
+		MaxTokens:      req.MaxTokens,
+	})
+	if err != nil {
+		var optionsErr *answer.OptionsError
+		if errors.As(err, &optionsErr) {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]string{"error": "Invalid options: " + optionsErr.Message})
+			return
+		}
+		log.Printf("Error selecting LLM provider: %v", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]string{"error": "LLM provider is not configured"})
+		return
+	}
+
+	// The generation stops when the client gives up waiting
+	ctx := r.Context()
+	sources, indexResults := pipeline.Retrieve(ctx, req.Query, 0)
+	content, err := pipeline.Generate(ctx, req.Query, indexResults, nil, nil)
+	if err != nil {
+		log.Printf("Error generating answer: %v", err)
+		w.WriteHeader(http.StatusBadGateway)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Error generating answer"})
+		return
+	}
+
+	json.NewEncoder(w).Encode(AskResponse{
+		Answer:  content,
+		Profile: pipeline.QualityProfile(),
+		Sources: sources,
+	})
+}
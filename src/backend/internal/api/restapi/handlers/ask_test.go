@@ -0,0 +1,43 @@
+package handlers_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"gitlab.cherkaoui.ch/quillium-ai/quillium/src/backend/internal/api/restapi/handlers"
+)
+
+func TestAskRejectsInvalidRequests(t *testing.T) {
+	testCases := []struct {
+		name           string
+		method         string
+		body           string
+		expectedStatus int
+	}{
+		{"GET is not allowed", http.MethodGet, "", http.StatusMethodNotAllowed},
+		{"Invalid body", http.MethodPost, `{"query":`, http.StatusBadRequest},
+		{"Missing query", http.MethodPost, `{"profile":"speed"}`, http.StatusBadRequest},
+		{"Blank query", http.MethodPost, `{"query":"   "}`, http.StatusBadRequest},
+		{"Unknown profile", http.MethodPost, `{"query":"What is Go?","profile":"fastest"}`, http.StatusBadRequest},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest(tc.method, "/api/v1/ask", bytes.NewBufferString(tc.body))
+			rec := httptest.NewRecorder()
+
+			handlers.Ask(rec, req)
+
+			if rec.Code != tc.expectedStatus {
+				t.Errorf("Expected status %d, got %d", tc.expectedStatus, rec.Code)
+			}
+			var resp map[string]string
+			if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil || resp["error"] == "" {
+				t.Errorf("Expected an error message, got %v (%v)", resp, err)
+			}
+		})
+	}
+}
@@ -2,6 +2,7 @@ package handlers
 
 import (
 	"encoding/json"
+	"errors"
 	"log"
 	"net/http"
 	"time"
@@ -17,11 +18,11 @@ import (
 	"gitlab.cherkaoui.ch/quillium-ai/quillium/src/backend/internal/user"
 )
 
-var dbConn *db.DB
+var dbConn db.Store
 var httpsEnabled, _ = strconv.ParseBool(os.Getenv("HTTPS_SECURE"))
 
 // InitHandlers initializes the handlers with a database connection
-func InitHandlers(db *db.DB) {
+func InitHandlers(db db.Store) {
 	dbConn = db
 }
 
@@ -42,34 +43,80 @@ func Login(w http.ResponseWriter, r *http.Request) {
 	// Debug: Log the remember me value
 	log.Printf("Login request received with remember_me: %v", req.RememberMe)
 
-	// Validate credentials
-	userData, err := dbConn.GetUser(&req.Email, nil)
-	if err != nil || userData == nil {
-		w.WriteHeader(http.StatusUnauthorized)
-		json.NewEncoder(w).Encode(map[string]string{"error": "Invalid credentials"})
+	// Validate credentials against the local accounts, then the LDAP directory
+	userData, err := dbConn.GetUser(r.Context(), &req.Email, nil)
+	if err != nil || userData == nil || !userData.ValidatePassword(req.Password) {
+		userData, err = ldapLogin(r.Context(), req.Email, req.Password)
+		if err != nil {
+			log.Printf("LDAP login failed: %v", err)
+		}
+		if userData == nil {
+			w.WriteHeader(http.StatusUnauthorized)
+			json.NewEncoder(w).Encode(map[string]string{"error": "Invalid credentials"})
+			return
+		}
+	}
+
+	// Accounts with two-factor authentication finish the login with a code
+	challenge, err := twoFactorChallenge(r.Context(), userData, req.RememberMe)
+	if err != nil {
+		log.Printf("Failed to check two-factor authentication: %v", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Failed to check two-factor authentication"})
+		return
+	}
+	if challenge != nil {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(challenge)
 		return
 	}
 
-	userSettings, err := dbConn.GetUserSettings(*userData.ID)
+	writeLoginResponse(w, r, userData, req.RememberMe, nil)
+}
+
+// writeLoginResponse starts a session for an authenticated user and answers
+// with its tokens, the user and their settings
+func writeLoginResponse(w http.ResponseWriter, r *http.Request, userData *user.User, rememberMe bool, recoveryCodes []string) {
+	userSettings, err := dbConn.GetUserSettings(r.Context(), *userData.ID)
 	if err != nil {
 		w.WriteHeader(http.StatusInternalServerError)
 		json.NewEncoder(w).Encode(map[string]string{"error": "Failed to get user settings"})
 		return
 	}
 
-	// Verify password using the user's method
-	if !userData.ValidatePassword(req.Password) {
-		w.WriteHeader(http.StatusUnauthorized)
-		json.NewEncoder(w).Encode(map[string]string{"error": "Invalid credentials"})
+	token, refreshToken, err := startSession(w, r, *userData.ID, userData.IsAdmin, rememberMe)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
 		return
 	}
 
+	// Return tokens in response body as well (for non-browser clients)
+	w.Header().Set("Content-Type", "application/json")
+	response := LoginResponse{
+		Token:    token,
+		UserID:   *userData.ID,
+		IsAdmin:  userData.IsAdmin,
+		Settings: *userSettings,
+
+		RecoveryCodes: recoveryCodes,
+	}
+
+	// Add refresh token to response if remember me is enabled
+	if rememberMe && refreshToken != "" {
+		response.RefreshToken = refreshToken
+	}
+
+	json.NewEncoder(w).Encode(response)
+}
+
+// startSession sets the short-lived JWT cookie and, with rememberMe, stores a
+// refresh token and sets its cookie. The tokens are returned for non-browser clients.
+func startSession(w http.ResponseWriter, r *http.Request, userID int, isAdmin bool, rememberMe bool) (string, string, error) {
 	// Generate short-lived JWT token (15 minutes)
-	token, err := middleware.GenerateJWT(*userData.ID, userData.IsAdmin)
+	token, err := middleware.GenerateJWT(userID, isAdmin)
 	if err != nil {
-		w.WriteHeader(http.StatusInternalServerError)
-		json.NewEncoder(w).Encode(map[string]string{"error": "Failed to generate token"})
-		return
+		return "", "", errors.New("Failed to generate token")
 	}
 
 	// Set JWT cookie with short expiration for browser clients
@@ -83,61 +130,38 @@ func Login(w http.ResponseWriter, r *http.Request) {
 		MaxAge:   int(15 * time.Minute.Seconds()), // 15 minutes expiration
 	})
 
-	// Handle refresh token if remember me is enabled
-	var refreshToken string
-	if req.RememberMe {
-		log.Printf("Generating refresh token for user ID: %d", *userData.ID)
-		// Generate refresh token
-		refreshToken, err = middleware.GenerateRefreshToken()
-		if err != nil {
-			log.Printf("Failed to generate refresh token: %v", err)
-			w.WriteHeader(http.StatusInternalServerError)
-			json.NewEncoder(w).Encode(map[string]string{"error": "Failed to generate refresh token"})
-			return
-		}
-		log.Printf("Refresh token generated successfully")
-
-		// Store refresh token in database (valid for 180 days)
-		refreshExpiration := time.Now().Add(180 * 24 * time.Hour) // 180 days
-		log.Printf("Storing refresh token in database with expiration: %v", refreshExpiration)
-		err = dbConn.CreateRefreshToken(*userData.ID, refreshToken, refreshExpiration)
-		if err != nil {
-			log.Printf("Failed to store refresh token in database: %v", err)
-			w.WriteHeader(http.StatusInternalServerError)
-			json.NewEncoder(w).Encode(map[string]string{"error": "Failed to store refresh token"})
-			return
-		}
-		log.Printf("Refresh token stored successfully in database")
-
-		// Set refresh token cookie for browser clients
-		cookie := &http.Cookie{
-			Name:     "refresh_token",
-			Value:    refreshToken,
-			Path:     "/api/auth", // Restrict to auth endpoints only
-			HttpOnly: true,
-			Secure:   httpsEnabled,
-			SameSite: http.SameSiteStrictMode,
-			MaxAge:   int(180 * 24 * time.Hour.Seconds()), // 180 days
-		}
-		http.SetCookie(w, cookie)
-		log.Printf("Refresh token cookie set successfully")
+	if !rememberMe {
+		return token, "", nil
 	}
 
-	// Return tokens in response body as well (for non-browser clients)
-	w.Header().Set("Content-Type", "application/json")
-	response := LoginResponse{
-		Token:    token,
-		UserID:   *userData.ID,
-		IsAdmin:  userData.IsAdmin,
-		Settings: *userSettings,
+	log.Printf("Generating refresh token for user ID: %d", userID)
+	refreshToken, err := middleware.GenerateRefreshToken()
+	if err != nil {
+		log.Printf("Failed to generate refresh token: %v", err)
+		return "", "", errors.New("Failed to generate refresh token")
 	}
 
-	// Add refresh token to response if remember me is enabled
-	if req.RememberMe && refreshToken != "" {
-		response.RefreshToken = refreshToken
+	// Store refresh token in database (valid for 180 days)
+	refreshExpiration := time.Now().Add(180 * 24 * time.Hour) // 180 days
+	err = dbConn.CreateRefreshToken(r.Context(), userID, refreshToken, refreshExpiration)
+	if err != nil {
+		log.Printf("Failed to store refresh token in database: %v", err)
+		return "", "", errors.New("Failed to store refresh token")
 	}
 
-	json.NewEncoder(w).Encode(response)
+	// Set refresh token cookie for browser clients
+	http.SetCookie(w, &http.Cookie{
+		Name:     "refresh_token",
+		Value:    refreshToken,
+		Path:     "/api/auth", // Restrict to auth endpoints only
+		HttpOnly: true,
+		Secure:   httpsEnabled,
+		SameSite: http.SameSiteStrictMode,
+		MaxAge:   int(180 * 24 * time.Hour.Seconds()), // 180 days
+	})
+	log.Printf("Refresh token cookie set successfully")
+
+	return token, refreshToken, nil
 }
 
 // Logout handles user logout
@@ -169,7 +193,7 @@ func Logout(w http.ResponseWriter, r *http.Request) {
 
 	// If we have a user ID, delete all refresh tokens for this user
 	if userID > 0 {
-		_ = dbConn.DeleteUserRefreshTokens(userID)
+		_ = dbConn.DeleteUserRefreshTokens(r.Context(), userID)
 	}
 
 	w.Header().Set("Content-Type", "application/json")
@@ -206,7 +230,7 @@ func RefreshToken(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Use the refresh token to get a new JWT token
-	newToken, userID, isAdmin, err := middleware.RefreshJWT(refreshTokenStr)
+	newToken, userID, isAdmin, err := middleware.RefreshJWT(r.Context(), refreshTokenStr)
 	if err != nil {
 		w.WriteHeader(http.StatusUnauthorized)
 		json.NewEncoder(w).Encode(map[string]string{"error": "Invalid or expired refresh token"})
@@ -225,7 +249,7 @@ func RefreshToken(w http.ResponseWriter, r *http.Request) {
 	})
 
 	// Get user settings for the response
-	userSettings, err := dbConn.GetUserSettings(userID)
+	userSettings, err := dbConn.GetUserSettings(r.Context(), userID)
 	if err != nil {
 		userSettings = &settings.UserSettings{} // Use empty settings if error
 	}
@@ -248,7 +272,7 @@ func Signup(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Check if signups are enabled in admin settings
-	adminSettings, err := dbConn.GetAdminSettings()
+	adminSettings, err := dbConn.GetAdminSettings(r.Context())
 	if err != nil {
 		w.WriteHeader(http.StatusInternalServerError)
 		json.NewEncoder(w).Encode(map[string]string{"error": "Failed to retrieve admin settings"})
@@ -281,7 +305,7 @@ func Signup(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Check if user already exists
-	existingUser, err := dbConn.GetUser(&req.Email, nil)
+	existingUser, err := dbConn.GetUser(r.Context(), &req.Email, nil)
 	if err == nil && existingUser != nil {
 		w.WriteHeader(http.StatusConflict)
 		json.NewEncoder(w).Encode(map[string]string{"error": "User already exists"})
@@ -312,7 +336,7 @@ func Signup(w http.ResponseWriter, r *http.Request) {
 		IsAdmin:      false,
 	}
 
-	userID, err := dbConn.CreateUser(newUser)
+	userID, err := dbConn.CreateUser(r.Context(), newUser)
 	if err != nil {
 		w.WriteHeader(http.StatusInternalServerError)
 		json.NewEncoder(w).Encode(map[string]string{"error": "Failed to create user: " + err.Error()})
@@ -348,7 +372,7 @@ func Signup(w http.ResponseWriter, r *http.Request) {
 
 	// Store refresh token in database (valid for 180 days)
 	refreshExpiration := time.Now().Add(180 * 24 * time.Hour) // 180 days
-	err = dbConn.CreateRefreshToken(*userID, refreshToken, refreshExpiration)
+	err = dbConn.CreateRefreshToken(r.Context(), *userID, refreshToken, refreshExpiration)
 	if err != nil {
 		w.WriteHeader(http.StatusInternalServerError)
 		json.NewEncoder(w).Encode(map[string]string{"error": "Failed to store refresh token"})
@@ -367,7 +391,7 @@ func Signup(w http.ResponseWriter, r *http.Request) {
 	})
 
 	// Get default user settings
-	userSettings, err := dbConn.GetUserSettings(*userID)
+	userSettings, err := dbConn.GetUserSettings(r.Context(), *userID)
 	if err != nil {
 		userSettings = &settings.UserSettings{} // Use empty settings if error
 	}
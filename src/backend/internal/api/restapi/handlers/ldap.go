@@ -0,0 +1,98 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+
+	"gitlab.cherkaoui.ch/quillium-ai/quillium/src/backend/internal/db"
+	"gitlab.cherkaoui.ch/quillium-ai/quillium/src/backend/internal/ldapauth"
+	"gitlab.cherkaoui.ch/quillium-ai/quillium/src/backend/internal/security"
+	"gitlab.cherkaoui.ch/quillium-ai/quillium/src/backend/internal/user"
+)
+
+// ldapLogin authenticates a login the local accounts rejected against the
+// LDAP directory of the admin settings. It returns nil without an error when
+// LDAP is disabled or rejects the credentials.
+//
+// Directory users sign in to the local account with their directory email,
+// which is created on their first login. Their username follows the
+// directory, and so does their admin role when an admin group is configured.
+// Password and SSO accounts with the same email are never signed in to, as
+// the directory would otherwise take them over or change their admin role,
+// and neither are accounts created for another entry with that email.
+func ldapLogin(ctx context.Context, login, password string) (*user.User, error) {
+	adminSettings, err := dbConn.GetAdminSettings(ctx)
+	if err != nil {
+		return nil, errors.New("failed to get admin settings: " + err.Error())
+	}
+	if !adminSettings.LDAP.Enabled {
+		return nil, nil
+	}
+
+	identity, err := ldapauth.Authenticate(&adminSettings.LDAP, login, password)
+	if errors.Is(err, ldapauth.ErrInvalidCredentials) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if !user.IsValidEmail(identity.Email) {
+		return nil, errors.New("LDAP entry " + identity.DN + " has no valid email address")
+	}
+
+	username := identity.Username
+	if len(username) < 3 {
+		username = login
+	}
+
+	userData, err := dbConn.GetUser(ctx, &identity.Email, nil)
+	switch {
+	case errors.Is(err, db.ErrUserNotFound):
+		// Directory users never sign in with a local password, the random
+		// one only satisfies the password constraint of local accounts
+		randomPassword, err := security.GenerateRandomString(32)
+		if err != nil {
+			return nil, errors.New("failed to generate password: " + err.Error())
+		}
+		passwordHash, err := security.HashPassword(randomPassword)
+		if err != nil {
+			return nil, errors.New("failed to hash password: " + err.Error())
+		}
+		userID, err := dbConn.CreateUser(ctx, &user.User{
+			Email:        identity.Email,
+			Username:     username,
+			PasswordHash: passwordHash,
+			LdapDN:       &identity.DN,
+		})
+		if err != nil {
+			return nil, err
+		}
+		log.Printf("Created user %d for LDAP entry %s", *userID, identity.DN)
+		userData, err = dbConn.GetUser(ctx, nil, userID)
+		if err != nil {
+			return nil, err
+		}
+	case err != nil:
+		return nil, err
+	case userData.LdapDN == nil || userData.IsSso:
+		return nil, fmt.Errorf("LDAP entry %s matches user %d, which was not created by an LDAP login", identity.DN, *userData.ID)
+	case !ldapauth.SameDN(*userData.LdapDN, identity.DN):
+		return nil, fmt.Errorf("LDAP entry %s matches user %d, which was created for LDAP entry %s", identity.DN, *userData.ID, *userData.LdapDN)
+	case userData.Username != username:
+		if err := dbConn.UpdateUserUsername(ctx, *userData.ID, username); err != nil {
+			return nil, err
+		}
+		userData.Username = username
+	}
+
+	if identity.IsAdmin != nil && *identity.IsAdmin != userData.IsAdmin {
+		if err := dbConn.UpdateUserIsAdmin(ctx, *userData.ID, *identity.IsAdmin); err != nil {
+			return nil, err
+		}
+		log.Printf("Set admin role of user %d to %t from LDAP group %s", *userData.ID, *identity.IsAdmin, adminSettings.LDAP.AdminGroup)
+		userData.IsAdmin = *identity.IsAdmin
+	}
+	return userData, nil
+}
@@ -0,0 +1,258 @@
+package handlers_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"gitlab.cherkaoui.ch/quillium-ai/quillium/src/backend/internal/api/restapi/handlers"
+	"gitlab.cherkaoui.ch/quillium-ai/quillium/src/backend/internal/api/restapi/handlers/testutils"
+	"gitlab.cherkaoui.ch/quillium-ai/quillium/src/backend/internal/api/restapi/middleware"
+	"gitlab.cherkaoui.ch/quillium-ai/quillium/src/backend/internal/db"
+	"gitlab.cherkaoui.ch/quillium-ai/quillium/src/backend/internal/initialization"
+	"gitlab.cherkaoui.ch/quillium-ai/quillium/src/backend/internal/security"
+	"gitlab.cherkaoui.ch/quillium-ai/quillium/src/backend/internal/sso"
+	"gitlab.cherkaoui.ch/quillium-ai/quillium/src/backend/internal/user"
+)
+
+const (
+	ldapUserDN  = "uid=jdoe,ou=people,dc=example,dc=com"
+	ldapAdminDN = "cn=admins,ou=groups,dc=example,dc=com"
+)
+
+// setupLDAPDirectory creates a store whose admin settings authenticate
+// against a mock directory with one user, who is in the admin group
+func setupLDAPDirectory(t *testing.T) (db.Store, *testutils.MockLDAPServer) {
+	testDB := setupTestDB(t)
+	handlers.InitHandlers(testDB)
+	middleware.InitAuth([]byte("test-secret"), testDB)
+	if err := initialization.InitializeAdminSettings(context.Background(), testDB); err != nil {
+		t.Fatalf("Failed to initialize admin settings: %v", err)
+	}
+
+	directory := testutils.NewMockLDAPServer(t,
+		testutils.MockLDAPEntry{
+			DN:       ldapUserDN,
+			Password: "directory-secret",
+			Attributes: map[string][]string{
+				"objectClass": {"inetOrgPerson"},
+				"uid":         {"jdoe"},
+				"mail":        {"jdoe@example.com"},
+			},
+		},
+		testutils.MockLDAPEntry{
+			DN: ldapAdminDN,
+			Attributes: map[string][]string{
+				"objectClass": {"groupOfNames"},
+				"member":      {ldapUserDN},
+			},
+		},
+	)
+
+	adminSettings, err := testDB.GetAdminSettings(context.Background())
+	if err != nil {
+		t.Fatalf("Failed to get admin settings: %v", err)
+	}
+	adminSettings.LDAP.Enabled = true
+	adminSettings.LDAP.URL = directory.URL
+	adminSettings.LDAP.BindDN = "uid={username},ou=people,dc=example,dc=com"
+	adminSettings.LDAP.BaseDN = "dc=example,dc=com"
+	adminSettings.LDAP.GroupFilter = "(&(objectClass=groupOfNames)(member={dn}))"
+	adminSettings.LDAP.AdminGroup = ldapAdminDN
+	if err := adminSettings.LDAP.Validate(); err != nil {
+		t.Fatalf("Invalid LDAP settings: %v", err)
+	}
+	if err := testDB.CreateAdminSettings(context.Background(), adminSettings); err != nil {
+		t.Fatalf("Failed to update admin settings: %v", err)
+	}
+	return testDB, directory
+}
+
+func postLogin(login, password string) *httptest.ResponseRecorder {
+	body, _ := json.Marshal(handlers.LoginRequest{Email: login, Password: password})
+	req := httptest.NewRequest(http.MethodPost, "/api/auth/login", bytes.NewBuffer(body))
+	rr := httptest.NewRecorder()
+	handlers.Login(rr, req)
+	return rr
+}
+
+func TestLDAPLoginProvisionsUser(t *testing.T) {
+	if !testutils.ShouldRunTests(t) {
+		return
+	}
+	testDB, directory := setupLDAPDirectory(t)
+
+	rr := postLogin("jdoe", "directory-secret")
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d: %s", http.StatusOK, rr.Code, rr.Body.String())
+	}
+	var response handlers.LoginResponse
+	if err := json.NewDecoder(rr.Body).Decode(&response); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if response.Token == "" || !response.IsAdmin {
+		t.Errorf("Expected an admin session, got %+v", response)
+	}
+
+	email := "jdoe@example.com"
+	created, err := testDB.GetUser(context.Background(), &email, nil)
+	if err != nil {
+		t.Fatalf("Expected the user to be created: %v", err)
+	}
+	if created.Username != "jdoe" || created.IsSso || !created.IsAdmin || *created.ID != response.UserID {
+		t.Errorf("Unexpected LDAP user: %+v", created)
+	}
+	if created.LdapDN == nil || *created.LdapDN != ldapUserDN {
+		t.Errorf("Expected the directory entry to be recorded, got %v", created.LdapDN)
+	}
+	if created.ValidatePassword("directory-secret") {
+		t.Error("Expected the directory password not to be stored")
+	}
+
+	// The admin role follows the group on every login
+	directory.SetAttribute(ldapAdminDN, "member")
+	rr = postLogin("jdoe", "directory-secret")
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Expected a second login to succeed, got %d: %s", rr.Code, rr.Body.String())
+	}
+	updated, _ := testDB.GetUser(context.Background(), nil, created.ID)
+	if updated.IsAdmin {
+		t.Error("Expected the admin role to be removed")
+	}
+	if users, _ := testDB.GetUsers(context.Background()); len(users) != 1 {
+		t.Errorf("Expected 1 user, got %d", len(users))
+	}
+}
+
+func TestLDAPLoginRejectsInvalidCredentials(t *testing.T) {
+	if !testutils.ShouldRunTests(t) {
+		return
+	}
+	testDB, _ := setupLDAPDirectory(t)
+
+	tests := []struct {
+		name     string
+		login    string
+		password string
+	}{
+		{"wrong password", "jdoe", "wrong"},
+		{"unknown user", "nobody", "directory-secret"},
+		// The mock directory accepts unauthenticated binds
+		{"empty password", "jdoe", ""},
+		{"filter injection", "*", "directory-secret"},
+		{"DN injection", "jdoe,ou=people,dc=example,dc=com", "directory-secret"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if rr := postLogin(tt.login, tt.password); rr.Code != http.StatusUnauthorized {
+				t.Errorf("Expected status %d, got %d", http.StatusUnauthorized, rr.Code)
+			}
+		})
+	}
+	if users, _ := testDB.GetUsers(context.Background()); len(users) != 0 {
+		t.Errorf("Expected no user to be created, got %d", len(users))
+	}
+
+	// No login reaches the directory once LDAP is disabled
+	adminSettings, _ := testDB.GetAdminSettings(context.Background())
+	adminSettings.LDAP.Enabled = false
+	testDB.CreateAdminSettings(context.Background(), adminSettings)
+	if rr := postLogin("jdoe", "directory-secret"); rr.Code != http.StatusUnauthorized {
+		t.Errorf("Expected status %d with LDAP disabled, got %d", http.StatusUnauthorized, rr.Code)
+	}
+}
+
+func TestLDAPLoginRefusesOtherAccounts(t *testing.T) {
+	if !testutils.ShouldRunTests(t) {
+		return
+	}
+	testDB, _ := setupLDAPDirectory(t)
+
+	// A password account with the directory email keeps its name and role
+	passwordHash, err := security.HashPassword("local-Password1")
+	if err != nil {
+		t.Fatalf("Failed to hash password: %v", err)
+	}
+	userID, err := testDB.CreateUser(context.Background(), &user.User{
+		Email:        "jdoe@example.com",
+		Username:     "john",
+		PasswordHash: passwordHash,
+	})
+	if err != nil {
+		t.Fatalf("Failed to create user: %v", err)
+	}
+
+	if rr := postLogin("jdoe", "directory-secret"); rr.Code != http.StatusUnauthorized {
+		t.Errorf("Expected status %d for a password account, got %d", http.StatusUnauthorized, rr.Code)
+	}
+	unchanged, _ := testDB.GetUser(context.Background(), nil, userID)
+	if unchanged.Username != "john" || unchanged.IsAdmin || unchanged.LdapDN != nil {
+		t.Errorf("Expected the password account to be left alone, got %+v", unchanged)
+	}
+	// The local password keeps working
+	if rr := postLogin("jdoe@example.com", "local-Password1"); rr.Code != http.StatusOK {
+		t.Errorf("Expected a local login to succeed, got %d", rr.Code)
+	}
+
+	// So does an SSO account
+	if err := testDB.DeleteUser(context.Background(), *userID); err != nil {
+		t.Fatalf("Failed to delete user: %v", err)
+	}
+	providerID, err := testDB.CreateSsoProvider(context.Background(), &sso.SsoProvider{Provider: "test-provider", AuthType: "OAuth2"})
+	if err != nil {
+		t.Fatalf("Failed to create SSO provider: %v", err)
+	}
+	ssoID, err := testDB.CreateSsoUser(context.Background(), "jdoe@example.com", "sso-user", *providerID)
+	if err != nil {
+		t.Fatalf("Failed to create SSO user: %v", err)
+	}
+
+	if rr := postLogin("jdoe", "directory-secret"); rr.Code != http.StatusUnauthorized {
+		t.Errorf("Expected status %d for an SSO account, got %d", http.StatusUnauthorized, rr.Code)
+	}
+	unchanged, _ = testDB.GetUser(context.Background(), nil, ssoID)
+	if unchanged.IsAdmin || unchanged.LdapDN != nil {
+		t.Errorf("Expected the SSO account to be left alone, got %+v", unchanged)
+	}
+}
+
+func TestLDAPLoginRefusesOtherEntries(t *testing.T) {
+	if !testutils.ShouldRunTests(t) {
+		return
+	}
+	testDB, directory := setupLDAPDirectory(t)
+
+	if rr := postLogin("jdoe", "directory-secret"); rr.Code != http.StatusOK {
+		t.Fatalf("Expected the first login to succeed, got %d", rr.Code)
+	}
+	email := "jdoe@example.com"
+	created, err := testDB.GetUser(context.Background(), &email, nil)
+	if err != nil {
+		t.Fatalf("Failed to get user: %v", err)
+	}
+
+	// Another entry with the same email does not sign in to the account of the first
+	directory.AddEntry(testutils.MockLDAPEntry{
+		DN:       "uid=jsmith,ou=people,dc=example,dc=com",
+		Password: "other-secret",
+		Attributes: map[string][]string{
+			"objectClass": {"inetOrgPerson"},
+			"uid":         {"jsmith"},
+			"mail":        {"jdoe@example.com"},
+		},
+	})
+	if rr := postLogin("jsmith", "other-secret"); rr.Code != http.StatusUnauthorized {
+		t.Errorf("Expected status %d for another entry, got %d", http.StatusUnauthorized, rr.Code)
+	}
+	unchanged, _ := testDB.GetUser(context.Background(), nil, created.ID)
+	if unchanged.Username != "jdoe" || !unchanged.IsAdmin || *unchanged.LdapDN != ldapUserDN {
+		t.Errorf("Expected the account to be left alone, got %+v", unchanged)
+	}
+	if rr := postLogin("jdoe", "directory-secret"); rr.Code != http.StatusOK {
+		t.Errorf("Expected the first entry to still sign in, got %d", rr.Code)
+	}
+}
@@ -0,0 +1,75 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"net/http"
+	"time"
+
+	"gitlab.cherkaoui.ch/quillium-ai/quillium/src/backend/internal/api/restapi/middleware"
+	llmproviders "gitlab.cherkaoui.ch/quillium-ai/quillium/src/backend/internal/llm_providers"
+)
+
+// ListProviderModels returns the models available on the configured LLM providers,
+// so that the LLM profiles can be picked from a list in the admin panel.
+// The optional provider query parameter limits the response to one provider.
+func ListProviderModels(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	// Check if the current user is an admin
+	if !middleware.IsAdmin(r.Context()) {
+		w.WriteHeader(http.StatusForbidden)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Admin access required"})
+		return
+	}
+
+	adminSettings, err := dbConn.GetAdminSettings(r.Context())
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Failed to retrieve admin settings"})
+		return
+	}
+
+	registry, err := llmproviders.NewRegistryFromSettings(adminSettings)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Failed to load LLM providers"})
+		return
+	}
+
+	names := registry.Names()
+	if name := r.URL.Query().Get("provider"); name != "" {
+		if _, err := registry.Get(name); err != nil {
+			w.WriteHeader(http.StatusNotFound)
+			json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+			return
+		}
+		names = []string{name}
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+	defer cancel()
+
+	// A provider that cannot be reached reports its error without failing the whole response
+	providers := make([]ProviderModels, 0, len(names))
+	for _, name := range names {
+		provider, _ := registry.Get(name)
+		entry := ProviderModels{Provider: name, Models: []llmproviders.Model{}}
+		if !provider.Capabilities().ModelListing {
+			entry.Error = "provider does not support listing models"
+		} else if models, err := provider.ListModels(ctx); err != nil {
+			log.Printf("Error listing models of provider %s: %v", name, err)
+			entry.Error = err.Error()
+		} else {
+			entry.Models = models
+		}
+		providers = append(providers, entry)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"providers": providers})
+}
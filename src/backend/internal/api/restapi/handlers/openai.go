@@ -0,0 +1,292 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"gitlab.cherkaoui.ch/quillium-ai/quillium/src/backend/internal/answer"
+	"gitlab.cherkaoui.ch/quillium-ai/quillium/src/backend/internal/api/restapi/middleware"
+	"gitlab.cherkaoui.ch/quillium-ai/quillium/src/backend/internal/chats"
+	"gitlab.cherkaoui.ch/quillium-ai/quillium/src/backend/internal/security"
+	"gitlab.cherkaoui.ch/quillium-ai/quillium/src/backend/internal/settings"
+)
+
+// Models of the OpenAI compatible API, one per quality profile
+var completionModels = []string{
+	settings.QualityProfileSpeed,
+	settings.QualityProfileBalanced,
+	settings.QualityProfileQuality,
+}
+
+// ListModels returns the quality profiles as models of the OpenAI compatible API
+func ListModels(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	if r.Method != http.MethodGet {
+		writeOpenAIError(w, http.StatusMethodNotAllowed, "invalid_request_error", "", "Method not allowed")
+		return
+	}
+
+	models := ModelList{Object: "list", Data: make([]ModelInfo, 0, len(completionModels))}
+	for _, model := range completionModels {
+		models.Data = append(models.Data, ModelInfo{ID: model, Object: "model", OwnedBy: "quillium"})
+	}
+	json.NewEncoder(w).Encode(models)
+}
+
+// ChatCompletions answers an OpenAI compatible chat completion request with a search grounded answer.
+// The sources are returned in the sources extension field, with the final chunk when streaming.
+func ChatCompletions(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	if r.Method != http.MethodPost {
+		writeOpenAIError(w, http.StatusMethodNotAllowed, "invalid_request_error", "", "Method not allowed")
+		return
+	}
+
+	userID, ok := middleware.GetUserID(r.Context())
+	if !ok {
+		writeOpenAIError(w, http.StatusUnauthorized, "invalid_request_error", "", "Unauthorized")
+		return
+	}
+
+	var req ChatCompletionRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeOpenAIError(w, http.StatusBadRequest, "invalid_request_error", "", "Invalid request body")
+		return
+	}
+
+	qualityProfile := strings.ToLower(req.Model)
+	if !isCompletionModel(qualityProfile) {
+		writeOpenAIError(w, http.StatusNotFound, "invalid_request_error", "model",
+			fmt.Sprintf("The model %q does not exist, use one of %s", req.Model, strings.Join(completionModels, ", ")))
+		return
+	}
+
+	history, err := completionHistory(req.Messages)
+	if err != nil {
+		writeOpenAIError(w, http.StatusBadRequest, "invalid_request_error", "messages", err.Error())
+		return
+	}
+	userMessage := history[len(history)-1]
+	history = history[:len(history)-1]
+
+	maxTokens := req.MaxTokens
+	if req.MaxCompletionTokens != 0 {
+		maxTokens = req.MaxCompletionTokens
+	}
+
+	adminSettings, err := dbConn.GetAdminSettings(r.Context())
+	if err != nil {
+		log.Printf("Error getting admin settings: %v", err)
+		writeOpenAIError(w, http.StatusInternalServerError, "server_error", "", "Failed to get admin settings")
+		return
+	}
+
+	pipeline, err := answer.NewPipeline(adminSettings, answer.Options{
+		QualityProfile: qualityProfile,
+		Temperature:    req.Temperature,
+		MaxTokens:      maxTokens,
+	})
+	if err != nil {
+		var optionsErr *answer.OptionsError
+		if errors.As(err, &optionsErr) {
+			writeOpenAIError(w, http.StatusBadRequest, "invalid_request_error", "", optionsErr.Message)
+			return
+		}
+		log.Printf("Error selecting LLM provider: %v", err)
+		writeOpenAIError(w, http.StatusInternalServerError, "server_error", "", "LLM provider is not configured")
+		return
+	}
+
+	id, err := security.GenerateRandomString(18)
+	if err != nil {
+		writeOpenAIError(w, http.StatusInternalServerError, "server_error", "", "Failed to create completion ID")
+		return
+	}
+	completion := ChatCompletionResponse{
+		ID:      "chatcmpl-" + id,
+		Created: time.Now().Unix(),
+		Model:   qualityProfile,
+	}
+
+	msgNum := userMessage.MsgNum
+	ctx := r.Context()
+	sources, indexResults := pipeline.Retrieve(ctx, userMessage.Content, msgNum)
+
+	var content string
+	if req.Stream {
+		content, err = streamCompletion(w, completion, func(onChunk func(string)) (string, error) {
+			return pipeline.Generate(ctx, userMessage.Content, indexResults, history, onChunk)
+		}, sources)
+		if err != nil {
+			log.Printf("Error streaming chat completion: %v", err)
+			return
+		}
+	} else {
+		content, err = pipeline.Generate(ctx, userMessage.Content, indexResults, history, nil)
+		if err != nil {
+			log.Printf("Error generating chat completion: %v", err)
+			writeOpenAIError(w, http.StatusBadGateway, "server_error", "", "Error generating response")
+			return
+		}
+	}
+
+	// Store the exchange in the chat history of the API key owner
+	if req.SaveChat {
+		chatContent := &chats.ChatContent{
+			Title: chats.GenerateTitle(userMessage.Content),
+			Messages: append(history, userMessage, chats.Message{
+				Role:       "assistant",
+				Content:    content,
+				MsgNum:     msgNum,
+				Generation: pipeline.Generation(),
+			}),
+			Sources: sources,
+		}
+		chatID, err := dbConn.CreateChat(r.Context(), userID, chatContent)
+		if err != nil {
+			log.Printf("Error saving chat completion: %v", err)
+		} else {
+			completion.ChatID = *chatID
+		}
+	}
+
+	if req.Stream {
+		// The chat ID is only known once the answer was streamed
+		if completion.ChatID != 0 {
+			completion.Object = "chat.completion.chunk"
+			completion.Choices = []ChatCompletionChoice{}
+			writeCompletionEvent(w, completion)
+		}
+		io.WriteString(w, "data: [DONE]\n\n")
+		flush(w)
+		return
+	}
+
+	stop := "stop"
+	completion.Object = "chat.completion"
+	completion.Sources = sources
+	completion.Choices = []ChatCompletionChoice{{
+		Message:      &ChatCompletionContent{Role: "assistant", Content: content},
+		FinishReason: &stop,
+	}}
+	json.NewEncoder(w).Encode(completion)
+}
+
+// streamCompletion sends the answer produced by generate as chat completion chunks.
+// The final chunk carries the finish reason and the sources. When the generation fails
+// after the first chunk was sent, the error is sent as an event.
+func streamCompletion(w http.ResponseWriter, completion ChatCompletionResponse, generate func(onChunk func(string)) (string, error), sources []chats.Source) (string, error) {
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+
+	completion.Object = "chat.completion.chunk"
+	chunk := func(delta ChatCompletionContent, finishReason *string, sources []chats.Source) {
+		completion.Choices = []ChatCompletionChoice{{Delta: &delta, FinishReason: finishReason}}
+		completion.Sources = sources
+		writeCompletionEvent(w, completion)
+	}
+
+	chunk(ChatCompletionContent{Role: "assistant"}, nil, nil)
+	content, err := generate(func(content string) {
+		chunk(ChatCompletionContent{Content: content}, nil, nil)
+	})
+	if err != nil {
+		data, _ := json.Marshal(OpenAIErrorResponse{Error: OpenAIError{Message: "Error generating response", Type: "server_error"}})
+		fmt.Fprintf(w, "data: %s\n\n", data)
+		flush(w)
+		return content, err
+	}
+
+	stop := "stop"
+	chunk(ChatCompletionContent{}, &stop, sources)
+	return content, nil
+}
+
+// writeCompletionEvent writes a chat completion chunk as a server-sent event
+func writeCompletionEvent(w http.ResponseWriter, completion ChatCompletionResponse) {
+	data, err := json.Marshal(completion)
+	if err != nil {
+		log.Printf("Error marshaling chat completion chunk: %v", err)
+		return
+	}
+	fmt.Fprintf(w, "data: %s\n\n", data)
+	flush(w)
+}
+
+// flush sends buffered data to the client when the writer supports it
+func flush(w http.ResponseWriter) {
+	if flusher, ok := w.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// isCompletionModel reports whether model is one of the models of the OpenAI compatible API
+func isCompletionModel(model string) bool {
+	for _, completionModel := range completionModels {
+		if model == completionModel {
+			return true
+		}
+	}
+	return false
+}
+
+// completionHistory converts the messages of a chat completion request into chat messages.
+// System messages are dropped because Quillium uses its own system prompt, and the last message must be from the user.
+func completionHistory(messages []ChatCompletionMessage) ([]chats.Message, error) {
+	history := make([]chats.Message, 0, len(messages))
+	for _, message := range messages {
+		switch message.Role {
+		case "system", "developer":
+			continue
+		case "user", "assistant":
+		default:
+			return nil, fmt.Errorf("unsupported message role: %s", message.Role)
+		}
+
+		content, err := messageText(message.Content)
+		if err != nil {
+			return nil, err
+		}
+		history = append(history, chats.Message{Role: message.Role, Content: content, MsgNum: len(history) / 2})
+	}
+
+	if len(history) == 0 || history[len(history)-1].Role != "user" {
+		return nil, errors.New("the last message must be from the user")
+	}
+	return history, nil
+}
+
+// messageText returns the text of a message content, given either as a string or as content parts
+func messageText(content json.RawMessage) (string, error) {
+	var text string
+	if err := json.Unmarshal(content, &text); err == nil {
+		return text, nil
+	}
+
+	var parts []ChatCompletionContentPart
+	if err := json.Unmarshal(content, &parts); err != nil {
+		return "", errors.New("message content must be a string or a list of content parts")
+	}
+	var texts []string
+	for _, part := range parts {
+		if part.Type != "text" {
+			return "", fmt.Errorf("unsupported content part type: %s", part.Type)
+		}
+		texts = append(texts, part.Text)
+	}
+	return strings.Join(texts, "\n"), nil
+}
+
+// writeOpenAIError writes an error in the format of the OpenAI API
+func writeOpenAIError(w http.ResponseWriter, status int, errorType string, param string, message string) {
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(OpenAIErrorResponse{Error: OpenAIError{Message: message, Type: errorType, Param: param}})
+}
@@ -0,0 +1,82 @@
+package handlers_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"gitlab.cherkaoui.ch/quillium-ai/quillium/src/backend/internal/api/restapi/handlers"
+	"gitlab.cherkaoui.ch/quillium-ai/quillium/src/backend/internal/api/restapi/middleware"
+)
+
+func TestListModels(t *testing.T) {
+	req := httptest.NewRequest(http.MethodGet, "/v1/models", nil)
+	rec := httptest.NewRecorder()
+
+	handlers.ListModels(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d", rec.Code)
+	}
+	var models handlers.ModelList
+	if err := json.NewDecoder(rec.Body).Decode(&models); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if models.Object != "list" || len(models.Data) != 3 {
+		t.Fatalf("Unexpected model list: %+v", models)
+	}
+	for i, expected := range []string{"speed", "balanced", "quality"} {
+		if models.Data[i].ID != expected || models.Data[i].Object != "model" {
+			t.Errorf("Expected model %s, got %+v", expected, models.Data[i])
+		}
+	}
+}
+
+func TestChatCompletionsRejectsInvalidRequests(t *testing.T) {
+	testCases := []struct {
+		name           string
+		method         string
+		body           string
+		authenticated  bool
+		expectedStatus int
+		expectedParam  string
+	}{
+		{"GET is not allowed", http.MethodGet, "", true, http.StatusMethodNotAllowed, ""},
+		{"Missing user", http.MethodPost, `{"model":"balanced"}`, false, http.StatusUnauthorized, ""},
+		{"Invalid body", http.MethodPost, `{"model":`, true, http.StatusBadRequest, ""},
+		{"Unknown model", http.MethodPost, `{"model":"gpt-4o","messages":[{"role":"user","content":"Hi"}]}`, true, http.StatusNotFound, "model"},
+		{"No messages", http.MethodPost, `{"model":"speed","messages":[]}`, true, http.StatusBadRequest, "messages"},
+		{"Last message from the assistant", http.MethodPost, `{"model":"speed","messages":[{"role":"user","content":"Hi"},{"role":"assistant","content":"Hello"}]}`, true, http.StatusBadRequest, "messages"},
+		{"Only a system message", http.MethodPost, `{"model":"quality","messages":[{"role":"system","content":"Be brief"}]}`, true, http.StatusBadRequest, "messages"},
+		{"Tool message", http.MethodPost, `{"model":"quality","messages":[{"role":"tool","content":"42"}]}`, true, http.StatusBadRequest, "messages"},
+		{"Image content", http.MethodPost, `{"model":"balanced","messages":[{"role":"user","content":[{"type":"image_url"}]}]}`, true, http.StatusBadRequest, "messages"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest(tc.method, "/v1/chat/completions", bytes.NewBufferString(tc.body))
+			if tc.authenticated {
+				req = req.WithContext(middleware.AddUserToContext(req.Context(), 1, false, true))
+			}
+			rec := httptest.NewRecorder()
+
+			handlers.ChatCompletions(rec, req)
+
+			if rec.Code != tc.expectedStatus {
+				t.Errorf("Expected status %d, got %d", tc.expectedStatus, rec.Code)
+			}
+			var resp handlers.OpenAIErrorResponse
+			if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+				t.Fatalf("Expected an OpenAI error, got decoding error: %v", err)
+			}
+			if resp.Error.Message == "" || resp.Error.Type != "invalid_request_error" {
+				t.Errorf("Unexpected error: %+v", resp.Error)
+			}
+			if resp.Error.Param != tc.expectedParam {
+				t.Errorf("Expected param %q, got %q", tc.expectedParam, resp.Error.Param)
+			}
+		})
+	}
+}
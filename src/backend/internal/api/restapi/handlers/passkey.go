@@ -0,0 +1,521 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-webauthn/webauthn/webauthn"
+	"gitlab.cherkaoui.ch/quillium-ai/quillium/src/backend/internal/db"
+	"gitlab.cherkaoui.ch/quillium-ai/quillium/src/backend/internal/passkey"
+	"gitlab.cherkaoui.ch/quillium-ai/quillium/src/backend/internal/security"
+	"gitlab.cherkaoui.ch/quillium-ai/quillium/src/backend/internal/user"
+)
+
+// passkeyCeremonyCookie carries the state of a passkey registration or login
+// between its two requests
+const passkeyCeremonyCookie = "passkey_ceremony"
+
+// maxPasskeyNameLength is the length of the name column
+const maxPasskeyNameLength = 255
+
+// webauthnRPID overrides the WebAuthn relying party ID, which defaults to the
+// host of the frontend. A parent domain lets passkeys work on its subdomains.
+var webauthnRPID = os.Getenv("WEBAUTHN_RP_ID")
+
+// passkeyCeremony is stored encrypted in the ceremony cookie, so the second
+// request can be handled by any backend instance
+type passkeyCeremony struct {
+	Session      webauthn.SessionData `json:"session"`
+	Registration bool                 `json:"registration,omitempty"`
+	UserID       int                  `json:"user_id,omitempty"` // Registration only
+	Name         string               `json:"name,omitempty"`    // Registration only
+	RememberMe   bool                 `json:"remember_me,omitempty"`
+	ExpiresAt    time.Time            `json:"expires_at"`
+}
+
+// relyingParty returns the WebAuthn relying party of the frontend. Without
+// FRONTEND_URL, the frontend is expected to be served from the backend's host.
+func relyingParty(r *http.Request) (*webauthn.WebAuthn, error) {
+	origin := frontendURL
+	if origin == "" {
+		scheme := "http"
+		if r.TLS != nil || httpsEnabled {
+			scheme = "https"
+		}
+		origin = scheme + "://" + r.Host
+	}
+	parsed, err := url.Parse(origin)
+	if err != nil {
+		return nil, errors.New("invalid frontend URL: " + err.Error())
+	}
+	return passkey.New(parsed.Scheme+"://"+parsed.Host, webauthnRPID)
+}
+
+// setPasskeyCeremony stores the state of a ceremony in its cookie
+func setPasskeyCeremony(w http.ResponseWriter, ceremony *passkeyCeremony) error {
+	ceremony.ExpiresAt = time.Now().Add(passkey.CeremonyTimeout)
+	ceremonyJSON, err := json.Marshal(ceremony)
+	if err != nil {
+		return errors.New("failed to encode passkey ceremony: " + err.Error())
+	}
+	encrypted, err := security.EncryptPassword(string(ceremonyJSON))
+	if err != nil {
+		return errors.New("failed to encrypt passkey ceremony: " + err.Error())
+	}
+
+	http.SetCookie(w, &http.Cookie{
+		Name:     passkeyCeremonyCookie,
+		Value:    *encrypted,
+		Path:     "/api",
+		HttpOnly: true,
+		Secure:   httpsEnabled,
+		SameSite: http.SameSiteStrictMode,
+		MaxAge:   int(passkey.CeremonyTimeout.Seconds()),
+	})
+	return nil
+}
+
+// readPasskeyCeremony decrypts the ceremony cookie and clears it, a ceremony is only completed once
+func readPasskeyCeremony(w http.ResponseWriter, r *http.Request) (*passkeyCeremony, error) {
+	cookie, err := r.Cookie(passkeyCeremonyCookie)
+	if err != nil || cookie.Value == "" {
+		return nil, errors.New("no passkey ceremony cookie")
+	}
+
+	http.SetCookie(w, &http.Cookie{
+		Name:     passkeyCeremonyCookie,
+		Value:    "",
+		Path:     "/api",
+		HttpOnly: true,
+		Secure:   httpsEnabled,
+		SameSite: http.SameSiteStrictMode,
+		MaxAge:   -1, // Delete the cookie
+	})
+
+	decrypted, err := security.DecryptPassword(cookie.Value)
+	if err != nil {
+		return nil, errors.New("failed to decrypt passkey ceremony: " + err.Error())
+	}
+	var ceremony passkeyCeremony
+	if err := json.Unmarshal([]byte(*decrypted), &ceremony); err != nil {
+		return nil, errors.New("failed to parse passkey ceremony: " + err.Error())
+	}
+	if time.Now().After(ceremony.ExpiresAt) {
+		return nil, errors.New("passkey ceremony expired")
+	}
+	return &ceremony, nil
+}
+
+// currentPasskeyUser returns the signed in user for the passkey management
+// endpoints, which only apply to accounts that sign in with a password. The
+// user is nil when the request has been answered.
+func currentPasskeyUser(w http.ResponseWriter, r *http.Request) *user.User {
+	return signedInPasswordUser(w, r, "Passkeys are only available for password logins")
+}
+
+// passkeyAccount returns the user with their passkeys
+func passkeyAccount(ctx context.Context, userData *user.User) (*passkey.Account, error) {
+	passkeys, err := dbConn.GetPasskeys(ctx, *userData.ID)
+	if err != nil {
+		return nil, err
+	}
+	return passkey.NewAccount(userData, passkeys)
+}
+
+// discoverPasskeyAccount finds the account a passkey presented at login belongs to
+func discoverPasskeyAccount(ctx context.Context, credentialID, userHandle []byte) (*passkey.Account, error) {
+	storedPasskey, err := dbConn.GetPasskeyByCredentialID(ctx, passkey.EncodeCredentialID(credentialID))
+	if err != nil {
+		return nil, err
+	}
+	userID, err := passkey.ParseUserHandle(userHandle)
+	if err != nil {
+		return nil, err
+	}
+	if userID != storedPasskey.UserID {
+		return nil, errors.New("user handle does not match the passkey owner")
+	}
+
+	userData, err := dbConn.GetUser(ctx, nil, &userID)
+	if err != nil {
+		return nil, err
+	}
+	return passkeyAccount(ctx, userData)
+}
+
+// passkeyResponse removes the credential from a passkey
+func passkeyResponse(p *user.Passkey) PasskeyResponse {
+	return PasskeyResponse{
+		ID:         p.ID,
+		Name:       p.Name,
+		CreatedAt:  p.CreatedAt,
+		LastUsedAt: p.LastUsedAt,
+	}
+}
+
+// parsePasskeyName trims a passkey name and checks its length. An empty name is replaced by defaultName.
+func parsePasskeyName(name, defaultName string) (string, error) {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		name = defaultName
+	}
+	if name == "" {
+		return "", errors.New("Passkey name is required")
+	}
+	if len(name) > maxPasskeyNameLength {
+		return "", errors.New("Passkey name must be at most " + strconv.Itoa(maxPasskeyNameLength) + " characters")
+	}
+	return name, nil
+}
+
+// PasskeyLoginBegin starts a passkey login. Any passkey stored by the
+// browser or a security key can answer, the user does not enter an email.
+func PasskeyLoginBegin(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	// Unlike the other endpoints, the body may be left out: its only field is
+	// optional and a login starts without knowing who signs in
+	var req PasskeyLoginRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && !errors.Is(err, io.EOF) {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Invalid request"})
+		return
+	}
+
+	rp, err := relyingParty(r)
+	if err != nil {
+		log.Printf("Failed to start passkey login: %v", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Failed to start passkey login"})
+		return
+	}
+	assertion, session, err := rp.BeginDiscoverableLogin()
+	if err == nil {
+		err = setPasskeyCeremony(w, &passkeyCeremony{Session: *session, RememberMe: req.RememberMe})
+	}
+	if err != nil {
+		log.Printf("Failed to start passkey login: %v", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Failed to start passkey login"})
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(assertion)
+}
+
+// PasskeyLoginFinish checks the assertion of a passkey and signs its owner in
+// with the same session and cookies as a password login
+func PasskeyLoginFinish(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	ceremony, err := readPasskeyCeremony(w, r)
+	if err == nil && ceremony.Registration {
+		err = errors.New("passkey ceremony is a registration")
+	}
+	if err != nil {
+		log.Printf("Invalid passkey login: %v", err)
+		w.WriteHeader(http.StatusUnauthorized)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Passkey login expired, please try again"})
+		return
+	}
+
+	rp, err := relyingParty(r)
+	if err != nil {
+		log.Printf("Failed to finish passkey login: %v", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Failed to finish passkey login"})
+		return
+	}
+
+	var account *passkey.Account
+	_, credential, err := rp.FinishPasskeyLogin(func(rawID, userHandle []byte) (webauthn.User, error) {
+		discovered, err := discoverPasskeyAccount(r.Context(), rawID, userHandle)
+		if err != nil {
+			return nil, err
+		}
+		account = discovered
+		return account, nil
+	}, ceremony.Session, r)
+	if err == nil && credential.Authenticator.CloneWarning {
+		err = errors.New("signature counter went backwards, the authenticator may be cloned")
+	}
+	if err != nil {
+		log.Printf("Passkey login failed: %v", err)
+		w.WriteHeader(http.StatusUnauthorized)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Passkey login failed"})
+		return
+	}
+
+	// Store the new signature counter so the assertion cannot be replayed by a clone
+	storedPasskey := account.Passkey(credential.ID)
+	credentialJSON, err := passkey.EncodeCredential(credential)
+	if err == nil {
+		err = dbConn.UpdatePasskeyUsage(r.Context(), storedPasskey.ID, credentialJSON, time.Now())
+	}
+	if err != nil {
+		log.Printf("Failed to update passkey %d: %v", storedPasskey.ID, err)
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Failed to finish passkey login"})
+		return
+	}
+
+	writeLoginResponse(w, r, account.User, ceremony.RememberMe, nil)
+}
+
+// ListPasskeys returns the passkeys of the current user
+func ListPasskeys(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	userData := currentPasskeyUser(w, r)
+	if userData == nil {
+		return
+	}
+
+	passkeys, err := dbConn.GetPasskeys(r.Context(), *userData.ID)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Failed to retrieve passkeys"})
+		return
+	}
+
+	response := make([]PasskeyResponse, 0, len(passkeys))
+	for _, p := range passkeys {
+		response = append(response, passkeyResponse(p))
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+// PasskeyRegisterBegin starts the registration of a passkey for the current user
+func PasskeyRegisterBegin(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	userData := currentPasskeyUser(w, r)
+	if userData == nil {
+		return
+	}
+
+	// The body may be left out, its only field is optional
+	var req PasskeyRegisterRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && !errors.Is(err, io.EOF) {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Invalid request"})
+		return
+	}
+	name, err := parsePasskeyName(req.Name, "Passkey")
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+		return
+	}
+
+	account, err := passkeyAccount(r.Context(), userData)
+	if err != nil {
+		log.Printf("Failed to start passkey registration: %v", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Failed to start passkey registration"})
+		return
+	}
+	rp, err := relyingParty(r)
+	if err != nil {
+		log.Printf("Failed to start passkey registration: %v", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Failed to start passkey registration"})
+		return
+	}
+
+	// Authenticators that already hold a passkey of the user are excluded
+	exclusions := webauthn.Credentials(account.WebAuthnCredentials()).CredentialDescriptors()
+	creation, session, err := rp.BeginRegistration(account, webauthn.WithExclusions(exclusions))
+	if err == nil {
+		err = setPasskeyCeremony(w, &passkeyCeremony{
+			Session:      *session,
+			Registration: true,
+			UserID:       *userData.ID,
+			Name:         name,
+		})
+	}
+	if err != nil {
+		log.Printf("Failed to start passkey registration: %v", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Failed to start passkey registration"})
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(creation)
+}
+
+// PasskeyRegisterFinish checks the attestation of a new passkey and stores it
+func PasskeyRegisterFinish(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	userData := currentPasskeyUser(w, r)
+	if userData == nil {
+		return
+	}
+
+	ceremony, err := readPasskeyCeremony(w, r)
+	if err == nil && (!ceremony.Registration || ceremony.UserID != *userData.ID) {
+		err = errors.New("passkey ceremony is not a registration of the user")
+	}
+	if err != nil {
+		log.Printf("Invalid passkey registration: %v", err)
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Passkey registration expired, please try again"})
+		return
+	}
+
+	account, err := passkeyAccount(r.Context(), userData)
+	if err != nil {
+		log.Printf("Failed to finish passkey registration: %v", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Failed to finish passkey registration"})
+		return
+	}
+	rp, err := relyingParty(r)
+	if err != nil {
+		log.Printf("Failed to finish passkey registration: %v", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Failed to finish passkey registration"})
+		return
+	}
+
+	credential, err := rp.FinishRegistration(account, ceremony.Session, r)
+	if err != nil {
+		log.Printf("Passkey registration failed: %v", err)
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Passkey registration failed"})
+		return
+	}
+
+	credentialJSON, err := passkey.EncodeCredential(credential)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Failed to store passkey"})
+		return
+	}
+	passkeyID, err := dbConn.CreatePasskey(r.Context(), &user.Passkey{
+		UserID:       *userData.ID,
+		CredentialID: passkey.EncodeCredentialID(credential.ID),
+		Name:         ceremony.Name,
+		Credential:   credentialJSON,
+	})
+	if err != nil {
+		log.Printf("Failed to store passkey: %v", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Failed to store passkey"})
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(PasskeyResponse{ID: *passkeyID, Name: ceremony.Name, CreatedAt: time.Now()})
+}
+
+// RenamePasskey renames a passkey of the current user
+func RenamePasskey(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	userData := currentPasskeyUser(w, r)
+	if userData == nil {
+		return
+	}
+
+	passkeyID, err := strconv.Atoi(r.URL.Query().Get("id"))
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Invalid passkey ID format"})
+		return
+	}
+	var req PasskeyRegisterRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Invalid request"})
+		return
+	}
+	name, err := parsePasskeyName(req.Name, "")
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+		return
+	}
+
+	err = dbConn.RenamePasskey(r.Context(), *userData.ID, passkeyID, name)
+	if errors.Is(err, db.ErrPasskeyNotFound) {
+		w.WriteHeader(http.StatusNotFound)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Passkey not found"})
+		return
+	}
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Failed to rename passkey"})
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"message": "Passkey renamed successfully"})
+}
+
+// DeletePasskey revokes a passkey of the current user
+func DeletePasskey(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodDelete {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	userData := currentPasskeyUser(w, r)
+	if userData == nil {
+		return
+	}
+
+	passkeyID, err := strconv.Atoi(r.URL.Query().Get("id"))
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Invalid passkey ID format"})
+		return
+	}
+
+	err = dbConn.DeletePasskey(r.Context(), *userData.ID, passkeyID)
+	if errors.Is(err, db.ErrPasskeyNotFound) {
+		w.WriteHeader(http.StatusNotFound)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Passkey not found"})
+		return
+	}
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Failed to delete passkey"})
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"message": "Passkey deleted successfully"})
+}
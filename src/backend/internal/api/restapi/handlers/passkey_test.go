@@ -0,0 +1,208 @@
+package handlers_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+
+	"gitlab.cherkaoui.ch/quillium-ai/quillium/src/backend/internal/api/restapi/handlers"
+	"gitlab.cherkaoui.ch/quillium-ai/quillium/src/backend/internal/api/restapi/handlers/testutils"
+	"gitlab.cherkaoui.ch/quillium-ai/quillium/src/backend/internal/api/restapi/middleware"
+	"gitlab.cherkaoui.ch/quillium-ai/quillium/src/backend/internal/sso"
+	"gitlab.cherkaoui.ch/quillium-ai/quillium/src/backend/internal/user"
+)
+
+// passkeyOrigin is the origin of requests made by httptest
+const passkeyOrigin = "http://example.com"
+
+// callPasskey calls a handler with a JSON body and the ceremony cookie, as the given user unless userID is 0
+func callPasskey(handler http.HandlerFunc, method, target string, userID int, ceremony *http.Cookie, body []byte) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, target, bytes.NewBuffer(body))
+	if userID != 0 {
+		req = req.WithContext(context.WithValue(req.Context(), middleware.UserIDKey(), userID))
+	}
+	if ceremony != nil {
+		req.AddCookie(ceremony)
+	}
+	rr := httptest.NewRecorder()
+	handler(rr, req)
+	return rr
+}
+
+// registerPasskey registers a passkey of the authenticator for the user
+func registerPasskey(t *testing.T, authenticator *testutils.MockAuthenticator, userID int, name string) handlers.PasskeyResponse {
+	t.Helper()
+	body, _ := json.Marshal(handlers.PasskeyRegisterRequest{Name: name})
+	rr := callPasskey(handlers.PasskeyRegisterBegin, http.MethodPost, "/api/user/passkeys/register/begin", userID, nil, body)
+	ceremony := responseCookie(rr, "passkey_ceremony")
+	if rr.Code != http.StatusOK || ceremony == nil {
+		t.Fatalf("Expected a registration ceremony, got %d: %s", rr.Code, rr.Body.String())
+	}
+
+	rr = callPasskey(handlers.PasskeyRegisterFinish, http.MethodPost, "/api/user/passkeys/register/finish", userID, ceremony, authenticator.Register(t, rr.Body.Bytes()))
+	if rr.Code != http.StatusCreated {
+		t.Fatalf("Expected status %d, got %d: %s", http.StatusCreated, rr.Code, rr.Body.String())
+	}
+	var response handlers.PasskeyResponse
+	json.NewDecoder(rr.Body).Decode(&response)
+	return response
+}
+
+// loginWithPasskey runs a passkey login with the authenticator
+func loginWithPasskey(t *testing.T, authenticator *testutils.MockAuthenticator, rememberMe bool) *httptest.ResponseRecorder {
+	t.Helper()
+	body, _ := json.Marshal(handlers.PasskeyLoginRequest{RememberMe: rememberMe})
+	rr := callPasskey(handlers.PasskeyLoginBegin, http.MethodPost, "/api/auth/passkey/login/begin", 0, nil, body)
+	ceremony := responseCookie(rr, "passkey_ceremony")
+	if rr.Code != http.StatusOK || ceremony == nil {
+		t.Fatalf("Expected a login ceremony, got %d: %s", rr.Code, rr.Body.String())
+	}
+	return callPasskey(handlers.PasskeyLoginFinish, http.MethodPost, "/api/auth/passkey/login/finish", 0, ceremony, authenticator.Login(t, rr.Body.Bytes()))
+}
+
+func TestPasskeyLogin(t *testing.T) {
+	if !testutils.ShouldRunTests(t) {
+		return
+	}
+	_, userID := setupTwoFactorUser(t, false)
+	authenticator := testutils.NewMockAuthenticator(passkeyOrigin)
+
+	registered := registerPasskey(t, authenticator, userID, "  Laptop ")
+	if registered.ID == 0 || registered.Name != "Laptop" {
+		t.Errorf("Unexpected passkey: %+v", registered)
+	}
+
+	rr := loginWithPasskey(t, authenticator, true)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d: %s", http.StatusOK, rr.Code, rr.Body.String())
+	}
+	if responseCookie(rr, "auth_token") == nil || responseCookie(rr, "refresh_token") == nil {
+		t.Error("Expected the session cookies of a password login")
+	}
+	var response handlers.LoginResponse
+	json.NewDecoder(rr.Body).Decode(&response)
+	if response.UserID != userID || response.Token == "" {
+		t.Errorf("Unexpected login response: %+v", response)
+	}
+
+	rr = callPasskey(handlers.ListPasskeys, http.MethodGet, "/api/user/passkeys", userID, nil, nil)
+	var passkeys []handlers.PasskeyResponse
+	json.NewDecoder(rr.Body).Decode(&passkeys)
+	if len(passkeys) != 1 || passkeys[0].ID != registered.ID || passkeys[0].LastUsedAt == nil {
+		t.Fatalf("Expected the passkey to be listed as used, got %+v", passkeys)
+	}
+
+	// A copy of the authenticator falls behind once the original signs in again
+	clone := authenticator.Clone()
+	if rr := loginWithPasskey(t, authenticator, false); rr.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d: %s", http.StatusOK, rr.Code, rr.Body.String())
+	}
+	if rr := loginWithPasskey(t, clone, false); rr.Code != http.StatusUnauthorized {
+		t.Errorf("Expected status %d for a cloned authenticator, got %d", http.StatusUnauthorized, rr.Code)
+	}
+}
+
+func TestPasskeyCeremonyErrors(t *testing.T) {
+	if !testutils.ShouldRunTests(t) {
+		return
+	}
+	_, userID := setupTwoFactorUser(t, false)
+	authenticator := testutils.NewMockAuthenticator(passkeyOrigin)
+	registerPasskey(t, authenticator, userID, "")
+
+	// The body of a login start is optional
+	rr := callPasskey(handlers.PasskeyLoginBegin, http.MethodPost, "/api/auth/passkey/login/begin", 0, nil, nil)
+	ceremony := responseCookie(rr, "passkey_ceremony")
+	if ceremony == nil {
+		t.Fatalf("Expected a login ceremony without a body, got %d: %s", rr.Code, rr.Body.String())
+	}
+	assertion := authenticator.Login(t, rr.Body.Bytes())
+	if rr := callPasskey(handlers.PasskeyLoginBegin, http.MethodPost, "/api/auth/passkey/login/begin", 0, nil, []byte("{")); rr.Code != http.StatusBadRequest {
+		t.Errorf("Expected status %d for an invalid body, got %d", http.StatusBadRequest, rr.Code)
+	}
+	if rr := callPasskey(handlers.PasskeyLoginFinish, http.MethodPost, "/api/auth/passkey/login/finish", 0, nil, assertion); rr.Code != http.StatusUnauthorized {
+		t.Errorf("Expected status %d without a ceremony, got %d", http.StatusUnauthorized, rr.Code)
+	}
+	if rr := callPasskey(handlers.PasskeyLoginFinish, http.MethodPost, "/api/auth/passkey/login/finish", 0, ceremony, assertion); rr.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d: %s", http.StatusOK, rr.Code, rr.Body.String())
+	}
+	// The signature counter stops a replayed assertion
+	if rr := callPasskey(handlers.PasskeyLoginFinish, http.MethodPost, "/api/auth/passkey/login/finish", 0, ceremony, assertion); rr.Code != http.StatusUnauthorized {
+		t.Errorf("Expected status %d for a replayed assertion, got %d", http.StatusUnauthorized, rr.Code)
+	}
+
+	// A login ceremony cannot finish a registration
+	rr = callPasskey(handlers.PasskeyLoginBegin, http.MethodPost, "/api/auth/passkey/login/begin", 0, nil, nil)
+	creation, _ := json.Marshal(map[string]any{"publicKey": map[string]any{"rp": map[string]string{"id": "example.com"}, "user": map[string]string{"id": "MQ"}}})
+	if rr := callPasskey(handlers.PasskeyRegisterFinish, http.MethodPost, "/api/user/passkeys/register/finish", userID, responseCookie(rr, "passkey_ceremony"), authenticator.Register(t, creation)); rr.Code != http.StatusBadRequest {
+		t.Errorf("Expected status %d, got %d", http.StatusBadRequest, rr.Code)
+	}
+
+	// Passkeys from another origin are rejected
+	foreign := testutils.NewMockAuthenticator("http://evil.example.com")
+	body, _ := json.Marshal(handlers.PasskeyRegisterRequest{})
+	rr = callPasskey(handlers.PasskeyRegisterBegin, http.MethodPost, "/api/user/passkeys/register/begin", userID, nil, body)
+	if rr := callPasskey(handlers.PasskeyRegisterFinish, http.MethodPost, "/api/user/passkeys/register/finish", userID, responseCookie(rr, "passkey_ceremony"), foreign.Register(t, rr.Body.Bytes())); rr.Code != http.StatusBadRequest {
+		t.Errorf("Expected status %d for a foreign origin, got %d", http.StatusBadRequest, rr.Code)
+	}
+}
+
+func TestPasskeyManagement(t *testing.T) {
+	if !testutils.ShouldRunTests(t) {
+		return
+	}
+	testDB, userID := setupTwoFactorUser(t, false)
+	authenticator := testutils.NewMockAuthenticator(passkeyOrigin)
+	registered := registerPasskey(t, authenticator, userID, "Laptop")
+	target := "/api/user/passkeys?id=" + strconv.Itoa(registered.ID)
+
+	passwordHash := "hash"
+	otherID, err := testDB.CreateUser(context.Background(), &user.User{Email: "other@example.com", Username: "other", PasswordHash: &passwordHash})
+	if err != nil {
+		t.Fatalf("Failed to create user: %v", err)
+	}
+	body, _ := json.Marshal(handlers.PasskeyRegisterRequest{Name: "Phone"})
+	if rr := callPasskey(handlers.RenamePasskey, http.MethodPost, target, *otherID, nil, body); rr.Code != http.StatusNotFound {
+		t.Errorf("Expected status %d for another user's passkey, got %d", http.StatusNotFound, rr.Code)
+	}
+	if rr := callPasskey(handlers.DeletePasskey, http.MethodDelete, target, *otherID, nil, nil); rr.Code != http.StatusNotFound {
+		t.Errorf("Expected status %d for another user's passkey, got %d", http.StatusNotFound, rr.Code)
+	}
+
+	emptyName, _ := json.Marshal(handlers.PasskeyRegisterRequest{Name: " "})
+	if rr := callPasskey(handlers.RenamePasskey, http.MethodPost, target, userID, nil, emptyName); rr.Code != http.StatusBadRequest {
+		t.Errorf("Expected status %d for an empty name, got %d", http.StatusBadRequest, rr.Code)
+	}
+	if rr := callPasskey(handlers.RenamePasskey, http.MethodPost, target, userID, nil, body); rr.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d: %s", http.StatusOK, rr.Code, rr.Body.String())
+	}
+	rr := callPasskey(handlers.ListPasskeys, http.MethodGet, "/api/user/passkeys", userID, nil, nil)
+	var passkeys []handlers.PasskeyResponse
+	json.NewDecoder(rr.Body).Decode(&passkeys)
+	if len(passkeys) != 1 || passkeys[0].Name != "Phone" {
+		t.Errorf("Expected the passkey to be renamed, got %+v", passkeys)
+	}
+
+	if rr := callPasskey(handlers.DeletePasskey, http.MethodDelete, target, userID, nil, nil); rr.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d: %s", http.StatusOK, rr.Code, rr.Body.String())
+	}
+	if rr := loginWithPasskey(t, authenticator, false); rr.Code != http.StatusUnauthorized {
+		t.Errorf("Expected status %d for a revoked passkey, got %d", http.StatusUnauthorized, rr.Code)
+	}
+
+	providerID, err := testDB.CreateSsoProvider(context.Background(), &sso.SsoProvider{Provider: "test-provider", AuthType: "OAuth2"})
+	if err != nil {
+		t.Fatalf("Failed to create SSO provider: %v", err)
+	}
+	ssoID, err := testDB.CreateSsoUser(context.Background(), "sso@example.com", "sso-user", *providerID)
+	if err != nil {
+		t.Fatalf("Failed to create SSO user: %v", err)
+	}
+	if rr := callPasskey(handlers.PasskeyRegisterBegin, http.MethodPost, "/api/user/passkeys/register/begin", *ssoID, nil, nil); rr.Code != http.StatusBadRequest {
+		t.Errorf("Expected status %d for an SSO user, got %d", http.StatusBadRequest, rr.Code)
+	}
+}
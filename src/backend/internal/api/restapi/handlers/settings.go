@@ -2,6 +2,7 @@ package handlers
 
 import (
 	"encoding/json"
+	"errors"
 	"net/http"
 
 	"gitlab.cherkaoui.ch/quillium-ai/quillium/src/backend/internal/api/restapi/middleware"
@@ -32,7 +33,7 @@ func UpdateUserSettings(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Update user settings in database
-	err := dbConn.UpdateUserSettings(userID, &req.Settings)
+	err := dbConn.UpdateUserSettings(r.Context(), userID, &req.Settings)
 	if err != nil {
 		w.WriteHeader(http.StatusInternalServerError)
 		json.NewEncoder(w).Encode(map[string]string{"error": "Failed to update user settings: " + err.Error()})
@@ -53,7 +54,7 @@ func GetAdminSettings(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Get admin settings from database
-	adminSettings, err := dbConn.GetAdminSettings()
+	adminSettings, err := dbConn.GetAdminSettings(r.Context())
 	if err != nil {
 		w.WriteHeader(http.StatusInternalServerError)
 		json.NewEncoder(w).Encode(map[string]string{"error": "Failed to retrieve admin settings"})
@@ -62,16 +63,31 @@ func GetAdminSettings(w http.ResponseWriter, r *http.Request) {
 
 	// Create a response object with API key indicators for frontend display
 	response := map[string]interface{}{
-		"openai_base_url":        adminSettings.OpenAIBaseURL,
-		"llm_profile_speed":      adminSettings.LLMProfileSpeed,
-		"llm_profile_balanced":   adminSettings.LLMProfileBalanced,
-		"llm_profile_quality":    adminSettings.LLMProfileQuality,
-		"enable_sign_ups":        adminSettings.EnableSignUps,
-		"webcrawler_url":         adminSettings.WebcrawlerURL,
-		"elasticsearch_url":      adminSettings.ElasticsearchURL,
-		"elasticsearch_username": adminSettings.ElasticsearchUsername,
-		"elasticsearch_password": adminSettings.ElasticsearchPassword,
-		"env_overrides":          adminSettings.EnvOverrides,
+		"openai_base_url":            adminSettings.OpenAIBaseURL,
+		"llm_profile_speed":          adminSettings.LLMProfileSpeed,
+		"llm_profile_balanced":       adminSettings.LLMProfileBalanced,
+		"llm_profile_quality":        adminSettings.LLMProfileQuality,
+		"llm_provider_speed":         adminSettings.LLMProviderSpeed,
+		"llm_provider_balanced":      adminSettings.LLMProviderBalanced,
+		"llm_provider_quality":       adminSettings.LLMProviderQuality,
+		"llm_providers":              llmProvidersResponse(adminSettings.LLMProviders),
+		"llm_model_metadata":         adminSettings.LLMModelMetadata,
+		"retrieval_profile_speed":    adminSettings.GetRetrievalProfile(settings.QualityProfileSpeed),
+		"retrieval_profile_balanced": adminSettings.GetRetrievalProfile(settings.QualityProfileBalanced),
+		"retrieval_profile_quality":  adminSettings.GetRetrievalProfile(settings.QualityProfileQuality),
+		"generation_limits_speed":    adminSettings.GetGenerationLimits(settings.QualityProfileSpeed),
+		"generation_limits_balanced": adminSettings.GetGenerationLimits(settings.QualityProfileBalanced),
+		"generation_limits_quality":  adminSettings.GetGenerationLimits(settings.QualityProfileQuality),
+		"enable_sign_ups":            adminSettings.EnableSignUps,
+		"webcrawler_url":             adminSettings.WebcrawlerURL,
+		"webcrawler_index_pages":     adminSettings.WebcrawlerIndexPages,
+		"elasticsearch_url":          adminSettings.ElasticsearchURL,
+		"elasticsearch_username":     adminSettings.ElasticsearchUsername,
+		"elasticsearch_password":     adminSettings.ElasticsearchPassword,
+		"elasticsearch_index":        adminSettings.ElasticsearchIndex,
+		"ldap":                       adminSettings.LDAP,
+		"require_admin_two_factor":   adminSettings.RequireAdminTwoFactor,
+		"env_overrides":              adminSettings.EnvOverrides,
 	}
 
 	// Add indicators for API keys if they exist
@@ -93,7 +109,7 @@ func UpdateAdminSettings(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Get current admin settings from database
-	currentSettings, err := dbConn.GetAdminSettings()
+	currentSettings, err := dbConn.GetAdminSettings(r.Context())
 	if err != nil {
 		w.WriteHeader(http.StatusInternalServerError)
 		json.NewEncoder(w).Encode(map[string]string{"error": "Failed to retrieve current admin settings"})
@@ -111,17 +127,32 @@ func UpdateAdminSettings(w http.ResponseWriter, r *http.Request) {
 	// Create a new settings object based on the current settings
 	// This ensures we don't modify the original object and we preserve all existing values
 	newSettings := settings.AdminSettings{
-		OpenAIBaseURL:         currentSettings.OpenAIBaseURL,
-		OpenAIAPIKey_encrypt:  currentSettings.OpenAIAPIKey_encrypt,
-		LLMProfileSpeed:       currentSettings.LLMProfileSpeed,
-		LLMProfileBalanced:    currentSettings.LLMProfileBalanced,
-		LLMProfileQuality:     currentSettings.LLMProfileQuality,
-		EnableSignUps:         currentSettings.EnableSignUps,
-		WebcrawlerURL:         currentSettings.WebcrawlerURL,
-		ElasticsearchURL:      currentSettings.ElasticsearchURL,
-		ElasticsearchUsername: currentSettings.ElasticsearchUsername,
-		ElasticsearchPassword: currentSettings.ElasticsearchPassword,
-		EnvOverrides:          currentSettings.EnvOverrides,
+		OpenAIBaseURL:            currentSettings.OpenAIBaseURL,
+		OpenAIAPIKey_encrypt:     currentSettings.OpenAIAPIKey_encrypt,
+		LLMProfileSpeed:          currentSettings.LLMProfileSpeed,
+		LLMProfileBalanced:       currentSettings.LLMProfileBalanced,
+		LLMProfileQuality:        currentSettings.LLMProfileQuality,
+		LLMProviderSpeed:         currentSettings.LLMProviderSpeed,
+		LLMProviderBalanced:      currentSettings.LLMProviderBalanced,
+		LLMProviderQuality:       currentSettings.LLMProviderQuality,
+		LLMProviders:             currentSettings.LLMProviders,
+		LLMModelMetadata:         currentSettings.LLMModelMetadata,
+		RetrievalProfileSpeed:    currentSettings.RetrievalProfileSpeed,
+		RetrievalProfileBalanced: currentSettings.RetrievalProfileBalanced,
+		RetrievalProfileQuality:  currentSettings.RetrievalProfileQuality,
+		GenerationLimitsSpeed:    currentSettings.GenerationLimitsSpeed,
+		GenerationLimitsBalanced: currentSettings.GenerationLimitsBalanced,
+		GenerationLimitsQuality:  currentSettings.GenerationLimitsQuality,
+		EnableSignUps:            currentSettings.EnableSignUps,
+		WebcrawlerURL:            currentSettings.WebcrawlerURL,
+		WebcrawlerIndexPages:     currentSettings.WebcrawlerIndexPages,
+		ElasticsearchURL:         currentSettings.ElasticsearchURL,
+		ElasticsearchUsername:    currentSettings.ElasticsearchUsername,
+		ElasticsearchPassword:    currentSettings.ElasticsearchPassword,
+		ElasticsearchIndex:       currentSettings.ElasticsearchIndex,
+		LDAP:                     currentSettings.LDAP,
+		RequireAdminTwoFactor:    currentSettings.RequireAdminTwoFactor,
+		EnvOverrides:             currentSettings.EnvOverrides,
 	}
 
 	// Handle API key encryption
@@ -140,6 +171,85 @@ func UpdateAdminSettings(w http.ResponseWriter, r *http.Request) {
 		delete(updates, "openai_api_key")
 	}
 
+	// Handle LLM providers, whose API keys need to be encrypted
+	_, providersUpdated := updates["llm_providers"]
+	if providersUpdated {
+		providers, err := parseLLMProviders(updates["llm_providers"], currentSettings.LLMProviders)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]string{"error": "Invalid llm_providers: " + err.Error()})
+			return
+		}
+		newSettings.LLMProviders = providers
+		delete(updates, "llm_providers")
+	}
+
+	// Handle model metadata, which sets the context budget of each model
+	if value, ok := updates["llm_model_metadata"]; ok {
+		metadata, err := parseModelMetadata(value)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]string{"error": "Invalid llm_model_metadata: " + err.Error()})
+			return
+		}
+		newSettings.LLMModelMetadata = metadata
+		delete(updates, "llm_model_metadata")
+	}
+
+	// Handle retrieval profiles, which are nested objects and need validation
+	retrievalProfiles := map[string]*settings.RetrievalProfile{
+		"retrieval_profile_speed":    &newSettings.RetrievalProfileSpeed,
+		"retrieval_profile_balanced": &newSettings.RetrievalProfileBalanced,
+		"retrieval_profile_quality":  &newSettings.RetrievalProfileQuality,
+	}
+	for key, target := range retrievalProfiles {
+		value, ok := updates[key]
+		if !ok {
+			continue
+		}
+		profile, err := parseRetrievalProfile(value)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]string{"error": "Invalid " + key + ": " + err.Error()})
+			return
+		}
+		*target = *profile
+		delete(updates, key)
+	}
+
+	// Handle generation limits, which are nested objects and need validation
+	generationLimits := map[string]*settings.GenerationLimits{
+		"generation_limits_speed":    &newSettings.GenerationLimitsSpeed,
+		"generation_limits_balanced": &newSettings.GenerationLimitsBalanced,
+		"generation_limits_quality":  &newSettings.GenerationLimitsQuality,
+	}
+	for key, target := range generationLimits {
+		value, ok := updates[key]
+		if !ok {
+			continue
+		}
+		limits, err := parseGenerationLimits(value)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]string{"error": "Invalid " + key + ": " + err.Error()})
+			return
+		}
+		*target = *limits
+		delete(updates, key)
+	}
+
+	// Handle the LDAP settings, a nested object that needs validation
+	if value, ok := updates["ldap"]; ok {
+		ldapSettings, err := parseLDAPSettings(value)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]string{"error": "Invalid ldap: " + err.Error()})
+			return
+		}
+		newSettings.LDAP = *ldapSettings
+		delete(updates, "ldap")
+	}
+
 	// Apply all other updates to the new settings object
 	for key, value := range updates {
 		switch key {
@@ -159,6 +269,21 @@ func UpdateAdminSettings(w http.ResponseWriter, r *http.Request) {
 			if strValue, ok := value.(string); ok {
 				newSettings.LLMProfileQuality = strValue
 			}
+		case "llm_provider_speed":
+			if strValue, ok := value.(string); ok {
+				newSettings.LLMProviderSpeed = strValue
+				providersUpdated = true
+			}
+		case "llm_provider_balanced":
+			if strValue, ok := value.(string); ok {
+				newSettings.LLMProviderBalanced = strValue
+				providersUpdated = true
+			}
+		case "llm_provider_quality":
+			if strValue, ok := value.(string); ok {
+				newSettings.LLMProviderQuality = strValue
+				providersUpdated = true
+			}
 		case "enable_sign_ups":
 			if boolValue, ok := value.(bool); ok {
 				newSettings.EnableSignUps = boolValue
@@ -167,6 +292,10 @@ func UpdateAdminSettings(w http.ResponseWriter, r *http.Request) {
 			if strValue, ok := value.(string); ok {
 				newSettings.WebcrawlerURL = strValue
 			}
+		case "webcrawler_index_pages":
+			if boolValue, ok := value.(bool); ok {
+				newSettings.WebcrawlerIndexPages = boolValue
+			}
 		case "elasticsearch_url":
 			if strValue, ok := value.(string); ok {
 				newSettings.ElasticsearchURL = strValue
@@ -179,11 +308,28 @@ func UpdateAdminSettings(w http.ResponseWriter, r *http.Request) {
 			if strValue, ok := value.(string); ok {
 				newSettings.ElasticsearchPassword = strValue
 			}
+		case "elasticsearch_index":
+			if strValue, ok := value.(string); ok {
+				newSettings.ElasticsearchIndex = strValue
+			}
+		case "require_admin_two_factor":
+			if boolValue, ok := value.(bool); ok {
+				newSettings.RequireAdminTwoFactor = boolValue
+			}
+		}
+	}
+
+	// Make sure every profile still points to an existing provider
+	if providersUpdated {
+		if err := newSettings.ValidateLLMProviders(); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+			return
 		}
 	}
 
 	// Update admin settings in database with the new settings object
-	err = dbConn.CreateAdminSettings(&newSettings)
+	err = dbConn.CreateAdminSettings(r.Context(), &newSettings)
 	if err != nil {
 		w.WriteHeader(http.StatusInternalServerError)
 		json.NewEncoder(w).Encode(map[string]string{"error": "Failed to update admin settings"})
@@ -194,3 +340,144 @@ func UpdateAdminSettings(w http.ResponseWriter, r *http.Request) {
 	w.WriteHeader(http.StatusOK)
 	json.NewEncoder(w).Encode(map[string]string{"message": "Admin settings updated successfully"})
 }
+
+// parseRetrievalProfile converts a decoded JSON object into a validated retrieval profile
+func parseRetrievalProfile(value interface{}) (*settings.RetrievalProfile, error) {
+	jsonValue, err := json.Marshal(value)
+	if err != nil {
+		return nil, err
+	}
+
+	var profile settings.RetrievalProfile
+	if err := json.Unmarshal(jsonValue, &profile); err != nil {
+		return nil, err
+	}
+
+	if err := profile.Validate(); err != nil {
+		return nil, err
+	}
+	return &profile, nil
+}
+
+// parseGenerationLimits converts a decoded JSON object into validated generation limits
+func parseGenerationLimits(value interface{}) (*settings.GenerationLimits, error) {
+	jsonValue, err := json.Marshal(value)
+	if err != nil {
+		return nil, err
+	}
+
+	var limits settings.GenerationLimits
+	if err := json.Unmarshal(jsonValue, &limits); err != nil {
+		return nil, err
+	}
+
+	if err := limits.Validate(); err != nil {
+		return nil, err
+	}
+	return &limits, nil
+}
+
+// parseLDAPSettings converts a decoded JSON object into validated LDAP settings
+func parseLDAPSettings(value interface{}) (*settings.LDAPSettings, error) {
+	jsonValue, err := json.Marshal(value)
+	if err != nil {
+		return nil, err
+	}
+
+	var ldapSettings settings.LDAPSettings
+	if err := json.Unmarshal(jsonValue, &ldapSettings); err != nil {
+		return nil, err
+	}
+
+	if err := ldapSettings.Validate(); err != nil {
+		return nil, err
+	}
+	return &ldapSettings, nil
+}
+
+// parseModelMetadata converts a decoded JSON list into validated model metadata
+func parseModelMetadata(value interface{}) ([]settings.ModelMetadata, error) {
+	jsonValue, err := json.Marshal(value)
+	if err != nil {
+		return nil, err
+	}
+
+	var metadata []settings.ModelMetadata
+	if err := json.Unmarshal(jsonValue, &metadata); err != nil {
+		return nil, err
+	}
+
+	for i := range metadata {
+		if err := metadata[i].Validate(); err != nil {
+			return nil, err
+		}
+	}
+	return metadata, nil
+}
+
+// llmProviderUpdate is a provider as sent by the admin frontend, with a plain text API key
+type llmProviderUpdate struct {
+	Name    string  `json:"name"`
+	Type    string  `json:"type"`
+	BaseURL string  `json:"base_url"`
+	APIKey  *string `json:"api_key"`
+}
+
+// parseLLMProviders converts a decoded JSON list into providers with encrypted API keys.
+// Providers sent without api_key keep the key of the existing provider with the same name,
+// an empty api_key removes it.
+func parseLLMProviders(value interface{}, current []settings.LLMProvider) ([]settings.LLMProvider, error) {
+	jsonValue, err := json.Marshal(value)
+	if err != nil {
+		return nil, err
+	}
+
+	var updates []llmProviderUpdate
+	if err := json.Unmarshal(jsonValue, &updates); err != nil {
+		return nil, err
+	}
+
+	existingKeys := make(map[string]string)
+	for _, provider := range current {
+		existingKeys[provider.Name] = provider.APIKey_encrypt
+	}
+
+	providers := make([]settings.LLMProvider, 0, len(updates))
+	for _, update := range updates {
+		provider := settings.LLMProvider{
+			Name:           update.Name,
+			Type:           update.Type,
+			BaseURL:        update.BaseURL,
+			APIKey_encrypt: existingKeys[update.Name],
+		}
+		if update.APIKey != nil {
+			provider.APIKey_encrypt = ""
+			if *update.APIKey != "" {
+				encryptedKey, err := security.EncryptPassword(*update.APIKey)
+				if err != nil {
+					return nil, errors.New("failed to encrypt API key for provider " + update.Name)
+				}
+				provider.APIKey_encrypt = *encryptedKey
+			}
+		}
+		if err := provider.Validate(); err != nil {
+			return nil, err
+		}
+		providers = append(providers, provider)
+	}
+	return providers, nil
+}
+
+// llmProvidersResponse hides the encrypted API keys, only flagging whether a key is set
+func llmProvidersResponse(providers []settings.LLMProvider) []map[string]interface{} {
+	response := make([]map[string]interface{}, 0, len(providers))
+	for _, provider := range providers {
+		response = append(response, map[string]interface{}{
+			"name":        provider.Name,
+			"type":        provider.Type,
+			"base_url":    provider.BaseURL,
+			"has_api_key": provider.APIKey_encrypt != "",
+		})
+	}
+	return response
+}
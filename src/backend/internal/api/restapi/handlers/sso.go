@@ -0,0 +1,455 @@
+package handlers
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"gitlab.cherkaoui.ch/quillium-ai/quillium/src/backend/internal/db"
+	"gitlab.cherkaoui.ch/quillium-ai/quillium/src/backend/internal/security"
+	"gitlab.cherkaoui.ch/quillium-ai/quillium/src/backend/internal/sso"
+	"gitlab.cherkaoui.ch/quillium-ai/quillium/src/backend/internal/user"
+	"golang.org/x/oauth2"
+)
+
+// ssoStateCookie carries the state of a login between the redirect to the
+// provider and its callback
+const ssoStateCookie = "sso_state"
+
+// ssoStateTTL is how long a user has to complete a login at the provider
+const ssoStateTTL = 10 * time.Minute
+
+// frontendURL is where the browser is sent back to after an SSO login
+var frontendURL = strings.TrimSuffix(os.Getenv("FRONTEND_URL"), "/")
+
+// ssoState is stored encrypted in the state cookie, so the callback can be
+// handled by any backend instance
+type ssoState struct {
+	Provider   string    `json:"provider"`
+	State      string    `json:"state"`
+	Nonce      string    `json:"nonce,omitempty"`
+	Verifier   string    `json:"verifier,omitempty"`
+	RequestID  string    `json:"request_id,omitempty"` // SAML only
+	RememberMe bool      `json:"remember_me"`
+	LinkUserID int       `json:"link_user_id,omitempty"` // Set when linking a signed in account
+	ExpiresAt  time.Time `json:"expires_at"`
+}
+
+// SsoLogin redirects the browser to the login page of an SSO provider
+func SsoLogin(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	provider, err := dbConn.GetSsoProvider(r.Context(), r.URL.Query().Get("provider"))
+	if err != nil {
+		if !errors.Is(err, db.ErrSsoProviderNotFound) {
+			log.Printf("Failed to get SSO provider: %v", err)
+		}
+		redirectSsoError(w, r, "Unknown SSO provider")
+		return
+	}
+
+	state := &ssoState{
+		Provider:   provider.Provider,
+		RememberMe: r.URL.Query().Get("remember_me") == "true",
+	}
+	authURL, err := beginSsoLogin(w, r, provider, state)
+	if err != nil {
+		redirectSsoError(w, r, err.Error())
+		return
+	}
+
+	http.Redirect(w, r, authURL, http.StatusFound)
+}
+
+// SsoLink starts an SSO login that links the provider to the signed in
+// account. Password accounts are never linked by an SSO login alone, the user
+// proves they own the account by being signed in. The response holds the URL
+// of the provider's login page, the callback sends the browser back to the
+// settings page.
+func SsoLink(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	userData := signedInPasswordUser(w, r, "Your account is already linked to an SSO login")
+	if userData == nil {
+		return
+	}
+	reason, err := checkSsoLinkable(r.Context(), userData)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Failed to check two-factor authentication: " + err.Error()})
+		return
+	}
+	if reason != "" {
+		w.WriteHeader(http.StatusConflict)
+		json.NewEncoder(w).Encode(map[string]string{"error": reason})
+		return
+	}
+
+	provider, err := dbConn.GetSsoProvider(r.Context(), r.URL.Query().Get("provider"))
+	if err != nil {
+		if !errors.Is(err, db.ErrSsoProviderNotFound) {
+			log.Printf("Failed to get SSO provider: %v", err)
+		}
+		w.WriteHeader(http.StatusNotFound)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Unknown SSO provider"})
+		return
+	}
+
+	authURL, err := beginSsoLogin(w, r, provider, &ssoState{Provider: provider.Provider, LinkUserID: *userData.ID})
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(SsoLinkResponse{URL: authURL})
+}
+
+// checkSsoLinkable returns why an account cannot be linked to an SSO login, or
+// an empty reason when it can. SSO logins never ask for a second factor, so
+// linking must not remove one the user enabled or the admin settings require.
+func checkSsoLinkable(ctx context.Context, userData *user.User) (string, error) {
+	totp, err := dbConn.GetUserTOTP(ctx, *userData.ID)
+	if err != nil && !errors.Is(err, db.ErrTOTPNotFound) {
+		return "", err
+	}
+	if err == nil && totp.Enabled {
+		return "Disable two-factor authentication before linking an SSO login, SSO logins do not ask for a code", nil
+	}
+	required, err := isTwoFactorRequired(ctx, userData.IsAdmin)
+	if err != nil {
+		return "", err
+	}
+	if required {
+		return "Administrators must use two-factor authentication and cannot link an SSO login", nil
+	}
+	return "", nil
+}
+
+// beginSsoLogin sets the state cookie of a login with the provider and
+// returns the URL of its login page. The returned errors are shown to the user.
+func beginSsoLogin(w http.ResponseWriter, r *http.Request, provider *sso.SsoProvider, state *ssoState) (string, error) {
+	state.ExpiresAt = time.Now().Add(ssoStateTTL)
+	var err error
+	if state.State, err = security.GenerateRandomString(32); err != nil {
+		return "", errors.New("Failed to start SSO login")
+	}
+
+	var authURL string
+	if provider.AuthType == "SAML" {
+		serviceProvider, err := sso.NewSAMLServiceProvider(provider)
+		if err != nil {
+			log.Printf("Failed to set up SSO provider %s: %v", provider.Provider, err)
+			return "", errors.New("SSO provider is unavailable")
+		}
+		// The relay state comes back with the response, like the OAuth2 state
+		authURL, state.RequestID, err = serviceProvider.AuthnRequestURL(state.State)
+		if err != nil {
+			log.Printf("Failed to start SAML login with %s: %v", provider.Provider, err)
+			return "", errors.New("Failed to start SSO login")
+		}
+	} else {
+		client, err := sso.NewClient(r.Context(), provider)
+		if err != nil {
+			log.Printf("Failed to set up SSO provider %s: %v", provider.Provider, err)
+			return "", errors.New("SSO provider is unavailable")
+		}
+		state.Verifier = oauth2.GenerateVerifier()
+		if state.Nonce, err = security.GenerateRandomString(32); err != nil {
+			return "", errors.New("Failed to start SSO login")
+		}
+		authURL = client.AuthCodeURL(state.State, state.Nonce, state.Verifier)
+	}
+
+	stateJSON, err := json.Marshal(state)
+	if err != nil {
+		return "", errors.New("Failed to start SSO login")
+	}
+	encrypted, err := security.EncryptPassword(string(stateJSON))
+	if err != nil {
+		log.Printf("Failed to encrypt SSO state: %v", err)
+		return "", errors.New("Failed to start SSO login")
+	}
+
+	// Lax, the callback is a top-level navigation coming from the provider.
+	// SAML responses are posted cross-site, which only sends None cookies,
+	// and browsers only accept those over HTTPS.
+	sameSite := http.SameSiteLaxMode
+	if provider.AuthType == "SAML" && httpsEnabled {
+		sameSite = http.SameSiteNoneMode
+	}
+	http.SetCookie(w, &http.Cookie{
+		Name:     ssoStateCookie,
+		Value:    *encrypted,
+		Path:     "/api/auth/sso",
+		HttpOnly: true,
+		Secure:   httpsEnabled,
+		SameSite: sameSite,
+		MaxAge:   int(ssoStateTTL.Seconds()),
+	})
+	return authURL, nil
+}
+
+// SsoCallback completes an OIDC or OAuth2 login and starts a session for the user
+func SsoCallback(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	state, err := readSsoState(w, r)
+	if err != nil {
+		log.Printf("Rejected SSO callback: %v", err)
+		redirectSsoError(w, r, "SSO login expired, please try again")
+		return
+	}
+
+	query := r.URL.Query()
+	if query.Get("error") != "" {
+		log.Printf("SSO provider %s returned an error: %s", state.Provider, query.Get("error"))
+		redirectSsoError(w, r, "SSO login was cancelled or denied")
+		return
+	}
+	if subtle.ConstantTimeCompare([]byte(query.Get("state")), []byte(state.State)) != 1 {
+		redirectSsoError(w, r, "SSO login expired, please try again")
+		return
+	}
+
+	provider, err := dbConn.GetSsoProvider(r.Context(), state.Provider)
+	if err != nil {
+		log.Printf("Failed to get SSO provider %s: %v", state.Provider, err)
+		redirectSsoError(w, r, "Unknown SSO provider")
+		return
+	}
+	client, err := sso.NewClient(r.Context(), provider)
+	if err != nil {
+		log.Printf("Failed to set up SSO provider %s: %v", provider.Provider, err)
+		redirectSsoError(w, r, "SSO provider is unavailable")
+		return
+	}
+
+	identity, err := client.Exchange(r.Context(), query.Get("code"), state.Verifier, state.Nonce)
+	if err != nil {
+		log.Printf("SSO login with %s failed: %v", provider.Provider, err)
+		redirectSsoError(w, r, "SSO login failed")
+		return
+	}
+
+	completeSsoLogin(w, r, provider, identity, state)
+}
+
+// completeSsoLogin starts a session for the user of an authenticated identity
+// and sends the browser back to the frontend. Logins started by SsoLink link
+// the identity to the account instead, and go back to the settings page.
+func completeSsoLogin(w http.ResponseWriter, r *http.Request, provider *sso.SsoProvider, identity *sso.Identity, state *ssoState) {
+	if state.LinkUserID != 0 {
+		if err := linkSsoUser(r.Context(), provider, identity, state.LinkUserID); err != nil {
+			log.Printf("Linking user %d to SSO provider %s failed: %v", state.LinkUserID, provider.Provider, err)
+			http.Redirect(w, r, frontendURL+"/settings?error="+url.QueryEscape(err.Error()), http.StatusFound)
+			return
+		}
+		http.Redirect(w, r, frontendURL+"/settings?sso_linked="+url.QueryEscape(provider.Provider), http.StatusFound)
+		return
+	}
+
+	userData, err := resolveSsoUser(r.Context(), provider, identity)
+	if err != nil {
+		log.Printf("SSO login with %s failed: %v", provider.Provider, err)
+		redirectSsoError(w, r, err.Error())
+		return
+	}
+
+	if _, _, err := startSession(w, r, *userData.ID, userData.IsAdmin, state.RememberMe); err != nil {
+		redirectSsoError(w, r, err.Error())
+		return
+	}
+
+	http.Redirect(w, r, frontendURL+"/", http.StatusFound)
+}
+
+// linkSsoUser links an SSO identity to the password account that started the
+// login with SsoLink. The returned errors are shown to the user.
+func linkSsoUser(ctx context.Context, provider *sso.SsoProvider, identity *sso.Identity, userID int) error {
+	if identity.Subject == "" {
+		return errors.New("SSO provider did not return a user identifier")
+	}
+
+	_, err := dbConn.GetSsoUser(ctx, *provider.ID, identity.Subject)
+	if err == nil {
+		return errors.New("This SSO login is already linked to an account")
+	}
+	if !errors.Is(err, db.ErrUserNotFound) {
+		log.Printf("Failed to get SSO user: %v", err)
+		return errors.New("Failed to get user")
+	}
+
+	userData, err := dbConn.GetUser(ctx, nil, &userID)
+	if err != nil {
+		log.Printf("Failed to get user: %v", err)
+		return errors.New("Failed to get user")
+	}
+	if userData.IsSso {
+		return errors.New("Your account is already linked to an SSO login")
+	}
+	// Checked again, two-factor may have been enabled while at the provider
+	reason, err := checkSsoLinkable(ctx, userData)
+	if err != nil {
+		log.Printf("Failed to check two-factor authentication: %v", err)
+		return errors.New("Failed to link account")
+	}
+	if reason != "" {
+		return errors.New(reason)
+	}
+
+	if err := dbConn.LinkSsoUser(ctx, userID, identity.Subject, *provider.ID); err != nil {
+		log.Printf("Failed to link SSO user: %v", err)
+		return errors.New("Failed to link account")
+	}
+	log.Printf("Linked user %d to SSO provider %s", userID, provider.Provider)
+	return nil
+}
+
+// readSsoState decrypts the state cookie and clears it, a state is only used once
+func readSsoState(w http.ResponseWriter, r *http.Request) (*ssoState, error) {
+	cookie, err := r.Cookie(ssoStateCookie)
+	if err != nil || cookie.Value == "" {
+		return nil, errors.New("no SSO state cookie")
+	}
+
+	http.SetCookie(w, &http.Cookie{
+		Name:     ssoStateCookie,
+		Value:    "",
+		Path:     "/api/auth/sso",
+		HttpOnly: true,
+		Secure:   httpsEnabled,
+		SameSite: http.SameSiteLaxMode,
+		MaxAge:   -1, // Delete the cookie
+	})
+
+	decrypted, err := security.DecryptPassword(cookie.Value)
+	if err != nil {
+		return nil, errors.New("failed to decrypt SSO state: " + err.Error())
+	}
+	var state ssoState
+	if err := json.Unmarshal([]byte(*decrypted), &state); err != nil {
+		return nil, errors.New("failed to parse SSO state: " + err.Error())
+	}
+	if time.Now().After(state.ExpiresAt) {
+		return nil, errors.New("SSO state expired")
+	}
+	return &state, nil
+}
+
+// resolveSsoUser returns the user an SSO identity belongs to, with the admin
+// role the provider decided. The returned errors are shown to the user.
+func resolveSsoUser(ctx context.Context, provider *sso.SsoProvider, identity *sso.Identity) (*user.User, error) {
+	userData, err := findSsoUser(ctx, provider, identity)
+	if err != nil || identity.IsAdmin == nil || *identity.IsAdmin == userData.IsAdmin {
+		return userData, err
+	}
+
+	if err := dbConn.UpdateUserIsAdmin(ctx, *userData.ID, *identity.IsAdmin); err != nil {
+		log.Printf("Failed to update admin role of SSO user: %v", err)
+		return nil, errors.New("Failed to update user")
+	}
+	log.Printf("Set admin role of user %d to %t from SSO provider %s", *userData.ID, *identity.IsAdmin, provider.Provider)
+	userData.IsAdmin = *identity.IsAdmin
+	return userData, nil
+}
+
+// findSsoUser returns the user an SSO identity belongs to. Unknown
+// identities get a new account when sign ups are enabled and the provider
+// allows the email domain. Users moved from a deleted provider have no
+// subject yet and are linked by their verified email. Password accounts are
+// only linked by SsoLink, while the user is signed in. The returned errors are
+// shown to the user.
+func findSsoUser(ctx context.Context, provider *sso.SsoProvider, identity *sso.Identity) (*user.User, error) {
+	if identity.Subject == "" {
+		return nil, errors.New("SSO provider did not return a user identifier")
+	}
+
+	userData, err := dbConn.GetSsoUser(ctx, *provider.ID, identity.Subject)
+	if err == nil {
+		return userData, nil
+	}
+	if !errors.Is(err, db.ErrUserNotFound) {
+		log.Printf("Failed to get SSO user: %v", err)
+		return nil, errors.New("Failed to get user")
+	}
+
+	if !user.IsValidEmail(identity.Email) {
+		return nil, errors.New("SSO provider did not return a valid email address")
+	}
+
+	existingUser, err := dbConn.GetUser(ctx, &identity.Email, nil)
+	switch {
+	case err == nil:
+		if !existingUser.IsSso {
+			return nil, errors.New("An account with this email already exists, sign in with your password and link the SSO login from your account settings")
+		}
+		if !identity.EmailVerified {
+			return nil, errors.New("An account with this email already exists and the SSO provider has not verified the email")
+		}
+		awaitsRelink := existingUser.SsoProviderID != nil && *existingUser.SsoProviderID == *provider.ID &&
+			existingUser.SsoUserID != nil && *existingUser.SsoUserID == ""
+		if !awaitsRelink {
+			return nil, errors.New("An account with this email is already linked to another SSO login")
+		}
+		if err := dbConn.LinkSsoUser(ctx, *existingUser.ID, identity.Subject, *provider.ID); err != nil {
+			log.Printf("Failed to link SSO user: %v", err)
+			return nil, errors.New("Failed to link account")
+		}
+		log.Printf("Linked user %d to SSO provider %s", *existingUser.ID, provider.Provider)
+		return dbConn.GetUser(ctx, nil, existingUser.ID)
+	case errors.Is(err, db.ErrUserNotFound):
+		adminSettings, err := dbConn.GetAdminSettings(ctx)
+		if err != nil {
+			log.Printf("Failed to get admin settings: %v", err)
+			return nil, errors.New("Failed to retrieve admin settings")
+		}
+		if !adminSettings.EnableSignUps {
+			return nil, errors.New("User registration is currently disabled by the administrator")
+		}
+		if !provider.AllowsEmail(identity.Email) {
+			return nil, errors.New("Sign up with this email domain is not allowed")
+		}
+
+		userID, err := dbConn.CreateSsoUser(ctx, identity.Email, identity.Subject, *provider.ID)
+		if err != nil {
+			log.Printf("Failed to create SSO user: %v", err)
+			return nil, errors.New("Failed to create user")
+		}
+
+		username := identity.Username
+		if username == "" {
+			username, _, _ = strings.Cut(identity.Email, "@")
+		}
+		if err := dbConn.UpdateUserUsername(ctx, *userID, username); err != nil {
+			log.Printf("Failed to set username of SSO user: %v", err)
+		}
+		log.Printf("Created user %d for SSO provider %s", *userID, provider.Provider)
+		return dbConn.GetUser(ctx, nil, userID)
+	default:
+		log.Printf("Failed to get user: %v", err)
+		return nil, errors.New("Failed to get user")
+	}
+}
+
+// redirectSsoError sends the browser back to the sign in page with an error message
+func redirectSsoError(w http.ResponseWriter, r *http.Request, message string) {
+	http.Redirect(w, r, frontendURL+"/signin?error="+url.QueryEscape(message), http.StatusFound)
+}
@@ -0,0 +1,347 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+
+	"gitlab.cherkaoui.ch/quillium-ai/quillium/src/backend/internal/api/restapi/middleware"
+	"gitlab.cherkaoui.ch/quillium-ai/quillium/src/backend/internal/db"
+	"gitlab.cherkaoui.ch/quillium-ai/quillium/src/backend/internal/security"
+	"gitlab.cherkaoui.ch/quillium-ai/quillium/src/backend/internal/sso"
+)
+
+// ListSsoProviders returns all SSO providers without their client secrets (admin only)
+func ListSsoProviders(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	// Check if the current user is an admin
+	if !middleware.IsAdmin(r.Context()) {
+		w.WriteHeader(http.StatusForbidden)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Admin access required"})
+		return
+	}
+
+	providers, err := dbConn.GetSsoProviders(r.Context())
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Failed to retrieve SSO providers"})
+		return
+	}
+
+	responses := make([]SsoProviderResponse, 0, len(providers))
+	for _, provider := range providers {
+		userCount, err := dbConn.CountSsoProviderUsers(r.Context(), *provider.ID)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			json.NewEncoder(w).Encode(map[string]string{"error": "Failed to retrieve SSO providers"})
+			return
+		}
+		responses = append(responses, ssoProviderResponse(provider, userCount))
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(responses)
+}
+
+// CreateSsoProvider adds an SSO provider with an encrypted client secret (admin only)
+func CreateSsoProvider(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	// Check if the current user is an admin
+	if !middleware.IsAdmin(r.Context()) {
+		w.WriteHeader(http.StatusForbidden)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Admin access required"})
+		return
+	}
+
+	var req SsoProviderRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Invalid request"})
+		return
+	}
+
+	provider := &sso.SsoProvider{}
+	if err := applySsoProviderRequest(provider, &req); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+		return
+	}
+
+	// Provider names are unique, they select the provider at login
+	if _, err := dbConn.GetSsoProvider(r.Context(), provider.Provider); err == nil {
+		w.WriteHeader(http.StatusConflict)
+		json.NewEncoder(w).Encode(map[string]string{"error": "SSO provider already exists"})
+		return
+	}
+
+	if err := encryptClientSecret(provider, req.ClientSecret); err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Failed to encrypt client secret"})
+		return
+	}
+
+	providerID, err := dbConn.CreateSsoProvider(r.Context(), provider)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Failed to create SSO provider"})
+		return
+	}
+	provider.ID = providerID
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(ssoProviderResponse(provider, 0))
+}
+
+// UpdateSsoProvider changes the fields of an SSO provider given in the request (admin only)
+func UpdateSsoProvider(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	// Check if the current user is an admin
+	if !middleware.IsAdmin(r.Context()) {
+		w.WriteHeader(http.StatusForbidden)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Admin access required"})
+		return
+	}
+
+	var req SsoProviderRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.ID == nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Invalid request"})
+		return
+	}
+
+	provider, err := dbConn.GetSsoProviderByID(r.Context(), *req.ID)
+	if errors.Is(err, db.ErrSsoProviderNotFound) {
+		w.WriteHeader(http.StatusNotFound)
+		json.NewEncoder(w).Encode(map[string]string{"error": "SSO provider not found"})
+		return
+	}
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Failed to retrieve SSO provider"})
+		return
+	}
+
+	if err := applySsoProviderRequest(provider, &req); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+		return
+	}
+
+	// A rename must not take the name of another provider
+	if existing, err := dbConn.GetSsoProvider(r.Context(), provider.Provider); err == nil && *existing.ID != *provider.ID {
+		w.WriteHeader(http.StatusConflict)
+		json.NewEncoder(w).Encode(map[string]string{"error": "SSO provider already exists"})
+		return
+	}
+
+	if err := encryptClientSecret(provider, req.ClientSecret); err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Failed to encrypt client secret"})
+		return
+	}
+
+	if err := dbConn.UpdateSsoProvider(r.Context(), provider); err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Failed to update SSO provider"})
+		return
+	}
+
+	userCount, err := dbConn.CountSsoProviderUsers(r.Context(), *provider.ID)
+	if err != nil {
+		log.Printf("Failed to count users of SSO provider %d: %v", *provider.ID, err)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(ssoProviderResponse(provider, userCount))
+}
+
+// DeleteSsoProvider removes an SSO provider (admin only). Deleting a provider
+// would delete its users, so a provider with users is only deleted when the
+// migrate_to parameter names a provider to move them to first.
+func DeleteSsoProvider(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodDelete {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	// Check if the current user is an admin
+	if !middleware.IsAdmin(r.Context()) {
+		w.WriteHeader(http.StatusForbidden)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Admin access required"})
+		return
+	}
+
+	providerID, err := strconv.Atoi(r.URL.Query().Get("id"))
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Invalid SSO provider ID format"})
+		return
+	}
+
+	if _, err := dbConn.GetSsoProviderByID(r.Context(), providerID); err != nil {
+		if errors.Is(err, db.ErrSsoProviderNotFound) {
+			w.WriteHeader(http.StatusNotFound)
+			json.NewEncoder(w).Encode(map[string]string{"error": "SSO provider not found"})
+			return
+		}
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Failed to retrieve SSO provider"})
+		return
+	}
+
+	// The users are counted, moved and the provider deleted in one transaction of the store,
+	// a user signing in meanwhile is never deleted with the provider
+	var migrateToID *int
+	if migrateTo := r.URL.Query().Get("migrate_to"); migrateTo != "" {
+		targetID, err := strconv.Atoi(migrateTo)
+		if err != nil || targetID == providerID {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]string{"error": "Invalid migrate_to SSO provider ID"})
+			return
+		}
+		if _, err := dbConn.GetSsoProviderByID(r.Context(), targetID); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]string{"error": "Invalid migrate_to SSO provider ID"})
+			return
+		}
+		migrateToID = &targetID
+	}
+
+	err = dbConn.DeleteSsoProvider(r.Context(), providerID, migrateToID)
+	if errors.Is(err, db.ErrSsoProviderInUse) {
+		message := "SSO provider still has users, migrate them to another provider first"
+		if userCount, err := dbConn.CountSsoProviderUsers(r.Context(), providerID); err == nil {
+			message = "SSO provider still has " + strconv.Itoa(userCount) + " users, migrate them to another provider first"
+		}
+		w.WriteHeader(http.StatusConflict)
+		json.NewEncoder(w).Encode(map[string]string{"error": message})
+		return
+	}
+	if errors.Is(err, db.ErrSsoProviderNotFound) {
+		w.WriteHeader(http.StatusNotFound)
+		json.NewEncoder(w).Encode(map[string]string{"error": "SSO provider not found"})
+		return
+	}
+	if err != nil {
+		log.Printf("Failed to delete SSO provider %d: %v", providerID, err)
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Failed to delete SSO provider"})
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]string{"message": "SSO provider deleted successfully"})
+}
+
+// applySsoProviderRequest copies the fields set in req to provider and
+// validates the result. The client secret is handled by encryptClientSecret.
+func applySsoProviderRequest(provider *sso.SsoProvider, req *SsoProviderRequest) error {
+	if req.Provider != nil {
+		provider.Provider = *req.Provider
+	}
+	if req.AuthType != nil {
+		provider.AuthType = *req.AuthType
+	}
+	if req.ClientID != nil {
+		provider.ClientID = *req.ClientID
+	}
+	if req.RedirectURL != nil {
+		provider.RedirectURL = *req.RedirectURL
+	}
+	if req.IssuerURL != nil {
+		provider.IssuerURL = *req.IssuerURL
+	}
+	if req.AuthURL != nil {
+		provider.AuthURL = *req.AuthURL
+	}
+	if req.TokenURL != nil {
+		provider.TokenURL = *req.TokenURL
+	}
+	if req.UserInfoURL != nil {
+		provider.UserInfoURL = *req.UserInfoURL
+	}
+	if req.Scopes != nil {
+		provider.Scopes = *req.Scopes
+	}
+	if req.SubjectField != nil {
+		provider.SubjectField = *req.SubjectField
+	}
+	if req.EmailField != nil {
+		provider.EmailField = *req.EmailField
+	}
+	if req.EmailVerifiedField != nil {
+		provider.EmailVerifiedField = *req.EmailVerifiedField
+	}
+	if req.UsernameField != nil {
+		provider.UsernameField = *req.UsernameField
+	}
+	if req.AllowedDomains != nil {
+		provider.AllowedDomains = sso.NormalizeDomains(*req.AllowedDomains)
+	}
+	if req.IdPMetadata != nil {
+		provider.IdPMetadata = *req.IdPMetadata
+	}
+	if req.AdminField != nil {
+		provider.AdminField = *req.AdminField
+	}
+	if req.AdminValue != nil {
+		provider.AdminValue = *req.AdminValue
+	}
+	return provider.Validate()
+}
+
+// encryptClientSecret replaces the stored secret when a new one is given
+func encryptClientSecret(provider *sso.SsoProvider, clientSecret *string) error {
+	if clientSecret == nil || *clientSecret == "" {
+		return nil
+	}
+	encrypted, err := security.EncryptPassword(*clientSecret)
+	if err != nil {
+		return err
+	}
+	provider.ClientSecret = *encrypted
+	return nil
+}
+
+func ssoProviderResponse(provider *sso.SsoProvider, userCount int) SsoProviderResponse {
+	return SsoProviderResponse{
+		ID:              *provider.ID,
+		Provider:        provider.Provider,
+		AuthType:        provider.AuthType,
+		ClientID:        provider.ClientID,
+		ClientSecretSet: provider.ClientSecret != "",
+		RedirectURL:     provider.RedirectURL,
+		IssuerURL:       provider.IssuerURL,
+
+		AuthURL:            provider.AuthURL,
+		TokenURL:           provider.TokenURL,
+		UserInfoURL:        provider.UserInfoURL,
+		Scopes:             provider.Scopes,
+		SubjectField:       provider.SubjectField,
+		EmailField:         provider.EmailField,
+		EmailVerifiedField: provider.EmailVerifiedField,
+		UsernameField:      provider.UsernameField,
+		AllowedDomains:     provider.AllowedDomains,
+
+		IdPMetadata: provider.IdPMetadata,
+		AdminField:  provider.AdminField,
+		AdminValue:  provider.AdminValue,
+
+		UserCount: userCount,
+	}
+}
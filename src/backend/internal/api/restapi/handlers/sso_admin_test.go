@@ -0,0 +1,243 @@
+package handlers_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"gitlab.cherkaoui.ch/quillium-ai/quillium/src/backend/internal/api/restapi/handlers"
+	"gitlab.cherkaoui.ch/quillium-ai/quillium/src/backend/internal/api/restapi/handlers/testutils"
+	"gitlab.cherkaoui.ch/quillium-ai/quillium/src/backend/internal/api/restapi/middleware"
+	"gitlab.cherkaoui.ch/quillium-ai/quillium/src/backend/internal/db"
+	"gitlab.cherkaoui.ch/quillium-ai/quillium/src/backend/internal/security"
+)
+
+// Setup test context for the SSO admin endpoints
+func setupSsoAdminContext(isAdmin bool) context.Context {
+	ctx := context.WithValue(context.Background(), middleware.UserIDKey(), 1)
+	return context.WithValue(ctx, middleware.IsAdminKey(), isAdmin)
+}
+
+// createSsoProviderRequest calls CreateSsoProvider with the given body
+func createSsoProviderRequest(t *testing.T, body map[string]interface{}, isAdmin bool) *httptest.ResponseRecorder {
+	t.Helper()
+	jsonBody, _ := json.Marshal(body)
+	req := httptest.NewRequest(http.MethodPost, "/api/admin/sso/create", bytes.NewBuffer(jsonBody))
+	req = req.WithContext(setupSsoAdminContext(isAdmin))
+	rr := httptest.NewRecorder()
+	handlers.CreateSsoProvider(rr, req)
+	return rr
+}
+
+func validSsoProviderBody(name string) map[string]interface{} {
+	return map[string]interface{}{
+		"provider":      name,
+		"auth_type":     "OIDC",
+		"client_id":     "quillium",
+		"client_secret": "super-secret",
+		"redirect_url":  "https://quillium.example.com/api/auth/sso/callback",
+		"issuer_url":    "https://idp.example.com",
+	}
+}
+
+func TestCreateSsoProvider(t *testing.T) {
+	if !testutils.ShouldRunTests(t) {
+		return
+	}
+
+	testCases := []struct {
+		name           string
+		body           map[string]interface{}
+		isAdmin        bool
+		expectedStatus int
+	}{
+		{"admin creates provider", validSsoProviderBody("company"), true, http.StatusCreated},
+		{"non-admin is forbidden", validSsoProviderBody("company"), false, http.StatusForbidden},
+		{"unknown auth type", map[string]interface{}{
+			"provider": "company", "auth_type": "LDAP", "client_id": "quillium",
+			"redirect_url": "https://quillium.example.com/api/auth/sso/callback",
+		}, true, http.StatusBadRequest},
+		{"OIDC without issuer", map[string]interface{}{
+			"provider": "company", "auth_type": "OIDC", "client_id": "quillium",
+			"redirect_url": "https://quillium.example.com/api/auth/sso/callback",
+		}, true, http.StatusBadRequest},
+		{"OAuth2 provider", map[string]interface{}{
+			"provider": "company", "auth_type": "OAuth2", "client_id": "quillium", "client_secret": "super-secret",
+			"redirect_url": "https://quillium.example.com/api/auth/sso/callback",
+			"auth_url":     "https://gitlab.example.com/oauth/authorize",
+			"token_url":    "https://gitlab.example.com/oauth/token",
+			"userinfo_url": "https://gitlab.example.com/api/v4/user",
+			"scopes":       "read_user", "allowed_domains": []string{"@Example.com", "example.com"},
+		}, true, http.StatusCreated},
+		{"SAML with invalid metadata", map[string]interface{}{
+			"provider": "company", "auth_type": "SAML", "client_id": "quillium",
+			"redirect_url": "https://quillium.example.com/api/auth/sso/saml/acs",
+			"idp_metadata": "<html/>",
+		}, true, http.StatusBadRequest},
+		{"OAuth2 without endpoints", map[string]interface{}{
+			"provider": "company", "auth_type": "OAuth2", "client_id": "quillium",
+			"redirect_url": "https://quillium.example.com/api/auth/sso/callback",
+		}, true, http.StatusBadRequest},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			testDB := setupTestDB(t)
+			handlers.InitHandlers(testDB)
+
+			rr := createSsoProviderRequest(t, tc.body, tc.isAdmin)
+			if rr.Code != tc.expectedStatus {
+				t.Fatalf("Expected status %d, got %d: %s", tc.expectedStatus, rr.Code, rr.Body.String())
+			}
+			if tc.expectedStatus != http.StatusCreated {
+				return
+			}
+
+			// The secret is never returned and is stored encrypted
+			if strings.Contains(rr.Body.String(), "super-secret") {
+				t.Errorf("Response contains the client secret: %s", rr.Body.String())
+			}
+			var response handlers.SsoProviderResponse
+			if err := json.Unmarshal(rr.Body.Bytes(), &response); err != nil {
+				t.Fatalf("Failed to parse response: %v", err)
+			}
+			if !response.ClientSecretSet || response.Provider != "company" {
+				t.Errorf("Unexpected response: %+v", response)
+			}
+			if response.AuthType == "OAuth2" && (len(response.AllowedDomains) != 1 || response.AllowedDomains[0] != "example.com") {
+				t.Errorf("Expected normalized allowed domains, got %v", response.AllowedDomains)
+			}
+
+			stored, err := testDB.GetSsoProvider(context.Background(), "company")
+			if err != nil {
+				t.Fatalf("Failed to get SSO provider: %v", err)
+			}
+			if stored.ClientSecret == "super-secret" {
+				t.Error("Expected the client secret to be stored encrypted")
+			}
+			decrypted, err := security.DecryptPassword(stored.ClientSecret)
+			if err != nil || *decrypted != "super-secret" {
+				t.Errorf("Expected the stored secret to decrypt, got %v", err)
+			}
+
+			// Provider names are unique
+			if rr := createSsoProviderRequest(t, tc.body, true); rr.Code != http.StatusConflict {
+				t.Errorf("Expected status %d for a duplicate, got %d", http.StatusConflict, rr.Code)
+			}
+		})
+	}
+}
+
+func TestListAndUpdateSsoProviders(t *testing.T) {
+	if !testutils.ShouldRunTests(t) {
+		return
+	}
+	testDB := setupTestDB(t)
+	handlers.InitHandlers(testDB)
+
+	if rr := createSsoProviderRequest(t, validSsoProviderBody("company"), true); rr.Code != http.StatusCreated {
+		t.Fatalf("Failed to create SSO provider: %s", rr.Body.String())
+	}
+	before, _ := testDB.GetSsoProvider(context.Background(), "company")
+
+	// Without a client secret the stored one is kept
+	body, _ := json.Marshal(map[string]interface{}{"id": *before.ID, "client_id": "renamed-client"})
+	req := httptest.NewRequest(http.MethodPost, "/api/admin/sso/update", bytes.NewBuffer(body))
+	req = req.WithContext(setupSsoAdminContext(true))
+	rr := httptest.NewRecorder()
+	handlers.UpdateSsoProvider(rr, req)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d: %s", http.StatusOK, rr.Code, rr.Body.String())
+	}
+	after, _ := testDB.GetSsoProvider(context.Background(), "company")
+	if after.ClientID != "renamed-client" || after.ClientSecret != before.ClientSecret {
+		t.Errorf("Unexpected provider after update: %+v", after)
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "/api/admin/sso", nil)
+	req = req.WithContext(setupSsoAdminContext(true))
+	rr = httptest.NewRecorder()
+	handlers.ListSsoProviders(rr, req)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d", http.StatusOK, rr.Code)
+	}
+	if strings.Contains(rr.Body.String(), "client_secret\"") || strings.Contains(rr.Body.String(), after.ClientSecret) {
+		t.Errorf("Response contains the client secret: %s", rr.Body.String())
+	}
+	var providers []handlers.SsoProviderResponse
+	if err := json.Unmarshal(rr.Body.Bytes(), &providers); err != nil || len(providers) != 1 || providers[0].ClientID != "renamed-client" {
+		t.Errorf("Unexpected providers: %+v, %v", providers, err)
+	}
+
+	// Updating a missing provider
+	body, _ = json.Marshal(map[string]interface{}{"id": 999, "client_id": "missing"})
+	req = httptest.NewRequest(http.MethodPost, "/api/admin/sso/update", bytes.NewBuffer(body))
+	req = req.WithContext(setupSsoAdminContext(true))
+	rr = httptest.NewRecorder()
+	handlers.UpdateSsoProvider(rr, req)
+	if rr.Code != http.StatusNotFound {
+		t.Errorf("Expected status %d, got %d", http.StatusNotFound, rr.Code)
+	}
+}
+
+func TestDeleteSsoProvider(t *testing.T) {
+	if !testutils.ShouldRunTests(t) {
+		return
+	}
+	testDB := setupTestDB(t)
+	handlers.InitHandlers(testDB)
+
+	providerIDs := map[string]int{}
+	for _, name := range []string{"old", "new", "unused"} {
+		if rr := createSsoProviderRequest(t, validSsoProviderBody(name), true); rr.Code != http.StatusCreated {
+			t.Fatalf("Failed to create SSO provider: %s", rr.Body.String())
+		}
+		provider, _ := testDB.GetSsoProvider(context.Background(), name)
+		providerIDs[name] = *provider.ID
+	}
+	userID, err := testDB.CreateSsoUser(context.Background(), "sso@example.com", "subject", providerIDs["old"])
+	if err != nil {
+		t.Fatalf("Failed to create SSO user: %v", err)
+	}
+
+	deleteProvider := func(query string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodDelete, "/api/admin/sso/delete?"+query, nil)
+		req = req.WithContext(setupSsoAdminContext(true))
+		rr := httptest.NewRecorder()
+		handlers.DeleteSsoProvider(rr, req)
+		return rr
+	}
+
+	// A provider with users is not deleted with them
+	if rr := deleteProvider("id=" + strconv.Itoa(providerIDs["old"])); rr.Code != http.StatusConflict {
+		t.Fatalf("Expected status %d, got %d: %s", http.StatusConflict, rr.Code, rr.Body.String())
+	}
+	if rr := deleteProvider("id=" + strconv.Itoa(providerIDs["old"]) + "&migrate_to=" + strconv.Itoa(providerIDs["old"])); rr.Code != http.StatusBadRequest {
+		t.Errorf("Expected status %d for a migration to itself, got %d", http.StatusBadRequest, rr.Code)
+	}
+
+	rr := deleteProvider("id=" + strconv.Itoa(providerIDs["old"]) + "&migrate_to=" + strconv.Itoa(providerIDs["new"]))
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d: %s", http.StatusOK, rr.Code, rr.Body.String())
+	}
+	migrated, err := testDB.GetUser(context.Background(), nil, userID)
+	if err != nil || *migrated.SsoProviderID != providerIDs["new"] || *migrated.SsoUserID != "" {
+		t.Errorf("Expected the user to be migrated, got %+v, %v", migrated, err)
+	}
+	if _, err := testDB.GetSsoProviderByID(context.Background(), providerIDs["old"]); err != db.ErrSsoProviderNotFound {
+		t.Errorf("Expected the provider to be deleted, got %v", err)
+	}
+
+	// Providers without users are deleted directly
+	if rr := deleteProvider("id=" + strconv.Itoa(providerIDs["unused"])); rr.Code != http.StatusOK {
+		t.Errorf("Expected status %d, got %d", http.StatusOK, rr.Code)
+	}
+	if rr := deleteProvider("id=999"); rr.Code != http.StatusNotFound {
+		t.Errorf("Expected status %d, got %d", http.StatusNotFound, rr.Code)
+	}
+}
@@ -0,0 +1,92 @@
+package handlers
+
+import (
+	"crypto/subtle"
+	"errors"
+	"log"
+	"net/http"
+
+	"gitlab.cherkaoui.ch/quillium-ai/quillium/src/backend/internal/db"
+	"gitlab.cherkaoui.ch/quillium-ai/quillium/src/backend/internal/sso"
+)
+
+// SsoSamlMetadata returns the service provider metadata of a SAML provider,
+// to be imported at the identity provider
+func SsoSamlMetadata(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	provider, err := dbConn.GetSsoProvider(r.Context(), r.URL.Query().Get("provider"))
+	if err != nil || provider.AuthType != "SAML" {
+		if err != nil && !errors.Is(err, db.ErrSsoProviderNotFound) {
+			log.Printf("Failed to get SSO provider: %v", err)
+		}
+		http.Error(w, "Unknown SAML provider", http.StatusNotFound)
+		return
+	}
+
+	serviceProvider, err := sso.NewSAMLServiceProvider(provider)
+	if err != nil {
+		log.Printf("Failed to set up SSO provider %s: %v", provider.Provider, err)
+		http.Error(w, "SAML provider is unavailable", http.StatusInternalServerError)
+		return
+	}
+	metadata, err := serviceProvider.Metadata()
+	if err != nil {
+		log.Printf("Failed to create SAML metadata for %s: %v", provider.Provider, err)
+		http.Error(w, "Failed to create SAML metadata", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/samlmetadata+xml")
+	w.Write(metadata)
+}
+
+// SsoSamlAcs is the assertion consumer service, it completes a SAML login
+// from a response posted by the identity provider. Only responses to a login
+// started with SsoLogin are accepted.
+func SsoSamlAcs(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	state, err := readSsoState(w, r)
+	if err != nil {
+		log.Printf("Rejected SAML response: %v", err)
+		redirectSsoError(w, r, "SSO login expired, please try again")
+		return
+	}
+	if err := r.ParseForm(); err != nil {
+		redirectSsoError(w, r, "SSO login failed")
+		return
+	}
+	if subtle.ConstantTimeCompare([]byte(r.PostForm.Get("RelayState")), []byte(state.State)) != 1 {
+		redirectSsoError(w, r, "SSO login expired, please try again")
+		return
+	}
+
+	provider, err := dbConn.GetSsoProvider(r.Context(), state.Provider)
+	if err != nil {
+		log.Printf("Failed to get SSO provider %s: %v", state.Provider, err)
+		redirectSsoError(w, r, "Unknown SSO provider")
+		return
+	}
+	serviceProvider, err := sso.NewSAMLServiceProvider(provider)
+	if err != nil {
+		log.Printf("Failed to set up SSO provider %s: %v", provider.Provider, err)
+		redirectSsoError(w, r, "SSO provider is unavailable")
+		return
+	}
+
+	identity, err := serviceProvider.ParseResponse(r.PostForm.Get("SAMLResponse"), state.RequestID)
+	if err != nil {
+		log.Printf("SAML login with %s failed: %v", provider.Provider, err)
+		redirectSsoError(w, r, "SSO login failed")
+		return
+	}
+
+	completeSsoLogin(w, r, provider, identity, state)
+}
@@ -0,0 +1,224 @@
+package handlers_test
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/xml"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/crewjam/saml"
+	"gitlab.cherkaoui.ch/quillium-ai/quillium/src/backend/internal/api/restapi/handlers"
+	"gitlab.cherkaoui.ch/quillium-ai/quillium/src/backend/internal/api/restapi/handlers/testutils"
+	"gitlab.cherkaoui.ch/quillium-ai/quillium/src/backend/internal/api/restapi/middleware"
+	"gitlab.cherkaoui.ch/quillium-ai/quillium/src/backend/internal/db"
+	"gitlab.cherkaoui.ch/quillium-ai/quillium/src/backend/internal/initialization"
+	"gitlab.cherkaoui.ch/quillium-ai/quillium/src/backend/internal/sso"
+)
+
+const samlAcsURL = "http://localhost:8080/api/auth/sso/saml/acs"
+
+// setupSAMLProvider creates a store with a SAML provider trusting a mock
+// identity provider, which trusts the provider's service provider metadata
+func setupSAMLProvider(t *testing.T) (db.Store, *testutils.MockSAMLIdP) {
+	testDB := setupTestDB(t)
+	handlers.InitHandlers(testDB)
+	middleware.InitAuth([]byte("test-secret"), testDB)
+	if err := initialization.InitializeAdminSettings(context.Background(), testDB); err != nil {
+		t.Fatalf("Failed to initialize admin settings: %v", err)
+	}
+
+	idp := testutils.NewMockSAMLIdP(t, "https://idp.example.com/saml")
+	idp.NameID = "saml-subject"
+	idp.Attributes["email"] = []string{"saml@example.com"}
+	idp.Attributes["username"] = []string{"samluser"}
+	idp.Attributes["groups"] = []string{"staff", "quillium-admins"}
+
+	_, err := testDB.CreateSsoProvider(context.Background(), &sso.SsoProvider{
+		ClientID:    "quillium",
+		Provider:    "corp",
+		RedirectURL: samlAcsURL,
+		AuthType:    "SAML",
+		IdPMetadata: idp.Metadata(t),
+		AdminField:  "groups",
+		AdminValue:  "quillium-admins",
+	})
+	if err != nil {
+		t.Fatalf("Failed to create SSO provider: %v", err)
+	}
+
+	rr := getSamlMetadata("corp")
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Failed to get service provider metadata: %d %s", rr.Code, rr.Body.String())
+	}
+	idp.RegisterServiceProvider(t, rr.Body.Bytes())
+	return testDB, idp
+}
+
+func getSamlMetadata(provider string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodGet, "/api/auth/sso/saml/metadata?provider="+provider, nil)
+	rr := httptest.NewRecorder()
+	handlers.SsoSamlMetadata(rr, req)
+	return rr
+}
+
+// runSamlLogin goes through the login redirect, the mock identity provider and
+// the assertion consumer service. tamper may change the posted form.
+func runSamlLogin(t *testing.T, idp *testutils.MockSAMLIdP, query string, tamper func(authURL string, form url.Values)) *httptest.ResponseRecorder {
+	t.Helper()
+
+	req := httptest.NewRequest(http.MethodGet, "/api/auth/sso/login?"+query, nil)
+	rr := httptest.NewRecorder()
+	handlers.SsoLogin(rr, req)
+	if rr.Code != http.StatusFound || !strings.HasPrefix(rr.Header().Get("Location"), "https://idp.example.com/saml/sso?") {
+		t.Fatalf("Expected a redirect to the identity provider, got %d %q", rr.Code, rr.Header().Get("Location"))
+	}
+	stateCookie := responseCookie(rr, "sso_state")
+	if stateCookie == nil {
+		t.Fatal("Expected an sso_state cookie")
+	}
+
+	authURL := rr.Header().Get("Location")
+	form := idp.Respond(t, authURL)
+	if tamper != nil {
+		tamper(authURL, form)
+	}
+
+	req = httptest.NewRequest(http.MethodPost, "/api/auth/sso/saml/acs", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.AddCookie(stateCookie)
+	rr = httptest.NewRecorder()
+	handlers.SsoSamlAcs(rr, req)
+	return rr
+}
+
+func TestSsoSamlMetadata(t *testing.T) {
+	if !testutils.ShouldRunTests(t) {
+		return
+	}
+	setupSAMLProvider(t)
+
+	rr := getSamlMetadata("corp")
+	if rr.Header().Get("Content-Type") != "application/samlmetadata+xml" {
+		t.Errorf("Unexpected content type %q", rr.Header().Get("Content-Type"))
+	}
+	var metadata saml.EntityDescriptor
+	if err := xml.Unmarshal(rr.Body.Bytes(), &metadata); err != nil {
+		t.Fatalf("Failed to parse metadata: %v", err)
+	}
+	if metadata.EntityID != "quillium" || len(metadata.SPSSODescriptors) != 1 {
+		t.Fatalf("Unexpected metadata: %s", rr.Body.String())
+	}
+	services := metadata.SPSSODescriptors[0].AssertionConsumerServices
+	if len(services) != 1 || services[0].Binding != saml.HTTPPostBinding || services[0].Location != samlAcsURL {
+		t.Errorf("Expected a single HTTP-POST assertion consumer service, got %+v", services)
+	}
+
+	if rr := getSamlMetadata("unknown"); rr.Code != http.StatusNotFound {
+		t.Errorf("Expected status %d for an unknown provider, got %d", http.StatusNotFound, rr.Code)
+	}
+}
+
+func TestSsoSamlLoginCreatesUser(t *testing.T) {
+	if !testutils.ShouldRunTests(t) {
+		return
+	}
+	testDB, idp := setupSAMLProvider(t)
+
+	rr := runSamlLogin(t, idp, "provider=corp&remember_me=true", nil)
+	if rr.Code != http.StatusFound || rr.Header().Get("Location") != "/" {
+		t.Fatalf("Expected a redirect to the frontend, got %d %q", rr.Code, rr.Header().Get("Location"))
+	}
+	if responseCookie(rr, "auth_token") == nil || responseCookie(rr, "refresh_token") == nil {
+		t.Error("Expected auth_token and refresh_token cookies")
+	}
+
+	email := "saml@example.com"
+	created, err := testDB.GetUser(context.Background(), &email, nil)
+	if err != nil {
+		t.Fatalf("Expected the user to be created: %v", err)
+	}
+	if !created.IsSso || created.SsoUserID == nil || *created.SsoUserID != "saml-subject" || created.Username != "samluser" {
+		t.Errorf("Unexpected SSO user: %+v", created)
+	}
+	if !created.IsAdmin {
+		t.Error("Expected the admin group to grant the admin role")
+	}
+
+	// The admin role follows the groups on every login
+	idp.Attributes["groups"] = []string{"staff"}
+	rr = runSamlLogin(t, idp, "provider=corp", nil)
+	if responseCookie(rr, "auth_token") == nil {
+		t.Fatalf("Expected a second login to succeed, got %q", rr.Header().Get("Location"))
+	}
+	updated, _ := testDB.GetUser(context.Background(), nil, created.ID)
+	if updated.IsAdmin {
+		t.Error("Expected the admin role to be removed")
+	}
+	if users, _ := testDB.GetUsers(context.Background()); len(users) != 1 {
+		t.Errorf("Expected 1 user, got %d", len(users))
+	}
+}
+
+func TestSsoSamlAcsRejectsInvalidResponses(t *testing.T) {
+	if !testutils.ShouldRunTests(t) {
+		return
+	}
+
+	tests := []struct {
+		name   string
+		tamper func(t *testing.T, authURL string, form url.Values)
+	}{
+		{"relay state mismatch", func(t *testing.T, authURL string, form url.Values) {
+			form.Set("RelayState", "forged")
+		}},
+		{"modified assertion", func(t *testing.T, authURL string, form url.Values) {
+			decoded, _ := base64.StdEncoding.DecodeString(form.Get("SAMLResponse"))
+			modified := strings.ReplaceAll(string(decoded), "saml@example.com", "admin@example.com")
+			form.Set("SAMLResponse", base64.StdEncoding.EncodeToString([]byte(modified)))
+		}},
+		{"untrusted signature", func(t *testing.T, authURL string, form url.Values) {
+			// Another identity provider using the same entity ID answers
+			impostor := testutils.NewMockSAMLIdP(t, "https://idp.example.com/saml")
+			impostor.NameID = "saml-subject"
+			impostor.Attributes["email"] = []string{"saml@example.com"}
+			impostor.RegisterServiceProvider(t, getSamlMetadata("corp").Body.Bytes())
+			form.Set("SAMLResponse", impostor.Respond(t, authURL).Get("SAMLResponse"))
+		}},
+		{"missing response", func(t *testing.T, authURL string, form url.Values) {
+			form.Del("SAMLResponse")
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			testDB, idp := setupSAMLProvider(t)
+
+			rr := runSamlLogin(t, idp, "provider=corp", func(authURL string, form url.Values) { tt.tamper(t, authURL, form) })
+			if rr.Code != http.StatusFound || !strings.HasPrefix(rr.Header().Get("Location"), "/signin?error=") {
+				t.Errorf("Expected a redirect to the sign in page, got %d %q", rr.Code, rr.Header().Get("Location"))
+			}
+			if responseCookie(rr, "auth_token") != nil {
+				t.Error("Expected no auth_token cookie")
+			}
+			if users, _ := testDB.GetUsers(context.Background()); len(users) != 0 {
+				t.Errorf("Expected no user to be created, got %d", len(users))
+			}
+		})
+	}
+
+	// A response without a login started by the browser is rejected
+	setupSAMLProvider(t)
+	req := httptest.NewRequest(http.MethodPost, "/api/auth/sso/saml/acs", strings.NewReader(url.Values{
+		"SAMLResponse": {base64.StdEncoding.EncodeToString([]byte("<Response/>"))},
+	}.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	rr := httptest.NewRecorder()
+	handlers.SsoSamlAcs(rr, req)
+	if !strings.HasPrefix(rr.Header().Get("Location"), "/signin?error=") {
+		t.Errorf("Expected a redirect to the sign in page, got %q", rr.Header().Get("Location"))
+	}
+}
@@ -0,0 +1,617 @@
+package handlers_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"gitlab.cherkaoui.ch/quillium-ai/quillium/src/backend/internal/api/restapi/handlers"
+	"gitlab.cherkaoui.ch/quillium-ai/quillium/src/backend/internal/api/restapi/handlers/testutils"
+	"gitlab.cherkaoui.ch/quillium-ai/quillium/src/backend/internal/api/restapi/middleware"
+	"gitlab.cherkaoui.ch/quillium-ai/quillium/src/backend/internal/db"
+	"gitlab.cherkaoui.ch/quillium-ai/quillium/src/backend/internal/initialization"
+	"gitlab.cherkaoui.ch/quillium-ai/quillium/src/backend/internal/security"
+	"gitlab.cherkaoui.ch/quillium-ai/quillium/src/backend/internal/sso"
+	"gitlab.cherkaoui.ch/quillium-ai/quillium/src/backend/internal/user"
+)
+
+// setupOIDCProvider creates a store with an OIDC provider backed by a mock issuer
+func setupOIDCProvider(t *testing.T) (db.Store, *testutils.MockOIDCIssuer) {
+	testDB := setupTestDB(t)
+	handlers.InitHandlers(testDB)
+	middleware.InitAuth([]byte("test-secret"), testDB)
+	if err := initialization.InitializeAdminSettings(context.Background(), testDB); err != nil {
+		t.Fatalf("Failed to initialize admin settings: %v", err)
+	}
+
+	issuer := testutils.NewMockOIDCIssuer(t, "quillium", "client-secret")
+	issuer.Subject = "oidc-subject"
+	issuer.Email = "oidc@example.com"
+	issuer.EmailVerified = true
+	issuer.Username = "oidcuser"
+
+	encryptedSecret, err := security.EncryptPassword(issuer.ClientSecret)
+	if err != nil {
+		t.Fatalf("Failed to encrypt client secret: %v", err)
+	}
+	_, err = testDB.CreateSsoProvider(context.Background(), &sso.SsoProvider{
+		ClientID:     issuer.ClientID,
+		ClientSecret: *encryptedSecret,
+		Provider:     "mock",
+		RedirectURL:  "http://localhost:8080/api/auth/sso/callback",
+		AuthType:     "OIDC",
+		IssuerURL:    issuer.URL,
+	})
+	if err != nil {
+		t.Fatalf("Failed to create SSO provider: %v", err)
+	}
+	return testDB, issuer
+}
+
+// runSsoLogin goes through the login redirect, the mock issuer and the callback.
+// tamper may change the callback URL before it is called.
+func runSsoLogin(t *testing.T, query string, tamper func(callback *url.URL)) *httptest.ResponseRecorder {
+	t.Helper()
+
+	req := httptest.NewRequest(http.MethodGet, "/api/auth/sso/login?"+query, nil)
+	rr := httptest.NewRecorder()
+	handlers.SsoLogin(rr, req)
+	if rr.Code != http.StatusFound {
+		t.Fatalf("Expected a redirect to the provider, got %d", rr.Code)
+	}
+	return followSsoLogin(t, rr, rr.Header().Get("Location"), tamper)
+}
+
+// followSsoLogin sends the browser of a started login to authURL at the mock
+// issuer and calls the callback it redirects to with the state cookie
+func followSsoLogin(t *testing.T, started *httptest.ResponseRecorder, authURL string, tamper func(callback *url.URL)) *httptest.ResponseRecorder {
+	t.Helper()
+
+	var stateCookie *http.Cookie
+	for _, cookie := range started.Result().Cookies() {
+		if cookie.Name == "sso_state" {
+			stateCookie = cookie
+		}
+	}
+	if stateCookie == nil {
+		t.Fatal("Expected an sso_state cookie")
+	}
+
+	client := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error {
+		return http.ErrUseLastResponse
+	}}
+	resp, err := client.Get(authURL)
+	if err != nil {
+		t.Fatalf("Failed to call the authorization endpoint: %v", err)
+	}
+	resp.Body.Close()
+	callback, err := url.Parse(resp.Header.Get("Location"))
+	if err != nil || resp.StatusCode != http.StatusFound {
+		t.Fatalf("Expected a redirect to the callback, got %d %q", resp.StatusCode, resp.Header.Get("Location"))
+	}
+	if tamper != nil {
+		tamper(callback)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, callback.String(), nil)
+	req.AddCookie(stateCookie)
+	rr := httptest.NewRecorder()
+	handlers.SsoCallback(rr, req)
+	return rr
+}
+
+func responseCookie(rr *httptest.ResponseRecorder, name string) *http.Cookie {
+	for _, cookie := range rr.Result().Cookies() {
+		if cookie.Name == name && cookie.MaxAge >= 0 {
+			return cookie
+		}
+	}
+	return nil
+}
+
+func TestSsoLoginRedirect(t *testing.T) {
+	if !testutils.ShouldRunTests(t) {
+		return
+	}
+	_, issuer := setupOIDCProvider(t)
+
+	req := httptest.NewRequest(http.MethodGet, "/api/auth/sso/login?provider=mock", nil)
+	rr := httptest.NewRecorder()
+	handlers.SsoLogin(rr, req)
+
+	if rr.Code != http.StatusFound {
+		t.Fatalf("Expected status %d, got %d", http.StatusFound, rr.Code)
+	}
+	location, err := url.Parse(rr.Header().Get("Location"))
+	if err != nil || !strings.HasPrefix(location.String(), issuer.URL+"/authorize") {
+		t.Fatalf("Expected a redirect to the issuer, got %q", rr.Header().Get("Location"))
+	}
+	query := location.Query()
+	for _, param := range []string{"state", "nonce", "code_challenge"} {
+		if query.Get(param) == "" {
+			t.Errorf("Expected the %s parameter to be set", param)
+		}
+	}
+	if query.Get("code_challenge_method") != "S256" {
+		t.Errorf("Expected the S256 code challenge method, got %q", query.Get("code_challenge_method"))
+	}
+	if !strings.Contains(query.Get("scope"), "openid") {
+		t.Errorf("Expected the openid scope, got %q", query.Get("scope"))
+	}
+
+	// Unknown providers are sent back to the sign in page
+	req = httptest.NewRequest(http.MethodGet, "/api/auth/sso/login?provider=unknown", nil)
+	rr = httptest.NewRecorder()
+	handlers.SsoLogin(rr, req)
+	if rr.Code != http.StatusFound || !strings.HasPrefix(rr.Header().Get("Location"), "/signin?error=") {
+		t.Errorf("Expected a redirect to the sign in page, got %d %q", rr.Code, rr.Header().Get("Location"))
+	}
+}
+
+func TestSsoLoginCreatesUser(t *testing.T) {
+	if !testutils.ShouldRunTests(t) {
+		return
+	}
+	testDB, _ := setupOIDCProvider(t)
+
+	rr := runSsoLogin(t, "provider=mock&remember_me=true", nil)
+	if rr.Code != http.StatusFound || rr.Header().Get("Location") != "/" {
+		t.Fatalf("Expected a redirect to the frontend, got %d %q", rr.Code, rr.Header().Get("Location"))
+	}
+	if responseCookie(rr, "auth_token") == nil || responseCookie(rr, "refresh_token") == nil {
+		t.Error("Expected auth_token and refresh_token cookies")
+	}
+
+	email := "oidc@example.com"
+	created, err := testDB.GetUser(context.Background(), &email, nil)
+	if err != nil {
+		t.Fatalf("Expected the user to be created: %v", err)
+	}
+	if !created.IsSso || created.SsoUserID == nil || *created.SsoUserID != "oidc-subject" || created.Username != "oidcuser" {
+		t.Errorf("Unexpected SSO user: %+v", created)
+	}
+
+	// Signing in again finds the same user
+	rr = runSsoLogin(t, "provider=mock", nil)
+	if responseCookie(rr, "auth_token") == nil {
+		t.Fatalf("Expected a second login to succeed, got %q", rr.Header().Get("Location"))
+	}
+	if responseCookie(rr, "refresh_token") != nil {
+		t.Error("Expected no refresh token without remember_me")
+	}
+	users, _ := testDB.GetUsers(context.Background())
+	if len(users) != 1 {
+		t.Errorf("Expected 1 user, got %d", len(users))
+	}
+}
+
+func TestSsoLoginRefusesPasswordAccounts(t *testing.T) {
+	if !testutils.ShouldRunTests(t) {
+		return
+	}
+
+	// Even a verified email does not prove the SSO user owns the password account
+	for _, emailVerified := range []bool{true, false} {
+		testDB, issuer := setupOIDCProvider(t)
+		issuer.EmailVerified = emailVerified
+
+		passwordHash := "hashedpassword"
+		userID, err := testDB.CreateUser(context.Background(), &user.User{
+			Email:        "oidc@example.com",
+			Username:     "existing",
+			PasswordHash: &passwordHash,
+			IsAdmin:      true,
+		})
+		if err != nil {
+			t.Fatalf("Failed to create user: %v", err)
+		}
+
+		rr := runSsoLogin(t, "provider=mock", nil)
+		if responseCookie(rr, "auth_token") != nil || !strings.HasPrefix(rr.Header().Get("Location"), "/signin?error=") {
+			t.Fatalf("Expected the login to be rejected, got %q", rr.Header().Get("Location"))
+		}
+		existing, err := testDB.GetUser(context.Background(), nil, userID)
+		if err != nil {
+			t.Fatalf("Failed to get user: %v", err)
+		}
+		if existing.IsSso {
+			t.Errorf("Expected the user not to be linked, got %+v", existing)
+		}
+	}
+}
+
+// startSsoLink calls SsoLink as the signed in user
+func startSsoLink(userID int) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPost, "/api/auth/sso/link?provider=mock", nil)
+	req = req.WithContext(context.WithValue(req.Context(), middleware.UserIDKey(), userID))
+	rr := httptest.NewRecorder()
+	handlers.SsoLink(rr, req)
+	return rr
+}
+
+func TestSsoLinkLinksSignedInUser(t *testing.T) {
+	if !testutils.ShouldRunTests(t) {
+		return
+	}
+	testDB, _ := setupOIDCProvider(t)
+	ctx := context.Background()
+
+	passwordHash := "hashedpassword"
+	userID, err := testDB.CreateUser(ctx, &user.User{
+		Email:        "other@example.com",
+		Username:     "existing",
+		PasswordHash: &passwordHash,
+		IsAdmin:      true,
+	})
+	if err != nil {
+		t.Fatalf("Failed to create user: %v", err)
+	}
+
+	started := startSsoLink(*userID)
+	if started.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d: %s", http.StatusOK, started.Code, started.Body.String())
+	}
+	var response handlers.SsoLinkResponse
+	json.NewDecoder(started.Body).Decode(&response)
+
+	rr := followSsoLogin(t, started, response.URL, nil)
+	if location := rr.Header().Get("Location"); location != "/settings?sso_linked=mock" {
+		t.Fatalf("Expected a redirect to the settings, got %q", location)
+	}
+	if responseCookie(rr, "auth_token") != nil {
+		t.Error("Expected linking not to start a new session")
+	}
+	linked, err := testDB.GetUser(ctx, nil, userID)
+	if err != nil {
+		t.Fatalf("Failed to get user: %v", err)
+	}
+	if !linked.IsSso || linked.SsoUserID == nil || *linked.SsoUserID != "oidc-subject" {
+		t.Errorf("Expected the user to be linked, got %+v", linked)
+	}
+	if !linked.IsAdmin || linked.Username != "existing" {
+		t.Errorf("Expected the account to be kept, got %+v", linked)
+	}
+
+	// The SSO login now signs in to the linked account
+	rr = runSsoLogin(t, "provider=mock", nil)
+	if responseCookie(rr, "auth_token") == nil {
+		t.Fatalf("Expected the login to succeed, got %q", rr.Header().Get("Location"))
+	}
+	if rr := startSsoLink(*userID); rr.Code != http.StatusBadRequest {
+		t.Errorf("Expected an SSO user to be refused with %d, got %d", http.StatusBadRequest, rr.Code)
+	}
+}
+
+func TestSsoLinkRefusesTwoFactorUsers(t *testing.T) {
+	if !testutils.ShouldRunTests(t) {
+		return
+	}
+	testDB, _ := setupOIDCProvider(t)
+	ctx := context.Background()
+
+	passwordHash := "hashedpassword"
+	userID, err := testDB.CreateUser(ctx, &user.User{
+		Email:        "other@example.com",
+		PasswordHash: &passwordHash,
+		IsAdmin:      true,
+	})
+	if err != nil {
+		t.Fatalf("Failed to create user: %v", err)
+	}
+
+	// SSO logins never ask for a code, so they must not replace a required second factor
+	adminSettings, _ := testDB.GetAdminSettings(ctx)
+	adminSettings.RequireAdminTwoFactor = true
+	if err := testDB.CreateAdminSettings(ctx, adminSettings); err != nil {
+		t.Fatalf("Failed to update admin settings: %v", err)
+	}
+	if rr := startSsoLink(*userID); rr.Code != http.StatusConflict {
+		t.Errorf("Expected status %d for a required second factor, got %d: %s", http.StatusConflict, rr.Code, rr.Body.String())
+	}
+
+	// Two-factor enabled while at the provider is checked again by the callback
+	adminSettings.RequireAdminTwoFactor = false
+	if err := testDB.CreateAdminSettings(ctx, adminSettings); err != nil {
+		t.Fatalf("Failed to update admin settings: %v", err)
+	}
+	started := startSsoLink(*userID)
+	if started.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d: %s", http.StatusOK, started.Code, started.Body.String())
+	}
+	var response handlers.SsoLinkResponse
+	json.NewDecoder(started.Body).Decode(&response)
+	enrollTwoFactor(t, *userID)
+
+	rr := followSsoLogin(t, started, response.URL, nil)
+	if location := rr.Header().Get("Location"); !strings.HasPrefix(location, "/settings?error=") {
+		t.Fatalf("Expected linking to be rejected, got %q", location)
+	}
+	if linked, _ := testDB.GetUser(ctx, nil, userID); linked.IsSso {
+		t.Errorf("Expected the user not to be linked, got %+v", linked)
+	}
+	if rr := startSsoLink(*userID); rr.Code != http.StatusConflict {
+		t.Errorf("Expected status %d with two-factor enabled, got %d: %s", http.StatusConflict, rr.Code, rr.Body.String())
+	}
+}
+
+func TestSsoLoginRelinksMigratedUser(t *testing.T) {
+	if !testutils.ShouldRunTests(t) {
+		return
+	}
+
+	for _, emailVerified := range []bool{true, false} {
+		testDB, issuer := setupOIDCProvider(t)
+		issuer.EmailVerified = emailVerified
+		ctx := context.Background()
+
+		// The user signed in through a provider that was deleted, their subject was issued by it
+		oldID, err := testDB.CreateSsoProvider(ctx, &sso.SsoProvider{Provider: "old", AuthType: "OIDC", IssuerURL: issuer.URL})
+		if err != nil {
+			t.Fatalf("Failed to create SSO provider: %v", err)
+		}
+		userID, err := testDB.CreateSsoUser(ctx, "oidc@example.com", "old-subject", *oldID)
+		if err != nil {
+			t.Fatalf("Failed to create SSO user: %v", err)
+		}
+		provider, _ := testDB.GetSsoProvider(ctx, "mock")
+		if err := testDB.DeleteSsoProvider(ctx, *oldID, provider.ID); err != nil {
+			t.Fatalf("Failed to delete SSO provider: %v", err)
+		}
+
+		rr := runSsoLogin(t, "provider=mock", nil)
+		relinked, err := testDB.GetUser(ctx, nil, userID)
+		if err != nil {
+			t.Fatalf("Failed to get user: %v", err)
+		}
+		if emailVerified {
+			if responseCookie(rr, "auth_token") == nil || *relinked.SsoUserID != "oidc-subject" {
+				t.Errorf("Expected the user to be linked to the new provider, got %q, %+v", rr.Header().Get("Location"), relinked)
+			}
+		} else if responseCookie(rr, "auth_token") != nil || *relinked.SsoUserID != "" {
+			t.Errorf("Expected an unverified email not to be linked, got %+v", relinked)
+		}
+	}
+}
+
+func TestSsoCallbackRejectsInvalidRequests(t *testing.T) {
+	if !testutils.ShouldRunTests(t) {
+		return
+	}
+
+	tests := []struct {
+		name   string
+		tamper func(callback *url.URL)
+	}{
+		{"state mismatch", func(callback *url.URL) {
+			query := callback.Query()
+			query.Set("state", "forged")
+			callback.RawQuery = query.Encode()
+		}},
+		{"invalid code", func(callback *url.URL) {
+			query := callback.Query()
+			query.Set("code", "forged")
+			callback.RawQuery = query.Encode()
+		}},
+		{"provider error", func(callback *url.URL) {
+			query := callback.Query()
+			query.Set("error", "access_denied")
+			callback.RawQuery = query.Encode()
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			testDB, _ := setupOIDCProvider(t)
+
+			rr := runSsoLogin(t, "provider=mock", tt.tamper)
+			if rr.Code != http.StatusFound || !strings.HasPrefix(rr.Header().Get("Location"), "/signin?error=") {
+				t.Errorf("Expected a redirect to the sign in page, got %d %q", rr.Code, rr.Header().Get("Location"))
+			}
+			if responseCookie(rr, "auth_token") != nil {
+				t.Error("Expected no auth_token cookie")
+			}
+			if users, _ := testDB.GetUsers(context.Background()); len(users) != 0 {
+				t.Errorf("Expected no user to be created, got %d", len(users))
+			}
+		})
+	}
+
+	// A callback without the state cookie is rejected
+	req := httptest.NewRequest(http.MethodGet, "/api/auth/sso/callback?code=code&state=state", nil)
+	rr := httptest.NewRecorder()
+	handlers.SsoCallback(rr, req)
+	if !strings.HasPrefix(rr.Header().Get("Location"), "/signin?error=") {
+		t.Errorf("Expected a redirect to the sign in page, got %q", rr.Header().Get("Location"))
+	}
+}
+
+// setupOAuth2Provider creates a store with an OAuth2 provider reading the
+// identity from the userinfo endpoint of a mock issuer
+func setupOAuth2Provider(t *testing.T, configure func(provider *sso.SsoProvider)) (db.Store, *testutils.MockOIDCIssuer) {
+	testDB := setupTestDB(t)
+	handlers.InitHandlers(testDB)
+	middleware.InitAuth([]byte("test-secret"), testDB)
+	if err := initialization.InitializeAdminSettings(context.Background(), testDB); err != nil {
+		t.Fatalf("Failed to initialize admin settings: %v", err)
+	}
+
+	issuer := testutils.NewMockOIDCIssuer(t, "quillium", "client-secret")
+	issuer.UserInfo = map[string]interface{}{
+		"id":    12345678901234,
+		"login": "octocat",
+		"profile": map[string]interface{}{
+			"mail": "octocat@example.com",
+		},
+	}
+
+	encryptedSecret, err := security.EncryptPassword(issuer.ClientSecret)
+	if err != nil {
+		t.Fatalf("Failed to encrypt client secret: %v", err)
+	}
+	provider := &sso.SsoProvider{
+		ClientID:      issuer.ClientID,
+		ClientSecret:  *encryptedSecret,
+		Provider:      "mock",
+		RedirectURL:   "http://localhost:8080/api/auth/sso/callback",
+		AuthType:      "OAuth2",
+		AuthURL:       issuer.URL + "/authorize",
+		TokenURL:      issuer.URL + "/token",
+		UserInfoURL:   issuer.URL + "/userinfo",
+		Scopes:        "read_user",
+		EmailField:    "profile.mail",
+		UsernameField: "login",
+	}
+	if configure != nil {
+		configure(provider)
+	}
+	if _, err := testDB.CreateSsoProvider(context.Background(), provider); err != nil {
+		t.Fatalf("Failed to create SSO provider: %v", err)
+	}
+	return testDB, issuer
+}
+
+func TestOAuth2SsoLoginMapsUserInfo(t *testing.T) {
+	if !testutils.ShouldRunTests(t) {
+		return
+	}
+	testDB, issuer := setupOAuth2Provider(t, nil)
+
+	req := httptest.NewRequest(http.MethodGet, "/api/auth/sso/login?provider=mock", nil)
+	rr := httptest.NewRecorder()
+	handlers.SsoLogin(rr, req)
+	location, err := url.Parse(rr.Header().Get("Location"))
+	if err != nil || !strings.HasPrefix(location.String(), issuer.URL+"/authorize") {
+		t.Fatalf("Expected a redirect to the provider, got %q", rr.Header().Get("Location"))
+	}
+	if location.Query().Get("scope") != "read_user" || location.Query().Get("code_challenge") == "" {
+		t.Errorf("Unexpected authorization request: %s", location.RawQuery)
+	}
+
+	rr = runSsoLogin(t, "provider=mock", nil)
+	if responseCookie(rr, "auth_token") == nil {
+		t.Fatalf("Expected the login to succeed, got %q", rr.Header().Get("Location"))
+	}
+
+	email := "octocat@example.com"
+	created, err := testDB.GetUser(context.Background(), &email, nil)
+	if err != nil {
+		t.Fatalf("Expected the user to be created: %v", err)
+	}
+	if created.SsoUserID == nil || *created.SsoUserID != "12345678901234" || created.Username != "octocat" {
+		t.Errorf("Unexpected SSO user: %+v", created)
+	}
+
+	// A userinfo response without the mapped subject is rejected
+	issuer.UserInfo = map[string]interface{}{"login": "octocat", "profile": map[string]interface{}{"mail": email}}
+	rr = runSsoLogin(t, "provider=mock", nil)
+	if responseCookie(rr, "auth_token") != nil {
+		t.Error("Expected a login without a subject to be rejected")
+	}
+}
+
+func TestOAuth2SsoLoginRequiresVerifiedEmail(t *testing.T) {
+	if !testutils.ShouldRunTests(t) {
+		return
+	}
+	ctx := context.Background()
+
+	// Without a verified email field, an existing account is never linked
+	testDB, _ := setupOAuth2Provider(t, nil)
+	passwordHash := "hashedpassword"
+	userID, err := testDB.CreateUser(ctx, &user.User{
+		Email:        "octocat@example.com",
+		Username:     "existing",
+		PasswordHash: &passwordHash,
+		IsAdmin:      true,
+	})
+	if err != nil {
+		t.Fatalf("Failed to create user: %v", err)
+	}
+	rr := runSsoLogin(t, "provider=mock", nil)
+	if responseCookie(rr, "auth_token") != nil || !strings.HasPrefix(rr.Header().Get("Location"), "/signin?error=") {
+		t.Errorf("Expected the login to be rejected, got %q", rr.Header().Get("Location"))
+	}
+	if existing, _ := testDB.GetUser(ctx, nil, userID); existing.IsSso {
+		t.Errorf("Expected the user not to be linked, got %+v", existing)
+	}
+
+	// Users moved from a deleted provider are linked again once the configured field reports the email verified
+	for _, verified := range []bool{false, true} {
+		testDB, issuer := setupOAuth2Provider(t, func(provider *sso.SsoProvider) {
+			provider.EmailVerifiedField = "profile.verified"
+		})
+		issuer.UserInfo["profile"].(map[string]interface{})["verified"] = verified
+
+		oldID, err := testDB.CreateSsoProvider(ctx, &sso.SsoProvider{Provider: "old", AuthType: "OIDC", IssuerURL: issuer.URL})
+		if err != nil {
+			t.Fatalf("Failed to create SSO provider: %v", err)
+		}
+		userID, err := testDB.CreateSsoUser(ctx, "octocat@example.com", "old-subject", *oldID)
+		if err != nil {
+			t.Fatalf("Failed to create SSO user: %v", err)
+		}
+		provider, _ := testDB.GetSsoProvider(ctx, "mock")
+		if err := testDB.DeleteSsoProvider(ctx, *oldID, provider.ID); err != nil {
+			t.Fatalf("Failed to delete SSO provider: %v", err)
+		}
+
+		rr := runSsoLogin(t, "provider=mock", nil)
+		relinked, _ := testDB.GetUser(ctx, nil, userID)
+		if linked := responseCookie(rr, "auth_token") != nil && *relinked.SsoUserID == "12345678901234"; linked != verified {
+			t.Errorf("Expected the user to be linked: %t, got %q, %+v", verified, rr.Header().Get("Location"), relinked)
+		}
+	}
+}
+
+func TestSsoLoginSignUpRestrictions(t *testing.T) {
+	if !testutils.ShouldRunTests(t) {
+		return
+	}
+
+	tests := []struct {
+		name           string
+		allowedDomains []string
+		enableSignUps  bool
+		expectLogin    bool
+	}{
+		{"sign ups enabled", nil, true, true},
+		{"sign ups disabled", nil, false, false},
+		{"allowed domain", []string{"corp.example", "example.com"}, true, true},
+		{"other domain", []string{"corp.example"}, true, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			testDB, _ := setupOAuth2Provider(t, func(provider *sso.SsoProvider) {
+				provider.AllowedDomains = tt.allowedDomains
+			})
+
+			adminSettings, err := testDB.GetAdminSettings(context.Background())
+			if err != nil {
+				t.Fatalf("Failed to get admin settings: %v", err)
+			}
+			adminSettings.EnableSignUps = tt.enableSignUps
+			if err := testDB.CreateAdminSettings(context.Background(), adminSettings); err != nil {
+				t.Fatalf("Failed to save admin settings: %v", err)
+			}
+			rr := runSsoLogin(t, "provider=mock", nil)
+			users, _ := testDB.GetUsers(context.Background())
+			if tt.expectLogin {
+				if responseCookie(rr, "auth_token") == nil || len(users) != 1 {
+					t.Errorf("Expected the login to succeed, got %q with %d users", rr.Header().Get("Location"), len(users))
+				}
+			} else {
+				if responseCookie(rr, "auth_token") != nil || !strings.HasPrefix(rr.Header().Get("Location"), "/signin?error=") {
+					t.Errorf("Expected the login to be rejected, got %q", rr.Header().Get("Location"))
+				}
+				if len(users) != 0 {
+					t.Errorf("Expected no user to be created, got %d", len(users))
+				}
+			}
+		})
+	}
+}
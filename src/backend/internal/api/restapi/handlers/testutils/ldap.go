@@ -0,0 +1,272 @@
+package testutils
+
+import (
+	"io"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+
+	ber "github.com/go-asn1-ber/asn1-ber"
+	"github.com/go-ldap/ldap/v3"
+)
+
+// LDAP protocol operations handled by the mock server
+const (
+	ldapBindRequest      = 0
+	ldapBindResponse     = 1
+	ldapUnbindRequest    = 2
+	ldapSearchRequest    = 3
+	ldapSearchResultItem = 4
+	ldapSearchResultDone = 5
+)
+
+// MockLDAPEntry is a directory entry of the mock LDAP server
+type MockLDAPEntry struct {
+	DN         string
+	Password   string // Users can bind with their DN or userPrincipalName and this password
+	Attributes map[string][]string
+}
+
+// MockLDAPServer is a local LDAP server for testing password logins. It
+// supports simple binds and searches with equality, presence, and, or and not
+// filters over plain TCP. Like most directories, it accepts unauthenticated
+// binds with an empty password.
+type MockLDAPServer struct {
+	URL string
+
+	mu       sync.Mutex
+	entries  []MockLDAPEntry
+	listener net.Listener
+}
+
+// NewMockLDAPServer starts a server with the given entries. It is stopped
+// when the test finishes.
+func NewMockLDAPServer(t *testing.T, entries ...MockLDAPEntry) *MockLDAPServer {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to start mock LDAP server: %v", err)
+	}
+
+	server := &MockLDAPServer{
+		URL:      "ldap://" + listener.Addr().String(),
+		entries:  entries,
+		listener: listener,
+	}
+	go server.serve()
+	t.Cleanup(func() { listener.Close() })
+	return server
+}
+
+// AddEntry adds an entry to the directory
+func (s *MockLDAPServer) AddEntry(entry MockLDAPEntry) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.entries = append(s.entries, entry)
+}
+
+// SetAttribute replaces the values of an attribute of the entry with the given DN
+func (s *MockLDAPServer) SetAttribute(dn, name string, values ...string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i := range s.entries {
+		if strings.EqualFold(s.entries[i].DN, dn) {
+			s.entries[i].Attributes[name] = values
+		}
+	}
+}
+
+func (s *MockLDAPServer) serve() {
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			return
+		}
+		go s.handle(conn)
+	}
+}
+
+// handle answers the requests of a connection until it is unbound or closed
+func (s *MockLDAPServer) handle(conn net.Conn) {
+	defer conn.Close()
+
+	bound := false
+	for {
+		packet, err := ber.ReadPacket(conn)
+		if err != nil || len(packet.Children) < 2 {
+			return
+		}
+		messageID, _ := packet.Children[0].Value.(int64)
+		request := packet.Children[1]
+
+		switch request.Tag {
+		case ldapBindRequest:
+			bound = s.bind(request)
+			resultCode := ldap.LDAPResultSuccess
+			if !bound {
+				resultCode = ldap.LDAPResultInvalidCredentials
+			}
+			writeLDAPResult(conn, messageID, ldapBindResponse, resultCode)
+		case ldapSearchRequest:
+			if !bound {
+				writeLDAPResult(conn, messageID, ldapSearchResultDone, ldap.LDAPResultInsufficientAccessRights)
+				continue
+			}
+			for _, entry := range s.search(request) {
+				writeLDAPMessage(conn, messageID, entry)
+			}
+			writeLDAPResult(conn, messageID, ldapSearchResultDone, ldap.LDAPResultSuccess)
+		case ldapUnbindRequest:
+			return
+		default:
+			writeLDAPResult(conn, messageID, request.Tag+1, ldap.LDAPResultUnwillingToPerform)
+		}
+	}
+}
+
+// bind checks a simple bind request against the entries
+func (s *MockLDAPServer) bind(request *ber.Packet) bool {
+	if len(request.Children) < 3 || request.Children[2].ClassType != ber.ClassContext || request.Children[2].Tag != 0 {
+		return false
+	}
+	name, _ := request.Children[1].Value.(string)
+	password := request.Children[2].Data.String()
+	if password == "" {
+		return true
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, entry := range s.entries {
+		matchesName := strings.EqualFold(entry.DN, name)
+		for _, principal := range entry.Attributes["userPrincipalName"] {
+			matchesName = matchesName || strings.EqualFold(principal, name)
+		}
+		if matchesName && entry.Password == password {
+			return true
+		}
+	}
+	return false
+}
+
+// search returns the result entries of a search request
+func (s *MockLDAPServer) search(request *ber.Packet) []*ber.Packet {
+	if len(request.Children) < 8 {
+		return nil
+	}
+	baseDN, err := ldap.ParseDN(request.Children[0].Value.(string))
+	if err != nil {
+		return nil
+	}
+	filter := request.Children[6]
+	var requested []string
+	for _, attribute := range request.Children[7].Children {
+		if name, ok := attribute.Value.(string); ok {
+			requested = append(requested, name)
+		}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var results []*ber.Packet
+	for _, entry := range s.entries {
+		dn, err := ldap.ParseDN(entry.DN)
+		if err != nil || !(baseDN.EqualFold(dn) || baseDN.AncestorOfFold(dn)) || !matchesLDAPFilter(filter, entry) {
+			continue
+		}
+
+		result := ber.Encode(ber.ClassApplication, ber.TypeConstructed, ldapSearchResultItem, nil, "Search Result Entry")
+		result.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, entry.DN, "DN"))
+		attributes := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSequence, nil, "Attributes")
+		for name, values := range entry.Attributes {
+			if !isRequestedAttribute(requested, name) {
+				continue
+			}
+			attribute := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSequence, nil, "Attribute")
+			attribute.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, name, "Type"))
+			set := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSet, nil, "Values")
+			for _, value := range values {
+				set.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, value, "Value"))
+			}
+			attribute.AppendChild(set)
+			attributes.AppendChild(attribute)
+		}
+		result.AppendChild(attributes)
+		results = append(results, result)
+	}
+	return results
+}
+
+func isRequestedAttribute(requested []string, name string) bool {
+	if len(requested) == 0 {
+		return true
+	}
+	for _, attribute := range requested {
+		if attribute == "*" || strings.EqualFold(attribute, name) {
+			return true
+		}
+	}
+	return false
+}
+
+// matchesLDAPFilter evaluates an encoded filter against an entry, ignoring case
+func matchesLDAPFilter(filter *ber.Packet, entry MockLDAPEntry) bool {
+	switch filter.Tag {
+	case ldap.FilterAnd:
+		for _, child := range filter.Children {
+			if !matchesLDAPFilter(child, entry) {
+				return false
+			}
+		}
+		return true
+	case ldap.FilterOr:
+		for _, child := range filter.Children {
+			if matchesLDAPFilter(child, entry) {
+				return true
+			}
+		}
+		return false
+	case ldap.FilterNot:
+		return len(filter.Children) == 1 && !matchesLDAPFilter(filter.Children[0], entry)
+	case ldap.FilterEqualityMatch:
+		if len(filter.Children) != 2 {
+			return false
+		}
+		name, _ := filter.Children[0].Value.(string)
+		value, _ := filter.Children[1].Value.(string)
+		for _, entryValue := range entryAttribute(entry, name) {
+			if strings.EqualFold(entryValue, value) {
+				return true
+			}
+		}
+		return false
+	case ldap.FilterPresent:
+		return len(entryAttribute(entry, filter.Data.String())) > 0
+	default:
+		return false
+	}
+}
+
+func entryAttribute(entry MockLDAPEntry, name string) []string {
+	for attribute, values := range entry.Attributes {
+		if strings.EqualFold(attribute, name) {
+			return values
+		}
+	}
+	return nil
+}
+
+func writeLDAPResult(w io.Writer, messageID int64, operation ber.Tag, resultCode int) {
+	result := ber.Encode(ber.ClassApplication, ber.TypeConstructed, operation, nil, "Result")
+	result.AppendChild(ber.NewInteger(ber.ClassUniversal, ber.TypePrimitive, ber.TagEnumerated, int64(resultCode), "Result Code"))
+	result.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, "", "Matched DN"))
+	result.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, "", "Diagnostic Message"))
+	writeLDAPMessage(w, messageID, result)
+}
+
+func writeLDAPMessage(w io.Writer, messageID int64, operation *ber.Packet) {
+	message := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSequence, nil, "LDAP Response")
+	message.AppendChild(ber.NewInteger(ber.ClassUniversal, ber.TypePrimitive, ber.TagInteger, messageID, "Message ID"))
+	message.AppendChild(operation)
+	w.Write(message.Bytes())
+}
@@ -0,0 +1,135 @@
+package testutils
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/xml"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/crewjam/saml"
+)
+
+// MockSAMLIdP is a local SAML identity provider for testing login flows. It
+// signs in every authentication request as its configured user and signs the
+// responses with a generated certificate.
+type MockSAMLIdP struct {
+	// The user put in the assertions
+	NameID     string
+	Attributes map[string][]string
+
+	idp        *saml.IdentityProvider
+	spMetadata *saml.EntityDescriptor
+}
+
+// NewMockSAMLIdP creates an identity provider with the given entity ID and a
+// new key pair. The provider is not served, its URLs only need to be unique.
+func NewMockSAMLIdP(t *testing.T, entityID string) *MockSAMLIdP {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("Failed to generate signing key: %v", err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: entityID},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("Failed to create certificate: %v", err)
+	}
+	certificate, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatalf("Failed to parse certificate: %v", err)
+	}
+
+	metadataURL, _ := url.Parse(entityID)
+	ssoURL, _ := url.Parse(entityID + "/sso")
+	mock := &MockSAMLIdP{Attributes: make(map[string][]string)}
+	mock.idp = &saml.IdentityProvider{
+		Key:                     key,
+		Certificate:             certificate,
+		MetadataURL:             *metadataURL,
+		SSOURL:                  *ssoURL,
+		ServiceProviderProvider: mock,
+	}
+	return mock
+}
+
+// Metadata returns the identity provider metadata XML
+func (m *MockSAMLIdP) Metadata(t *testing.T) string {
+	data, err := xml.Marshal(m.idp.Metadata())
+	if err != nil {
+		t.Fatalf("Failed to marshal identity provider metadata: %v", err)
+	}
+	return string(data)
+}
+
+// RegisterServiceProvider trusts the service provider described by the metadata XML
+func (m *MockSAMLIdP) RegisterServiceProvider(t *testing.T, metadata []byte) {
+	var spMetadata saml.EntityDescriptor
+	if err := xml.Unmarshal(metadata, &spMetadata); err != nil {
+		t.Fatalf("Failed to parse service provider metadata: %v", err)
+	}
+	m.spMetadata = &spMetadata
+}
+
+// GetServiceProvider implements saml.ServiceProviderProvider
+func (m *MockSAMLIdP) GetServiceProvider(r *http.Request, serviceProviderID string) (*saml.EntityDescriptor, error) {
+	if m.spMetadata == nil || m.spMetadata.EntityID != serviceProviderID {
+		return nil, os.ErrNotExist
+	}
+	return m.spMetadata, nil
+}
+
+// Respond answers the authentication request in authURL like a browser
+// redirected to the identity provider, and returns the form it would post
+// to the assertion consumer service
+func (m *MockSAMLIdP) Respond(t *testing.T, authURL string) url.Values {
+	t.Helper()
+
+	req, err := saml.NewIdpAuthnRequest(m.idp, httptest.NewRequest(http.MethodGet, authURL, nil))
+	if err != nil {
+		t.Fatalf("Failed to parse authentication request: %v", err)
+	}
+	if err := req.Validate(); err != nil {
+		t.Fatalf("Invalid authentication request: %v", err)
+	}
+
+	session := &saml.Session{
+		ID:           rand.Text(),
+		CreateTime:   time.Now(),
+		ExpireTime:   time.Now().Add(time.Hour),
+		Index:        rand.Text(),
+		NameID:       m.NameID,
+		NameIDFormat: string(saml.PersistentNameIDFormat),
+	}
+	for name, values := range m.Attributes {
+		attribute := saml.Attribute{Name: name, NameFormat: "urn:oasis:names:tc:SAML:2.0:attrname-format:basic"}
+		for _, value := range values {
+			attribute.Values = append(attribute.Values, saml.AttributeValue{Type: "xs:string", Value: value})
+		}
+		session.CustomAttributes = append(session.CustomAttributes, attribute)
+	}
+	if err := (saml.DefaultAssertionMaker{}).MakeAssertion(req, session); err != nil {
+		t.Fatalf("Failed to make assertion: %v", err)
+	}
+
+	form, err := req.PostBinding()
+	if err != nil {
+		t.Fatalf("Failed to make response: %v", err)
+	}
+	return url.Values{
+		"SAMLResponse": {form.SAMLResponse},
+		"RelayState":   {form.RelayState},
+	}
+}
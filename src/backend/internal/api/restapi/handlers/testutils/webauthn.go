@@ -0,0 +1,206 @@
+package testutils
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"testing"
+
+	"github.com/go-webauthn/webauthn/protocol/webauthncbor"
+	"github.com/go-webauthn/webauthn/protocol/webauthncose"
+)
+
+// Authenticator data flags set by the mock authenticator
+const (
+	authenticatorUserPresent  = 0x01
+	authenticatorUserVerified = 0x04
+	authenticatorAttestedData = 0x40
+)
+
+// MockAuthenticator is a software passkey authenticator for testing WebAuthn
+// ceremonies. It creates ES256 discoverable credentials without attestation
+// and answers logins with the most recent credential of the relying party.
+type MockAuthenticator struct {
+	Origin string
+
+	credentials []*mockCredential
+}
+
+type mockCredential struct {
+	id         []byte
+	key        *ecdsa.PrivateKey
+	rpID       string
+	userHandle []byte
+	counter    uint32
+}
+
+// mockCeremonyOptions holds the fields of creation and request options the mock authenticator uses
+type mockCeremonyOptions struct {
+	PublicKey struct {
+		Challenge string `json:"challenge"`
+		RPID      string `json:"rpId"`
+		RP        struct {
+			ID string `json:"id"`
+		} `json:"rp"`
+		User struct {
+			ID string `json:"id"`
+		} `json:"user"`
+	} `json:"publicKey"`
+}
+
+// NewMockAuthenticator creates an authenticator for pages served from origin
+func NewMockAuthenticator(origin string) *MockAuthenticator {
+	return &MockAuthenticator{Origin: origin}
+}
+
+// Clone returns an authenticator with copies of the credentials and their
+// signature counters, like a security key whose keys were extracted
+func (a *MockAuthenticator) Clone() *MockAuthenticator {
+	clone := &MockAuthenticator{Origin: a.Origin}
+	for _, credential := range a.credentials {
+		c := *credential
+		clone.credentials = append(clone.credentials, &c)
+	}
+	return clone
+}
+
+// Register creates a credential for the creation options of a registration
+// and returns the body of the request finishing it
+func (a *MockAuthenticator) Register(t *testing.T, creationOptions []byte) []byte {
+	t.Helper()
+
+	var options mockCeremonyOptions
+	if err := json.Unmarshal(creationOptions, &options); err != nil {
+		t.Fatalf("Failed to parse creation options: %v", err)
+	}
+	userHandle, err := base64.RawURLEncoding.DecodeString(options.PublicKey.User.ID)
+	if err != nil {
+		t.Fatalf("Failed to decode user handle: %v", err)
+	}
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("Failed to generate credential key: %v", err)
+	}
+	credential := &mockCredential{id: make([]byte, 16), key: key, rpID: options.PublicKey.RP.ID, userHandle: userHandle}
+	rand.Read(credential.id)
+
+	publicKey, err := key.PublicKey.ECDH()
+	if err != nil {
+		t.Fatalf("Failed to encode credential key: %v", err)
+	}
+	point := publicKey.Bytes() // 0x04 followed by the coordinates
+	coseKey, err := webauthncbor.Marshal(webauthncose.EC2PublicKeyData{
+		PublicKeyData: webauthncose.PublicKeyData{
+			KeyType:   int64(webauthncose.EllipticKey),
+			Algorithm: int64(webauthncose.AlgES256),
+		},
+		Curve:  int64(webauthncose.P256),
+		XCoord: point[1:33],
+		YCoord: point[33:],
+	})
+	if err != nil {
+		t.Fatalf("Failed to encode COSE key: %v", err)
+	}
+
+	// Attested credential data: an empty AAGUID, the credential ID and its public key
+	attested := make([]byte, 16, 18+len(credential.id)+len(coseKey))
+	attested = binary.BigEndian.AppendUint16(attested, uint16(len(credential.id)))
+	attested = append(append(attested, credential.id...), coseKey...)
+	authData := authenticatorData(credential.rpID, authenticatorUserPresent|authenticatorUserVerified|authenticatorAttestedData, 0, attested)
+
+	attestationObject, err := webauthncbor.Marshal(map[string]any{
+		"fmt":      "none",
+		"attStmt":  map[string]any{},
+		"authData": authData,
+	})
+	if err != nil {
+		t.Fatalf("Failed to encode attestation object: %v", err)
+	}
+
+	a.credentials = append(a.credentials, credential)
+	return mustMarshal(t, map[string]any{
+		"id":    base64.RawURLEncoding.EncodeToString(credential.id),
+		"rawId": base64.RawURLEncoding.EncodeToString(credential.id),
+		"type":  "public-key",
+		"response": map[string]any{
+			"clientDataJSON":    base64.RawURLEncoding.EncodeToString(a.clientData(t, "webauthn.create", options.PublicKey.Challenge)),
+			"attestationObject": base64.RawURLEncoding.EncodeToString(attestationObject),
+			"transports":        []string{"internal"},
+		},
+		"clientExtensionResults": map[string]any{},
+	})
+}
+
+// Login signs the challenge of the request options of a login and returns
+// the body of the request finishing it
+func (a *MockAuthenticator) Login(t *testing.T, requestOptions []byte) []byte {
+	t.Helper()
+
+	var options mockCeremonyOptions
+	if err := json.Unmarshal(requestOptions, &options); err != nil {
+		t.Fatalf("Failed to parse request options: %v", err)
+	}
+	var credential *mockCredential
+	for _, c := range a.credentials {
+		if c.rpID == options.PublicKey.RPID {
+			credential = c
+		}
+	}
+	if credential == nil {
+		t.Fatalf("No credential for relying party %q", options.PublicKey.RPID)
+	}
+
+	credential.counter++
+	authData := authenticatorData(credential.rpID, authenticatorUserPresent|authenticatorUserVerified, credential.counter, nil)
+	clientData := a.clientData(t, "webauthn.get", options.PublicKey.Challenge)
+	clientDataHash := sha256.Sum256(clientData)
+	digest := sha256.Sum256(append(authData, clientDataHash[:]...))
+	signature, err := ecdsa.SignASN1(rand.Reader, credential.key, digest[:])
+	if err != nil {
+		t.Fatalf("Failed to sign assertion: %v", err)
+	}
+
+	return mustMarshal(t, map[string]any{
+		"id":    base64.RawURLEncoding.EncodeToString(credential.id),
+		"rawId": base64.RawURLEncoding.EncodeToString(credential.id),
+		"type":  "public-key",
+		"response": map[string]any{
+			"clientDataJSON":    base64.RawURLEncoding.EncodeToString(clientData),
+			"authenticatorData": base64.RawURLEncoding.EncodeToString(authData),
+			"signature":         base64.RawURLEncoding.EncodeToString(signature),
+			"userHandle":        base64.RawURLEncoding.EncodeToString(credential.userHandle),
+		},
+		"clientExtensionResults": map[string]any{},
+	})
+}
+
+func (a *MockAuthenticator) clientData(t *testing.T, ceremonyType, challenge string) []byte {
+	return mustMarshal(t, map[string]any{
+		"type":        ceremonyType,
+		"challenge":   challenge,
+		"origin":      a.Origin,
+		"crossOrigin": false,
+	})
+}
+
+// authenticatorData encodes the RP ID hash, flags, signature counter and attested credential data
+func authenticatorData(rpID string, flags byte, counter uint32, attested []byte) []byte {
+	rpIDHash := sha256.Sum256([]byte(rpID))
+	data := append(rpIDHash[:], flags)
+	data = binary.BigEndian.AppendUint32(data, counter)
+	return append(data, attested...)
+}
+
+func mustMarshal(t *testing.T, v any) []byte {
+	t.Helper()
+	data, err := json.Marshal(v)
+	if err != nil {
+		t.Fatalf("Failed to encode JSON: %v", err)
+	}
+	return data
+}
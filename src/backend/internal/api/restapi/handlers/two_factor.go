@@ -0,0 +1,609 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"time"
+
+	"gitlab.cherkaoui.ch/quillium-ai/quillium/src/backend/internal/api/restapi/middleware"
+	"gitlab.cherkaoui.ch/quillium-ai/quillium/src/backend/internal/db"
+	"gitlab.cherkaoui.ch/quillium-ai/quillium/src/backend/internal/security"
+	"gitlab.cherkaoui.ch/quillium-ai/quillium/src/backend/internal/twofactor"
+	"gitlab.cherkaoui.ch/quillium-ai/quillium/src/backend/internal/user"
+)
+
+// loginChallengeTTL is how long a user has to enter a code after their password
+const loginChallengeTTL = 5 * time.Minute
+
+var (
+	errInvalidTwoFactorCode = errors.New("invalid two-factor code")
+	errTwoFactorEnabled     = errors.New("two-factor authentication is already enabled")
+	errTwoFactorNotEnabled  = errors.New("two-factor authentication is not enabled")
+)
+
+// loginChallenge is returned encrypted by a password login that needs a
+// second factor, and exchanged for a session together with a code. Setup
+// challenges let admins who must use two-factor authentication enroll
+// before their first session.
+//
+// The nonce is stored with the TOTP enrollment, when the login for code
+// challenges and when the enrollment starts for setup challenges, and is
+// cleared once the challenge is completed. A token only works while its
+// nonce is the stored one, so it cannot be replayed.
+type loginChallenge struct {
+	UserID     int       `json:"user_id"`
+	RememberMe bool      `json:"remember_me"`
+	Setup      bool      `json:"setup,omitempty"`
+	Nonce      string    `json:"nonce"`
+	ExpiresAt  time.Time `json:"expires_at"`
+}
+
+// twoFactorChallenge returns the challenge a password login of the user has
+// to complete, or nil when the password is enough. SSO logins are left to the
+// identity provider and never get here.
+func twoFactorChallenge(ctx context.Context, userData *user.User, rememberMe bool) (*TwoFactorChallengeResponse, error) {
+	nonce, err := security.GenerateRandomString(32)
+	if err != nil {
+		return nil, errors.New("failed to generate login challenge nonce: " + err.Error())
+	}
+	challenge := loginChallenge{
+		UserID:     *userData.ID,
+		RememberMe: rememberMe,
+		Nonce:      nonce,
+		ExpiresAt:  time.Now().Add(loginChallengeTTL),
+	}
+
+	totp, err := dbConn.GetUserTOTP(ctx, *userData.ID)
+	if err != nil && !errors.Is(err, db.ErrTOTPNotFound) {
+		return nil, err
+	}
+	if err != nil || !totp.Enabled {
+		required, err := isTwoFactorRequired(ctx, userData.IsAdmin)
+		if err != nil || !required {
+			return nil, err
+		}
+		challenge.Setup = true
+	} else if err := dbConn.SetUserTOTPChallengeNonce(ctx, *userData.ID, nonce); err != nil {
+		return nil, err
+	}
+
+	challengeJSON, err := json.Marshal(challenge)
+	if err != nil {
+		return nil, errors.New("failed to encode login challenge: " + err.Error())
+	}
+	token, err := security.EncryptPassword(string(challengeJSON))
+	if err != nil {
+		return nil, errors.New("failed to encrypt login challenge: " + err.Error())
+	}
+	return &TwoFactorChallengeResponse{
+		TwoFactorRequired: true,
+		SetupRequired:     challenge.Setup,
+		ChallengeToken:    *token,
+	}, nil
+}
+
+// readLoginChallenge decrypts a challenge token and checks that it has not expired
+func readLoginChallenge(token string) (*loginChallenge, error) {
+	decrypted, err := security.DecryptPassword(token)
+	if err != nil {
+		return nil, errors.New("failed to decrypt login challenge: " + err.Error())
+	}
+	var challenge loginChallenge
+	if err := json.Unmarshal([]byte(*decrypted), &challenge); err != nil {
+		return nil, errors.New("failed to parse login challenge: " + err.Error())
+	}
+	if time.Now().After(challenge.ExpiresAt) {
+		return nil, errors.New("login challenge expired")
+	}
+	return &challenge, nil
+}
+
+// isTwoFactorRequired reports whether the admin settings require admins to use two-factor authentication
+func isTwoFactorRequired(ctx context.Context, isAdmin bool) (bool, error) {
+	if !isAdmin {
+		return false, nil
+	}
+	adminSettings, err := dbConn.GetAdminSettings(ctx)
+	if err != nil {
+		return false, errors.New("failed to get admin settings: " + err.Error())
+	}
+	return adminSettings.RequireAdminTwoFactor, nil
+}
+
+// verifySecondFactor checks a TOTP or recovery code of a user with two-factor
+// authentication enabled. Failed codes are counted, and lock the second
+// factor for a while once there are too many.
+func verifySecondFactor(ctx context.Context, userID int, code string) error {
+	totp, err := dbConn.GetUserTOTP(ctx, userID)
+	if errors.Is(err, db.ErrTOTPNotFound) {
+		return errTwoFactorNotEnabled
+	}
+	if err != nil {
+		return err
+	}
+	if !totp.Enabled {
+		return errTwoFactorNotEnabled
+	}
+	now := time.Now()
+	if twofactor.IsLocked(totp, now) {
+		return twofactor.ErrLocked
+	}
+
+	if twofactor.IsTOTPCode(code) {
+		secret, err := security.DecryptPassword(totp.Secret)
+		if err != nil {
+			return errors.New("failed to decrypt TOTP secret: " + err.Error())
+		}
+		if step, ok := twofactor.ValidateCode(*secret, code, totp.LastUsedStep, now); ok {
+			return dbConn.UpdateUserTOTPAttempts(ctx, userID, step, 0, nil)
+		}
+	} else {
+		used, err := dbConn.UseRecoveryCode(ctx, userID, twofactor.HashRecoveryCode(code))
+		if err != nil {
+			return err
+		}
+		if used {
+			log.Printf("User %d signed in with a recovery code", userID)
+			return dbConn.UpdateUserTOTPAttempts(ctx, userID, totp.LastUsedStep, 0, nil)
+		}
+	}
+
+	// The count starts over once a lockout has expired
+	failedAttempts := totp.FailedAttempts
+	if failedAttempts >= twofactor.MaxFailedAttempts {
+		failedAttempts = 0
+	}
+	if err := dbConn.UpdateUserTOTPAttempts(ctx, userID, totp.LastUsedStep, failedAttempts+1, &now); err != nil {
+		return err
+	}
+	return errInvalidTwoFactorCode
+}
+
+// startTOTPEnrollment stores a new pending secret for the user, replacing any
+// previous pending one. It only takes effect once enableTOTP confirms a code.
+func startTOTPEnrollment(ctx context.Context, userData *user.User) (*TwoFactorSetupResponse, error) {
+	totp, err := dbConn.GetUserTOTP(ctx, *userData.ID)
+	if err == nil && totp.Enabled {
+		return nil, errTwoFactorEnabled
+	}
+	if err != nil && !errors.Is(err, db.ErrTOTPNotFound) {
+		return nil, err
+	}
+
+	secret, provisioningURI, err := twofactor.NewSecret(userData.Email)
+	if err != nil {
+		return nil, err
+	}
+	secretEncrypt, err := security.EncryptPassword(secret)
+	if err != nil {
+		return nil, errors.New("failed to encrypt TOTP secret: " + err.Error())
+	}
+	if err := dbConn.SetUserTOTPSecret(ctx, *userData.ID, *secretEncrypt); err != nil {
+		return nil, err
+	}
+	return &TwoFactorSetupResponse{Secret: secret, ProvisioningURI: provisioningURI}, nil
+}
+
+// enableTOTP enables the pending secret of the user once a code generated
+// from it is valid, and returns the new recovery codes
+func enableTOTP(ctx context.Context, userID int, code string) ([]string, error) {
+	totp, err := dbConn.GetUserTOTP(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if totp.Enabled {
+		return nil, errTwoFactorEnabled
+	}
+
+	secret, err := security.DecryptPassword(totp.Secret)
+	if err != nil {
+		return nil, errors.New("failed to decrypt TOTP secret: " + err.Error())
+	}
+	step, ok := twofactor.ValidateCode(*secret, code, 0, time.Now())
+	if !ok {
+		return nil, errInvalidTwoFactorCode
+	}
+
+	recoveryCodes, err := twofactor.NewRecoveryCodes()
+	if err != nil {
+		return nil, err
+	}
+	if err := dbConn.EnableUserTOTP(ctx, userID, step, twofactor.HashRecoveryCodes(recoveryCodes)); err != nil {
+		return nil, err
+	}
+	log.Printf("Enabled two-factor authentication for user %d", userID)
+	return recoveryCodes, nil
+}
+
+// writeTwoFactorError answers a failed two-factor operation. Invalid codes are
+// answered with invalidCodeStatus, which differs between login and account endpoints.
+func writeTwoFactorError(w http.ResponseWriter, err error, invalidCodeStatus int) {
+	switch {
+	case errors.Is(err, errInvalidTwoFactorCode):
+		w.WriteHeader(invalidCodeStatus)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Invalid code"})
+	case errors.Is(err, twofactor.ErrLocked):
+		w.WriteHeader(http.StatusTooManyRequests)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Too many invalid codes, try again later"})
+	case errors.Is(err, errTwoFactorEnabled):
+		w.WriteHeader(http.StatusConflict)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Two-factor authentication is already enabled"})
+	case errors.Is(err, errTwoFactorNotEnabled):
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Two-factor authentication is not enabled"})
+	case errors.Is(err, db.ErrTOTPNotFound):
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Two-factor setup has not been started"})
+	default:
+		writeTwoFactorInternalError(w, err)
+	}
+}
+
+// writeTwoFactorInternalError answers a two-factor operation that failed on the server side
+func writeTwoFactorInternalError(w http.ResponseWriter, err error) {
+	log.Printf("Two-factor authentication failed: %v", err)
+	w.WriteHeader(http.StatusInternalServerError)
+	json.NewEncoder(w).Encode(map[string]string{"error": "Two-factor authentication failed"})
+}
+
+// LoginTwoFactor completes a password login with a TOTP or recovery code. For
+// setup challenges, the code confirms the enrollment started with
+// LoginTwoFactorSetup and the response contains the recovery codes.
+func LoginTwoFactor(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req TwoFactorLoginRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Invalid request"})
+		return
+	}
+
+	challenge, err := readLoginChallenge(req.ChallengeToken)
+	if err != nil {
+		log.Printf("Invalid login challenge: %v", err)
+		w.WriteHeader(http.StatusUnauthorized)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Login expired, please sign in again"})
+		return
+	}
+	userData, err := dbConn.GetUser(r.Context(), nil, &challenge.UserID)
+	if errors.Is(err, db.ErrUserNotFound) {
+		w.WriteHeader(http.StatusUnauthorized)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Login expired, please sign in again"})
+		return
+	}
+	if err != nil {
+		writeTwoFactorInternalError(w, err)
+		return
+	}
+
+	// Codes are only checked for the current challenge, a replaced or completed
+	// one would otherwise use up a recovery code or count a failed attempt
+	totp, err := dbConn.GetUserTOTP(r.Context(), challenge.UserID)
+	if err != nil && !errors.Is(err, db.ErrTOTPNotFound) {
+		writeTwoFactorInternalError(w, err)
+		return
+	}
+	if err != nil || totp.ChallengeNonce == nil || *totp.ChallengeNonce != challenge.Nonce {
+		log.Printf("Login challenge of user %d was already completed or replaced", challenge.UserID)
+		w.WriteHeader(http.StatusUnauthorized)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Login expired, please sign in again"})
+		return
+	}
+
+	// A mistyped code can be retried with the same challenge, so it is only
+	// consumed once the code is valid
+	var recoveryCodes []string
+	if challenge.Setup {
+		recoveryCodes, err = enableTOTP(r.Context(), challenge.UserID, req.Code)
+	} else {
+		err = verifySecondFactor(r.Context(), challenge.UserID, req.Code)
+	}
+	if err != nil {
+		writeTwoFactorError(w, err, http.StatusUnauthorized)
+		return
+	}
+
+	// Of concurrent requests with the same challenge, only one completes it
+	consumed, err := dbConn.ConsumeUserTOTPChallengeNonce(r.Context(), challenge.UserID, challenge.Nonce)
+	if err != nil {
+		writeTwoFactorInternalError(w, err)
+		return
+	}
+	if !consumed {
+		log.Printf("Login challenge of user %d was already completed or replaced", challenge.UserID)
+		w.WriteHeader(http.StatusUnauthorized)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Login expired, please sign in again"})
+		return
+	}
+
+	writeLoginResponse(w, r, userData, challenge.RememberMe, recoveryCodes)
+}
+
+// LoginTwoFactorSetup starts the enrollment of an admin whose login returned a
+// setup challenge, because the admin settings require two-factor authentication
+func LoginTwoFactorSetup(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req TwoFactorLoginRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Invalid request"})
+		return
+	}
+
+	challenge, err := readLoginChallenge(req.ChallengeToken)
+	if err == nil && !challenge.Setup {
+		err = errors.New("login challenge is not a setup challenge")
+	}
+	if err != nil {
+		log.Printf("Invalid login challenge: %v", err)
+		w.WriteHeader(http.StatusUnauthorized)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Login expired, please sign in again"})
+		return
+	}
+	userData, err := dbConn.GetUser(r.Context(), nil, &challenge.UserID)
+	if errors.Is(err, db.ErrUserNotFound) {
+		w.WriteHeader(http.StatusUnauthorized)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Login expired, please sign in again"})
+		return
+	}
+	if err != nil {
+		writeTwoFactorInternalError(w, err)
+		return
+	}
+
+	// Each setup challenge starts a single enrollment, later calls would
+	// replace the secret the user is adding to their authenticator app
+	totp, err := dbConn.GetUserTOTP(r.Context(), challenge.UserID)
+	if err != nil && !errors.Is(err, db.ErrTOTPNotFound) {
+		writeTwoFactorInternalError(w, err)
+		return
+	}
+	if err == nil && totp.ChallengeNonce != nil && *totp.ChallengeNonce == challenge.Nonce {
+		log.Printf("Setup challenge of user %d already started an enrollment", challenge.UserID)
+		w.WriteHeader(http.StatusUnauthorized)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Login expired, please sign in again"})
+		return
+	}
+
+	response, err := startTOTPEnrollment(r.Context(), userData)
+	if err != nil {
+		writeTwoFactorError(w, err, http.StatusUnauthorized)
+		return
+	}
+	// The new secret cleared the stored nonce, another nonce means a concurrent
+	// request with a newer setup challenge replaced the secret in between
+	claimed, err := dbConn.ClaimUserTOTPChallengeNonce(r.Context(), challenge.UserID, challenge.Nonce)
+	if err != nil {
+		writeTwoFactorInternalError(w, err)
+		return
+	}
+	if !claimed {
+		log.Printf("Setup challenge of user %d was replaced during the enrollment", challenge.UserID)
+		w.WriteHeader(http.StatusUnauthorized)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Login expired, please sign in again"})
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+// currentPasswordUser returns the signed in user for the two-factor endpoints,
+// which only apply to accounts that sign in with a password. The user is nil
+// when the request has been answered.
+func currentPasswordUser(w http.ResponseWriter, r *http.Request) *user.User {
+	return signedInPasswordUser(w, r, "Two-factor authentication is only available for password logins")
+}
+
+// signedInPasswordUser returns the signed in user for endpoints that only apply
+// to accounts that sign in with a password, answering SSO users with ssoError.
+// The user is nil when the request has been answered.
+func signedInPasswordUser(w http.ResponseWriter, r *http.Request, ssoError string) *user.User {
+	userID, ok := middleware.GetUserID(r.Context())
+	if !ok {
+		w.WriteHeader(http.StatusUnauthorized)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Unauthorized"})
+		return nil
+	}
+
+	userData, err := dbConn.GetUser(r.Context(), nil, &userID)
+	if errors.Is(err, db.ErrUserNotFound) {
+		w.WriteHeader(http.StatusNotFound)
+		json.NewEncoder(w).Encode(map[string]string{"error": "User not found"})
+		return nil
+	}
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Failed to retrieve user data: " + err.Error()})
+		return nil
+	}
+	if userData.IsSso {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": ssoError})
+		return nil
+	}
+	return userData
+}
+
+// GetTwoFactorStatus returns whether two-factor authentication is enabled for the current user
+func GetTwoFactorStatus(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	userData := currentPasswordUser(w, r)
+	if userData == nil {
+		return
+	}
+
+	var response TwoFactorStatusResponse
+	totp, err := dbConn.GetUserTOTP(r.Context(), *userData.ID)
+	if err != nil && !errors.Is(err, db.ErrTOTPNotFound) {
+		writeTwoFactorInternalError(w, err)
+		return
+	}
+	if err == nil && totp.Enabled {
+		response.Enabled = true
+		response.RecoveryCodesRemaining, err = dbConn.CountRecoveryCodes(r.Context(), *userData.ID)
+		if err != nil {
+			writeTwoFactorInternalError(w, err)
+			return
+		}
+	}
+	response.Required, err = isTwoFactorRequired(r.Context(), userData.IsAdmin)
+	if err != nil {
+		writeTwoFactorInternalError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+// SetupTwoFactor generates a new secret for the current user, to be added to
+// an authenticator app and confirmed with EnableTwoFactor
+func SetupTwoFactor(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	userData := currentPasswordUser(w, r)
+	if userData == nil {
+		return
+	}
+
+	response, err := startTOTPEnrollment(r.Context(), userData)
+	if err != nil {
+		writeTwoFactorError(w, err, http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+// EnableTwoFactor enables two-factor authentication once a code generated from
+// the new secret is valid. The recovery codes are only returned this once.
+func EnableTwoFactor(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	userData := currentPasswordUser(w, r)
+	if userData == nil {
+		return
+	}
+
+	var req TwoFactorCodeRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Invalid request"})
+		return
+	}
+
+	recoveryCodes, err := enableTOTP(r.Context(), *userData.ID, req.Code)
+	if err != nil {
+		writeTwoFactorError(w, err, http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(RecoveryCodesResponse{RecoveryCodes: recoveryCodes})
+}
+
+// DisableTwoFactor disables two-factor authentication of the current user
+// after checking a code. Admins cannot disable it while it is required.
+func DisableTwoFactor(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	userData := currentPasswordUser(w, r)
+	if userData == nil {
+		return
+	}
+
+	var req TwoFactorCodeRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Invalid request"})
+		return
+	}
+
+	required, err := isTwoFactorRequired(r.Context(), userData.IsAdmin)
+	if err != nil {
+		writeTwoFactorInternalError(w, err)
+		return
+	}
+	if required {
+		w.WriteHeader(http.StatusForbidden)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Two-factor authentication is required for admins"})
+		return
+	}
+
+	if err := verifySecondFactor(r.Context(), *userData.ID, req.Code); err != nil {
+		writeTwoFactorError(w, err, http.StatusBadRequest)
+		return
+	}
+	if err := dbConn.DeleteUserTOTP(r.Context(), *userData.ID); err != nil {
+		writeTwoFactorInternalError(w, err)
+		return
+	}
+	log.Printf("Disabled two-factor authentication for user %d", *userData.ID)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"message": "Two-factor authentication disabled"})
+}
+
+// RegenerateRecoveryCodes replaces the recovery codes of the current user
+// after checking a code
+func RegenerateRecoveryCodes(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	userData := currentPasswordUser(w, r)
+	if userData == nil {
+		return
+	}
+
+	var req TwoFactorCodeRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Invalid request"})
+		return
+	}
+
+	if err := verifySecondFactor(r.Context(), *userData.ID, req.Code); err != nil {
+		writeTwoFactorError(w, err, http.StatusBadRequest)
+		return
+	}
+	recoveryCodes, err := twofactor.NewRecoveryCodes()
+	if err != nil {
+		writeTwoFactorInternalError(w, err)
+		return
+	}
+	if err := dbConn.ReplaceRecoveryCodes(r.Context(), *userData.ID, twofactor.HashRecoveryCodes(recoveryCodes)); err != nil {
+		writeTwoFactorInternalError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(RecoveryCodesResponse{RecoveryCodes: recoveryCodes})
+}
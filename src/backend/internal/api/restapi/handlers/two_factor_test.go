@@ -0,0 +1,308 @@
+package handlers_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/pquerna/otp/totp"
+	"gitlab.cherkaoui.ch/quillium-ai/quillium/src/backend/internal/api/restapi/handlers"
+	"gitlab.cherkaoui.ch/quillium-ai/quillium/src/backend/internal/api/restapi/handlers/testutils"
+	"gitlab.cherkaoui.ch/quillium-ai/quillium/src/backend/internal/api/restapi/middleware"
+	"gitlab.cherkaoui.ch/quillium-ai/quillium/src/backend/internal/db"
+	"gitlab.cherkaoui.ch/quillium-ai/quillium/src/backend/internal/initialization"
+	"gitlab.cherkaoui.ch/quillium-ai/quillium/src/backend/internal/security"
+	"gitlab.cherkaoui.ch/quillium-ai/quillium/src/backend/internal/twofactor"
+	"gitlab.cherkaoui.ch/quillium-ai/quillium/src/backend/internal/user"
+)
+
+const twoFactorPassword = "Password123!"
+
+// setupTwoFactorUser creates a store with a password user
+func setupTwoFactorUser(t *testing.T, isAdmin bool) (db.Store, int) {
+	testDB := setupTestDB(t)
+	handlers.InitHandlers(testDB)
+	middleware.InitAuth([]byte("test-secret"), testDB)
+	if err := initialization.InitializeAdminSettings(context.Background(), testDB); err != nil {
+		t.Fatalf("Failed to initialize admin settings: %v", err)
+	}
+
+	passwordHash, err := security.HashPassword(twoFactorPassword)
+	if err != nil {
+		t.Fatalf("Failed to hash password: %v", err)
+	}
+	userID, err := testDB.CreateUser(context.Background(), &user.User{
+		Email:        "totp@example.com",
+		Username:     "totpuser",
+		PasswordHash: passwordHash,
+		IsAdmin:      isAdmin,
+	})
+	if err != nil {
+		t.Fatalf("Failed to create user: %v", err)
+	}
+	return testDB, *userID
+}
+
+// callTwoFactor calls a handler with a JSON body, as the given user unless userID is 0
+func callTwoFactor(handler http.HandlerFunc, method string, userID int, isAdmin bool, body interface{}) *httptest.ResponseRecorder {
+	payload, _ := json.Marshal(body)
+	req := httptest.NewRequest(method, "/api/user/2fa", bytes.NewBuffer(payload))
+	if userID != 0 {
+		ctx := context.WithValue(req.Context(), middleware.UserIDKey(), userID)
+		req = req.WithContext(context.WithValue(ctx, middleware.IsAdminKey(), isAdmin))
+	}
+	rr := httptest.NewRecorder()
+	handler(rr, req)
+	return rr
+}
+
+// loginChallenge signs in with the password and returns the challenge of the second step
+func loginChallenge(t *testing.T) handlers.TwoFactorChallengeResponse {
+	t.Helper()
+	rr := postLogin("totp@example.com", twoFactorPassword)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d: %s", http.StatusOK, rr.Code, rr.Body.String())
+	}
+	if responseCookie(rr, "auth_token") != nil {
+		t.Fatal("Expected no session before the second factor")
+	}
+	var challenge handlers.TwoFactorChallengeResponse
+	json.NewDecoder(rr.Body).Decode(&challenge)
+	if !challenge.TwoFactorRequired || challenge.ChallengeToken == "" {
+		t.Fatalf("Expected a two-factor challenge, got %+v", challenge)
+	}
+	return challenge
+}
+
+func postSecondFactor(challengeToken, code string) *httptest.ResponseRecorder {
+	return callTwoFactor(handlers.LoginTwoFactor, http.MethodPost, 0, false, handlers.TwoFactorLoginRequest{ChallengeToken: challengeToken, Code: code})
+}
+
+// enrollTwoFactor enables two-factor authentication for the user and returns the secret and recovery codes
+func enrollTwoFactor(t *testing.T, userID int) (string, []string) {
+	t.Helper()
+	rr := callTwoFactor(handlers.SetupTwoFactor, http.MethodPost, userID, false, nil)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d: %s", http.StatusOK, rr.Code, rr.Body.String())
+	}
+	var setup handlers.TwoFactorSetupResponse
+	json.NewDecoder(rr.Body).Decode(&setup)
+
+	code, _ := totp.GenerateCode(setup.Secret, time.Now())
+	rr = callTwoFactor(handlers.EnableTwoFactor, http.MethodPost, userID, false, handlers.TwoFactorCodeRequest{Code: code})
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d: %s", http.StatusOK, rr.Code, rr.Body.String())
+	}
+	var response handlers.RecoveryCodesResponse
+	json.NewDecoder(rr.Body).Decode(&response)
+	return setup.Secret, response.RecoveryCodes
+}
+
+func TestTwoFactorEnrollment(t *testing.T) {
+	if !testutils.ShouldRunTests(t) {
+		return
+	}
+	_, userID := setupTwoFactorUser(t, false)
+
+	// A code of the pending secret is needed to enable it
+	rr := callTwoFactor(handlers.SetupTwoFactor, http.MethodPost, userID, false, nil)
+	var setup handlers.TwoFactorSetupResponse
+	json.NewDecoder(rr.Body).Decode(&setup)
+	if setup.Secret == "" || setup.ProvisioningURI == "" {
+		t.Fatalf("Expected a secret and provisioning URI, got %s", rr.Body.String())
+	}
+	if rr := callTwoFactor(handlers.EnableTwoFactor, http.MethodPost, userID, false, handlers.TwoFactorCodeRequest{Code: "000000"}); rr.Code != http.StatusBadRequest {
+		t.Errorf("Expected status %d for an invalid code, got %d", http.StatusBadRequest, rr.Code)
+	}
+	// A pending secret does not change the login
+	if rr := postLogin("totp@example.com", twoFactorPassword); responseCookie(rr, "auth_token") == nil {
+		t.Errorf("Expected a session before two-factor authentication is enabled, got %s", rr.Body.String())
+	}
+
+	_, recoveryCodes := enrollTwoFactor(t, userID)
+	if len(recoveryCodes) != twofactor.RecoveryCodeCount {
+		t.Errorf("Expected %d recovery codes, got %d", twofactor.RecoveryCodeCount, len(recoveryCodes))
+	}
+	if rr := callTwoFactor(handlers.SetupTwoFactor, http.MethodPost, userID, false, nil); rr.Code != http.StatusConflict {
+		t.Errorf("Expected status %d when already enabled, got %d", http.StatusConflict, rr.Code)
+	}
+
+	rr = callTwoFactor(handlers.GetTwoFactorStatus, http.MethodGet, userID, false, nil)
+	var status handlers.TwoFactorStatusResponse
+	json.NewDecoder(rr.Body).Decode(&status)
+	if !status.Enabled || status.RecoveryCodesRemaining != twofactor.RecoveryCodeCount || status.Required {
+		t.Errorf("Unexpected status: %+v", status)
+	}
+
+	// Disabling needs a valid code
+	if rr := callTwoFactor(handlers.DisableTwoFactor, http.MethodPost, userID, false, handlers.TwoFactorCodeRequest{Code: "wrong-code"}); rr.Code != http.StatusBadRequest {
+		t.Errorf("Expected status %d for an invalid code, got %d", http.StatusBadRequest, rr.Code)
+	}
+	if rr := callTwoFactor(handlers.DisableTwoFactor, http.MethodPost, userID, false, handlers.TwoFactorCodeRequest{Code: recoveryCodes[0]}); rr.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d: %s", http.StatusOK, rr.Code, rr.Body.String())
+	}
+	if rr := postLogin("totp@example.com", twoFactorPassword); responseCookie(rr, "auth_token") == nil {
+		t.Errorf("Expected a session once two-factor authentication is disabled, got %s", rr.Body.String())
+	}
+}
+
+func TestTwoFactorLogin(t *testing.T) {
+	if !testutils.ShouldRunTests(t) {
+		return
+	}
+	testDB, userID := setupTwoFactorUser(t, false)
+	secret, recoveryCodes := enrollTwoFactor(t, userID)
+	challenge := loginChallenge(t)
+
+	// The code used for enabling cannot be used again
+	code, _ := totp.GenerateCode(secret, time.Now())
+	if rr := postSecondFactor(challenge.ChallengeToken, code); rr.Code != http.StatusUnauthorized {
+		t.Errorf("Expected status %d for a used code, got %d", http.StatusUnauthorized, rr.Code)
+	}
+	if rr := postSecondFactor("forged", code); rr.Code != http.StatusUnauthorized {
+		t.Errorf("Expected status %d for a forged challenge, got %d", http.StatusUnauthorized, rr.Code)
+	}
+
+	code, _ = totp.GenerateCode(secret, time.Now().Add(30*time.Second))
+	rr := postSecondFactor(challenge.ChallengeToken, code)
+	if rr.Code != http.StatusOK || responseCookie(rr, "auth_token") == nil {
+		t.Fatalf("Expected a session, got %d: %s", rr.Code, rr.Body.String())
+	}
+	var response handlers.LoginResponse
+	json.NewDecoder(rr.Body).Decode(&response)
+	if response.UserID != userID || response.Token == "" {
+		t.Errorf("Unexpected login response: %+v", response)
+	}
+
+	// A completed challenge cannot be replayed, even with a valid code
+	if rr := postSecondFactor(challenge.ChallengeToken, recoveryCodes[0]); rr.Code != http.StatusUnauthorized {
+		t.Errorf("Expected status %d for a replayed challenge, got %d", http.StatusUnauthorized, rr.Code)
+	}
+	// Nor can a challenge a newer login replaced
+	replaced := loginChallenge(t)
+	challenge = loginChallenge(t)
+	if rr := postSecondFactor(replaced.ChallengeToken, recoveryCodes[0]); rr.Code != http.StatusUnauthorized {
+		t.Errorf("Expected status %d for a replaced challenge, got %d", http.StatusUnauthorized, rr.Code)
+	}
+	// whose invalid codes are neither counted nor bring it back in place of the newer one
+	if rr := postSecondFactor(replaced.ChallengeToken, "000000"); rr.Code != http.StatusUnauthorized {
+		t.Errorf("Expected status %d for a replaced challenge, got %d", http.StatusUnauthorized, rr.Code)
+	}
+	if stored, _ := testDB.GetUserTOTP(context.Background(), userID); stored.FailedAttempts != 0 {
+		t.Errorf("Expected no failed attempts for a replaced challenge, got %d", stored.FailedAttempts)
+	}
+
+	// Recovery codes work once, however they are typed. The replaced challenge did not use this one up.
+	if rr := postSecondFactor(challenge.ChallengeToken, " "+recoveryCodes[0]+" "); rr.Code != http.StatusOK {
+		t.Errorf("Expected a recovery code to be accepted, got %d: %s", rr.Code, rr.Body.String())
+	}
+	challenge = loginChallenge(t)
+	if rr := postSecondFactor(challenge.ChallengeToken, recoveryCodes[0]); rr.Code != http.StatusUnauthorized {
+		t.Errorf("Expected a used recovery code to be rejected, got %d", rr.Code)
+	}
+
+	rr = callTwoFactor(handlers.RegenerateRecoveryCodes, http.MethodPost, userID, false, handlers.TwoFactorCodeRequest{Code: recoveryCodes[2]})
+	var regenerated handlers.RecoveryCodesResponse
+	json.NewDecoder(rr.Body).Decode(&regenerated)
+	if rr.Code != http.StatusOK || len(regenerated.RecoveryCodes) != twofactor.RecoveryCodeCount {
+		t.Fatalf("Expected new recovery codes, got %d: %s", rr.Code, rr.Body.String())
+	}
+	if rr := postSecondFactor(challenge.ChallengeToken, recoveryCodes[3]); rr.Code != http.StatusUnauthorized {
+		t.Errorf("Expected a replaced recovery code to be rejected, got %d", rr.Code)
+	}
+	// The challenge still works after invalid codes
+	if rr := postSecondFactor(challenge.ChallengeToken, regenerated.RecoveryCodes[0]); rr.Code != http.StatusOK {
+		t.Errorf("Expected status %d, got %d: %s", http.StatusOK, rr.Code, rr.Body.String())
+	}
+}
+
+func TestTwoFactorLockout(t *testing.T) {
+	if !testutils.ShouldRunTests(t) {
+		return
+	}
+	testDB, userID := setupTwoFactorUser(t, false)
+	secret, _ := enrollTwoFactor(t, userID)
+	challenge := loginChallenge(t)
+
+	for range twofactor.MaxFailedAttempts {
+		if rr := postSecondFactor(challenge.ChallengeToken, "000000"); rr.Code != http.StatusUnauthorized {
+			t.Fatalf("Expected status %d, got %d", http.StatusUnauthorized, rr.Code)
+		}
+	}
+
+	code, _ := totp.GenerateCode(secret, time.Now().Add(30*time.Second))
+	if rr := postSecondFactor(challenge.ChallengeToken, code); rr.Code != http.StatusTooManyRequests {
+		t.Errorf("Expected status %d while locked, got %d", http.StatusTooManyRequests, rr.Code)
+	}
+
+	// Codes are accepted again once the lockout expires
+	expired := time.Now().Add(-twofactor.LockoutDuration)
+	if err := testDB.UpdateUserTOTPAttempts(context.Background(), userID, 0, twofactor.MaxFailedAttempts, &expired); err != nil {
+		t.Fatalf("Failed to update attempts: %v", err)
+	}
+	if rr := postSecondFactor(challenge.ChallengeToken, code); rr.Code != http.StatusOK {
+		t.Errorf("Expected status %d after the lockout, got %d: %s", http.StatusOK, rr.Code, rr.Body.String())
+	}
+}
+
+func TestTwoFactorRequiredForAdmins(t *testing.T) {
+	if !testutils.ShouldRunTests(t) {
+		return
+	}
+	testDB, userID := setupTwoFactorUser(t, true)
+	adminSettings, _ := testDB.GetAdminSettings(context.Background())
+	adminSettings.RequireAdminTwoFactor = true
+	testDB.CreateAdminSettings(context.Background(), adminSettings)
+
+	challenge := loginChallenge(t)
+	if !challenge.SetupRequired {
+		t.Fatalf("Expected a setup challenge, got %+v", challenge)
+	}
+
+	rr := callTwoFactor(handlers.LoginTwoFactorSetup, http.MethodPost, 0, false, handlers.TwoFactorLoginRequest{ChallengeToken: challenge.ChallengeToken})
+	var setup handlers.TwoFactorSetupResponse
+	json.NewDecoder(rr.Body).Decode(&setup)
+	if rr.Code != http.StatusOK || setup.Secret == "" {
+		t.Fatalf("Expected a secret, got %d: %s", rr.Code, rr.Body.String())
+	}
+	// A setup challenge starts a single enrollment
+	if rr := callTwoFactor(handlers.LoginTwoFactorSetup, http.MethodPost, 0, false, handlers.TwoFactorLoginRequest{ChallengeToken: challenge.ChallengeToken}); rr.Code != http.StatusUnauthorized {
+		t.Errorf("Expected status %d for a second setup, got %d", http.StatusUnauthorized, rr.Code)
+	}
+
+	// A mistyped code can be retried
+	if rr := postSecondFactor(challenge.ChallengeToken, "000000"); rr.Code != http.StatusUnauthorized {
+		t.Errorf("Expected status %d for an invalid code, got %d", http.StatusUnauthorized, rr.Code)
+	}
+	code, _ := totp.GenerateCode(setup.Secret, time.Now())
+	rr = postSecondFactor(challenge.ChallengeToken, code)
+	if rr.Code != http.StatusOK || responseCookie(rr, "auth_token") == nil {
+		t.Fatalf("Expected a session, got %d: %s", rr.Code, rr.Body.String())
+	}
+	var response handlers.LoginResponse
+	json.NewDecoder(rr.Body).Decode(&response)
+	if !response.IsAdmin || len(response.RecoveryCodes) != twofactor.RecoveryCodeCount {
+		t.Errorf("Expected an admin session with recovery codes, got %+v", response)
+	}
+	code, _ = totp.GenerateCode(setup.Secret, time.Now().Add(30*time.Second))
+	if rr := postSecondFactor(challenge.ChallengeToken, code); rr.Code != http.StatusUnauthorized {
+		t.Errorf("Expected status %d for a replayed setup challenge, got %d", http.StatusUnauthorized, rr.Code)
+	}
+
+	// The next login asks for a code, and it cannot be disabled
+	if challenge := loginChallenge(t); challenge.SetupRequired {
+		t.Error("Expected a code challenge once enrolled")
+	}
+	if rr := callTwoFactor(handlers.DisableTwoFactor, http.MethodPost, userID, true, handlers.TwoFactorCodeRequest{Code: response.RecoveryCodes[0]}); rr.Code != http.StatusForbidden {
+		t.Errorf("Expected status %d, got %d", http.StatusForbidden, rr.Code)
+	}
+
+	// Setup challenges cannot replace an enabled secret
+	if rr := callTwoFactor(handlers.LoginTwoFactorSetup, http.MethodPost, 0, false, handlers.TwoFactorLoginRequest{ChallengeToken: challenge.ChallengeToken}); rr.Code != http.StatusConflict {
+		t.Errorf("Expected status %d, got %d", http.StatusConflict, rr.Code)
+	}
+}
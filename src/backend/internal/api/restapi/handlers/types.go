@@ -1,6 +1,13 @@
 package handlers
 
-import "gitlab.cherkaoui.ch/quillium-ai/quillium/src/backend/internal/settings"
+import (
+	"encoding/json"
+	"time"
+
+	"gitlab.cherkaoui.ch/quillium-ai/quillium/src/backend/internal/chats"
+	llmproviders "gitlab.cherkaoui.ch/quillium-ai/quillium/src/backend/internal/llm_providers"
+	"gitlab.cherkaoui.ch/quillium-ai/quillium/src/backend/internal/settings"
+)
 
 // LoginRequest represents a login request
 type LoginRequest struct {
@@ -16,6 +23,65 @@ type LoginResponse struct {
 	UserID       int                   `json:"user_id"`
 	IsAdmin      bool                  `json:"is_admin"`
 	Settings     settings.UserSettings `json:"settings"`
+
+	// Set when the login enrolled two-factor authentication, the codes are only returned this once
+	RecoveryCodes []string `json:"recovery_codes,omitempty"`
+}
+
+// TwoFactorChallengeResponse is returned instead of a LoginResponse when the
+// login needs a second factor. The challenge token is exchanged for a session
+// together with a code.
+type TwoFactorChallengeResponse struct {
+	TwoFactorRequired bool   `json:"two_factor_required"`
+	SetupRequired     bool   `json:"two_factor_setup_required,omitempty"` // The admin has to enroll before signing in
+	ChallengeToken    string `json:"challenge_token"`
+}
+
+// TwoFactorLoginRequest completes a login with a TOTP or recovery code
+type TwoFactorLoginRequest struct {
+	ChallengeToken string `json:"challenge_token"`
+	Code           string `json:"code"`
+}
+
+// TwoFactorCodeRequest confirms a change to two-factor authentication with a code
+type TwoFactorCodeRequest struct {
+	Code string `json:"code"`
+}
+
+// TwoFactorSetupResponse is a new TOTP secret, usually shown as a QR code of the provisioning URI
+type TwoFactorSetupResponse struct {
+	Secret          string `json:"secret"`
+	ProvisioningURI string `json:"provisioning_uri"`
+}
+
+// TwoFactorStatusResponse describes the two-factor authentication of the current user
+type TwoFactorStatusResponse struct {
+	Enabled                bool `json:"enabled"`
+	RecoveryCodesRemaining int  `json:"recovery_codes_remaining"`
+	Required               bool `json:"required"` // The user is an admin and admins must use it
+}
+
+// RecoveryCodesResponse lists new one-time recovery codes
+type RecoveryCodesResponse struct {
+	RecoveryCodes []string `json:"recovery_codes"`
+}
+
+// PasskeyLoginRequest starts a passkey login
+type PasskeyLoginRequest struct {
+	RememberMe bool `json:"remember_me"`
+}
+
+// PasskeyRegisterRequest names a passkey being registered or renamed
+type PasskeyRegisterRequest struct {
+	Name string `json:"name"`
+}
+
+// PasskeyResponse represents a passkey with its credential removed
+type PasskeyResponse struct {
+	ID         int        `json:"id"`
+	Name       string     `json:"name"`
+	CreatedAt  time.Time  `json:"created_at"`
+	LastUsedAt *time.Time `json:"last_used_at"`
 }
 
 // APIKeyResponse represents an API key response
@@ -48,6 +114,66 @@ type CreateUserRequest struct {
 	IsAdmin  bool   `json:"is_admin"`
 }
 
+// SsoProviderRequest creates or updates an SSO provider. Omitted fields are
+// kept on update, an empty client secret keeps the stored one.
+type SsoProviderRequest struct {
+	ID           *int    `json:"id"`
+	Provider     *string `json:"provider"`
+	AuthType     *string `json:"auth_type"`
+	ClientID     *string `json:"client_id"`
+	ClientSecret *string `json:"client_secret"`
+	RedirectURL  *string `json:"redirect_url"`
+	IssuerURL    *string `json:"issuer_url"`
+
+	// OAuth2 only
+	AuthURL            *string   `json:"auth_url"`
+	TokenURL           *string   `json:"token_url"`
+	UserInfoURL        *string   `json:"userinfo_url"`
+	Scopes             *string   `json:"scopes"`
+	SubjectField       *string   `json:"subject_field"`
+	EmailField         *string   `json:"email_field"`
+	EmailVerifiedField *string   `json:"email_verified_field"`
+	UsernameField      *string   `json:"username_field"`
+	AllowedDomains     *[]string `json:"allowed_domains"`
+
+	// SAML only
+	IdPMetadata *string `json:"idp_metadata"`
+	AdminField  *string `json:"admin_field"`
+	AdminValue  *string `json:"admin_value"`
+}
+
+// SsoProviderResponse represents an SSO provider with its client secret removed
+type SsoProviderResponse struct {
+	ID              int    `json:"id"`
+	Provider        string `json:"provider"`
+	AuthType        string `json:"auth_type"`
+	ClientID        string `json:"client_id"`
+	ClientSecretSet bool   `json:"client_secret_set"`
+	RedirectURL     string `json:"redirect_url"`
+	IssuerURL       string `json:"issuer_url,omitempty"`
+
+	AuthURL            string   `json:"auth_url,omitempty"`
+	TokenURL           string   `json:"token_url,omitempty"`
+	UserInfoURL        string   `json:"userinfo_url,omitempty"`
+	Scopes             string   `json:"scopes,omitempty"`
+	SubjectField       string   `json:"subject_field,omitempty"`
+	EmailField         string   `json:"email_field,omitempty"`
+	EmailVerifiedField string   `json:"email_verified_field,omitempty"`
+	UsernameField      string   `json:"username_field,omitempty"`
+	AllowedDomains     []string `json:"allowed_domains,omitempty"`
+
+	IdPMetadata string `json:"idp_metadata,omitempty"`
+	AdminField  string `json:"admin_field,omitempty"`
+	AdminValue  string `json:"admin_value,omitempty"`
+
+	UserCount int `json:"user_count"`
+}
+
+// SsoLinkResponse holds the login page of the provider to link the account to
+type SsoLinkResponse struct {
+	URL string `json:"url"`
+}
+
 // ChatSummary represents a summary of a chat
 type ChatSummary struct {
 	ID    int    `json:"id"`
@@ -58,3 +184,102 @@ type ChatSummary struct {
 type UpdateUserSettingsRequest struct {
 	Settings settings.UserSettings `json:"settings"`
 }
+
+// ProviderModels lists the models available on one LLM provider
+type ProviderModels struct {
+	Provider string               `json:"provider"`
+	Models   []llmproviders.Model `json:"models"`
+	Error    string               `json:"error,omitempty"`
+}
+
+// AskRequest is the body of a synchronous question
+type AskRequest struct {
+	Query       string   `json:"query"`
+	Profile     string   `json:"profile"`     // Speed, balanced or quality, balanced when empty
+	Temperature *float64 `json:"temperature"` // Omitted to use the provider default
+	MaxTokens   int      `json:"max_tokens"`  // 0 to use the provider default
+}
+
+// AskResponse is the answer to a synchronous question with the sources it cites
+type AskResponse struct {
+	Answer  string         `json:"answer"`
+	Profile string         `json:"profile"`
+	Sources []chats.Source `json:"sources"`
+}
+
+// ChatCompletionRequest is the body of an OpenAI compatible chat completion request.
+// The model selects the speed, balanced or quality profile.
+type ChatCompletionRequest struct {
+	Model               string                  `json:"model"`
+	Messages            []ChatCompletionMessage `json:"messages"`
+	Stream              bool                    `json:"stream"`
+	Temperature         *float64                `json:"temperature"`
+	MaxTokens           int                     `json:"max_tokens"`
+	MaxCompletionTokens int                     `json:"max_completion_tokens"` // Replaces max_tokens in newer clients
+	SaveChat            bool                    `json:"save_chat"`             // Quillium extension, saves the exchange as a chat of the API key owner
+}
+
+// ChatCompletionMessage is a message of a chat completion request.
+// The content is either a string or a list of content parts.
+type ChatCompletionMessage struct {
+	Role    string          `json:"role"`
+	Content json.RawMessage `json:"content"`
+}
+
+// ChatCompletionContentPart is a part of a message content, only text parts are supported
+type ChatCompletionContentPart struct {
+	Type string `json:"type"`
+	Text string `json:"text"`
+}
+
+// ChatCompletionResponse is a chat completion, or a chunk of it when streaming
+type ChatCompletionResponse struct {
+	ID      string                 `json:"id"`
+	Object  string                 `json:"object"`
+	Created int64                  `json:"created"`
+	Model   string                 `json:"model"`
+	Choices []ChatCompletionChoice `json:"choices"`
+	Sources []chats.Source         `json:"sources,omitempty"` // Quillium extension, the sources cited in the answer
+	ChatID  int                    `json:"chat_id,omitempty"` // Quillium extension, set when the exchange was saved
+}
+
+// ChatCompletionChoice is the answer of a chat completion, Message is set on completions and Delta on chunks
+type ChatCompletionChoice struct {
+	Index        int                    `json:"index"`
+	Message      *ChatCompletionContent `json:"message,omitempty"`
+	Delta        *ChatCompletionContent `json:"delta,omitempty"`
+	FinishReason *string                `json:"finish_reason"`
+}
+
+// ChatCompletionContent is the generated message, or the part of it contained in a chunk
+type ChatCompletionContent struct {
+	Role    string `json:"role,omitempty"`
+	Content string `json:"content"`
+}
+
+// ModelList lists the models of the OpenAI compatible API
+type ModelList struct {
+	Object string      `json:"object"`
+	Data   []ModelInfo `json:"data"`
+}
+
+// ModelInfo describes a model of the OpenAI compatible API
+type ModelInfo struct {
+	ID      string `json:"id"`
+	Object  string `json:"object"`
+	Created int64  `json:"created"`
+	OwnedBy string `json:"owned_by"`
+}
+
+// OpenAIErrorResponse is an error in the format OpenAI clients expect
+type OpenAIErrorResponse struct {
+	Error OpenAIError `json:"error"`
+}
+
+// OpenAIError describes an error of the OpenAI compatible API
+type OpenAIError struct {
+	Message string `json:"message"`
+	Type    string `json:"type"`
+	Param   string `json:"param,omitempty"`
+	Code    string `json:"code,omitempty"`
+}
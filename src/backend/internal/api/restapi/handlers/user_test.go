@@ -1,666 +1,642 @@
-package handlers
-
-import (
-	"bytes"
-	"context"
-	"encoding/json"
-	"net/http"
-	"net/http/httptest"
-	"strconv"
-	"testing"
-
-	"gitlab.cherkaoui.ch/quillium-ai/quillium/src/backend/internal/api/restapi/handlers/testutils"
-	"gitlab.cherkaoui.ch/quillium-ai/quillium/src/backend/internal/api/restapi/middleware"
-	"gitlab.cherkaoui.ch/quillium-ai/quillium/src/backend/internal/security"
-	"gitlab.cherkaoui.ch/quillium-ai/quillium/src/backend/internal/sso"
-	"gitlab.cherkaoui.ch/quillium-ai/quillium/src/backend/internal/user"
-)
-
-func TestGetCurrentUser(t *testing.T) {
-	// Skip if we shouldn't run tests
-	if !testutils.ShouldRunTests(t) {
-		return
-	}
-
-	// Setup test DB
-	testDB := testutils.SetupTestDB(t)
-	defer testDB.Close()
-
-	// Initialize handlers with the test DB
-	InitHandlers(testDB)
-
-	// Create test users
-	hashedPassword, err := security.HashPassword("password123")
-	if err != nil {
-		t.Fatalf("Failed to hash password: %v", err)
-	}
-
-	testUser1 := &user.User{
-		Email:        "user1@example.com",
-		PasswordHash: hashedPassword,
-		IsAdmin:      false,
-		IsSso:        false,
-	}
-
-	testUser2 := &user.User{
-		Email:        "user2@example.com",
-		PasswordHash: hashedPassword, // Using the same hash for simplicity
-		IsAdmin:      true,
-		IsSso:        false,
-	}
-
-	// Insert the test users
-	userID1, err := testDB.CreateUser(testUser1)
-	if err != nil {
-		t.Fatalf("Failed to create test user 1: %v", err)
-	}
-	if userID1 == nil {
-		t.Fatalf("Expected non-nil user ID from CreateUser for user 1")
-	}
-	testUser1.ID = userID1
-
-	userID2, err := testDB.CreateUser(testUser2)
-	if err != nil {
-		t.Fatalf("Failed to create test user 2: %v", err)
-	}
-	if userID2 == nil {
-		t.Fatalf("Expected non-nil user ID from CreateUser for user 2")
-	}
-	testUser2.ID = userID2
-
-	// Debug: Print all users in the database
-	users, err := testDB.GetUsers()
-	if err != nil {
-		t.Logf("Failed to get users for debugging: %v", err)
-	} else {
-		t.Logf("Users in database:")
-		for _, u := range users {
-			if u.ID != nil {
-				t.Logf("User ID: %d, Email: %s, IsAdmin: %v", *u.ID, u.Email, u.IsAdmin)
-			} else {
-				t.Logf("User with nil ID, Email: %s", u.Email)
-			}
-		}
-	}
-
-	tests := []struct {
-		name             string
-		userID           string
-		expectedStatus   int
-		expectedResponse interface{}
-	}{
-		{
-			name:           "Valid User",
-			userID:         strconv.Itoa(*userID1),
-			expectedStatus: http.StatusOK,
-			expectedResponse: UserResponse{
-				ID:      *userID1,
-				Email:   testUser1.Email,
-				IsAdmin: testUser1.IsAdmin,
-				IsSso:   testUser1.IsSso,
-			},
-		},
-		{
-			name:           "User Not Found",
-			userID:         "999",
-			expectedStatus: http.StatusNotFound,
-			expectedResponse: map[string]string{
-				"error": "User not found",
-			},
-		},
-	}
-
-	for _, tc := range tests {
-		t.Run(tc.name, func(t *testing.T) {
-			// Create a new HTTP request
-			req, err := http.NewRequest(http.MethodGet, "/api/user", nil)
-			if err != nil {
-				t.Fatalf("Failed to create request: %v", err)
-			}
-
-			// Create a new response recorder
-			rec := httptest.NewRecorder()
-
-			// Create a context with the user ID
-			ctx := context.Background()
-			ctx = context.WithValue(ctx, middleware.UserIDKey(), tc.userID)
-			ctx = context.WithValue(ctx, middleware.IsAdminKey(), tc.userID == strconv.Itoa(*userID2))
-
-			// Set the context on the request
-			req = req.WithContext(ctx)
-
-			// Call the handler
-			GetCurrentUser(rec, req)
-
-			// Check the status code
-			if rec.Code != tc.expectedStatus {
-				t.Errorf("Expected status %d, got %d", tc.expectedStatus, rec.Code)
-			}
-
-			// Check the response body
-			if tc.expectedStatus == http.StatusOK {
-				var response UserResponse
-				err := json.Unmarshal(rec.Body.Bytes(), &response)
-				if err != nil {
-					t.Fatalf("Failed to unmarshal response: %v", err)
-				}
-
-				expected := tc.expectedResponse.(UserResponse)
-
-				// Log the actual response for debugging
-				t.Logf("Expected response: %+v", expected)
-				t.Logf("Actual response: %+v", response)
-
-				if response.ID != expected.ID ||
-					response.Email != expected.Email ||
-					response.IsAdmin != expected.IsAdmin ||
-					response.IsSso != expected.IsSso {
-					t.Errorf("Response mismatch. Expected %+v, got %+v", expected, response)
-				}
-			} else {
-				var response map[string]string
-				err := json.Unmarshal(rec.Body.Bytes(), &response)
-				if err != nil {
-					t.Fatalf("Failed to unmarshal response: %v", err)
-				}
-
-				expected := tc.expectedResponse.(map[string]string)
-				if response["error"] != expected["error"] {
-					t.Errorf("Expected error %q, got %q", expected["error"], response["error"])
-				}
-			}
-		})
-	}
-}
-
-func TestCreateUser(t *testing.T) {
-	// Skip if we shouldn't run tests
-	if !testutils.ShouldRunTests(t) {
-		return
-	}
-
-	// Setup test DB
-	testDB := testutils.SetupTestDB(t)
-	defer testDB.Close()
-
-	// Initialize handlers with the test DB
-	InitHandlers(testDB)
-
-	// Setup middleware with a test secret
-	testSecret := []byte("test-secret-key")
-	middleware.InitAuth(testSecret, testDB)
-
-	// Create admin and non-admin users for testing
-	hashedPassword, err := security.HashPassword("password123")
-	if err != nil {
-		t.Fatalf("Failed to hash password: %v", err)
-	}
-
-	adminUser := &user.User{
-		Email:        "admin@example.com",
-		PasswordHash: hashedPassword,
-		IsAdmin:      true,
-		IsSso:        false,
-	}
-
-	regularUser := &user.User{
-		Email:        "regular@example.com",
-		PasswordHash: hashedPassword,
-		IsAdmin:      false,
-		IsSso:        false,
-	}
-
-	// Insert the test users
-	adminID, err := testDB.CreateUser(adminUser)
-	if err != nil {
-		t.Fatalf("Failed to create admin user: %v", err)
-	}
-	if adminID == nil {
-		t.Fatalf("Expected non-nil user ID from CreateUser for admin user")
-	}
-	adminUser.ID = adminID
-
-	regularID, err := testDB.CreateUser(regularUser)
-	if err != nil {
-		t.Fatalf("Failed to create regular user: %v", err)
-	}
-	if regularID == nil {
-		t.Fatalf("Expected non-nil user ID from CreateUser for regular user")
-	}
-	regularUser.ID = regularID
-
-	tests := []struct {
-		name            string
-		requestBody     CreateUserRequest
-		userID          string // ID of the user making the request
-		isAdmin         bool   // Whether the user is an admin
-		expectedStatus  int
-		expectedMessage string
-	}{
-		{
-			name: "Valid Create User (Admin)",
-			requestBody: CreateUserRequest{
-				Email:    "newuser@example.com",
-				Password: "password123",
-				IsAdmin:  true,
-			},
-			userID:          strconv.Itoa(*adminUser.ID),
-			isAdmin:         true,
-			expectedStatus:  http.StatusOK, // The actual status might be OK instead of Created
-			expectedMessage: "User created successfully",
-		},
-		{
-			name: "Non-Admin Trying to Create Admin",
-			requestBody: CreateUserRequest{
-				Email:    "newuser2@example.com",
-				Password: "password123",
-				IsAdmin:  true,
-			},
-			userID:          strconv.Itoa(*regularUser.ID),
-			isAdmin:         false,
-			expectedStatus:  http.StatusForbidden,
-			expectedMessage: "Admin access required", // The actual error message might be different
-		},
-		{
-			name: "Valid Create Regular User",
-			requestBody: CreateUserRequest{
-				Email:    "regularuser@example.com",
-				Password: "password123",
-				IsAdmin:  false,
-			},
-			userID:          strconv.Itoa(*regularUser.ID),
-			isAdmin:         false,
-			expectedStatus:  http.StatusForbidden, // Non-admins might not be allowed to create users
-			expectedMessage: "Admin access required",
-		},
-	}
-
-	for _, tc := range tests {
-		t.Run(tc.name, func(t *testing.T) {
-			// Create request body
-			reqBody, err := json.Marshal(tc.requestBody)
-			if err != nil {
-				t.Fatalf("Failed to marshal request body: %v", err)
-			}
-
-			// Create request
-			req := httptest.NewRequest("POST", "/api/users", bytes.NewBuffer(reqBody))
-			req.Header.Set("Content-Type", "application/json")
-
-			// Add user ID and admin status to context
-			ctx := context.WithValue(context.Background(), middleware.UserIDKey(), tc.userID)
-			ctx = context.WithValue(ctx, middleware.IsAdminKey(), tc.isAdmin)
-			req = req.WithContext(ctx)
-
-			// Create response recorder
-			rec := httptest.NewRecorder()
-
-			// Call the handler
-			CreateUser(rec, req)
-
-			// Check the status code
-			if rec.Code != tc.expectedStatus {
-				t.Errorf("Expected status %d, got %d", tc.expectedStatus, rec.Code)
-			}
-
-			// Check the response body
-			var response map[string]interface{}
-			err = json.Unmarshal(rec.Body.Bytes(), &response)
-			if err != nil {
-				t.Logf("Failed to unmarshal response as map: %v", err)
-				// Try to unmarshal as boolean (some endpoints might return just true/false)
-				var boolResponse bool
-				err = json.Unmarshal(rec.Body.Bytes(), &boolResponse)
-				if err != nil {
-					t.Fatalf("Failed to unmarshal response as bool: %v", err)
-				}
-
-				// If we got a boolean response, just check if it's true for success cases
-				if tc.expectedStatus == http.StatusOK || tc.expectedStatus == http.StatusCreated {
-					if !boolResponse {
-						t.Errorf("Expected true response for success case, got %v", boolResponse)
-					}
-					return
-				}
-			}
-
-			// Check for expected message or error
-			if tc.expectedStatus == http.StatusOK || tc.expectedStatus == http.StatusCreated {
-				// For success cases, check for message
-				if message, ok := response["message"].(string); ok {
-					if message != tc.expectedMessage {
-						t.Errorf("Expected message %q, got %q", tc.expectedMessage, message)
-					}
-				}
-			} else {
-				// For error cases, check for error message
-				if errorMsg, ok := response["error"].(string); ok {
-					if errorMsg != tc.expectedMessage {
-						t.Errorf("Expected error %q, got %q", tc.expectedMessage, errorMsg)
-					}
-				}
-			}
-
-			// For successful user creation, verify the user exists in the database
-			if (tc.expectedStatus == http.StatusOK || tc.expectedStatus == http.StatusCreated) &&
-				(tc.name == "Valid Create User (Admin)" || tc.name == "Valid Create Regular User") {
-				// Give the database a moment to complete the operation
-				createdUser, err := testDB.GetUser(&tc.requestBody.Email, nil)
-				if err != nil {
-					t.Logf("Note: Could not retrieve created user: %v", err)
-					return
-				}
-
-				if createdUser == nil {
-					t.Logf("Note: Created user not found in database")
-				} else if createdUser.IsAdmin != tc.requestBody.IsAdmin {
-					t.Errorf("Expected IsAdmin=%v, got IsAdmin=%v", tc.requestBody.IsAdmin, createdUser.IsAdmin)
-				}
-			}
-		})
-	}
-}
-
-func TestListUsers(t *testing.T) {
-	// Skip if we shouldn't run tests
-	if !testutils.ShouldRunTests(t) {
-		return
-	}
-
-	// Setup test DB
-	testDB := testutils.SetupTestDB(t)
-	defer testDB.Close()
-
-	// Initialize handlers with the test DB
-	InitHandlers(testDB)
-
-	// Create test users
-	hashedPassword, err := security.HashPassword("password123")
-	if err != nil {
-		t.Fatalf("Failed to hash password: %v", err)
-	}
-
-	testUser1 := &user.User{
-		Email:        "listuser1@example.com",
-		PasswordHash: hashedPassword,
-		IsAdmin:      false,
-		IsSso:        false,
-	}
-
-	testUser2 := &user.User{
-		Email:        "listuser2@example.com",
-		PasswordHash: hashedPassword, // Using the same hash for simplicity
-		IsAdmin:      true,
-		IsSso:        false,
-	}
-
-	// Insert the test users
-	userID1, err := testDB.CreateUser(testUser1)
-	if err != nil {
-		t.Fatalf("Failed to create test user 1: %v", err)
-	}
-	if userID1 == nil {
-		t.Fatalf("Expected non-nil user ID from CreateUser for user 1")
-	}
-	testUser1.ID = userID1
-
-	userID2, err := testDB.CreateUser(testUser2)
-	if err != nil {
-		t.Fatalf("Failed to create test user 2: %v", err)
-	}
-	if userID2 == nil {
-		t.Fatalf("Expected non-nil user ID from CreateUser for user 2")
-	}
-	testUser2.ID = userID2
-
-	// Debug: Print all users in the database
-	users, err := testDB.GetUsers()
-	if err != nil {
-		t.Logf("Failed to get users for debugging: %v", err)
-	} else {
-		t.Logf("Users in database:")
-		for _, u := range users {
-			if u.ID != nil {
-				t.Logf("User ID: %d, Email: %s, IsAdmin: %v", *u.ID, u.Email, u.IsAdmin)
-			} else {
-				t.Logf("User with nil ID, Email: %s", u.Email)
-			}
-		}
-	}
-
-	tests := []struct {
-		name           string
-		userID         string
-		isAdmin        bool
-		expectedStatus int
-		expectedUsers  []UserResponse
-	}{
-		{
-			name:           "Admin Can List Users",
-			userID:         strconv.Itoa(*testUser2.ID),
-			isAdmin:        true,
-			expectedStatus: http.StatusOK,
-			// We expect at least our two test users, but there might be more from other tests
-			// So we'll check for the presence of our test users in the response
-		},
-		{
-			name:           "Non-Admin Cannot List Users",
-			userID:         strconv.Itoa(*testUser1.ID),
-			isAdmin:        false,
-			expectedStatus: http.StatusForbidden,
-		},
-	}
-
-	for _, tc := range tests {
-		t.Run(tc.name, func(t *testing.T) {
-			// Create a new HTTP request
-			req, err := http.NewRequest(http.MethodGet, "/api/users", nil)
-			if err != nil {
-				t.Fatalf("Failed to create request: %v", err)
-			}
-
-			// Create a new response recorder
-			rec := httptest.NewRecorder()
-
-			// Create a context with the user ID and admin status
-			ctx := context.Background()
-			ctx = context.WithValue(ctx, middleware.UserIDKey(), tc.userID)
-			ctx = context.WithValue(ctx, middleware.IsAdminKey(), tc.isAdmin)
-
-			// Set the context on the request
-			req = req.WithContext(ctx)
-
-			// Call the handler
-			ListUsers(rec, req)
-
-			// Check the status code
-			if rec.Code != tc.expectedStatus {
-				t.Errorf("Expected status %d, got %d", tc.expectedStatus, rec.Code)
-			}
-
-			// Check the response body
-			if tc.expectedStatus == http.StatusOK {
-				var response []UserResponse
-				err := json.Unmarshal(rec.Body.Bytes(), &response)
-				if err != nil {
-					t.Fatalf("Failed to unmarshal response: %v", err)
-				}
-
-				// Log the response for debugging
-				t.Logf("Response: %+v", response)
-
-				// Check that the response contains at least our test users
-				// Note: The database might contain other users from previous tests
-				user1ID := *testUser1.ID
-				user2ID := *testUser2.ID
-
-				user1Found := false
-				user2Found := false
-
-				for _, u := range response {
-					if u.ID == user1ID && u.Email == testUser1.Email {
-						user1Found = true
-					}
-					if u.ID == user2ID && u.Email == testUser2.Email {
-						user2Found = true
-					}
-				}
-
-				// Only check for the users if we're expecting them to be found
-				if tc.name == "Admin Can List Users" {
-					if !user1Found {
-						t.Errorf("Test user 1 (ID: %d, Email: %s) not found in response", user1ID, testUser1.Email)
-					}
-					if !user2Found {
-						t.Errorf("Test user 2 (ID: %d, Email: %s) not found in response", user2ID, testUser2.Email)
-					}
-				}
-			} else {
-				// For error response, check the error message
-				var response map[string]string
-				err := json.Unmarshal(rec.Body.Bytes(), &response)
-				if err != nil {
-					t.Fatalf("Failed to unmarshal response: %v", err)
-				}
-
-				if response["error"] != "Admin access required" {
-					t.Errorf("Expected error message %q, got %q", "Admin access required", response["error"])
-				}
-			}
-		})
-	}
-}
-
-func TestGetSsoUser(t *testing.T) {
-	// Skip if we shouldn't run tests
-	if !testutils.ShouldRunTests(t) {
-		return
-	}
-
-	// Setup test DB
-	testDB := testutils.SetupTestDB(t)
-	defer testDB.Close()
-
-	// Initialize handlers with the test DB
-	InitHandlers(testDB)
-
-	// Create an SSO provider first
-	ssoProvider := &sso.SsoProvider{
-		ClientID:     "test-client-id",
-		ClientSecret: "test-client-secret",
-		Provider:     "test-provider",
-		RedirectURL:  "http://localhost:3000/callback",
-		AuthType:     "OAuth2",
-	}
-
-	err := testDB.CreateSsoProvider(ssoProvider)
-	if err != nil {
-		t.Fatalf("Failed to create SSO provider: %v", err)
-	}
-
-	// Get the SSO provider ID directly from the database
-	var ssoProviderID int
-	err = testDB.QueryRow(context.Background(), "SELECT id FROM sso_logins WHERE sso_provider = $1", ssoProvider.Provider).Scan(&ssoProviderID)
-	if err != nil {
-		t.Fatalf("Failed to get SSO provider ID: %v", err)
-	}
-
-	t.Logf("Created SSO provider with ID: %d", ssoProviderID)
-
-	ssoUserID := "sso-user-123"
-
-	// Create an SSO user directly using SQL to bypass any issues with the CreateSsoUser function
-	var userID int
-	err = testDB.QueryRow(
-		context.Background(),
-		"INSERT INTO users (email, password_hash, is_sso, sso_user_id, sso_provider_id, is_admin) VALUES ($1, NULL, TRUE, $2, $3, FALSE) RETURNING id",
-		"ssouser@example.com",
-		ssoUserID,
-		ssoProviderID,
-	).Scan(&userID)
-	if err != nil {
-		t.Fatalf("Failed to create SSO user directly: %v", err)
-	}
-
-	// Also create user settings for this user
-	_, err = testDB.Exec(
-		context.Background(),
-		"INSERT INTO user_settings (user_id, config) VALUES ($1, '{}')",
-		userID,
-	)
-	if err != nil {
-		t.Fatalf("Failed to create user settings: %v", err)
-	}
-
-	t.Logf("Created SSO user with ID: %d", userID)
-
-	// Get the user to verify it was created correctly
-	email := "ssouser@example.com"
-	ssoUser, err := testDB.GetUser(&email, nil)
-	if err != nil {
-		t.Fatalf("Failed to retrieve SSO user: %v", err)
-	}
-
-	// Verify SSO user properties
-	if !ssoUser.IsSso {
-		t.Error("Expected IsSso to be true for SSO user")
-	}
-
-	if ssoUser.SsoUserID == nil || *ssoUser.SsoUserID != ssoUserID {
-		t.Errorf("Expected SsoUserID to be %q, got %v", ssoUserID, ssoUser.SsoUserID)
-	}
-
-	if ssoUser.SsoProviderID == nil || *ssoUser.SsoProviderID != ssoProviderID {
-		t.Errorf("Expected SsoProviderID to be %d, got %v", ssoProviderID, ssoUser.SsoProviderID)
-	}
-
-	// Test getting the SSO user through the API
-	req, err := http.NewRequest(http.MethodGet, "/api/user", nil)
-	if err != nil {
-		t.Fatalf("Failed to create request: %v", err)
-	}
-
-	// Create a new response recorder
-	rec := httptest.NewRecorder()
-
-	// Create a context with the user ID
-	ctx := context.Background()
-	ctx = context.WithValue(ctx, middleware.UserIDKey(), strconv.Itoa(userID))
-
-	// Set the context on the request
-	req = req.WithContext(ctx)
-
-	// Call the handler
-	GetCurrentUser(rec, req)
-
-	// Check the status code
-	if rec.Code != http.StatusOK {
-		t.Errorf("Expected status %d, got %d", http.StatusOK, rec.Code)
-	}
-
-	// Check the response body
-	var response UserResponse
-	err = json.Unmarshal(rec.Body.Bytes(), &response)
-	if err != nil {
-		t.Fatalf("Failed to unmarshal response: %v", err)
-	}
-
-	// Verify the response
-	expected := UserResponse{
-		ID:      userID,
-		Email:   "ssouser@example.com",
-		IsAdmin: false,
-		IsSso:   true,
-	}
-
-	// Log the actual response for debugging
-	t.Logf("Expected response: %+v", expected)
-	t.Logf("Actual response: %+v", response)
-
-	if response.ID != expected.ID ||
-		response.Email != expected.Email ||
-		response.IsAdmin != expected.IsAdmin ||
-		response.IsSso != expected.IsSso {
-		t.Errorf("Response mismatch. Expected %+v, got %+v", expected, response)
-	}
-}
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"gitlab.cherkaoui.ch/quillium-ai/quillium/src/backend/internal/api/restapi/handlers/testutils"
+	"gitlab.cherkaoui.ch/quillium-ai/quillium/src/backend/internal/api/restapi/middleware"
+	"gitlab.cherkaoui.ch/quillium-ai/quillium/src/backend/internal/security"
+	"gitlab.cherkaoui.ch/quillium-ai/quillium/src/backend/internal/sso"
+	"gitlab.cherkaoui.ch/quillium-ai/quillium/src/backend/internal/user"
+)
+
+func TestGetCurrentUser(t *testing.T) {
+	// Skip if we shouldn't run tests
+	if !testutils.ShouldRunTests(t) {
+		return
+	}
+
+	// Setup test DB
+	testDB := testutils.SetupTestDB(t)
+	defer testDB.Close()
+
+	// Initialize handlers with the test DB
+	InitHandlers(testDB)
+
+	// Create test users
+	hashedPassword, err := security.HashPassword("password123")
+	if err != nil {
+		t.Fatalf("Failed to hash password: %v", err)
+	}
+
+	testUser1 := &user.User{
+		Email:        "user1@example.com",
+		PasswordHash: hashedPassword,
+		IsAdmin:      false,
+		IsSso:        false,
+	}
+
+	testUser2 := &user.User{
+		Email:        "user2@example.com",
+		PasswordHash: hashedPassword, // Using the same hash for simplicity
+		IsAdmin:      true,
+		IsSso:        false,
+	}
+
+	// Insert the test users
+	userID1, err := testDB.CreateUser(context.Background(), testUser1)
+	if err != nil {
+		t.Fatalf("Failed to create test user 1: %v", err)
+	}
+	if userID1 == nil {
+		t.Fatalf("Expected non-nil user ID from CreateUser for user 1")
+	}
+	testUser1.ID = userID1
+
+	userID2, err := testDB.CreateUser(context.Background(), testUser2)
+	if err != nil {
+		t.Fatalf("Failed to create test user 2: %v", err)
+	}
+	if userID2 == nil {
+		t.Fatalf("Expected non-nil user ID from CreateUser for user 2")
+	}
+	testUser2.ID = userID2
+
+	// Debug: Print all users in the database
+	users, err := testDB.GetUsers(context.Background())
+	if err != nil {
+		t.Logf("Failed to get users for debugging: %v", err)
+	} else {
+		t.Logf("Users in database:")
+		for _, u := range users {
+			if u.ID != nil {
+				t.Logf("User ID: %d, Email: %s, IsAdmin: %v", *u.ID, u.Email, u.IsAdmin)
+			} else {
+				t.Logf("User with nil ID, Email: %s", u.Email)
+			}
+		}
+	}
+
+	tests := []struct {
+		name             string
+		userID           int
+		expectedStatus   int
+		expectedResponse interface{}
+	}{
+		{
+			name:           "Valid User",
+			userID:         *userID1,
+			expectedStatus: http.StatusOK,
+			expectedResponse: UserResponse{
+				ID:      *userID1,
+				Email:   testUser1.Email,
+				IsAdmin: testUser1.IsAdmin,
+				IsSso:   testUser1.IsSso,
+			},
+		},
+		{
+			name:           "User Not Found",
+			userID:         999,
+			expectedStatus: http.StatusNotFound,
+			expectedResponse: map[string]string{
+				"error": "User not found",
+			},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			// Create a new HTTP request
+			req, err := http.NewRequest(http.MethodGet, "/api/user", nil)
+			if err != nil {
+				t.Fatalf("Failed to create request: %v", err)
+			}
+
+			// Create a new response recorder
+			rec := httptest.NewRecorder()
+
+			// Create a context with the user ID
+			ctx := context.Background()
+			ctx = context.WithValue(ctx, middleware.UserIDKey(), tc.userID)
+			ctx = context.WithValue(ctx, middleware.IsAdminKey(), tc.userID == *userID2)
+
+			// Set the context on the request
+			req = req.WithContext(ctx)
+
+			// Call the handler
+			GetCurrentUser(rec, req)
+
+			// Check the status code
+			if rec.Code != tc.expectedStatus {
+				t.Errorf("Expected status %d, got %d", tc.expectedStatus, rec.Code)
+			}
+
+			// Check the response body
+			if tc.expectedStatus == http.StatusOK {
+				var response UserResponse
+				err := json.Unmarshal(rec.Body.Bytes(), &response)
+				if err != nil {
+					t.Fatalf("Failed to unmarshal response: %v", err)
+				}
+
+				expected := tc.expectedResponse.(UserResponse)
+
+				// Log the actual response for debugging
+				t.Logf("Expected response: %+v", expected)
+				t.Logf("Actual response: %+v", response)
+
+				if response.ID != expected.ID ||
+					response.Email != expected.Email ||
+					response.IsAdmin != expected.IsAdmin ||
+					response.IsSso != expected.IsSso {
+					t.Errorf("Response mismatch. Expected %+v, got %+v", expected, response)
+				}
+			} else {
+				var response map[string]string
+				err := json.Unmarshal(rec.Body.Bytes(), &response)
+				if err != nil {
+					t.Fatalf("Failed to unmarshal response: %v", err)
+				}
+
+				expected := tc.expectedResponse.(map[string]string)
+				if response["error"] != expected["error"] {
+					t.Errorf("Expected error %q, got %q", expected["error"], response["error"])
+				}
+			}
+		})
+	}
+}
+
+func TestCreateUser(t *testing.T) {
+	// Skip if we shouldn't run tests
+	if !testutils.ShouldRunTests(t) {
+		return
+	}
+
+	// Setup test DB
+	testDB := testutils.SetupTestDB(t)
+	defer testDB.Close()
+
+	// Initialize handlers with the test DB
+	InitHandlers(testDB)
+
+	// Setup middleware with a test secret
+	testSecret := []byte("test-secret-key")
+	middleware.InitAuth(testSecret, testDB)
+
+	// Create admin and non-admin users for testing
+	hashedPassword, err := security.HashPassword("password123")
+	if err != nil {
+		t.Fatalf("Failed to hash password: %v", err)
+	}
+
+	adminUser := &user.User{
+		Email:        "admin@example.com",
+		PasswordHash: hashedPassword,
+		IsAdmin:      true,
+		IsSso:        false,
+	}
+
+	regularUser := &user.User{
+		Email:        "regular@example.com",
+		PasswordHash: hashedPassword,
+		IsAdmin:      false,
+		IsSso:        false,
+	}
+
+	// Insert the test users
+	adminID, err := testDB.CreateUser(context.Background(), adminUser)
+	if err != nil {
+		t.Fatalf("Failed to create admin user: %v", err)
+	}
+	if adminID == nil {
+		t.Fatalf("Expected non-nil user ID from CreateUser for admin user")
+	}
+	adminUser.ID = adminID
+
+	regularID, err := testDB.CreateUser(context.Background(), regularUser)
+	if err != nil {
+		t.Fatalf("Failed to create regular user: %v", err)
+	}
+	if regularID == nil {
+		t.Fatalf("Expected non-nil user ID from CreateUser for regular user")
+	}
+	regularUser.ID = regularID
+
+	tests := []struct {
+		name            string
+		requestBody     CreateUserRequest
+		userID          int  // ID of the user making the request
+		isAdmin         bool // Whether the user is an admin
+		expectedStatus  int
+		expectedMessage string
+	}{
+		{
+			name: "Valid Create User (Admin)",
+			requestBody: CreateUserRequest{
+				Email:    "newuser@example.com",
+				Password: "password123",
+				IsAdmin:  true,
+			},
+			userID:          *adminUser.ID,
+			isAdmin:         true,
+			expectedStatus:  http.StatusOK, // The actual status might be OK instead of Created
+			expectedMessage: "User created successfully",
+		},
+		{
+			name: "Non-Admin Trying to Create Admin",
+			requestBody: CreateUserRequest{
+				Email:    "newuser2@example.com",
+				Password: "password123",
+				IsAdmin:  true,
+			},
+			userID:          *regularUser.ID,
+			isAdmin:         false,
+			expectedStatus:  http.StatusForbidden,
+			expectedMessage: "Admin access required", // The actual error message might be different
+		},
+		{
+			name: "Valid Create Regular User",
+			requestBody: CreateUserRequest{
+				Email:    "regularuser@example.com",
+				Password: "password123",
+				IsAdmin:  false,
+			},
+			userID:          *regularUser.ID,
+			isAdmin:         false,
+			expectedStatus:  http.StatusForbidden, // Non-admins might not be allowed to create users
+			expectedMessage: "Admin access required",
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			// Create request body
+			reqBody, err := json.Marshal(tc.requestBody)
+			if err != nil {
+				t.Fatalf("Failed to marshal request body: %v", err)
+			}
+
+			// Create request
+			req := httptest.NewRequest("POST", "/api/users", bytes.NewBuffer(reqBody))
+			req.Header.Set("Content-Type", "application/json")
+
+			// Add user ID and admin status to context
+			ctx := context.WithValue(context.Background(), middleware.UserIDKey(), tc.userID)
+			ctx = context.WithValue(ctx, middleware.IsAdminKey(), tc.isAdmin)
+			req = req.WithContext(ctx)
+
+			// Create response recorder
+			rec := httptest.NewRecorder()
+
+			// Call the handler
+			CreateUser(rec, req)
+
+			// Check the status code
+			if rec.Code != tc.expectedStatus {
+				t.Errorf("Expected status %d, got %d", tc.expectedStatus, rec.Code)
+			}
+
+			// Check the response body
+			var response map[string]interface{}
+			err = json.Unmarshal(rec.Body.Bytes(), &response)
+			if err != nil {
+				t.Logf("Failed to unmarshal response as map: %v", err)
+				// Try to unmarshal as boolean (some endpoints might return just true/false)
+				var boolResponse bool
+				err = json.Unmarshal(rec.Body.Bytes(), &boolResponse)
+				if err != nil {
+					t.Fatalf("Failed to unmarshal response as bool: %v", err)
+				}
+
+				// If we got a boolean response, just check if it's true for success cases
+				if tc.expectedStatus == http.StatusOK || tc.expectedStatus == http.StatusCreated {
+					if !boolResponse {
+						t.Errorf("Expected true response for success case, got %v", boolResponse)
+					}
+					return
+				}
+			}
+
+			// Check for expected message or error
+			if tc.expectedStatus == http.StatusOK || tc.expectedStatus == http.StatusCreated {
+				// For success cases, check for message
+				if message, ok := response["message"].(string); ok {
+					if message != tc.expectedMessage {
+						t.Errorf("Expected message %q, got %q", tc.expectedMessage, message)
+					}
+				}
+			} else {
+				// For error cases, check for error message
+				if errorMsg, ok := response["error"].(string); ok {
+					if errorMsg != tc.expectedMessage {
+						t.Errorf("Expected error %q, got %q", tc.expectedMessage, errorMsg)
+					}
+				}
+			}
+
+			// For successful user creation, verify the user exists in the database
+			if (tc.expectedStatus == http.StatusOK || tc.expectedStatus == http.StatusCreated) &&
+				(tc.name == "Valid Create User (Admin)" || tc.name == "Valid Create Regular User") {
+				// Give the database a moment to complete the operation
+				createdUser, err := testDB.GetUser(context.Background(), &tc.requestBody.Email, nil)
+				if err != nil {
+					t.Logf("Note: Could not retrieve created user: %v", err)
+					return
+				}
+
+				if createdUser == nil {
+					t.Logf("Note: Created user not found in database")
+				} else if createdUser.IsAdmin != tc.requestBody.IsAdmin {
+					t.Errorf("Expected IsAdmin=%v, got IsAdmin=%v", tc.requestBody.IsAdmin, createdUser.IsAdmin)
+				}
+			}
+		})
+	}
+}
+
+func TestListUsers(t *testing.T) {
+	// Skip if we shouldn't run tests
+	if !testutils.ShouldRunTests(t) {
+		return
+	}
+
+	// Setup test DB
+	testDB := testutils.SetupTestDB(t)
+	defer testDB.Close()
+
+	// Initialize handlers with the test DB
+	InitHandlers(testDB)
+
+	// Create test users
+	hashedPassword, err := security.HashPassword("password123")
+	if err != nil {
+		t.Fatalf("Failed to hash password: %v", err)
+	}
+
+	testUser1 := &user.User{
+		Email:        "listuser1@example.com",
+		PasswordHash: hashedPassword,
+		IsAdmin:      false,
+		IsSso:        false,
+	}
+
+	testUser2 := &user.User{
+		Email:        "listuser2@example.com",
+		PasswordHash: hashedPassword, // Using the same hash for simplicity
+		IsAdmin:      true,
+		IsSso:        false,
+	}
+
+	// Insert the test users
+	userID1, err := testDB.CreateUser(context.Background(), testUser1)
+	if err != nil {
+		t.Fatalf("Failed to create test user 1: %v", err)
+	}
+	if userID1 == nil {
+		t.Fatalf("Expected non-nil user ID from CreateUser for user 1")
+	}
+	testUser1.ID = userID1
+
+	userID2, err := testDB.CreateUser(context.Background(), testUser2)
+	if err != nil {
+		t.Fatalf("Failed to create test user 2: %v", err)
+	}
+	if userID2 == nil {
+		t.Fatalf("Expected non-nil user ID from CreateUser for user 2")
+	}
+	testUser2.ID = userID2
+
+	// Debug: Print all users in the database
+	users, err := testDB.GetUsers(context.Background())
+	if err != nil {
+		t.Logf("Failed to get users for debugging: %v", err)
+	} else {
+		t.Logf("Users in database:")
+		for _, u := range users {
+			if u.ID != nil {
+				t.Logf("User ID: %d, Email: %s, IsAdmin: %v", *u.ID, u.Email, u.IsAdmin)
+			} else {
+				t.Logf("User with nil ID, Email: %s", u.Email)
+			}
+		}
+	}
+
+	tests := []struct {
+		name           string
+		userID         int
+		isAdmin        bool
+		expectedStatus int
+		expectedUsers  []UserResponse
+	}{
+		{
+			name:           "Admin Can List Users",
+			userID:         *testUser2.ID,
+			isAdmin:        true,
+			expectedStatus: http.StatusOK,
+			// We expect at least our two test users, but there might be more from other tests
+			// So we'll check for the presence of our test users in the response
+		},
+		{
+			name:           "Non-Admin Cannot List Users",
+			userID:         *testUser1.ID,
+			isAdmin:        false,
+			expectedStatus: http.StatusForbidden,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			// Create a new HTTP request
+			req, err := http.NewRequest(http.MethodGet, "/api/users", nil)
+			if err != nil {
+				t.Fatalf("Failed to create request: %v", err)
+			}
+
+			// Create a new response recorder
+			rec := httptest.NewRecorder()
+
+			// Create a context with the user ID and admin status
+			ctx := context.Background()
+			ctx = context.WithValue(ctx, middleware.UserIDKey(), tc.userID)
+			ctx = context.WithValue(ctx, middleware.IsAdminKey(), tc.isAdmin)
+
+			// Set the context on the request
+			req = req.WithContext(ctx)
+
+			// Call the handler
+			ListUsers(rec, req)
+
+			// Check the status code
+			if rec.Code != tc.expectedStatus {
+				t.Errorf("Expected status %d, got %d", tc.expectedStatus, rec.Code)
+			}
+
+			// Check the response body
+			if tc.expectedStatus == http.StatusOK {
+				var response []UserResponse
+				err := json.Unmarshal(rec.Body.Bytes(), &response)
+				if err != nil {
+					t.Fatalf("Failed to unmarshal response: %v", err)
+				}
+
+				// Log the response for debugging
+				t.Logf("Response: %+v", response)
+
+				// Check that the response contains at least our test users
+				// Note: The database might contain other users from previous tests
+				user1ID := *testUser1.ID
+				user2ID := *testUser2.ID
+
+				user1Found := false
+				user2Found := false
+
+				for _, u := range response {
+					if u.ID == user1ID && u.Email == testUser1.Email {
+						user1Found = true
+					}
+					if u.ID == user2ID && u.Email == testUser2.Email {
+						user2Found = true
+					}
+				}
+
+				// Only check for the users if we're expecting them to be found
+				if tc.name == "Admin Can List Users" {
+					if !user1Found {
+						t.Errorf("Test user 1 (ID: %d, Email: %s) not found in response", user1ID, testUser1.Email)
+					}
+					if !user2Found {
+						t.Errorf("Test user 2 (ID: %d, Email: %s) not found in response", user2ID, testUser2.Email)
+					}
+				}
+			} else {
+				// For error response, check the error message
+				var response map[string]string
+				err := json.Unmarshal(rec.Body.Bytes(), &response)
+				if err != nil {
+					t.Fatalf("Failed to unmarshal response: %v", err)
+				}
+
+				if response["error"] != "Admin access required" {
+					t.Errorf("Expected error message %q, got %q", "Admin access required", response["error"])
+				}
+			}
+		})
+	}
+}
+
+func TestGetSsoUser(t *testing.T) {
+	// Skip if we shouldn't run tests
+	if !testutils.ShouldRunTests(t) {
+		return
+	}
+
+	// Setup test DB
+	testDB := testutils.SetupTestDB(t)
+	defer testDB.Close()
+
+	// Initialize handlers with the test DB
+	InitHandlers(testDB)
+
+	// Create an SSO provider first
+	ssoProvider := &sso.SsoProvider{
+		ClientID:     "test-client-id",
+		ClientSecret: "test-client-secret",
+		Provider:     "test-provider",
+		RedirectURL:  "http://localhost:3000/callback",
+		AuthType:     "OAuth2",
+	}
+
+	createdProviderID, err := testDB.CreateSsoProvider(context.Background(), ssoProvider)
+	if err != nil {
+		t.Fatalf("Failed to create SSO provider: %v", err)
+	}
+	ssoProviderID := *createdProviderID
+
+	t.Logf("Created SSO provider with ID: %d", ssoProviderID)
+
+	ssoUserID := "sso-user-123"
+
+	createdID, err := testDB.CreateSsoUser(context.Background(), "ssouser@example.com", ssoUserID, ssoProviderID)
+	if err != nil {
+		t.Fatalf("Failed to create SSO user: %v", err)
+	}
+	userID := *createdID
+
+	t.Logf("Created SSO user with ID: %d", userID)
+
+	// Get the user to verify it was created correctly
+	email := "ssouser@example.com"
+	ssoUser, err := testDB.GetUser(context.Background(), &email, nil)
+	if err != nil {
+		t.Fatalf("Failed to retrieve SSO user: %v", err)
+	}
+
+	// Verify SSO user properties
+	if !ssoUser.IsSso {
+		t.Error("Expected IsSso to be true for SSO user")
+	}
+
+	if ssoUser.SsoUserID == nil || *ssoUser.SsoUserID != ssoUserID {
+		t.Errorf("Expected SsoUserID to be %q, got %v", ssoUserID, ssoUser.SsoUserID)
+	}
+
+	if ssoUser.SsoProviderID == nil || *ssoUser.SsoProviderID != ssoProviderID {
+		t.Errorf("Expected SsoProviderID to be %d, got %v", ssoProviderID, ssoUser.SsoProviderID)
+	}
+
+	// Test getting the SSO user through the API
+	req, err := http.NewRequest(http.MethodGet, "/api/user", nil)
+	if err != nil {
+		t.Fatalf("Failed to create request: %v", err)
+	}
+
+	// Create a new response recorder
+	rec := httptest.NewRecorder()
+
+	// Create a context with the user ID
+	ctx := context.Background()
+	ctx = context.WithValue(ctx, middleware.UserIDKey(), userID)
+
+	// Set the context on the request
+	req = req.WithContext(ctx)
+
+	// Call the handler
+	GetCurrentUser(rec, req)
+
+	// Check the status code
+	if rec.Code != http.StatusOK {
+		t.Errorf("Expected status %d, got %d", http.StatusOK, rec.Code)
+	}
+
+	// Check the response body
+	var response UserResponse
+	err = json.Unmarshal(rec.Body.Bytes(), &response)
+	if err != nil {
+		t.Fatalf("Failed to unmarshal response: %v", err)
+	}
+
+	// Verify the response
+	expected := UserResponse{
+		ID:      userID,
+		Email:   "ssouser@example.com",
+		IsAdmin: false,
+		IsSso:   true,
+	}
+
+	// Log the actual response for debugging
+	t.Logf("Expected response: %+v", expected)
+	t.Logf("Actual response: %+v", response)
+
+	if response.ID != expected.ID ||
+		response.Email != expected.Email ||
+		response.IsAdmin != expected.IsAdmin ||
+		response.IsSso != expected.IsSso {
+		t.Errorf("Response mismatch. Expected %+v, got %+v", expected, response)
+	}
+}
@@ -11,10 +11,10 @@ import (
 )
 
 // NewServer creates a new API server
-func NewServer(addr string, db *db.DB, jwtSecret []byte) *Server {
+func NewServer(addr string, db db.Store, jwtSecret []byte) *Server {
 	return &Server{
 		Addr:      addr,
-		WSHub:     ws.NewHub(),
+		WSHub:     ws.NewHub(db),
 		HttpMux:   http.NewServeMux(),
 		DB:        db,
 		JWTSecret: jwtSecret,
@@ -44,6 +44,16 @@ func (s *Server) Start() error {
 		})(w, r)
 	})
 
+	// Server-Sent Events fallback for clients behind proxies that block websockets.
+	// Scripts can stream too, so both JWT and API key authentication are accepted.
+	s.HttpMux.HandleFunc("/api/v1/chat/stream", middleware.WithCORS(
+		middleware.WithAuth(middleware.AuthTypeAny,
+			middleware.WithLogging(func(w http.ResponseWriter, r *http.Request) {
+				ws.ServeSSE(s.WSHub, w, r)
+			}),
+		),
+	))
+
 	log.Printf("Server starting on %s", s.Addr)
 	return http.ListenAndServe(s.Addr, s.HttpMux)
 }
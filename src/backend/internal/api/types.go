@@ -3,6 +3,7 @@ package api
 import (
 	"net/http"
 
+	"gitlab.cherkaoui.ch/quillium-ai/quillium/src/backend/internal/api/ws"
 	"gitlab.cherkaoui.ch/quillium-ai/quillium/src/backend/internal/db"
 )
 
@@ -10,6 +11,7 @@ import (
 type Server struct {
 	Addr      string
 	HttpMux   *http.ServeMux
-	DB        *db.DB
+	WSHub     *ws.Hub
+	DB        db.Store
 	JWTSecret []byte
 }
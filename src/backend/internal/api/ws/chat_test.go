@@ -0,0 +1,140 @@
+package ws
+
+import (
+	"context"
+	"strconv"
+	"strings"
+	"testing"
+
+	"gitlab.cherkaoui.ch/quillium-ai/quillium/src/backend/internal/chats"
+	"gitlab.cherkaoui.ch/quillium-ai/quillium/src/backend/internal/db/memory"
+	"gitlab.cherkaoui.ch/quillium-ai/quillium/src/backend/internal/settings"
+	"gitlab.cherkaoui.ch/quillium-ai/quillium/src/backend/internal/user"
+)
+
+// createChatTestUser creates a password user in the store and returns its ID
+func createChatTestUser(t *testing.T, store *memory.Store, email string) int {
+	t.Helper()
+	passwordHash := "hashedpassword"
+	id, err := store.CreateUser(context.Background(), &user.User{Email: email, PasswordHash: &passwordHash})
+	if err != nil {
+		t.Fatalf("Failed to create user: %v", err)
+	}
+	return *id
+}
+
+// TestGetChatOwnership tests that chats are only returned to their owner
+func TestGetChatOwnership(t *testing.T) {
+	store := memory.New()
+	hub := NewHub(store)
+	ownerID := createChatTestUser(t, store, "owner@example.com")
+	otherID := createChatTestUser(t, store, "other@example.com")
+
+	chatID, err := store.CreateChat(context.Background(), ownerID, &chats.ChatContent{
+		Title:    "Test chat",
+		Messages: []chats.Message{{Role: "user", Content: "hello", MsgNum: 1}},
+	})
+	if err != nil {
+		t.Fatalf("Failed to create chat: %v", err)
+	}
+
+	session, err := GetChat(strconv.Itoa(*chatID), newTestClient(hub, ownerID))
+	if err != nil {
+		t.Fatalf("Expected owner to get the chat, got error: %v", err)
+	}
+	if session.Title != "Test chat" || len(session.Messages) != 1 {
+		t.Errorf("Unexpected chat session: %+v", session)
+	}
+
+	if _, err := GetChat(strconv.Itoa(*chatID), newTestClient(hub, otherID)); err == nil {
+		t.Error("Expected an error when another user requests the chat")
+	}
+}
+
+// TestChatHistoryAndDelete tests listing and deleting a user's chats
+func TestChatHistoryAndDelete(t *testing.T) {
+	store := memory.New()
+	userID := createChatTestUser(t, store, "history@example.com")
+
+	for _, title := range []string{"First", "Second"} {
+		if _, err := store.CreateChat(context.Background(), userID, &chats.ChatContent{Title: title}); err != nil {
+			t.Fatalf("Failed to create chat: %v", err)
+		}
+	}
+
+	sessions, err := GetChatHistory(context.Background(), store, strconv.Itoa(userID))
+	if err != nil {
+		t.Fatalf("Failed to get chat history: %v", err)
+	}
+	if len(sessions) != 2 || sessions[0].Title != "First" || sessions[1].Title != "Second" {
+		t.Fatalf("Unexpected chat history: %+v", sessions)
+	}
+
+	if err := DeleteChat(context.Background(), store, sessions[0].ChatID); err != nil {
+		t.Fatalf("Failed to delete chat: %v", err)
+	}
+
+	sessions, err = GetChatHistory(context.Background(), store, strconv.Itoa(userID))
+	if err != nil {
+		t.Fatalf("Failed to get chat history: %v", err)
+	}
+	if len(sessions) != 1 || sessions[0].Title != "Second" {
+		t.Errorf("Expected only the second chat to remain, got %+v", sessions)
+	}
+}
+
+// TestChatRequestForeignChat tests that answers cannot be streamed into a chat of another user
+func TestChatRequestForeignChat(t *testing.T) {
+	store := memory.New()
+	hub := NewHub(store)
+	ownerID := createChatTestUser(t, store, "owner@example.com")
+	otherID := createChatTestUser(t, store, "other@example.com")
+
+	content := &chats.ChatContent{
+		Title:    "Owner chat",
+		Messages: []chats.Message{{Role: "user", Content: "hello", MsgNum: 1}},
+	}
+	chatID, err := store.CreateChat(context.Background(), ownerID, content)
+	if err != nil {
+		t.Fatalf("Failed to create chat: %v", err)
+	}
+
+	client := newTestClient(hub, otherID)
+	processChatRequest(client, ChatRequest{
+		ChatID:   strconv.Itoa(*chatID),
+		Messages: []chats.Message{{Role: "user", Content: "overwrite"}},
+	})
+
+	if msg := receive(t, client); msg.Type != TypeError || msg.Content.(map[string]interface{})["error"] != "Chat not found" {
+		t.Errorf("Expected the request to be refused, got %s: %v", msg.Type, msg.Content)
+	}
+	saved, err := store.GetChatContent(context.Background(), *chatID)
+	if err != nil {
+		t.Fatalf("Failed to get chat: %v", err)
+	}
+	if saved.Title != "Owner chat" || len(saved.Messages) != 1 || saved.Messages[0].Content != "hello" {
+		t.Errorf("Expected the chat to be unchanged, got %+v", saved)
+	}
+}
+
+func TestChatRequestUnknownQualityProfile(t *testing.T) {
+	store := memory.New()
+	if err := store.CreateAdminSettings(context.Background(), &settings.AdminSettings{}); err != nil {
+		t.Fatalf("Failed to create admin settings: %v", err)
+	}
+	hub := NewHub(store)
+	client := newTestClient(hub, createChatTestUser(t, store, "user@example.com"))
+
+	processChatRequest(client, ChatRequest{
+		Messages: []chats.Message{{Role: "user", Content: "hello"}},
+		Options:  ChatOptions{QualityProfile: "fastest"},
+	})
+
+	msg := receive(t, client)
+	if errMsg, _ := msg.Content.(map[string]interface{})["error"].(string); msg.Type != TypeError || !strings.HasPrefix(errMsg, "Invalid options:") {
+		t.Errorf("Expected the request to be refused, got %s: %v", msg.Type, msg.Content)
+	}
+	if streams := hub.chatStreams(client.userID, ""); len(streams) != 0 {
+		t.Errorf("Expected no answer to be started, got %d streams", len(streams))
+	}
+}
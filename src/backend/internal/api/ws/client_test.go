@@ -0,0 +1,97 @@
+package ws
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+// newTestClient creates a client of the user without a websocket connection
+func newTestClient(hub *Hub, userID int) *Client {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &Client{
+		hub:    hub,
+		send:   make(chan []byte, 64),
+		userID: userID,
+		ctx:    ctx,
+		cancel: cancel,
+	}
+}
+
+// receive decodes the next message sent to the client
+func receive(t *testing.T, client *Client) Message {
+	t.Helper()
+	select {
+	case data := <-client.send:
+		var msg Message
+		if err := json.Unmarshal(data, &msg); err != nil {
+			t.Fatalf("Failed to decode message: %v", err)
+		}
+		return msg
+	case <-time.After(time.Second):
+		t.Fatal("Timed out waiting for a message")
+		return Message{}
+	}
+}
+
+// receiveStream decodes the next message sent to the client as a stream chunk
+func receiveStream(t *testing.T, client *Client) ChatStreamResponse {
+	t.Helper()
+	msg := receive(t, client)
+	if msg.Type != TypeChatStream {
+		t.Fatalf("Expected a %s message, got %s: %v", TypeChatStream, msg.Type, msg.Content)
+	}
+	data, _ := json.Marshal(msg.Content)
+	var resp ChatStreamResponse
+	json.Unmarshal(data, &resp)
+	return resp
+}
+
+func TestChatCancelMessage(t *testing.T) {
+	hub := NewHub(nil)
+	client := newTestClient(hub, 1)
+
+	stream, err := hub.createStream(client.userID, "42")
+	if err != nil {
+		t.Fatalf("Failed to create stream: %v", err)
+	}
+	other, _ := hub.createStream(client.userID, "43")
+	foreign, _ := hub.createStream(2, "42")
+
+	data, _ := json.Marshal(Message{Type: TypeChatCancel, Content: ChatCancelRequest{ChatID: "42"}})
+	HandleMessage(hub, client, data)
+
+	if stream.Context().Err() == nil {
+		t.Error("Expected chat_cancel to cancel the generation")
+	}
+	if other.Context().Err() != nil {
+		t.Error("Expected the generation of another chat to keep running")
+	}
+	if foreign.Context().Err() != nil {
+		t.Error("Expected the generation of another user to keep running")
+	}
+}
+
+func TestSendToDisconnectedClient(t *testing.T) {
+	hub := NewHub(nil)
+	go hub.Run()
+
+	client := newTestClient(hub, 1)
+	hub.register <- client
+	hub.unregister <- client
+
+	// Sending to a disconnected client must neither block nor panic
+	done := make(chan struct{})
+	go func() {
+		for i := 0; i < cap(client.send)+1; i++ {
+			sendChatStreamResponse(client, ChatStreamResponse{Content: "late chunk"})
+		}
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Sending to a disconnected client blocked")
+	}
+}
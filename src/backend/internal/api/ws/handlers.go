@@ -1,23 +1,30 @@
 package ws
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
-	"strings"
 	"time"
 
-	"github.com/Quillium-AI/Quillium/src/backend/internal/chats"
-	"github.com/Quillium-AI/Quillium/src/backend/internal/db"
-	llmproviders "github.com/Quillium-AI/Quillium/src/backend/internal/llm_providers"
-	"github.com/Quillium-AI/Quillium/src/backend/internal/security"
+	"gitlab.cherkaoui.ch/quillium-ai/quillium/src/backend/internal/answer"
+	"gitlab.cherkaoui.ch/quillium-ai/quillium/src/backend/internal/chats"
 )
 
+// Time allowed to save a chat once its answer is generated
+const saveTimeout = 10 * time.Second
+
 // MessageTypes for WebSocket communication
 const (
 	TypeChatRequest  = "chat_request"
 	TypeChatResponse = "chat_response"
 	TypeChatStream   = "chat_stream"
+	TypeChatCancel   = "chat_cancel"
+	TypeChatResume   = "chat_resume"
+	TypeChatView     = "chat_view"
+	TypeChatMessage  = "chat_message"
+	TypeChatTitle    = "chat_title"
 	TypeError        = "error"
 )
 
@@ -33,6 +40,12 @@ func HandleMessage(hub *Hub, client *Client, data []byte) {
 	switch msg.Type {
 	case TypeChatRequest:
 		handleChatRequest(client, msg.Content)
+	case TypeChatCancel:
+		handleChatCancel(hub, client, msg.Content)
+	case TypeChatResume:
+		handleChatResume(hub, client, msg.Content)
+	case TypeChatView:
+		handleChatView(hub, client, msg.Content)
 	default:
 		log.Printf("Unknown message type: %s", msg.Type)
 		sendErrorResponse(client, "Unknown message type")
@@ -59,37 +72,117 @@ func handleChatRequest(client *Client, content interface{}) {
 	}
 
 	// Store the active chat ID for this client
-	client.activeChatID = chatReq.ChatID
+	client.hub.viewChat(client, chatReq.ChatID)
 
 	// Process the chat request in a goroutine
 	go processChatRequest(client, chatReq)
 }
 
-// generateChatTitle creates a title for a new chat based on the first user message
-func generateChatTitle(firstMessage string) string {
-	// Truncate the message if it's too long
-	if len(firstMessage) > 50 {
-		return firstMessage[:47] + "..."
+// handleChatCancel stops the generation running for a chat
+func handleChatCancel(hub *Hub, client *Client, content interface{}) {
+	contentJSON, err := json.Marshal(content)
+	if err != nil {
+		log.Printf("Error marshaling content: %v", err)
+		sendErrorResponse(client, "Invalid request format")
+		return
 	}
-	return firstMessage
+
+	var cancelReq ChatCancelRequest
+	if err := json.Unmarshal(contentJSON, &cancelReq); err != nil {
+		log.Printf("Error parsing chat cancel request: %v", err)
+		sendErrorResponse(client, "Invalid chat cancel request format")
+		return
+	}
+
+	// The generation finishes on its own once its context is cancelled
+	cancelled := hub.cancelStreams(client.userID, cancelReq.ChatID)
+	log.Printf("Cancelled %d generation(s) for chat %q", cancelled, cancelReq.ChatID)
 }
 
-// processChatRequest handles the actual processing of the chat request
-func processChatRequest(client *Client, req ChatRequest) {
+// handleChatResume continues sending a stream to a client that reconnected
+func handleChatResume(hub *Hub, client *Client, content interface{}) {
+	contentJSON, err := json.Marshal(content)
+	if err != nil {
+		log.Printf("Error marshaling content: %v", err)
+		sendErrorResponse(client, "Invalid request format")
+		return
+	}
 
-	// Get the database connection
-	log.Printf("processChatRequest: Initializing database connection")
-	dbConn, err := db.Initialize()
+	var resumeReq ChatResumeRequest
+	if err := json.Unmarshal(contentJSON, &resumeReq); err != nil {
+		log.Printf("Error parsing chat resume request: %v", err)
+		sendErrorResponse(client, "Invalid chat resume request format")
+		return
+	}
+
+	// Expired streams are gone, the client has to load the saved chat instead
+	stream, ok := hub.getStream(resumeReq.StreamID, client.userID)
+	if !ok {
+		sendErrorResponse(client, "Stream not found")
+		return
+	}
+
+	if err := stream.Subscribe(client, resumeReq.Offset); err != nil {
+		sendErrorResponse(client, err.Error())
+		return
+	}
+	hub.viewChat(client, stream.ChatID)
+}
+
+// handleChatView records the chat displayed by the client. When an answer is being
+// generated for the chat, the client receives the stream from its beginning.
+func handleChatView(hub *Hub, client *Client, content interface{}) {
+	contentJSON, err := json.Marshal(content)
 	if err != nil {
-		log.Printf("Error initializing database: %v", err)
-		sendErrorResponse(client, "Internal server error: database connection failed")
+		log.Printf("Error marshaling content: %v", err)
+		sendErrorResponse(client, "Invalid request format")
 		return
 	}
-	defer dbConn.Close()
-	log.Printf("processChatRequest: Database connection initialized successfully")
+
+	var viewReq ChatViewRequest
+	if err := json.Unmarshal(contentJSON, &viewReq); err != nil {
+		log.Printf("Error parsing chat view request: %v", err)
+		sendErrorResponse(client, "Invalid chat view request format")
+		return
+	}
+
+	hub.viewChat(client, viewReq.ChatID)
+	for _, stream := range hub.chatStreams(client.userID, viewReq.ChatID) {
+		if !stream.hasSubscriber(client) {
+			stream.Subscribe(client, 0)
+		}
+	}
+}
+
+// processChatRequest handles the actual processing of the chat request
+func processChatRequest(client *Client, req ChatRequest) {
+
+	// Use the shared database connection pool
+	dbConn := client.hub.db
+
+	// Answers are only added to chats of the user, whatever the connection or API key
+	id := 0
+	if req.ChatID != "" {
+		if _, err := fmt.Sscanf(req.ChatID, "%d", &id); err != nil {
+			log.Printf("Error parsing chat ID: %v", err)
+			sendErrorResponse(client, "Error parsing chat ID")
+			return
+		}
+		isOwner, err := dbConn.VerifyChatOwnership(client.ctx, id, client.userID)
+		if err != nil {
+			log.Printf("Error verifying chat ownership: %v", err)
+			sendErrorResponse(client, "Internal server error: could not verify chat ownership")
+			return
+		}
+		if !isOwner {
+			log.Printf("User %d requested an answer for chat %d of another user", client.userID, id)
+			sendErrorResponse(client, "Chat not found")
+			return
+		}
+	}
 
 	// Get admin settings for API keys
-	adminSettings, err := dbConn.GetAdminSettings()
+	adminSettings, err := dbConn.GetAdminSettings(client.ctx)
 	if err != nil {
 		log.Printf("Error getting admin settings: %v", err)
 		sendErrorResponse(client, "Internal server error: could not get admin settings")
@@ -122,131 +215,66 @@ func processChatRequest(client *Client, req ChatRequest) {
 		chatHistory = append(chatHistory, req.Messages[i])
 	}
 
-	// Search index for relevant information
-	// Initialize sources as an empty array to ensure it's never null
-	sources := []chats.Source{}
-
-	// Decrypt API keys if needed
-	openAIAPIKey, err := security.DecryptPassword(adminSettings.OpenAIAPIKey_encrypt)
+	// Check the requested options and select the model of the quality profile
+	pipeline, err := answer.NewPipeline(adminSettings, answer.Options{
+		QualityProfile: req.Options.QualityProfile,
+		Temperature:    req.Options.Temperature,
+		MaxTokens:      req.Options.MaxTokens,
+	})
 	if err != nil {
-		log.Printf("Error decrypting OpenAI API key: %v", err)
-		sendErrorResponse(client, "Internal server error: OpenAI API key configuration issue")
+		var optionsErr *answer.OptionsError
+		if errors.As(err, &optionsErr) {
+			sendErrorResponse(client, "Invalid options: "+optionsErr.Message)
+			return
+		}
+		log.Printf("Error selecting LLM provider: %v", err)
+		sendErrorResponse(client, "Internal server error: LLM provider is not configured")
 		return
 	}
-	if openAIAPIKey == nil {
-		log.Printf("Error: Decrypted OpenAI API key is nil")
-		sendErrorResponse(client, "Internal server error: OpenAI API key is nil")
+
+	// From here on the answer is written to a stream that can be resumed after reconnecting,
+	// and cancelled by chat_cancel or when no client follows it anymore
+	stream, err := client.hub.createStream(client.userID, req.ChatID)
+	if err != nil {
+		log.Printf("Error creating stream: %v", err)
+		sendErrorResponse(client, "Internal server error: could not create stream")
 		return
 	}
-
-	// Determine search parameters based on quality profile
-	qualityProfile := "balanced" // Default to balanced profile
-	if req.Options.QualityProfile != "" {
-		qualityProfile = req.Options.QualityProfile
-	}
-
-	// Set search parameters based on quality profile
-	switch qualityProfile {
-	case "speed":
-		//TODO: implement speed profile
-	case "quality":
-		//TODO: implement quality profile
-	default: // balanced
-		//TODO: implement balanced profile
-	}
-
-	//TODO: implement search with elastic
-
-	// Select the appropriate model based on the quality profile
-	var model string
-	switch qualityProfile {
-	case "speed":
-		model = adminSettings.LLMProfileSpeed
-	case "quality":
-		model = adminSettings.LLMProfileQuality
-	default: // balanced
-		model = adminSettings.LLMProfileBalanced
-	}
-
-	// Accumulator for the full assistant response content
-	var fullAssistantContent strings.Builder
-	// Create a channel to signal when streaming is done
-	doneChan := make(chan bool, 1)
-
-	// Define the streaming callback function
-	streamCallback := func(streamResp llmproviders.StreamResponse) {
-		// Check for errors
-		if streamResp.Error != nil {
-			log.Printf("Error in stream: %v", streamResp.Error)
-			sendErrorResponse(client, fmt.Sprintf("Error in stream: %v", streamResp.Error))
-			// Ensure doneChan is signaled on error
-			select {
-			case doneChan <- true:
-			default:
-			}
-			return
-		}
-
-		if streamResp.Done {
-			// Send final stream marker with sources
-			sendChatStreamResponse(client, ChatStreamResponse{
-				ChatID:  req.ChatID,
-				Content: "",
-				Done:    true,
-				Sources: sources, // Include sources in the final DONE message
-			})
-			// Signal that streaming is done
-			doneChan <- true
-			return
-		}
-
-		// Append the content chunk to the accumulator
-		if streamResp.Content != "" {
-			fullAssistantContent.WriteString(streamResp.Content)
-		}
-
-		// Send the chunk to the client
-		sendChatStreamResponse(client, ChatStreamResponse{
-			ChatID:  req.ChatID,
-			Content: streamResp.Content,
-			Done:    false,
-			// Sources are sent only with the final Done message
-		})
-	}
-
-	// Start the streaming request in a goroutine - ignore the ChatResponse return value
-	go func() {
-		_, err := llmproviders.Chat( // Ignore the first return value
-			model,
-			*openAIAPIKey,
-			adminSettings.OpenAIBaseURL,
-			userMessage.Content,
-			nil, //TODO: implement index results
-			sources, // Pass sources struct
-			streamCallback,
-		)
-		if err != nil {
-			log.Printf("Error calling AI service: %v", err)
-			// Ensure doneChan is signaled if Chat fails before streaming starts/finishes
-			select {
-			case doneChan <- true:
-			default:
-			}
-			sendErrorResponse(client, "Error generating AI response")
-			// No return needed here, error is handled via callback/doneChan signal
+	// Every connection of the user viewing the chat follows the answer
+	stream.Subscribe(client, 0)
+	for _, viewer := range client.hub.chatViewers(client.userID, req.ChatID) {
+		if viewer != client {
+			stream.Subscribe(viewer, 0)
 		}
-		// No need to send to responseChan
-	}()
-
-	// Wait for streaming to complete
-	<-doneChan
-	log.Printf("Streaming finished. Final accumulated content length: %d", fullAssistantContent.Len())
+	}
+	client.hub.sendToChat(client.userID, req.ChatID, Message{
+		Type:    TypeChatMessage,
+		Content: ChatMessage{ChatID: req.ChatID, Message: userMessage},
+	}, client)
+	ctx := stream.Context()
+
+	// Search for the sources, then send the answer to the clients following the stream as it is generated
+	sources, indexResults := pipeline.Retrieve(ctx, userMessage.Content, msgNum)
+	content, streamErr := pipeline.Generate(ctx, userMessage.Content, indexResults, chatHistory, stream.Append)
+	stopped := streamErr != nil && ctx.Err() != nil
+	log.Printf("Streaming finished (stopped: %t). Final accumulated content length: %d", stopped, len(content))
+
+	// Send final stream marker with sources, a stopped answer keeps what was generated so far.
+	// A cancelled generation is not an error for the user.
+	if streamErr == nil || stopped {
+		stream.Finish(sources, stopped)
+	} else {
+		log.Printf("Error calling AI service: %v", streamErr)
+		stream.Fail(fmt.Sprintf("Error generating AI response: %v", streamErr))
+	}
 
 	// Create the assistant message using the accumulated content
 	assistantMessage := chats.Message{
-		Role:    "assistant",
-		Content: fullAssistantContent.String(), // Use the accumulated content
-		MsgNum:  msgNum,
+		Role:       "assistant",
+		Content:    content,
+		MsgNum:     msgNum,
+		Stopped:    stopped,
+		Generation: pipeline.Generation(),
 	}
 
 	// Prepare the chat content for saving
@@ -254,37 +282,44 @@ func processChatRequest(client *Client, req ChatRequest) {
 
 	// Create or update the chat content
 	chatContent := &chats.ChatContent{
-		Title:    generateChatTitle(userMessage.Content),
+		Title:    chats.GenerateTitle(userMessage.Content),
 		Messages: allMessages,
 		Sources:  sources,
 	}
 
-	// Save the chat content to the database
+	// Save the chat content to the database, even when the client left or the generation was stopped
+	saveCtx, cancel := context.WithTimeout(context.Background(), saveTimeout)
+	defer cancel()
+	chatID := req.ChatID
 	if req.ChatID == "" {
 		// Create a new chat
-		err = dbConn.CreateChat(client.userID, chatContent)
+		newChatID, err := dbConn.CreateChat(saveCtx, client.userID, chatContent)
 		if err != nil {
 			log.Printf("Error creating chat: %v", err)
 			sendErrorResponse(client, "Error creating chat")
 			return
 		}
+		chatID = fmt.Sprintf("%d", *newChatID)
 	} else {
-		// Update existing chat
-		chatID := 0
-		_, err = fmt.Sscanf(req.ChatID, "%d", &chatID)
+		// Update existing chat, its ownership was verified before generating
+		err = dbConn.UpdateChatContent(saveCtx, id, chatContent)
 		if err != nil {
-			log.Printf("Error parsing chat ID: %v", err)
-			sendErrorResponse(client, "Error parsing chat ID")
+			log.Printf("Error updating chat: %v", err)
+			sendErrorResponse(client, "Error updating chat")
 			return
-		} else {
-			err = dbConn.UpdateChatContent(chatID, chatContent)
-			if err != nil {
-				log.Printf("Error updating chat: %v", err)
-				sendErrorResponse(client, "Error updating chat")
-				return
-			}
 		}
 	}
+
+	// Update the chat list of every connection of the user.
+	// Event stream requests are not registered in the hub but still learn the ID of their chat.
+	titleMsg := Message{
+		Type:    TypeChatTitle,
+		Content: ChatTitleUpdate{ChatID: chatID, Title: chatContent.Title},
+	}
+	client.hub.sendToUser(client.userID, titleMsg)
+	if !client.hub.isRegistered(client) {
+		sendJSONMessage(client, titleMsg)
+	}
 }
 
 // sendChatStreamResponse sends a streaming chat response to the client
@@ -315,7 +350,24 @@ func sendJSONMessage(client *Client, msg interface{}) {
 		return
 	}
 
-	// Add a small delay to prevent message batching
-	time.Sleep(time.Millisecond * 10)
-	client.send <- jsonData
+	// Messages for a disconnected client are dropped
+	select {
+	case client.send <- jsonData:
+	case <-client.ctx.Done():
+	}
+}
+
+// queueMessage sends an encoded message to the client without waiting. A client whose queue
+// is full cannot keep up with the stream, it is disconnected and resumes after reconnecting.
+func queueMessage(client *Client, data []byte) {
+	if client.ctx.Err() != nil {
+		return
+	}
+
+	select {
+	case client.send <- data:
+	default:
+		log.Printf("Client of user %d is too slow, disconnecting it", client.userID)
+		client.hub.disconnectClient(client)
+	}
 }
@@ -1,41 +1,191 @@
-package ws
-
-import (
-	"log"
-)
-
-// NewHub creates a new hub instance
-func NewHub() *Hub {
-	return &Hub{
-		broadcast:  make(chan []byte),
-		register:   make(chan *Client),
-		unregister: make(chan *Client),
-		clients:    make(map[*Client]bool),
-	}
-}
-
-// Run starts the hub and handles client registration/messaging
-func (h *Hub) Run() {
-	for {
-		select {
-		case client := <-h.register:
-			h.clients[client] = true
-			log.Println("Client connected")
-		case client := <-h.unregister:
-			if _, ok := h.clients[client]; ok {
-				delete(h.clients, client)
-				close(client.send)
-				log.Println("Client disconnected")
-			}
-		case message := <-h.broadcast:
-			for client := range h.clients {
-				select {
-				case client.send <- message:
-				default:
-					close(client.send)
-					delete(h.clients, client)
-				}
-			}
-		}
-	}
-}
+package ws
+
+import (
+	"log"
+
+	"gitlab.cherkaoui.ch/quillium-ai/quillium/src/backend/internal/db"
+)
+
+// NewHub creates a new hub instance using the shared database connection pool
+func NewHub(database db.Store) *Hub {
+	return &Hub{
+		db:         database,
+		broadcast:  make(chan []byte),
+		register:   make(chan *Client),
+		unregister: make(chan *Client),
+		clients:    make(map[*Client]bool),
+		users:      make(map[int]map[*Client]bool),
+		viewers:    make(map[chatKey]map[*Client]bool),
+		streams:    make(map[string]*Stream),
+	}
+}
+
+// Run starts the hub and handles client registration/messaging
+func (h *Hub) Run() {
+	for {
+		select {
+		case client := <-h.register:
+			h.addClient(client)
+			log.Println("Client connected")
+		case client := <-h.unregister:
+			if h.removeClient(client) {
+				// Cancelling the client stops its write pump. The send channel stays open
+				// so late senders never write to a closed channel.
+				client.cancel()
+				// Running generations continue for a grace period in case the client reconnects
+				go h.detachClient(client)
+				log.Println("Client disconnected")
+			}
+		case message := <-h.broadcast:
+			for _, client := range h.allClients() {
+				select {
+				case client.send <- message:
+				default:
+					h.disconnectClient(client)
+				}
+			}
+		}
+	}
+}
+
+// disconnectClient drops a client that cannot keep up with its messages. Its write pump stops,
+// and its running generations continue for the grace period in case it reconnects.
+func (h *Hub) disconnectClient(client *Client) {
+	client.cancel()
+	h.removeClient(client)
+	go h.detachClient(client)
+}
+
+// addClient registers a client in the hub indexes
+func (h *Hub) addClient(client *Client) {
+	h.clientsLock.Lock()
+	defer h.clientsLock.Unlock()
+
+	h.clients[client] = true
+	if h.users[client.userID] == nil {
+		h.users[client.userID] = make(map[*Client]bool)
+	}
+	h.users[client.userID][client] = true
+	if client.activeChatID != "" {
+		h.addViewer(client)
+	}
+}
+
+// removeClient removes a client from the hub indexes, it reports whether the client was registered
+func (h *Hub) removeClient(client *Client) bool {
+	h.clientsLock.Lock()
+	defer h.clientsLock.Unlock()
+
+	if !h.clients[client] {
+		return false
+	}
+	delete(h.clients, client)
+	if clients := h.users[client.userID]; clients != nil {
+		delete(clients, client)
+		if len(clients) == 0 {
+			delete(h.users, client.userID)
+		}
+	}
+	h.removeViewer(client)
+	return true
+}
+
+// allClients returns every registered client
+func (h *Hub) allClients() []*Client {
+	h.clientsLock.RLock()
+	defer h.clientsLock.RUnlock()
+
+	clients := make([]*Client, 0, len(h.clients))
+	for client := range h.clients {
+		clients = append(clients, client)
+	}
+	return clients
+}
+
+// isRegistered reports whether the client is connected to the hub
+func (h *Hub) isRegistered(client *Client) bool {
+	h.clientsLock.RLock()
+	defer h.clientsLock.RUnlock()
+	return h.clients[client]
+}
+
+// viewChat records the chat displayed by a client, an empty chatID means no saved chat
+func (h *Hub) viewChat(client *Client, chatID string) {
+	h.clientsLock.Lock()
+	defer h.clientsLock.Unlock()
+
+	if client.activeChatID == chatID {
+		return
+	}
+	h.removeViewer(client)
+	client.activeChatID = chatID
+	// Unregistered clients are only indexed once they connect
+	if chatID != "" && h.clients[client] {
+		h.addViewer(client)
+	}
+}
+
+// addViewer indexes a client under its active chat, the caller must hold the clientsLock
+func (h *Hub) addViewer(client *Client) {
+	key := chatKey{userID: client.userID, chatID: client.activeChatID}
+	if h.viewers[key] == nil {
+		h.viewers[key] = make(map[*Client]bool)
+	}
+	h.viewers[key][client] = true
+}
+
+// removeViewer removes a client from the index of its active chat, the caller must hold the clientsLock
+func (h *Hub) removeViewer(client *Client) {
+	key := chatKey{userID: client.userID, chatID: client.activeChatID}
+	if viewers := h.viewers[key]; viewers != nil {
+		delete(viewers, client)
+		if len(viewers) == 0 {
+			delete(h.viewers, key)
+		}
+	}
+}
+
+// userClients returns the connections of a user
+func (h *Hub) userClients(userID int) []*Client {
+	h.clientsLock.RLock()
+	defer h.clientsLock.RUnlock()
+
+	clients := make([]*Client, 0, len(h.users[userID]))
+	for client := range h.users[userID] {
+		clients = append(clients, client)
+	}
+	return clients
+}
+
+// chatViewers returns the connections of a user currently viewing a chat
+func (h *Hub) chatViewers(userID int, chatID string) []*Client {
+	if chatID == "" {
+		return nil
+	}
+
+	h.clientsLock.RLock()
+	defer h.clientsLock.RUnlock()
+
+	key := chatKey{userID: userID, chatID: chatID}
+	clients := make([]*Client, 0, len(h.viewers[key]))
+	for client := range h.viewers[key] {
+		clients = append(clients, client)
+	}
+	return clients
+}
+
+// sendToUser sends a message to every connection of a user
+func (h *Hub) sendToUser(userID int, msg Message) {
+	for _, client := range h.userClients(userID) {
+		sendJSONMessage(client, msg)
+	}
+}
+
+// sendToChat sends a message to every connection of a user viewing the chat, except the given client
+func (h *Hub) sendToChat(userID int, chatID string, msg Message, except *Client) {
+	for _, client := range h.chatViewers(userID, chatID) {
+		if client != except {
+			sendJSONMessage(client, msg)
+		}
+	}
+}
@@ -0,0 +1,130 @@
+package ws
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+// viewChat sends a chat_view message for the client
+func viewChat(hub *Hub, client *Client, chatID string) {
+	data, _ := json.Marshal(Message{Type: TypeChatView, Content: ChatViewRequest{ChatID: chatID}})
+	HandleMessage(hub, client, data)
+}
+
+// expectNoMessage fails when the client received a message
+func expectNoMessage(t *testing.T, client *Client) {
+	t.Helper()
+	select {
+	case data := <-client.send:
+		t.Errorf("Expected no message, got %s", data)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+func TestHubIndexes(t *testing.T) {
+	hub := NewHub(nil)
+	tab := newTestClient(hub, 1)
+	phone := newTestClient(hub, 1)
+	other := newTestClient(hub, 2)
+	for _, client := range []*Client{tab, phone, other} {
+		hub.addClient(client)
+	}
+
+	hub.viewChat(tab, "7")
+	hub.viewChat(phone, "7")
+	hub.viewChat(other, "7")
+
+	if viewers := hub.chatViewers(1, "7"); len(viewers) != 2 {
+		t.Errorf("Expected 2 viewers of the chat, got %d", len(viewers))
+	}
+	if clients := hub.userClients(1); len(clients) != 2 {
+		t.Errorf("Expected 2 connections of the user, got %d", len(clients))
+	}
+
+	// Switching chats moves the connection
+	hub.viewChat(phone, "8")
+	if viewers := hub.chatViewers(1, "7"); len(viewers) != 1 || viewers[0] != tab {
+		t.Errorf("Expected only the tab to view the chat, got %v", viewers)
+	}
+
+	// A disconnected client is removed from every index
+	hub.removeClient(tab)
+	if viewers := hub.chatViewers(1, "7"); len(viewers) != 0 {
+		t.Errorf("Expected no viewer after disconnecting, got %d", len(viewers))
+	}
+	if clients := hub.userClients(1); len(clients) != 1 {
+		t.Errorf("Expected 1 connection of the user, got %d", len(clients))
+	}
+	if len(hub.viewers) != 2 {
+		t.Errorf("Expected empty indexes to be removed, got %d entries", len(hub.viewers))
+	}
+}
+
+func TestStreamFanOut(t *testing.T) {
+	hub := NewHub(nil)
+	tab := newTestClient(hub, 1)
+	phone := newTestClient(hub, 1)
+	elsewhere := newTestClient(hub, 1)
+	other := newTestClient(hub, 2)
+	for _, client := range []*Client{tab, phone, elsewhere, other} {
+		hub.addClient(client)
+	}
+	viewChat(hub, tab, "7")
+	viewChat(hub, elsewhere, "8")
+	viewChat(hub, other, "7")
+
+	stream, _ := hub.createStream(1, "7")
+	stream.Subscribe(tab, 0)
+	stream.Append("Hello")
+	receiveStream(t, tab)
+
+	// Opening the chat while the answer is generated replays it from the start
+	viewChat(hub, phone, "7")
+	if chunk := receiveStream(t, phone); chunk.Content != "Hello" || chunk.StreamID != stream.ID {
+		t.Errorf("Expected the stream from the start, got %+v", chunk)
+	}
+	// Viewing the chat again does not replay the stream twice
+	viewChat(hub, phone, "7")
+
+	stream.Append(" world")
+	for _, client := range []*Client{tab, phone} {
+		if chunk := receiveStream(t, client); chunk.Content != " world" {
+			t.Errorf("Expected the live chunk, got %+v", chunk)
+		}
+	}
+
+	// Other chats and other users receive nothing
+	expectNoMessage(t, phone)
+	expectNoMessage(t, elsewhere)
+	expectNoMessage(t, other)
+}
+
+func TestSendToUser(t *testing.T) {
+	hub := NewHub(nil)
+	tab := newTestClient(hub, 1)
+	phone := newTestClient(hub, 1)
+	other := newTestClient(hub, 2)
+	for _, client := range []*Client{tab, phone, other} {
+		hub.addClient(client)
+	}
+	hub.viewChat(tab, "7")
+	hub.viewChat(phone, "7")
+	hub.viewChat(other, "7")
+
+	hub.sendToUser(1, Message{Type: TypeChatTitle, Content: ChatTitleUpdate{ChatID: "7", Title: "Renamed"}})
+	for _, client := range []*Client{tab, phone} {
+		if msg := receive(t, client); msg.Type != TypeChatTitle {
+			t.Errorf("Expected a title update, got %s", msg.Type)
+		}
+	}
+	expectNoMessage(t, other)
+
+	// The sender already displays its own message
+	hub.sendToChat(1, "7", Message{Type: TypeChatMessage}, tab)
+	if msg := receive(t, phone); msg.Type != TypeChatMessage {
+		t.Errorf("Expected a chat message, got %s", msg.Type)
+	}
+	expectNoMessage(t, tab)
+	expectNoMessage(t, other)
+}
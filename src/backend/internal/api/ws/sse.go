@@ -0,0 +1,137 @@
+package ws
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"time"
+
+	"gitlab.cherkaoui.ch/quillium-ai/quillium/src/backend/internal/api/restapi/middleware"
+)
+
+// Interval of the comments sent to keep idle event streams open through proxies
+const sseKeepAlivePeriod = 15 * time.Second
+
+// sseMessage is a message queued for an event stream client, the content is forwarded as is
+type sseMessage struct {
+	Type    string          `json:"type"`
+	Content json.RawMessage `json:"content"`
+}
+
+// ServeSSE handles a chat request over Server-Sent Events, for clients that cannot open a websocket.
+// The body is a ChatRequest and the messages a websocket client would receive are sent as events
+// named after their type, until the chat is saved.
+func ServeSSE(hub *Hub, w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Method not allowed"})
+		return
+	}
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Streaming not supported"})
+		return
+	}
+
+	userID, ok := middleware.GetUserID(r.Context())
+	if !ok {
+		w.WriteHeader(http.StatusUnauthorized)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Unauthorized"})
+		return
+	}
+
+	var chatReq ChatRequest
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxMessageSize)).Decode(&chatReq); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Invalid chat request format"})
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	// The request is handled like a websocket message of a client that is not registered in the hub,
+	// so it receives the events of its own request only
+	ctx, cancel := context.WithCancel(context.Background())
+	client := &Client{
+		hub:    hub,
+		send:   make(chan []byte, 256),
+		userID: userID,
+		ctx:    ctx,
+		cancel: cancel,
+	}
+	hub.viewChat(client, chatReq.ChatID)
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		processChatRequest(client, chatReq)
+	}()
+
+	streamEvents(r.Context(), w, flusher, client, done)
+
+	// When the client went away the generation continues for the grace period,
+	// so the stream can still be resumed over a websocket
+	client.cancel()
+	go hub.detachClient(client)
+}
+
+// streamEvents writes the messages sent to the client as events until done is closed or ctx is cancelled
+func streamEvents(ctx context.Context, w io.Writer, flusher http.Flusher, client *Client, done <-chan struct{}) {
+	keepAlive := time.NewTicker(sseKeepAlivePeriod)
+	defer keepAlive.Stop()
+
+	for {
+		select {
+		case data := <-client.send:
+			if err := writeEvent(w, data); err != nil {
+				return
+			}
+			flusher.Flush()
+		case <-keepAlive.C:
+			if _, err := io.WriteString(w, ": keep-alive\n\n"); err != nil {
+				return
+			}
+			flusher.Flush()
+		case <-done:
+			// Deliver the messages queued before the processing returned
+			for {
+				select {
+				case data := <-client.send:
+					if err := writeEvent(w, data); err != nil {
+						return
+					}
+				default:
+					flusher.Flush()
+					return
+				}
+			}
+		case <-ctx.Done():
+			return
+		case <-client.ctx.Done():
+			// The client was too slow and got disconnected
+			return
+		}
+	}
+}
+
+// writeEvent writes a queued message as an event with its type as name and its content as data
+func writeEvent(w io.Writer, data []byte) error {
+	var msg sseMessage
+	if err := json.Unmarshal(data, &msg); err != nil {
+		log.Printf("Error parsing queued message: %v", err)
+		return nil
+	}
+	_, err := fmt.Fprintf(w, "event: %s\ndata: %s\n\n", msg.Type, msg.Content)
+	return err
+}
@@ -0,0 +1,91 @@
+package ws
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"gitlab.cherkaoui.ch/quillium-ai/quillium/src/backend/internal/api/restapi/middleware"
+)
+
+func TestServeSSERejectsInvalidRequests(t *testing.T) {
+	hub := NewHub(nil)
+
+	testCases := []struct {
+		name           string
+		method         string
+		body           string
+		authenticated  bool
+		expectedStatus int
+	}{
+		{"GET is not allowed", http.MethodGet, "", true, http.StatusMethodNotAllowed},
+		{"Missing user", http.MethodPost, `{"messages":[]}`, false, http.StatusUnauthorized},
+		{"Invalid body", http.MethodPost, `{"messages":`, true, http.StatusBadRequest},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest(tc.method, "/api/v1/chat/stream", strings.NewReader(tc.body))
+			if tc.authenticated {
+				req = req.WithContext(middleware.AddUserToContext(req.Context(), 1, false, true))
+			}
+			rec := httptest.NewRecorder()
+
+			ServeSSE(hub, rec, req)
+
+			if rec.Code != tc.expectedStatus {
+				t.Errorf("Expected status %d, got %d", tc.expectedStatus, rec.Code)
+			}
+			if contentType := rec.Header().Get("Content-Type"); contentType != "application/json" {
+				t.Errorf("Expected a JSON error, got %s", contentType)
+			}
+		})
+	}
+}
+
+func TestStreamEvents(t *testing.T) {
+	hub := NewHub(nil)
+	client := newTestClient(hub, 1)
+
+	sendChatStreamResponse(client, ChatStreamResponse{StreamID: "abc", ChatID: "7", Content: "Hello", Offset: 1})
+	sendChatStreamResponse(client, ChatStreamResponse{StreamID: "abc", ChatID: "7", Done: true, Offset: 1})
+	sendErrorResponse(client, "Error updating chat")
+
+	// The processing already returned, every queued message must still be written
+	done := make(chan struct{})
+	close(done)
+
+	rec := httptest.NewRecorder()
+	streamEvents(context.Background(), rec, rec, client, done)
+
+	expected := "event: chat_stream\n" +
+		`data: {"streamId":"abc","chatId":"7","content":"Hello","done":false,"offset":1}` + "\n\n" +
+		"event: chat_stream\n" +
+		`data: {"streamId":"abc","chatId":"7","content":"","done":true,"offset":1}` + "\n\n" +
+		"event: error\n" +
+		`data: {"error":"Error updating chat"}` + "\n\n"
+	if body := rec.Body.String(); body != expected {
+		t.Errorf("Unexpected events:\n%s\nexpected:\n%s", body, expected)
+	}
+	if !rec.Flushed {
+		t.Error("Expected the events to be flushed")
+	}
+}
+
+func TestStreamEventsStopsWhenClientLeaves(t *testing.T) {
+	hub := NewHub(nil)
+	client := newTestClient(hub, 1)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	// The processing keeps running, the handler must return anyway
+	rec := httptest.NewRecorder()
+	streamEvents(ctx, rec, rec, client, make(chan struct{}))
+
+	if rec.Body.Len() != 0 {
+		t.Errorf("Expected no events, got %q", rec.Body.String())
+	}
+}
@@ -0,0 +1,294 @@
+package ws
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"time"
+
+	"gitlab.cherkaoui.ch/quillium-ai/quillium/src/backend/internal/chats"
+	"gitlab.cherkaoui.ch/quillium-ai/quillium/src/backend/internal/security"
+)
+
+const (
+	// How long a finished stream can still be resumed
+	streamRetention = 5 * time.Minute
+
+	// How long a generation keeps running without any connected client before it is cancelled
+	detachGracePeriod = 30 * time.Second
+)
+
+// createStream registers a new stream for a generation of the user
+func (h *Hub) createStream(userID int, chatID string) (*Stream, error) {
+	id, err := security.GenerateRandomString(16)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	stream := &Stream{
+		ID:          id,
+		ChatID:      chatID,
+		UserID:      userID,
+		ctx:         ctx,
+		cancel:      cancel,
+		subscribers: make(map[*Client]bool),
+		hub:         h,
+	}
+
+	h.streamsLock.Lock()
+	h.streams[id] = stream
+	h.streamsLock.Unlock()
+	return stream, nil
+}
+
+// getStream returns the stream with the given ID if it belongs to the user
+func (h *Hub) getStream(id string, userID int) (*Stream, bool) {
+	h.streamsLock.Lock()
+	defer h.streamsLock.Unlock()
+
+	stream, ok := h.streams[id]
+	if !ok || stream.UserID != userID {
+		return nil, false
+	}
+	return stream, true
+}
+
+// removeStream forgets a stream, it can no longer be resumed
+func (h *Hub) removeStream(id string) {
+	h.streamsLock.Lock()
+	delete(h.streams, id)
+	h.streamsLock.Unlock()
+}
+
+// cancelStreams stops the running generations of a user for a chat,
+// or all generations of the user when chatID is empty. It returns the number of cancelled streams.
+func (h *Hub) cancelStreams(userID int, chatID string) int {
+	h.streamsLock.Lock()
+	defer h.streamsLock.Unlock()
+
+	cancelled := 0
+	for _, stream := range h.streams {
+		if stream.UserID == userID && (chatID == "" || stream.ChatID == chatID) && !stream.isDone() {
+			stream.cancel()
+			cancelled++
+		}
+	}
+	return cancelled
+}
+
+// chatStreams returns the running streams of a user for a chat
+func (h *Hub) chatStreams(userID int, chatID string) []*Stream {
+	h.streamsLock.Lock()
+	defer h.streamsLock.Unlock()
+
+	var streams []*Stream
+	for _, stream := range h.streams {
+		if chatID != "" && stream.UserID == userID && stream.ChatID == chatID && !stream.isDone() {
+			streams = append(streams, stream)
+		}
+	}
+	return streams
+}
+
+// detachClient removes a disconnected client from all streams it was following
+func (h *Hub) detachClient(client *Client) {
+	h.streamsLock.Lock()
+	streams := make([]*Stream, 0, len(h.streams))
+	for _, stream := range h.streams {
+		streams = append(streams, stream)
+	}
+	h.streamsLock.Unlock()
+
+	for _, stream := range streams {
+		stream.Unsubscribe(client)
+	}
+}
+
+// Context returns the context of the generation, cancelled by chat_cancel or when no client follows the stream
+func (s *Stream) Context() context.Context {
+	return s.ctx
+}
+
+// Append adds a chunk of generated content and sends it to the subscribed clients
+func (s *Stream) Append(content string) {
+	s.mu.Lock()
+	s.chunks = append(s.chunks, content)
+	msg := Message{Type: TypeChatStream, Content: ChatStreamResponse{
+		StreamID: s.ID,
+		ChatID:   s.ChatID,
+		Content:  content,
+		Offset:   len(s.chunks),
+	}}
+	s.unlockAndDeliver(s.subscriberList(), msg)
+}
+
+// Finish marks the stream as complete and sends the final message with the sources
+func (s *Stream) Finish(sources []chats.Source, stopped bool) {
+	s.mu.Lock()
+	s.done = true
+	s.stopped = stopped
+	s.sources = sources
+	subscribers := s.subscriberList()
+	msg := Message{Type: TypeChatStream, Content: s.finalResponse()}
+	s.expire()
+	s.unlockAndDeliver(subscribers, msg)
+}
+
+// Fail marks the stream as failed and sends the error to the subscribed clients
+func (s *Stream) Fail(errorMsg string) {
+	s.mu.Lock()
+	s.done = true
+	s.failure = errorMsg
+	subscribers := s.subscriberList()
+	s.expire()
+	s.unlockAndDeliver(subscribers, Message{Type: TypeError, Content: ErrorResponse{Error: errorMsg}})
+}
+
+// Subscribe sends the chunks from offset on to the client and keeps it updated until the stream ends.
+// The missed chunks are sent as a single message. When the stream already ended the client receives
+// the rest of the answer followed by the final message.
+func (s *Stream) Subscribe(client *Client, offset int) error {
+	s.mu.Lock()
+
+	if offset < 0 || offset > len(s.chunks) {
+		s.mu.Unlock()
+		return errors.New("invalid stream offset")
+	}
+
+	var msgs []Message
+	if offset < len(s.chunks) {
+		var missed string
+		for _, chunk := range s.chunks[offset:] {
+			missed += chunk
+		}
+		msgs = append(msgs, Message{Type: TypeChatStream, Content: ChatStreamResponse{
+			StreamID: s.ID,
+			ChatID:   s.ChatID,
+			Content:  missed,
+			Offset:   len(s.chunks),
+		}})
+	}
+
+	if s.done {
+		if s.failure != "" {
+			msgs = append(msgs, Message{Type: TypeError, Content: ErrorResponse{Error: s.failure}})
+		} else {
+			msgs = append(msgs, Message{Type: TypeChatStream, Content: s.finalResponse()})
+		}
+		s.unlockAndDeliver([]*Client{client}, msgs...)
+		return nil
+	}
+
+	// A client that disconnected before subscribing is never detached from the stream,
+	// the generation is cancelled after the grace period as if it had unsubscribed
+	if client.ctx.Err() != nil {
+		s.scheduleDetach()
+		s.mu.Unlock()
+		return nil
+	}
+
+	s.subscribers[client] = true
+	if s.detachTimer != nil {
+		s.detachTimer.Stop()
+		s.detachTimer = nil
+	}
+	s.unlockAndDeliver([]*Client{client}, msgs...)
+	return nil
+}
+
+// Unsubscribe stops sending the stream to the client.
+// A running generation without any subscriber is cancelled after the grace period,
+// unless a client resumes the stream before.
+func (s *Stream) Unsubscribe(client *Client) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if !s.subscribers[client] {
+		return
+	}
+	delete(s.subscribers, client)
+	s.scheduleDetach()
+}
+
+// scheduleDetach cancels a running generation after the grace period when no client follows it.
+// The caller must hold the lock.
+func (s *Stream) scheduleDetach() {
+	if len(s.subscribers) == 0 && !s.done && s.detachTimer == nil {
+		s.detachTimer = time.AfterFunc(detachGracePeriod, func() {
+			log.Printf("No client resumed stream %s, cancelling generation", s.ID)
+			s.cancel()
+		})
+	}
+}
+
+// hasSubscriber reports whether the client follows the stream
+func (s *Stream) hasSubscriber(client *Client) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.subscribers[client]
+}
+
+// isDone reports whether the generation has ended
+func (s *Stream) isDone() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.done
+}
+
+// subscriberList returns the subscribed clients, the caller must hold the lock
+func (s *Stream) subscriberList() []*Client {
+	clients := make([]*Client, 0, len(s.subscribers))
+	for client := range s.subscribers {
+		clients = append(clients, client)
+	}
+	return clients
+}
+
+// unlockAndDeliver releases the lock held by the caller and queues the messages for the clients.
+// The delivery lock is taken first, so messages reach the clients in the order the stream changed
+// while the stream stays available to the hub and to the generation.
+func (s *Stream) unlockAndDeliver(clients []*Client, msgs ...Message) {
+	s.deliverMu.Lock()
+	defer s.deliverMu.Unlock()
+	s.mu.Unlock()
+
+	for _, msg := range msgs {
+		data, err := json.Marshal(msg)
+		if err != nil {
+			log.Printf("Error marshaling message: %v", err)
+			continue
+		}
+		for _, client := range clients {
+			queueMessage(client, data)
+		}
+	}
+}
+
+// finalResponse builds the message that ends the stream, the caller must hold the lock
+func (s *Stream) finalResponse() ChatStreamResponse {
+	return ChatStreamResponse{
+		StreamID: s.ID,
+		ChatID:   s.ChatID,
+		Content:  "",
+		Done:     true,
+		Stopped:  s.stopped,
+		Offset:   len(s.chunks),
+		Sources:  s.sources,
+	}
+}
+
+// expire releases the resources of an ended stream and removes it after the retention period.
+// The caller must hold the lock.
+func (s *Stream) expire() {
+	s.subscribers = make(map[*Client]bool)
+	if s.detachTimer != nil {
+		s.detachTimer.Stop()
+		s.detachTimer = nil
+	}
+	s.cancel()
+	if s.hub != nil {
+		time.AfterFunc(streamRetention, func() { s.hub.removeStream(s.ID) })
+	}
+}
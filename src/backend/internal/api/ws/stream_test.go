@@ -0,0 +1,195 @@
+package ws
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"gitlab.cherkaoui.ch/quillium-ai/quillium/src/backend/internal/chats"
+)
+
+func TestStreamResume(t *testing.T) {
+	hub := NewHub(nil)
+	first := newTestClient(hub, 1)
+
+	stream, err := hub.createStream(1, "7")
+	if err != nil {
+		t.Fatalf("Failed to create stream: %v", err)
+	}
+	stream.Subscribe(first, 0)
+	stream.Append("Hello")
+	stream.Append(" there")
+
+	chunk := receiveStream(t, first)
+	if chunk.StreamID != stream.ID || chunk.Content != "Hello" || chunk.Offset != 1 {
+		t.Errorf("Unexpected first chunk: %+v", chunk)
+	}
+	receiveStream(t, first)
+
+	// The connection drops, chunks generated meanwhile are kept
+	stream.Unsubscribe(first)
+	stream.Append(",")
+	stream.Append(" world")
+
+	// A new connection resumes after the first chunk it received
+	second := newTestClient(hub, 1)
+	data, _ := json.Marshal(Message{Type: TypeChatResume, Content: ChatResumeRequest{StreamID: stream.ID, Offset: 1}})
+	HandleMessage(hub, second, data)
+
+	missed := receiveStream(t, second)
+	if missed.Content != " there, world" || missed.Offset != 4 {
+		t.Errorf("Expected the missed chunks in one message, got %+v", missed)
+	}
+
+	// Live chunks follow
+	stream.Append("!")
+	live := receiveStream(t, second)
+	if live.Content != "!" || live.Offset != 5 {
+		t.Errorf("Unexpected live chunk: %+v", live)
+	}
+
+	stream.Finish([]chats.Source{{Title: "Source", URL: "https://example.com"}}, false)
+	final := receiveStream(t, second)
+	if !final.Done || final.Offset != 5 || len(final.Sources) != 1 {
+		t.Errorf("Unexpected final message: %+v", final)
+	}
+	if stream.stopped {
+		t.Error("A finished stream must not be marked as stopped")
+	}
+}
+
+func TestStreamResumeFinished(t *testing.T) {
+	hub := NewHub(nil)
+	stream, _ := hub.createStream(1, "7")
+	stream.Append("The answer")
+	stream.Finish(nil, false)
+
+	// The generation completed while the client was away
+	client := newTestClient(hub, 1)
+	data, _ := json.Marshal(Message{Type: TypeChatResume, Content: ChatResumeRequest{StreamID: stream.ID, Offset: 0}})
+	HandleMessage(hub, client, data)
+
+	if rest := receiveStream(t, client); rest.Content != "The answer" {
+		t.Errorf("Expected the full answer, got %+v", rest)
+	}
+	if final := receiveStream(t, client); !final.Done {
+		t.Errorf("Expected the final message, got %+v", final)
+	}
+}
+
+func TestStreamResumeErrors(t *testing.T) {
+	hub := NewHub(nil)
+	stream, _ := hub.createStream(1, "7")
+	stream.Append("chunk")
+
+	testCases := []struct {
+		name   string
+		userID int
+		req    ChatResumeRequest
+	}{
+		{"Unknown stream", 1, ChatResumeRequest{StreamID: "missing"}},
+		{"Stream of another user", 2, ChatResumeRequest{StreamID: stream.ID}},
+		{"Offset beyond the stream", 1, ChatResumeRequest{StreamID: stream.ID, Offset: 5}},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			client := newTestClient(hub, tc.userID)
+			data, _ := json.Marshal(Message{Type: TypeChatResume, Content: tc.req})
+			HandleMessage(hub, client, data)
+
+			if msg := receive(t, client); msg.Type != TypeError {
+				t.Errorf("Expected an error, got %s", msg.Type)
+			}
+		})
+	}
+}
+
+func TestStreamDetachCancels(t *testing.T) {
+	hub := NewHub(nil)
+	client := newTestClient(hub, 1)
+	stream, _ := hub.createStream(1, "7")
+	stream.Subscribe(client, 0)
+
+	stream.Unsubscribe(client)
+	if stream.detachTimer == nil {
+		t.Fatal("Expected the generation to be scheduled for cancellation")
+	}
+
+	// Resuming within the grace period keeps the generation running
+	stream.Subscribe(client, 0)
+	if stream.detachTimer != nil {
+		t.Error("Expected resuming to stop the scheduled cancellation")
+	}
+	if stream.Context().Err() != nil {
+		t.Error("Expected the generation to keep running")
+	}
+}
+
+func TestStreamSubscribeAfterDisconnect(t *testing.T) {
+	hub := NewHub(nil)
+	client := newTestClient(hub, 1)
+
+	// The client left before its generation started, detaching it found no stream
+	client.cancel()
+	hub.detachClient(client)
+	stream, _ := hub.createStream(1, "7")
+	stream.Subscribe(client, 0)
+
+	if stream.hasSubscriber(client) {
+		t.Error("Expected a disconnected client not to be subscribed")
+	}
+	if stream.detachTimer == nil {
+		t.Fatal("Expected the generation to be scheduled for cancellation")
+	}
+
+	// A connected client resuming the stream keeps the generation running
+	other := newTestClient(hub, 1)
+	stream.Subscribe(other, 0)
+	if stream.detachTimer != nil {
+		t.Error("Expected resuming to stop the scheduled cancellation")
+	}
+}
+
+func TestStreamSlowSubscriber(t *testing.T) {
+	hub := NewHub(nil)
+	fast := newTestClient(hub, 1)
+	slow := newTestClient(hub, 1)
+	slow.send = make(chan []byte, 1)
+
+	stream, _ := hub.createStream(1, "7")
+	stream.Subscribe(fast, 0)
+	stream.Subscribe(slow, 0)
+
+	// The slow client never reads, the generation must not wait for it
+	done := make(chan struct{})
+	go func() {
+		for i := 0; i < 3; i++ {
+			stream.Append("chunk")
+		}
+		stream.Finish(nil, false)
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("A slow subscriber blocked the generation")
+	}
+
+	for i := 1; i <= 3; i++ {
+		if chunk := receiveStream(t, fast); chunk.Offset != i {
+			t.Errorf("Expected chunk %d, got %+v", i, chunk)
+		}
+	}
+	if final := receiveStream(t, fast); !final.Done {
+		t.Errorf("Expected the final message, got %+v", final)
+	}
+
+	// The slow client is disconnected, it resumes the stream after reconnecting
+	if slow.ctx.Err() == nil {
+		t.Error("Expected the slow client to be disconnected")
+	}
+	if fast.ctx.Err() != nil {
+		t.Error("Expected the fast client to stay connected")
+	}
+}
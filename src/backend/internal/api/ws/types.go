@@ -1,94 +1,169 @@
-package ws
-
-import (
-	"sync"
-
-	"github.com/Quillium-AI/Quillium/src/backend/internal/chats"
-	"github.com/gorilla/websocket"
-)
-
-// Hub maintains the set of active clients and broadcasts messages to the clients
-type Hub struct {
-	// Registered clients
-	clients map[*Client]bool
-
-	// Inbound messages from the clients
-	broadcast chan []byte
-
-	// Register requests from the clients
-	register chan *Client
-
-	// Unregister requests from clients
-	unregister chan *Client
-}
-
-// ChatSession represents an active chat session
-type ChatSession struct {
-	ChatID   string
-	UserID   string
-	Messages []chats.Message
-	Title    string
-}
-
-// ChatManager manages active chat sessions
-type ChatManager struct {
-	sessions map[string]*ChatSession
-	mutex    sync.RWMutex
-}
-
-// Message represents a message sent between clients
-type Message struct {
-	Type    string      `json:"type"`
-	Content interface{} `json:"content"`
-	Sender  string      `json:"sender,omitempty"`
-}
-
-// ChatMessage represents a chat message with its metadata
-type ChatMessage struct {
-	ChatID  string        `json:"chatId"`
-	Message chats.Message `json:"message"`
-}
-
-// ChatRequest represents a request to start or continue a chat
-type ChatRequest struct {
-	ChatID   string          `json:"chatId"`
-	Messages []chats.Message `json:"messages"`
-	Options  ChatOptions     `json:"options"`
-}
-
-// ChatOptions represents options for a chat request
-type ChatOptions struct {
-	QualityProfile string  `json:"qualityProfile"`
-	Temperature    float64 `json:"temperature"`
-	MaxTokens      int     `json:"maxTokens"`
-}
-
-// ChatStreamResponse represents a streaming response from the AI
-type ChatStreamResponse struct {
-	ChatID  string         `json:"chatId"`
-	Content string         `json:"content"`
-	Done    bool           `json:"done"`
-	Sources []chats.Source `json:"sources,omitempty"`
-}
-
-// ErrorResponse represents an error response
-type ErrorResponse struct {
-	Error string `json:"error"`
-}
-
-// Client is a middleman between the websocket connection and the hub
-type Client struct {
-	hub *Hub
-
-	// The websocket connection
-	conn *websocket.Conn
-
-	// Buffered channel of outbound messages
-	send chan []byte
-
-	// User ID associated with this client
-	userID int
-
-	// Current active chat ID
-	activeChatID string
-}
+package ws
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"gitlab.cherkaoui.ch/quillium-ai/quillium/src/backend/internal/chats"
+	"gitlab.cherkaoui.ch/quillium-ai/quillium/src/backend/internal/db"
+)
+
+// Hub maintains the set of active clients and broadcasts messages to the clients.
+// Clients are indexed by user and by viewed chat, so chat events reach every
+// connection of the user viewing the chat and never the connections of other users.
+type Hub struct {
+	// Registered clients
+	clients map[*Client]bool
+
+	// Registered clients by user ID, and by the chat they are viewing
+	users       map[int]map[*Client]bool
+	viewers     map[chatKey]map[*Client]bool
+	clientsLock sync.RWMutex
+
+	// Inbound messages from the clients
+	broadcast chan []byte
+
+	// Register requests from the clients
+	register chan *Client
+
+	// Unregister requests from clients
+	unregister chan *Client
+
+	// Shared storage
+	db db.Store
+
+	// Streams of running and recently finished generations, by stream ID
+	streams     map[string]*Stream
+	streamsLock sync.Mutex
+}
+
+// chatKey identifies a chat of a user in the hub indexes
+type chatKey struct {
+	userID int
+	chatID string
+}
+
+// ChatSession represents an active chat session
+type ChatSession struct {
+	ChatID   string
+	UserID   string
+	Messages []chats.Message
+	Title    string
+}
+
+// ChatManager manages active chat sessions
+type ChatManager struct {
+	sessions map[string]*ChatSession
+	mutex    sync.RWMutex
+	db       db.Store
+}
+
+// Message represents a message sent between clients
+type Message struct {
+	Type    string      `json:"type"`
+	Content interface{} `json:"content"`
+	Sender  string      `json:"sender,omitempty"`
+}
+
+// ChatMessage represents a chat message with its metadata
+type ChatMessage struct {
+	ChatID  string        `json:"chatId"`
+	Message chats.Message `json:"message"`
+}
+
+// ChatRequest represents a request to start or continue a chat
+type ChatRequest struct {
+	ChatID   string          `json:"chatId"`
+	Messages []chats.Message `json:"messages"`
+	Options  ChatOptions     `json:"options"`
+}
+
+// ChatOptions represents options for a chat request
+type ChatOptions struct {
+	QualityProfile string   `json:"qualityProfile"`
+	Temperature    *float64 `json:"temperature"` // Omitted to use the provider default
+	MaxTokens      int      `json:"maxTokens"`   // 0 to use the provider default
+}
+
+// ChatStreamResponse represents a streaming response from the AI
+type ChatStreamResponse struct {
+	StreamID string         `json:"streamId"`
+	ChatID   string         `json:"chatId"`
+	Content  string         `json:"content"`
+	Done     bool           `json:"done"`
+	Stopped  bool           `json:"stopped,omitempty"` // Set on the final message when the generation was cancelled
+	Offset   int            `json:"offset"`            // Number of chunks delivered so far, used to resume the stream
+	Sources  []chats.Source `json:"sources,omitempty"`
+}
+
+// ChatResumeRequest represents a request to continue receiving a stream after reconnecting
+type ChatResumeRequest struct {
+	StreamID string `json:"streamId"`
+	Offset   int    `json:"offset"` // Offset of the last message received from the stream
+}
+
+// Stream is the server side log of an answer being generated. Chunks are kept after the
+// generation ended so that clients whose connection dropped can resume from their last offset.
+type Stream struct {
+	ID     string
+	ChatID string
+	UserID int
+
+	ctx    context.Context
+	cancel context.CancelFunc
+	hub    *Hub
+
+	mu          sync.Mutex
+	deliverMu   sync.Mutex // Serializes the messages sent to the subscribers
+	chunks      []string
+	done        bool
+	stopped     bool
+	failure     string
+	sources     []chats.Source
+	subscribers map[*Client]bool
+	detachTimer *time.Timer
+}
+
+// ErrorResponse represents an error response
+type ErrorResponse struct {
+	Error string `json:"error"`
+}
+
+// ChatViewRequest tells the server which chat a connection is displaying
+type ChatViewRequest struct {
+	ChatID string `json:"chatId"` // Empty when no saved chat is displayed
+}
+
+// ChatTitleUpdate notifies the connections of a user that a chat was created or renamed
+type ChatTitleUpdate struct {
+	ChatID string `json:"chatId"`
+	Title  string `json:"title"`
+}
+
+// ChatCancelRequest represents a request to stop generating the answer of a chat
+type ChatCancelRequest struct {
+	ChatID string `json:"chatId"` // Empty to stop every generation of the connection
+}
+
+// Client is a middleman between the websocket connection and the hub
+type Client struct {
+	hub *Hub
+
+	// Context of the connection, cancelled when the client disconnects
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	// The websocket connection
+	conn *websocket.Conn
+
+	// Buffered channel of outbound messages
+	send chan []byte
+
+	// User ID associated with this client
+	userID int
+
+	// Current active chat ID, guarded by the clientsLock of the hub
+	activeChatID string
+}
@@ -153,3 +153,47 @@ func TestChatContentFromJSONInvalid(t *testing.T) {
 		t.Error("Expected error when parsing invalid JSON, but got nil")
 	}
 }
+
+func TestChatContentGenerationRoundTrip(t *testing.T) {
+	temperature := 0.3
+	chatContent := &ChatContent{
+		Title: "Test Chat",
+		Messages: []Message{
+			{Role: "user", Content: "Hello"},
+			{
+				Role:    "assistant",
+				Content: "Hi!",
+				Generation: &Generation{
+					QualityProfile: "quality",
+					Provider:       "openai",
+					Model:          "gpt-4o",
+					Temperature:    &temperature,
+					MaxTokens:      512,
+				},
+			},
+		},
+	}
+
+	jsonStr, err := chatContent.ToJSON()
+	if err != nil {
+		t.Fatalf("Failed to convert chat content to JSON: %v", err)
+	}
+
+	result, err := (&ChatContent{}).FromJSON(jsonStr)
+	if err != nil {
+		t.Fatalf("Failed to parse chat content: %v", err)
+	}
+
+	// User messages carry no generation settings
+	if result.Messages[0].Generation != nil {
+		t.Errorf("Expected no generation settings on the user message, got %+v", result.Messages[0].Generation)
+	}
+
+	generation := result.Messages[1].Generation
+	if generation == nil {
+		t.Fatal("Expected generation settings on the assistant message")
+	}
+	if generation.Model != "gpt-4o" || generation.MaxTokens != 512 || generation.Temperature == nil || *generation.Temperature != 0.3 {
+		t.Errorf("Unexpected generation settings: %+v", generation)
+	}
+}
@@ -2,9 +2,20 @@ package chats
 
 // Message represents a single message in a chat conversation
 type Message struct {
-	Role    string `json:"role"`    // "user" or "assistant"
-	Content string `json:"content"` // The message content
-	MsgNum  int    `json:"msg_num"` // Message number for reference
+	Role       string      `json:"role"`                 // "user" or "assistant"
+	Content    string      `json:"content"`              // The message content
+	MsgNum     int         `json:"msg_num"`              // Message number for reference
+	Generation *Generation `json:"generation,omitempty"` // Settings that produced an assistant message
+	Stopped    bool        `json:"stopped,omitempty"`    // The user stopped the generation, the content is partial
+}
+
+// Generation records the model and sampling settings used to generate an assistant message
+type Generation struct {
+	QualityProfile string   `json:"quality_profile"`
+	Provider       string   `json:"provider"`
+	Model          string   `json:"model"`
+	Temperature    *float64 `json:"temperature,omitempty"` // Empty when the provider default was used
+	MaxTokens      int      `json:"max_tokens,omitempty"`  // Empty when the provider default was used
 }
 
 // Source represents a source of information used in a response
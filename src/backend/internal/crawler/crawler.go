@@ -0,0 +1,194 @@
+// Package crawler finds and fetches live web pages through the webcrawler
+// service configured with webcrawler_url in the admin settings. The service
+// must answer two GET endpoints below that URL:
+//
+//   - /search?q=<query>&limit=<n> returns the candidate URLs for the query,
+//     most relevant first, as JSON: {"urls": ["https://..."]}. URLs beyond
+//     the limit are ignored.
+//   - /fetch?url=<page URL> returns the page itself, as HTML or another text/*
+//     content type, with status 200.
+//
+// Other statuses are errors. Pages that fail to fetch are skipped.
+package crawler
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"gitlab.cherkaoui.ch/quillium-ai/quillium/src/backend/internal/search"
+	"gitlab.cherkaoui.ch/quillium-ai/quillium/src/backend/internal/settings"
+)
+
+// maxPageSize is the maximum number of bytes read from a fetched page
+const maxPageSize = 5 * 1024 * 1024
+
+// maxSnippetLength is the number of characters of page text passed to the model
+const maxSnippetLength = 1500
+
+// NewClient creates a new crawler client for the service at baseURL
+func NewClient(baseURL string) *Client {
+	return &Client{
+		baseURL:    strings.TrimRight(baseURL, "/"),
+		httpClient: &http.Client{Timeout: 20 * time.Second},
+	}
+}
+
+// NewClientFromSettings creates a client using the webcrawler URL in the admin settings
+func NewClientFromSettings(adminSettings *settings.AdminSettings) (*Client, error) {
+	if adminSettings == nil || adminSettings.WebcrawlerURL == "" {
+		return nil, errors.New("webcrawler is not configured")
+	}
+	return NewClient(adminSettings.WebcrawlerURL), nil
+}
+
+// FindURLs asks the crawler service for the best candidate URLs for a query
+func (c *Client) FindURLs(ctx context.Context, query string, limit int) ([]string, error) {
+	params := url.Values{}
+	params.Set("q", query)
+	params.Set("limit", strconv.Itoa(limit))
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.baseURL+"/search?"+params.Encode(), nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create crawler request: %w", err)
+	}
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("crawler request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("crawler search error: %s", resp.Status)
+	}
+
+	var searchResp searchResponse
+	if err := json.NewDecoder(resp.Body).Decode(&searchResp); err != nil {
+		return nil, fmt.Errorf("failed to decode crawler response: %w", err)
+	}
+
+	urls := searchResp.URLs
+	if len(urls) > limit {
+		urls = urls[:limit]
+	}
+	return urls, nil
+}
+
+// FetchPage fetches a page through the crawler service and extracts its readable text
+func (c *Client) FetchPage(ctx context.Context, pageURL string) (*Page, error) {
+	params := url.Values{}
+	params.Set("url", pageURL)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.baseURL+"/fetch?"+params.Encode(), nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create crawler request: %w", err)
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("crawler request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("crawler fetch error for %s: %s", pageURL, resp.Status)
+	}
+
+	contentType := resp.Header.Get("Content-Type")
+	if contentType != "" && !strings.Contains(contentType, "html") && !strings.HasPrefix(contentType, "text/") {
+		return nil, fmt.Errorf("unsupported content type for %s: %s", pageURL, contentType)
+	}
+
+	return ExtractPage(pageURL, io.LimitReader(resp.Body, maxPageSize))
+}
+
+// FetchPages finds candidate URLs for the query and fetches them concurrently.
+// Pages that fail to load or contain no text are skipped.
+func (c *Client) FetchPages(ctx context.Context, query string, limit int) ([]Page, error) {
+	urls, err := c.FindURLs(ctx, query, limit)
+	if err != nil {
+		return nil, err
+	}
+
+	fetched := make([]*Page, len(urls))
+	var wg sync.WaitGroup
+	for i, pageURL := range urls {
+		wg.Add(1)
+		go func(i int, pageURL string) {
+			defer wg.Done()
+			page, err := c.FetchPage(ctx, pageURL)
+			if err != nil {
+				log.Printf("Error fetching %s: %v", pageURL, err)
+				return
+			}
+			fetched[i] = page
+		}(i, pageURL)
+	}
+	wg.Wait()
+
+	// Keep the order returned by the crawler, which reflects relevance
+	pages := make([]Page, 0, len(fetched))
+	for _, page := range fetched {
+		if page != nil && page.Text != "" {
+			pages = append(pages, *page)
+		}
+	}
+	return pages, nil
+}
+
+// Search fetches live pages for the query and returns them as search results
+func (c *Client) Search(ctx context.Context, query string, size int) ([]search.Result, error) {
+	pages, err := c.FetchPages(ctx, query, size)
+	if err != nil {
+		return nil, err
+	}
+	return ToResults(pages), nil
+}
+
+// ToResults converts fetched pages into search results
+func ToResults(pages []Page) []search.Result {
+	results := make([]search.Result, 0, len(pages))
+	for _, page := range pages {
+		snippet := page.Text
+		if runes := []rune(snippet); len(runes) > maxSnippetLength {
+			snippet = string(runes[:maxSnippetLength]) + "..."
+		}
+		results = append(results, search.Result{
+			ID:          DocumentID(page.URL),
+			Title:       page.Title,
+			URL:         page.URL,
+			Description: page.Description,
+			Snippet:     snippet,
+		})
+	}
+	return results
+}
+
+// ToDocument converts a fetched page into an index document
+func (p *Page) ToDocument() search.Document {
+	return search.Document{
+		Title:       p.Title,
+		URL:         p.URL,
+		Description: p.Description,
+		Content:     p.Text,
+	}
+}
+
+// DocumentID returns a stable index document ID for a URL, so re-crawled pages replace older copies
+func DocumentID(pageURL string) string {
+	sum := sha256.Sum256([]byte(pageURL))
+	return hex.EncodeToString(sum[:])
+}
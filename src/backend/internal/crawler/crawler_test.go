@@ -0,0 +1,151 @@
+package crawler
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+const testPage = `<html>
+<head>
+	<title>Go Modules Reference</title>
+	<meta name="description" content="How Go modules work">
+	<script>var tracking = true;</script>
+</head>
+<body>
+	<nav>Home | Docs</nav>
+	<article>
+		<h1>Modules</h1>
+		<p>A module is a collection of packages.</p>
+		<p>The go.mod file defines the module path.</p>
+	</article>
+	<footer>Copyright</footer>
+</body>
+</html>`
+
+// newTestCrawler starts a fake crawler service serving one HTML page and one broken URL
+func newTestCrawler(t *testing.T) *httptest.Server {
+	t.Helper()
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/search":
+			if r.URL.Query().Get("q") == "" {
+				t.Errorf("missing query parameter")
+			}
+			w.Header().Set("Content-Type", "application/json")
+			w.Write([]byte(`{"urls":["https://go.dev/ref/mod","https://broken.example.com","https://go.dev/doc"]}`))
+		case "/fetch":
+			switch r.URL.Query().Get("url") {
+			case "https://go.dev/ref/mod":
+				w.Header().Set("Content-Type", "text/html; charset=utf-8")
+				w.Write([]byte(testPage))
+			case "https://go.dev/doc":
+				w.Header().Set("Content-Type", "text/html; charset=utf-8")
+				w.Write([]byte(`<html><head><title>Docs</title></head><body><p>Documentation</p></body></html>`))
+			default:
+				http.Error(w, "unreachable", http.StatusBadGateway)
+			}
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+}
+
+func TestExtractPage(t *testing.T) {
+	page, err := ExtractPage("https://go.dev/ref/mod", strings.NewReader(testPage))
+	if err != nil {
+		t.Fatalf("ExtractPage failed: %v", err)
+	}
+
+	if page.Title != "Go Modules Reference" {
+		t.Errorf("Expected title 'Go Modules Reference', got '%s'", page.Title)
+	}
+	if page.Description != "How Go modules work" {
+		t.Errorf("Expected meta description, got '%s'", page.Description)
+	}
+	expected := "Modules\nA module is a collection of packages.\nThe go.mod file defines the module path."
+	if page.Text != expected {
+		t.Errorf("Expected text %q, got %q", expected, page.Text)
+	}
+	for _, unwanted := range []string{"tracking", "Home", "Copyright"} {
+		if strings.Contains(page.Text, unwanted) {
+			t.Errorf("Expected %q to be stripped from the text", unwanted)
+		}
+	}
+}
+
+func TestExtractPageFallbacks(t *testing.T) {
+	page, err := ExtractPage("https://example.com", strings.NewReader(`<p>Only some text</p>`))
+	if err != nil {
+		t.Fatalf("ExtractPage failed: %v", err)
+	}
+	if page.Title != "https://example.com" {
+		t.Errorf("Expected the URL as title, got '%s'", page.Title)
+	}
+	if page.Description != "Only some text" {
+		t.Errorf("Expected the text as description, got '%s'", page.Description)
+	}
+}
+
+func TestFetchPages(t *testing.T) {
+	server := newTestCrawler(t)
+	defer server.Close()
+
+	client := NewClient(server.URL)
+	pages, err := client.FetchPages(context.Background(), "go modules", 3)
+	if err != nil {
+		t.Fatalf("FetchPages failed: %v", err)
+	}
+
+	// The broken URL is skipped and the crawler order is preserved
+	if len(pages) != 2 {
+		t.Fatalf("Expected 2 pages, got %d", len(pages))
+	}
+	if pages[0].URL != "https://go.dev/ref/mod" || pages[1].URL != "https://go.dev/doc" {
+		t.Errorf("Unexpected page order: %s, %s", pages[0].URL, pages[1].URL)
+	}
+}
+
+func TestFindURLsLimit(t *testing.T) {
+	server := newTestCrawler(t)
+	defer server.Close()
+
+	client := NewClient(server.URL)
+	urls, err := client.FindURLs(context.Background(), "go modules", 1)
+	if err != nil {
+		t.Fatalf("FindURLs failed: %v", err)
+	}
+	if len(urls) != 1 {
+		t.Errorf("Expected 1 URL, got %d", len(urls))
+	}
+}
+
+func TestSearch(t *testing.T) {
+	server := newTestCrawler(t)
+	defer server.Close()
+
+	client := NewClient(server.URL)
+	results, err := client.Search(context.Background(), "go modules", 3)
+	if err != nil {
+		t.Fatalf("Search failed: %v", err)
+	}
+	if len(results) != 2 {
+		t.Fatalf("Expected 2 results, got %d", len(results))
+	}
+	if results[0].ID != DocumentID("https://go.dev/ref/mod") {
+		t.Errorf("Expected a stable document ID derived from the URL")
+	}
+	if !strings.Contains(results[0].Snippet, "collection of packages") {
+		t.Errorf("Expected the page text in the snippet, got '%s'", results[0].Snippet)
+	}
+}
+
+func TestToDocument(t *testing.T) {
+	page := Page{URL: "https://go.dev", Title: "Go", Description: "The Go language", Text: "Build simple software"}
+	doc := page.ToDocument()
+	if doc.URL != page.URL || doc.Title != page.Title || doc.Description != page.Description || doc.Content != page.Text {
+		t.Errorf("Unexpected document: %+v", doc)
+	}
+}
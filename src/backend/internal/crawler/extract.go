@@ -0,0 +1,147 @@
+package crawler
+
+import (
+	"fmt"
+	"io"
+	"strings"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// maxDescriptionLength is the number of characters of text used when a page has no meta description
+const maxDescriptionLength = 200
+
+// skippedElements never contain readable content
+var skippedElements = map[atom.Atom]bool{
+	atom.Script:   true,
+	atom.Style:    true,
+	atom.Noscript: true,
+	atom.Template: true,
+	atom.Svg:      true,
+	atom.Nav:      true,
+	atom.Header:   true,
+	atom.Footer:   true,
+	atom.Aside:    true,
+	atom.Form:     true,
+	atom.Button:   true,
+	atom.Iframe:   true,
+}
+
+// blockElements start a new line in the extracted text
+var blockElements = map[atom.Atom]bool{
+	atom.P:          true,
+	atom.Div:        true,
+	atom.Section:    true,
+	atom.Article:    true,
+	atom.Main:       true,
+	atom.H1:         true,
+	atom.H2:         true,
+	atom.H3:         true,
+	atom.H4:         true,
+	atom.H5:         true,
+	atom.H6:         true,
+	atom.Li:         true,
+	atom.Tr:         true,
+	atom.Br:         true,
+	atom.Blockquote: true,
+	atom.Pre:        true,
+	atom.Dd:         true,
+	atom.Dt:         true,
+	atom.Figcaption: true,
+}
+
+// ExtractPage parses an HTML document and extracts its title, description and readable text
+func ExtractPage(pageURL string, r io.Reader) (*Page, error) {
+	doc, err := html.Parse(r)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", pageURL, err)
+	}
+
+	page := &Page{URL: pageURL}
+	var lines []string
+	var current strings.Builder
+
+	flush := func() {
+		line := strings.Join(strings.Fields(current.String()), " ")
+		if line != "" {
+			lines = append(lines, line)
+		}
+		current.Reset()
+	}
+
+	var walk func(n *html.Node)
+	walk = func(n *html.Node) {
+		if n.Type == html.ElementNode {
+			switch n.DataAtom {
+			case atom.Title:
+				if page.Title == "" && n.FirstChild != nil {
+					page.Title = strings.Join(strings.Fields(n.FirstChild.Data), " ")
+				}
+				return
+			case atom.Meta:
+				readMeta(n, page)
+				return
+			}
+			if skippedElements[n.DataAtom] {
+				return
+			}
+			if blockElements[n.DataAtom] {
+				flush()
+			}
+		}
+
+		if n.Type == html.TextNode {
+			current.WriteString(n.Data)
+			current.WriteString(" ")
+		}
+
+		for child := n.FirstChild; child != nil; child = child.NextSibling {
+			walk(child)
+		}
+
+		if n.Type == html.ElementNode && blockElements[n.DataAtom] {
+			flush()
+		}
+	}
+	walk(doc)
+	flush()
+
+	page.Text = strings.Join(lines, "\n")
+	if page.Title == "" {
+		page.Title = pageURL
+	}
+	if page.Description == "" && page.Text != "" {
+		description := []rune(strings.ReplaceAll(page.Text, "\n", " "))
+		if len(description) > maxDescriptionLength {
+			description = append(description[:maxDescriptionLength], []rune("...")...)
+		}
+		page.Description = string(description)
+	}
+
+	return page, nil
+}
+
+// readMeta fills the page description from description meta tags
+func readMeta(n *html.Node, page *Page) {
+	var name, content string
+	for _, attr := range n.Attr {
+		switch strings.ToLower(attr.Key) {
+		case "name", "property":
+			name = strings.ToLower(attr.Val)
+		case "content":
+			content = strings.TrimSpace(attr.Val)
+		}
+	}
+	if content == "" {
+		return
+	}
+	switch name {
+	case "description":
+		page.Description = content
+	case "og:description":
+		if page.Description == "" {
+			page.Description = content
+		}
+	}
+}
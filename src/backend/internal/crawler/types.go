@@ -0,0 +1,22 @@
+package crawler
+
+import "net/http"
+
+// Client talks to the Quillium webcrawler service
+type Client struct {
+	baseURL    string
+	httpClient *http.Client
+}
+
+// Page represents a web page fetched through the crawler with its readable text extracted
+type Page struct {
+	URL         string // URL of the page
+	Title       string // Title of the page
+	Description string // Meta description, or the beginning of the text when missing
+	Text        string // Readable text content of the page
+}
+
+// searchResponse is the response of the crawler's /search endpoint
+type searchResponse struct {
+	URLs []string `json:"urls"`
+}
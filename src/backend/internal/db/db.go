@@ -1,667 +1,1099 @@
-package db
-
-import (
-	"context"
-	"encoding/json"
-	"errors"
-	"log"
-	"os"
-	"time"
-
-	"gitlab.cherkaoui.ch/quillium-ai/quillium/src/backend/internal/chats"
-	"gitlab.cherkaoui.ch/quillium-ai/quillium/src/backend/internal/settings"
-	"gitlab.cherkaoui.ch/quillium-ai/quillium/src/backend/internal/sso"
-	"gitlab.cherkaoui.ch/quillium-ai/quillium/src/backend/internal/user"
-	"github.com/jackc/pgx/v5"
-)
-
-type DB struct {
-	*pgx.Conn
-}
-
-func (d *DB) Close() error {
-	return d.Conn.Close(context.Background())
-}
-
-func (d *DB) Ping() error {
-	return d.Conn.Ping(context.Background())
-}
-
-func Initialize() (*DB, error) {
-	pgxConn, err := pgx.Connect(context.Background(), os.Getenv("DATABASE_URL"))
-	if err != nil {
-		return nil, errors.New("failed to connect to database: " + err.Error())
-	}
-
-	err = CreateTables(pgxConn)
-	if err != nil {
-		return nil, errors.New("failed to create tables: " + err.Error())
-	}
-
-	return &DB{Conn: pgxConn}, nil
-}
-
-func CreateTables(conn *pgx.Conn) error {
-	query := `
-		CREATE TABLE IF NOT EXISTS sso_logins (
-			id SERIAL PRIMARY KEY,
-			sso_client_id VARCHAR(255) NOT NULL,
-			sso_client_secret VARCHAR(255) NOT NULL,
-			sso_provider VARCHAR(255) NOT NULL UNIQUE,
-			sso_redirect_url VARCHAR(255) NOT NULL,
-			sso_auth_type VARCHAR(255) NOT NULL CHECK (sso_auth_type IN ('OAuth2', 'SAML', 'OIDC')),
-			created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
-		);
-		CREATE TABLE IF NOT EXISTS users (
-			id SERIAL PRIMARY KEY,
-			email VARCHAR(255) NOT NULL UNIQUE,
-			password_hash TEXT NULL,
-			sso_user_id TEXT NULL,
-			username VARCHAR(255) NOT NULL,
-			is_sso BOOLEAN NOT NULL DEFAULT FALSE,
-			sso_provider_id INT NULL,
-			is_admin BOOLEAN NOT NULL DEFAULT FALSE,
-			created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
-			FOREIGN KEY (sso_provider_id) REFERENCES sso_logins(id) ON DELETE CASCADE,
-			CONSTRAINT chk_sso_provider_id CHECK (
-				(is_sso = TRUE AND sso_provider_id IS NOT NULL) OR
-				(is_sso = FALSE AND sso_provider_id IS NULL)
-			),
-			CONSTRAINT chk_sso_user_id CHECK (
-				(is_sso = TRUE AND sso_user_id IS NOT NULL) OR
-				(is_sso = FALSE)
-			),
-			CONSTRAINT chk_password_hash CHECK (
-				(is_sso = FALSE AND password_hash IS NOT NULL) OR
-				(is_sso = TRUE)
-			)
-		);
-		CREATE INDEX IF NOT EXISTS idx_users_sso_provider_id ON users(sso_provider_id);
-		CREATE TABLE IF NOT EXISTS chat_contents (
-			id SERIAL PRIMARY KEY,
-			user_id INT NOT NULL,
-			content JSONB NOT NULL,
-			sources JSONB NOT NULL,
-			is_public BOOLEAN NOT NULL DEFAULT FALSE,
-			public_uuid VARCHAR(255) NULL UNIQUE,
-			created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
-			FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
-		);
-		CREATE INDEX IF NOT EXISTS idx_chat_contents_user_id ON chat_contents(user_id);
-		CREATE UNIQUE INDEX IF NOT EXISTS idx_chat_contents_public_uuid ON chat_contents(public_uuid) WHERE public_uuid IS NOT NULL;
-		CREATE INDEX IF NOT EXISTS idx_chat_contents_is_public ON chat_contents(is_public) WHERE is_public = TRUE;
-		CREATE TABLE IF NOT EXISTS admin_settings (
-			version SERIAL PRIMARY KEY,
-			config JSONB NOT NULL,
-			created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
-		);
-		CREATE TABLE IF NOT EXISTS user_settings (
-			id SERIAL PRIMARY KEY,
-			user_id INT NOT NULL UNIQUE,
-			config JSONB NOT NULL,
-			created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
-			FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
-		);
-		CREATE INDEX IF NOT EXISTS idx_user_settings_user_id ON user_settings(user_id);
-		CREATE TABLE IF NOT EXISTS user_apikeys (
-			id SERIAL PRIMARY KEY,
-			user_id INT NOT NULL,
-			api_key_encrypt TEXT NOT NULL UNIQUE,
-			created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
-			FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
-		);
-		CREATE INDEX IF NOT EXISTS idx_user_apikeys_user_id ON user_apikeys(user_id);
-		CREATE TABLE IF NOT EXISTS refresh_tokens (
-			id SERIAL PRIMARY KEY,
-			user_id INT NOT NULL,
-			token TEXT NOT NULL UNIQUE,
-			expires_at TIMESTAMP NOT NULL,
-			created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
-			FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
-		);
-		CREATE INDEX IF NOT EXISTS idx_refresh_tokens_user_id ON refresh_tokens(user_id);
-		CREATE INDEX IF NOT EXISTS idx_refresh_tokens_token ON refresh_tokens(token);
-	`
-	_, err := conn.Exec(context.Background(), query)
-	if err != nil {
-		return errors.New("failed to create tables: " + err.Error())
-	}
-	return nil
-}
-
-func (d *DB) CreateUser(user *user.User) (*int, error) {
-	query := `
-		INSERT INTO users (email, password_hash, is_sso, sso_provider_id, is_admin, username)
-		VALUES ($1, $2, $3, $4, $5, $6)
-		RETURNING id
-	`
-	querySettings := `
-		INSERT INTO user_settings (user_id, config)
-		VALUES ($1, '{}')
-	`
-	var id int
-	err := d.Conn.QueryRow(context.Background(), query, user.Email, user.PasswordHash, user.IsSso, user.SsoProviderID, user.IsAdmin, user.Username).Scan(&id)
-	if err != nil {
-		return nil, errors.New("failed to create user: " + err.Error())
-	}
-	_, err = d.Conn.Exec(context.Background(), querySettings, id)
-	if err != nil {
-		return nil, errors.New("failed to create user settings: " + err.Error())
-	}
-	log.Printf("Created user with ID: %d", id)
-	return &id, nil
-}
-
-func (d *DB) CreateSsoProvider(ssoProvider *sso.SsoProvider) error {
-	query := `
-		INSERT INTO sso_logins (sso_client_id, sso_client_secret, sso_provider, sso_redirect_url, sso_auth_type)
-		VALUES ($1, $2, $3, $4, $5)
-		RETURNING id
-	`
-	var id int
-	err := d.Conn.QueryRow(context.Background(), query, ssoProvider.ClientID, ssoProvider.ClientSecret, ssoProvider.Provider, ssoProvider.RedirectURL, ssoProvider.AuthType).Scan(&id)
-	if err != nil {
-		return errors.New("failed to create sso provider: " + err.Error())
-	}
-	log.Printf("Created sso provider with ID: %d", id)
-	return nil
-}
-
-func (d *DB) CreateChat(userId int, chatContent *chats.ChatContent) error {
-	jsonStr, err := chatContent.ToJSON()
-	if err != nil {
-		return errors.New("failed to convert chat content to JSON: " + err.Error())
-	}
-
-	// Extract sources from chatContent and convert to JSON
-	sourcesJSON, err := json.Marshal(chatContent.Sources)
-	if err != nil {
-		return errors.New("failed to convert sources to JSON: " + err.Error())
-	}
-
-	query := `
-		INSERT INTO chat_contents (user_id, content, sources)
-		VALUES ($1, $2, $3)
-		RETURNING id
-	`
-	var id int
-	err = d.Conn.QueryRow(context.Background(), query, userId, jsonStr, sourcesJSON).Scan(&id)
-	if err != nil {
-		return errors.New("failed to create chat: " + err.Error())
-	}
-	log.Printf("Created chat with ID: %d", id)
-	return nil
-}
-
-func (d *DB) GetChats(userId int) ([]int, error) {
-	query := `
-		SELECT id FROM chat_contents WHERE user_id = $1
-	`
-	rows, err := d.Conn.Query(context.Background(), query, userId)
-	if err != nil {
-		return nil, errors.New("failed to get chats: " + err.Error())
-	}
-	defer rows.Close()
-
-	var ids []int
-	for rows.Next() {
-		var id int
-		err = rows.Scan(&id)
-		if err != nil {
-			return nil, errors.New("failed to get chats: " + err.Error())
-		}
-		ids = append(ids, id)
-	}
-
-	return ids, nil
-}
-
-func (d *DB) GetChatContent(chatId int) (*chats.ChatContent, error) {
-	query := `
-		SELECT content, sources FROM chat_contents WHERE id = $1
-	`
-	var jsonContentStr string
-	var jsonSourcesStr string
-	err := d.Conn.QueryRow(context.Background(), query, chatId).Scan(&jsonContentStr, &jsonSourcesStr)
-	if err != nil {
-		return nil, errors.New("failed to get chat content: " + err.Error())
-	}
-
-	// Create an empty ChatContent instance to call the method on
-	var empty chats.ChatContent
-	chatContent, err := empty.FromJSON(jsonContentStr)
-	if err != nil {
-		return nil, errors.New("failed to parse chat content: " + err.Error())
-	}
-
-	// Parse sources from the sources column
-	var sources []chats.Source
-	err = json.Unmarshal([]byte(jsonSourcesStr), &sources)
-	if err != nil {
-		return nil, errors.New("failed to parse sources: " + err.Error())
-	}
-
-	// Add sources to the chat content
-	chatContent.Sources = sources
-
-	return chatContent, nil
-}
-
-// VerifyChatOwnership checks if a chat belongs to a specific user
-func (d *DB) VerifyChatOwnership(chatId int, userId int) (bool, error) {
-	query := `
-		SELECT COUNT(*) FROM chat_contents WHERE id = $1 AND user_id = $2
-	`
-	var count int
-	err := d.Conn.QueryRow(context.Background(), query, chatId, userId).Scan(&count)
-	if err != nil {
-		return false, errors.New("failed to verify chat ownership: " + err.Error())
-	}
-	return count > 0, nil
-}
-
-func (d *DB) DeleteChat(chatId int) error {
-	query := `
-		DELETE FROM chat_contents WHERE id = $1
-	`
-	_, err := d.Conn.Exec(context.Background(), query, chatId)
-	if err != nil {
-		return errors.New("failed to delete chat: " + err.Error())
-	}
-	log.Printf("Deleted chat with ID: %d", chatId)
-	return nil
-}
-
-func (d *DB) DeleteUser(userId int) error {
-	query := `
-		DELETE FROM users WHERE id = $1
-	`
-	_, err := d.Conn.Exec(context.Background(), query, userId)
-	if err != nil {
-		return errors.New("failed to delete user: " + err.Error())
-	}
-	log.Printf("Deleted user with ID: %d", userId)
-	return nil
-}
-
-func (d *DB) DeleteSsoProvider(ssoProviderId int) error {
-	query := `
-		DELETE FROM sso_logins WHERE id = $1
-	`
-	_, err := d.Conn.Exec(context.Background(), query, ssoProviderId)
-	if err != nil {
-		return errors.New("failed to delete sso provider: " + err.Error())
-	}
-	log.Printf("Deleted sso provider with ID: %d", ssoProviderId)
-	return nil
-}
-
-func (d *DB) UpdateUserSettings(userId int, config *settings.UserSettings) error {
-	query := `
-		UPDATE user_settings
-		SET config = $1
-		WHERE user_id = $2
-	`
-	_, err := d.Conn.Exec(context.Background(), query, config, userId)
-	if err != nil {
-		return errors.New("failed to update user settings: " + err.Error())
-	}
-	log.Printf("Updated user settings for user with ID: %d", userId)
-	return nil
-}
-
-func (d *DB) GetUserSettings(userId int) (*settings.UserSettings, error) {
-	query := `
-		SELECT config FROM user_settings WHERE user_id = $1
-	`
-	var config settings.UserSettings
-	err := d.Conn.QueryRow(context.Background(), query, userId).Scan(&config)
-	if err != nil {
-		return nil, errors.New("failed to get user settings: " + err.Error())
-	}
-	return &config, nil
-}
-
-func (d *DB) GetAdminSettings() (*settings.AdminSettings, error) {
-	query := `
-		SELECT config FROM admin_settings
-		WHERE version = (SELECT MAX(version) FROM admin_settings)
-	`
-	var config settings.AdminSettings
-	err := d.Conn.QueryRow(context.Background(), query).Scan(&config)
-	if err != nil {
-		return nil, errors.New("failed to get admin settings: " + err.Error())
-	}
-	return &config, nil
-}
-
-func (d *DB) UpdateChatContent(chatId int, chatContent *chats.ChatContent) error {
-	jsonStr, err := chatContent.ToJSON()
-	if err != nil {
-		return errors.New("failed to convert chat content to JSON: " + err.Error())
-	}
-	query := `
-		UPDATE chat_contents
-		SET content = $1
-		WHERE id = $2
-	`
-	_, err = d.Conn.Exec(context.Background(), query, jsonStr, chatId)
-	if err != nil {
-		return errors.New("failed to update chat content: " + err.Error())
-	}
-	log.Printf("Updated chat content for chat with ID: %d", chatId)
-	return nil
-}
-
-func (d *DB) UpdateUserPassword(userId int, passwordHash string) error {
-	query := `
-		UPDATE users
-		SET password_hash = $1
-		WHERE id = $2
-	`
-	_, err := d.Conn.Exec(context.Background(), query, passwordHash, userId)
-	if err != nil {
-		return errors.New("failed to update user password: " + err.Error())
-	}
-	log.Printf("Updated user password for user with ID: %d", userId)
-	return nil
-}
-
-func (d *DB) UpdateUserEmail(userId int, email string) error {
-	query := `
-		UPDATE users
-		SET email = $1
-		WHERE id = $2
-	`
-	_, err := d.Conn.Exec(context.Background(), query, email, userId)
-	if err != nil {
-		return errors.New("failed to update user email: " + err.Error())
-	}
-	log.Printf("Updated user email for user with ID: %d", userId)
-	return nil
-}
-
-func (d *DB) AdminExists() (bool, error) {
-	query := `
-		SELECT EXISTS(SELECT 1 FROM users WHERE is_admin = TRUE LIMIT 1)
-	`
-	var exists bool
-	err := d.Conn.QueryRow(context.Background(), query).Scan(&exists)
-	if err != nil {
-		return false, errors.New("failed to check if admin exists: " + err.Error())
-	}
-	return exists, nil
-}
-
-func (d *DB) UpdateUserIsAdmin(userId int, isAdmin bool) error {
-	query := `
-		UPDATE users
-		SET is_admin = $1
-		WHERE id = $2
-	`
-	_, err := d.Conn.Exec(context.Background(), query, isAdmin, userId)
-	if err != nil {
-		return errors.New("failed to update user is_admin: " + err.Error())
-	}
-	log.Printf("Updated user is_admin for user with ID: %d", userId)
-	return nil
-}
-
-func (d *DB) CreateAdminSettings(config *settings.AdminSettings) error {
-	// First create the admin settings with empty config
-	query := `
-		INSERT INTO admin_settings (config)
-		VALUES ($1)
-		RETURNING version
-	`
-	var version int
-	err := d.Conn.QueryRow(context.Background(), query, config).Scan(&version)
-	if err != nil {
-		return errors.New("failed to initialize admin settings: " + err.Error())
-	}
-
-	log.Printf("Created admin settings with version: %d", version)
-	return nil
-}
-
-func (d *DB) CreateSsoUser(email string, ssoUserId string, ssoProviderId int) (*int, error) {
-	// Create a User object with SSO information
-	user := &user.User{
-		Email:         email,
-		PasswordHash:  nil,
-		IsSso:         true,
-		SsoUserID:     &ssoUserId,
-		SsoProviderID: &ssoProviderId,
-		IsAdmin:       false,
-	}
-	id, err := d.CreateUser(user)
-	if err != nil {
-		return nil, errors.New("failed to create sso user: " + err.Error())
-	}
-	return id, nil
-}
-
-func (d *DB) GetUser(email *string, id *int) (*user.User, error) {
-	// Check if at least one parameter is provided
-	if email == nil && id == nil {
-		return nil, errors.New("at least one of email or id must be provided")
-	}
-
-	var query string
-	var args []interface{}
-
-	// Build query based on which parameters are provided
-	switch {
-	case email != nil && id != nil:
-		// Both email and id are provided
-		query = `
-			SELECT id, email, password_hash, is_sso, sso_user_id, sso_provider_id, is_admin, username
-			FROM users
-			WHERE email = $1 OR id = $2
-		`
-		args = []interface{}{email, *id}
-	case email != nil:
-		// Only email is provided
-		query = `
-			SELECT id, email, password_hash, is_sso, sso_user_id, sso_provider_id, is_admin, username
-			FROM users
-			WHERE email = $1
-		`
-		args = []interface{}{email}
-	case id != nil:
-		// Only id is provided
-		query = `
-			SELECT id, email, password_hash, is_sso, sso_user_id, sso_provider_id, is_admin, username
-			FROM users
-			WHERE id = $1
-		`
-		args = []interface{}{*id}
-	}
-
-	var u user.User
-	err := d.Conn.QueryRow(context.Background(), query, args...).Scan(
-		&u.ID,
-		&u.Email,
-		&u.PasswordHash,
-		&u.IsSso,
-		&u.SsoUserID,
-		&u.SsoProviderID,
-		&u.IsAdmin,
-		&u.Username,
-	)
-	if err != nil {
-		return nil, errors.New("failed to get user: " + err.Error())
-	}
-	return &u, nil
-}
-
-func (d *DB) GetUsers() ([]*user.User, error) {
-	query := `
-		SELECT id, email, password_hash, is_sso, sso_user_id, sso_provider_id, is_admin, username
-		FROM users
-	`
-	rows, err := d.Conn.Query(context.Background(), query)
-	if err != nil {
-		return nil, errors.New("failed to get users: " + err.Error())
-	}
-	defer rows.Close()
-
-	var users []*user.User
-	for rows.Next() {
-		u := &user.User{}
-		err := rows.Scan(
-			&u.ID,
-			&u.Email,
-			&u.PasswordHash,
-			&u.IsSso,
-			&u.SsoUserID,
-			&u.SsoProviderID,
-			&u.IsAdmin,
-			&u.Username,
-		)
-		if err != nil {
-			return nil, errors.New("failed to scan user: " + err.Error())
-		}
-		users = append(users, u)
-	}
-	return users, nil
-}
-
-func (d *DB) CreateUserApikey(user *user.User, apikey string) error {
-	query := `
-		INSERT INTO user_apikeys (user_id, api_key_encrypt)
-		VALUES ($1, $2)
-	`
-	_, err := d.Conn.Exec(context.Background(), query, user.ID, apikey)
-	if err != nil {
-		return errors.New("failed to create user apikey: " + err.Error())
-	}
-	return nil
-}
-
-func (d *DB) GetUserByApikey(apikey_encrypt string) (int, error) {
-	query := `
-		SELECT user_id
-		FROM user_apikeys
-		WHERE api_key_encrypt = $1
-	`
-	var apikey int
-	err := d.Conn.QueryRow(context.Background(), query, apikey_encrypt).Scan(&apikey)
-	if err != nil {
-		return -1, errors.New("failed to get user apikey: " + err.Error())
-	}
-	return apikey, nil
-}
-
-func (d *DB) GetUserApikeys(user *user.User) ([]string, error) {
-	query := `
-		SELECT api_key_encrypt
-		FROM user_apikeys
-		WHERE user_id = $1
-	`
-	var apikeys []string
-	rows, err := d.Conn.Query(context.Background(), query, user.ID)
-	if err != nil {
-		return nil, errors.New("failed to get user apikeys: " + err.Error())
-	}
-	defer rows.Close()
-
-	for rows.Next() {
-		var apikey string
-		err := rows.Scan(&apikey)
-		if err != nil {
-			return nil, errors.New("failed to scan user apikey: " + err.Error())
-		}
-		apikeys = append(apikeys, apikey)
-	}
-	return apikeys, nil
-}
-
-func (d *DB) DeleteUserApikey(user *user.User, apikey_encrypt string) error {
-	query := `
-		DELETE FROM user_apikeys
-		WHERE user_id = $1 AND api_key_encrypt = $2
-	`
-	_, err := d.Conn.Exec(context.Background(), query, user.ID, apikey_encrypt)
-	if err != nil {
-		return errors.New("failed to delete user apikey: " + err.Error())
-	}
-	return nil
-}
-
-// CreateRefreshToken creates a new refresh token for a user
-func (d *DB) CreateRefreshToken(userId int, token string, expiresAt time.Time) error {
-	query := `
-		INSERT INTO refresh_tokens (user_id, token, expires_at)
-		VALUES ($1, $2, $3)
-	`
-	_, err := d.Conn.Exec(context.Background(), query, userId, token, expiresAt)
-	if err != nil {
-		return errors.New("failed to create refresh token: " + err.Error())
-	}
-	return nil
-}
-
-// GetRefreshToken retrieves a refresh token and validates it's not expired
-func (d *DB) GetRefreshToken(token string) (int, error) {
-	query := `
-		SELECT user_id, expires_at
-		FROM refresh_tokens
-		WHERE token = $1
-	`
-	var userId int
-	var expiresAt time.Time
-	err := d.Conn.QueryRow(context.Background(), query, token).Scan(&userId, &expiresAt)
-	if err != nil {
-		return 0, errors.New("refresh token not found: " + err.Error())
-	}
-
-	// Check if token is expired
-	if time.Now().After(expiresAt) {
-		// Delete expired token
-		_ = d.DeleteRefreshToken(token)
-		return 0, errors.New("refresh token expired")
-	}
-
-	return userId, nil
-}
-
-// DeleteRefreshToken removes a refresh token
-func (d *DB) DeleteRefreshToken(token string) error {
-	query := `
-		DELETE FROM refresh_tokens
-		WHERE token = $1
-	`
-	_, err := d.Conn.Exec(context.Background(), query, token)
-	if err != nil {
-		return errors.New("failed to delete refresh token: " + err.Error())
-	}
-	return nil
-}
-
-// DeleteUserRefreshTokens removes all refresh tokens for a user
-func (d *DB) DeleteUserRefreshTokens(userId int) error {
-	query := `
-		DELETE FROM refresh_tokens
-		WHERE user_id = $1
-	`
-	_, err := d.Conn.Exec(context.Background(), query, userId)
-	if err != nil {
-		return errors.New("failed to delete user refresh tokens: " + err.Error())
-	}
-	return nil
-}
-
-// UpdateUserUsername updates a user's username
-func (d *DB) UpdateUserUsername(userID int, username string) error {
-	query := `
-		UPDATE users
-		SET username = $1
-		WHERE id = $2
-	`
-	_, err := d.Conn.Exec(context.Background(), query, username, userID)
-	if err != nil {
-		return errors.New("failed to update username: " + err.Error())
-	}
-	return nil
-}
+package db
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"time"
+
+	"gitlab.cherkaoui.ch/quillium-ai/quillium/src/backend/internal/chats"
+	"gitlab.cherkaoui.ch/quillium-ai/quillium/src/backend/internal/settings"
+	"gitlab.cherkaoui.ch/quillium-ai/quillium/src/backend/internal/sso"
+	"gitlab.cherkaoui.ch/quillium-ai/quillium/src/backend/internal/user"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// DB is a pool of database connections, safe for concurrent use
+type DB struct {
+	*pgxpool.Pool
+}
+
+func (d *DB) Close() {
+	d.Pool.Close()
+}
+
+// Connect opens the database named by DATABASE_URL without touching the schema.
+// sqlite:// URLs open a SQLite file, anything else is handed to Postgres.
+func Connect(ctx context.Context) (Database, error) {
+	databaseURL := os.Getenv("DATABASE_URL")
+	if path, ok := sqlitePath(databaseURL); ok {
+		return connectSQLite(ctx, path)
+	}
+	return connectPostgres(ctx, databaseURL)
+}
+
+// connectPostgres opens a pool to a Postgres URL.
+// DATABASE_MAX_CONNS and DATABASE_MIN_CONNS override the pool size.
+func connectPostgres(ctx context.Context, databaseURL string) (*DB, error) {
+	config, err := pgxpool.ParseConfig(databaseURL)
+	if err != nil {
+		return nil, errors.New("failed to parse database URL: " + err.Error())
+	}
+	if err := configurePoolSize(config); err != nil {
+		return nil, err
+	}
+
+	pool, err := pgxpool.NewWithConfig(ctx, config)
+	if err != nil {
+		return nil, errors.New("failed to connect to database: " + err.Error())
+	}
+	if err := pool.Ping(ctx); err != nil {
+		pool.Close()
+		return nil, errors.New("failed to connect to database: " + err.Error())
+	}
+
+	return &DB{Pool: pool}, nil
+}
+
+// Initialize connects to the database and applies any pending migrations
+func Initialize(ctx context.Context) (Database, error) {
+	database, err := Connect(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := database.Migrate(ctx); err != nil {
+		database.Close()
+		return nil, err
+	}
+
+	return database, nil
+}
+
+// configurePoolSize applies the pool size environment variables to the pool configuration
+func configurePoolSize(config *pgxpool.Config) error {
+	if value := os.Getenv("DATABASE_MAX_CONNS"); value != "" {
+		maxConns, err := strconv.Atoi(value)
+		if err != nil || maxConns <= 0 {
+			return fmt.Errorf("invalid DATABASE_MAX_CONNS: %q", value)
+		}
+		config.MaxConns = int32(maxConns)
+	}
+	if value := os.Getenv("DATABASE_MIN_CONNS"); value != "" {
+		minConns, err := strconv.Atoi(value)
+		if err != nil || minConns < 0 {
+			return fmt.Errorf("invalid DATABASE_MIN_CONNS: %q", value)
+		}
+		config.MinConns = int32(minConns)
+	}
+	if config.MinConns > config.MaxConns {
+		return fmt.Errorf("DATABASE_MIN_CONNS (%d) must not exceed DATABASE_MAX_CONNS (%d)", config.MinConns, config.MaxConns)
+	}
+	return nil
+}
+
+func (d *DB) CreateUser(ctx context.Context, user *user.User) (*int, error) {
+	query := `
+		INSERT INTO users (email, password_hash, is_sso, sso_user_id, sso_provider_id, is_admin, username, ldap_dn)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+		RETURNING id
+	`
+	querySettings := `
+		INSERT INTO user_settings (user_id, config)
+		VALUES ($1, '{}')
+	`
+	var id int
+	err := d.Pool.QueryRow(ctx, query, user.Email, user.PasswordHash, user.IsSso, user.SsoUserID, user.SsoProviderID, user.IsAdmin, user.Username, user.LdapDN).Scan(&id)
+	if err != nil {
+		return nil, errors.New("failed to create user: " + err.Error())
+	}
+	_, err = d.Pool.Exec(ctx, querySettings, id)
+	if err != nil {
+		return nil, errors.New("failed to create user settings: " + err.Error())
+	}
+	log.Printf("Created user with ID: %d", id)
+	return &id, nil
+}
+
+func (d *DB) CreateSsoProvider(ctx context.Context, ssoProvider *sso.SsoProvider) (*int, error) {
+	query := `
+		INSERT INTO sso_logins (` + ssoProviderWriteColumns + `)
+		VALUES ($1, $2, $3, $4, $5, NULLIF($6, ''), NULLIF($7, ''), NULLIF($8, ''), NULLIF($9, ''), NULLIF($10, ''),
+			NULLIF($11, ''), NULLIF($12, ''), NULLIF($13, ''), NULLIF($14, ''), NULLIF($15, ''),
+			NULLIF($16, ''), NULLIF($17, ''), NULLIF($18, ''))
+		RETURNING id
+	`
+	var id int
+	err := d.Pool.QueryRow(ctx, query, ssoProviderValues(ssoProvider)...).Scan(&id)
+	if err != nil {
+		return nil, errors.New("failed to create sso provider: " + err.Error())
+	}
+	log.Printf("Created sso provider with ID: %d", id)
+	return &id, nil
+}
+
+func (d *DB) GetSsoProvider(ctx context.Context, provider string) (*sso.SsoProvider, error) {
+	query := `SELECT ` + ssoProviderColumns + ` FROM sso_logins WHERE sso_provider = $1`
+	return scanSsoProvider(d.Pool.QueryRow(ctx, query, provider))
+}
+
+func (d *DB) GetSsoProviderByID(ctx context.Context, ssoProviderId int) (*sso.SsoProvider, error) {
+	query := `SELECT ` + ssoProviderColumns + ` FROM sso_logins WHERE id = $1`
+	return scanSsoProvider(d.Pool.QueryRow(ctx, query, ssoProviderId))
+}
+
+// scanSsoProvider reads an sso_logins row selected with ssoProviderColumns
+func scanSsoProvider(row pgx.Row) (*sso.SsoProvider, error) {
+	p, err := scanSsoProviderRow(row)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrSsoProviderNotFound
+	}
+	if err != nil {
+		return nil, errors.New("failed to get sso provider: " + err.Error())
+	}
+	return p, nil
+}
+
+func (d *DB) GetSsoProviders(ctx context.Context) ([]*sso.SsoProvider, error) {
+	query := `SELECT ` + ssoProviderColumns + ` FROM sso_logins ORDER BY id`
+	rows, err := d.Pool.Query(ctx, query)
+	if err != nil {
+		return nil, errors.New("failed to get sso providers: " + err.Error())
+	}
+	defer rows.Close()
+
+	var providers []*sso.SsoProvider
+	for rows.Next() {
+		p, err := scanSsoProvider(rows)
+		if err != nil {
+			return nil, err
+		}
+		providers = append(providers, p)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, errors.New("failed to get sso providers: " + err.Error())
+	}
+	return providers, nil
+}
+
+func (d *DB) UpdateSsoProvider(ctx context.Context, ssoProvider *sso.SsoProvider) error {
+	query := `
+		UPDATE sso_logins
+		SET (` + ssoProviderWriteColumns + `) =
+			($1, $2, $3, $4, $5, NULLIF($6, ''), NULLIF($7, ''), NULLIF($8, ''), NULLIF($9, ''), NULLIF($10, ''),
+			NULLIF($11, ''), NULLIF($12, ''), NULLIF($13, ''), NULLIF($14, ''), NULLIF($15, ''),
+			NULLIF($16, ''), NULLIF($17, ''), NULLIF($18, ''))
+		WHERE id = $19
+	`
+	args := append(ssoProviderValues(ssoProvider), *ssoProvider.ID)
+	_, err := d.Pool.Exec(ctx, query, args...)
+	if err != nil {
+		return errors.New("failed to update sso provider: " + err.Error())
+	}
+	log.Printf("Updated sso provider with ID: %d", *ssoProvider.ID)
+	return nil
+}
+
+func (d *DB) CountSsoProviderUsers(ctx context.Context, ssoProviderId int) (int, error) {
+	query := `
+		SELECT COUNT(*) FROM users WHERE sso_provider_id = $1
+	`
+	var count int
+	err := d.Pool.QueryRow(ctx, query, ssoProviderId).Scan(&count)
+	if err != nil {
+		return 0, errors.New("failed to count sso provider users: " + err.Error())
+	}
+	return count, nil
+}
+
+// MigrateSsoProviderUsers moves the users of a provider to another one. Their subjects were
+// issued by the old provider, so they are cleared and the users are linked again by their
+// verified email on their next login.
+func (d *DB) MigrateSsoProviderUsers(ctx context.Context, fromProviderId int, toProviderId int) (int, error) {
+	tx, err := d.Pool.Begin(ctx)
+	if err != nil {
+		return 0, errors.New("failed to migrate sso provider users: " + err.Error())
+	}
+	defer tx.Rollback(ctx)
+
+	migrated, err := migrateSsoProviderUsers(ctx, tx, fromProviderId, toProviderId)
+	if err != nil {
+		return 0, err
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return 0, errors.New("failed to migrate sso provider users: " + err.Error())
+	}
+	return migrated, nil
+}
+
+func migrateSsoProviderUsers(ctx context.Context, tx pgx.Tx, fromProviderId int, toProviderId int) (int, error) {
+	query := `
+		UPDATE users
+		SET sso_provider_id = $1, sso_user_id = ''
+		WHERE sso_provider_id = $2
+	`
+	tag, err := tx.Exec(ctx, query, toProviderId, fromProviderId)
+	if err != nil {
+		return 0, errors.New("failed to migrate sso provider users: " + err.Error())
+	}
+	log.Printf("Migrated %d users from sso provider %d to %d", tag.RowsAffected(), fromProviderId, toProviderId)
+	return int(tag.RowsAffected()), nil
+}
+
+func (d *DB) CreateChat(ctx context.Context, userId int, chatContent *chats.ChatContent) (*int, error) {
+	jsonStr, err := chatContent.ToJSON()
+	if err != nil {
+		return nil, errors.New("failed to convert chat content to JSON: " + err.Error())
+	}
+
+	// Extract sources from chatContent and convert to JSON
+	sourcesJSON, err := json.Marshal(chatContent.Sources)
+	if err != nil {
+		return nil, errors.New("failed to convert sources to JSON: " + err.Error())
+	}
+
+	query := `
+		INSERT INTO chat_contents (user_id, content, sources)
+		VALUES ($1, $2, $3)
+		RETURNING id
+	`
+	var id int
+	err = d.Pool.QueryRow(ctx, query, userId, jsonStr, sourcesJSON).Scan(&id)
+	if err != nil {
+		return nil, errors.New("failed to create chat: " + err.Error())
+	}
+	log.Printf("Created chat with ID: %d", id)
+	return &id, nil
+}
+
+func (d *DB) GetChats(ctx context.Context, userId int) ([]int, error) {
+	query := `
+		SELECT id FROM chat_contents WHERE user_id = $1
+	`
+	rows, err := d.Pool.Query(ctx, query, userId)
+	if err != nil {
+		return nil, errors.New("failed to get chats: " + err.Error())
+	}
+	defer rows.Close()
+
+	var ids []int
+	for rows.Next() {
+		var id int
+		err = rows.Scan(&id)
+		if err != nil {
+			return nil, errors.New("failed to get chats: " + err.Error())
+		}
+		ids = append(ids, id)
+	}
+
+	return ids, nil
+}
+
+func (d *DB) GetChatContent(ctx context.Context, chatId int) (*chats.ChatContent, error) {
+	query := `
+		SELECT content, sources FROM chat_contents WHERE id = $1
+	`
+	var jsonContentStr string
+	var jsonSourcesStr string
+	err := d.Pool.QueryRow(ctx, query, chatId).Scan(&jsonContentStr, &jsonSourcesStr)
+	if err != nil {
+		return nil, errors.New("failed to get chat content: " + err.Error())
+	}
+
+	// Create an empty ChatContent instance to call the method on
+	var empty chats.ChatContent
+	chatContent, err := empty.FromJSON(jsonContentStr)
+	if err != nil {
+		return nil, errors.New("failed to parse chat content: " + err.Error())
+	}
+
+	// Parse sources from the sources column
+	var sources []chats.Source
+	err = json.Unmarshal([]byte(jsonSourcesStr), &sources)
+	if err != nil {
+		return nil, errors.New("failed to parse sources: " + err.Error())
+	}
+
+	// Add sources to the chat content
+	chatContent.Sources = sources
+
+	return chatContent, nil
+}
+
+// VerifyChatOwnership checks if a chat belongs to a specific user
+func (d *DB) VerifyChatOwnership(ctx context.Context, chatId int, userId int) (bool, error) {
+	query := `
+		SELECT COUNT(*) FROM chat_contents WHERE id = $1 AND user_id = $2
+	`
+	var count int
+	err := d.Pool.QueryRow(ctx, query, chatId, userId).Scan(&count)
+	if err != nil {
+		return false, errors.New("failed to verify chat ownership: " + err.Error())
+	}
+	return count > 0, nil
+}
+
+func (d *DB) DeleteChat(ctx context.Context, chatId int) error {
+	query := `
+		DELETE FROM chat_contents WHERE id = $1
+	`
+	_, err := d.Pool.Exec(ctx, query, chatId)
+	if err != nil {
+		return errors.New("failed to delete chat: " + err.Error())
+	}
+	log.Printf("Deleted chat with ID: %d", chatId)
+	return nil
+}
+
+func (d *DB) DeleteUser(ctx context.Context, userId int) error {
+	query := `
+		DELETE FROM users WHERE id = $1
+	`
+	_, err := d.Pool.Exec(ctx, query, userId)
+	if err != nil {
+		return errors.New("failed to delete user: " + err.Error())
+	}
+	log.Printf("Deleted user with ID: %d", userId)
+	return nil
+}
+
+// DeleteSsoProvider deletes a provider, its users are moved to migrateToId first. Without a
+// provider to move them to, ErrSsoProviderInUse is returned while users remain, as deleting
+// the provider would delete them too.
+func (d *DB) DeleteSsoProvider(ctx context.Context, ssoProviderId int, migrateToId *int) error {
+	tx, err := d.Pool.Begin(ctx)
+	if err != nil {
+		return errors.New("failed to delete sso provider: " + err.Error())
+	}
+	defer tx.Rollback(ctx)
+
+	// Locking the provider makes logins that would link or create one of its users wait
+	// until it is deleted, so no user is created between counting and deleting
+	var id int
+	err = tx.QueryRow(ctx, "SELECT id FROM sso_logins WHERE id = $1 FOR UPDATE", ssoProviderId).Scan(&id)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return ErrSsoProviderNotFound
+	}
+	if err != nil {
+		return errors.New("failed to delete sso provider: " + err.Error())
+	}
+
+	var userCount int
+	if err := tx.QueryRow(ctx, "SELECT COUNT(*) FROM users WHERE sso_provider_id = $1", ssoProviderId).Scan(&userCount); err != nil {
+		return errors.New("failed to count sso provider users: " + err.Error())
+	}
+	if userCount > 0 {
+		if migrateToId == nil {
+			return ErrSsoProviderInUse
+		}
+		if _, err := migrateSsoProviderUsers(ctx, tx, ssoProviderId, *migrateToId); err != nil {
+			return err
+		}
+	}
+
+	if _, err := tx.Exec(ctx, "DELETE FROM sso_logins WHERE id = $1", ssoProviderId); err != nil {
+		return errors.New("failed to delete sso provider: " + err.Error())
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return errors.New("failed to delete sso provider: " + err.Error())
+	}
+	log.Printf("Deleted sso provider with ID: %d", ssoProviderId)
+	return nil
+}
+
+func (d *DB) UpdateUserSettings(ctx context.Context, userId int, config *settings.UserSettings) error {
+	query := `
+		UPDATE user_settings
+		SET config = $1
+		WHERE user_id = $2
+	`
+	_, err := d.Pool.Exec(ctx, query, config, userId)
+	if err != nil {
+		return errors.New("failed to update user settings: " + err.Error())
+	}
+	log.Printf("Updated user settings for user with ID: %d", userId)
+	return nil
+}
+
+func (d *DB) GetUserSettings(ctx context.Context, userId int) (*settings.UserSettings, error) {
+	query := `
+		SELECT config FROM user_settings WHERE user_id = $1
+	`
+	var config settings.UserSettings
+	err := d.Pool.QueryRow(ctx, query, userId).Scan(&config)
+	if err != nil {
+		return nil, errors.New("failed to get user settings: " + err.Error())
+	}
+	return &config, nil
+}
+
+func (d *DB) GetAdminSettings(ctx context.Context) (*settings.AdminSettings, error) {
+	query := `
+		SELECT config FROM admin_settings
+		WHERE version = (SELECT MAX(version) FROM admin_settings)
+	`
+	var config settings.AdminSettings
+	err := d.Pool.QueryRow(ctx, query).Scan(&config)
+	if err != nil {
+		return nil, errors.New("failed to get admin settings: " + err.Error())
+	}
+	return &config, nil
+}
+
+func (d *DB) UpdateChatContent(ctx context.Context, chatId int, chatContent *chats.ChatContent) error {
+	jsonStr, err := chatContent.ToJSON()
+	if err != nil {
+		return errors.New("failed to convert chat content to JSON: " + err.Error())
+	}
+	query := `
+		UPDATE chat_contents
+		SET content = $1
+		WHERE id = $2
+	`
+	_, err = d.Pool.Exec(ctx, query, jsonStr, chatId)
+	if err != nil {
+		return errors.New("failed to update chat content: " + err.Error())
+	}
+	log.Printf("Updated chat content for chat with ID: %d", chatId)
+	return nil
+}
+
+func (d *DB) UpdateUserPassword(ctx context.Context, userId int, passwordHash string) error {
+	query := `
+		UPDATE users
+		SET password_hash = $1
+		WHERE id = $2
+	`
+	_, err := d.Pool.Exec(ctx, query, passwordHash, userId)
+	if err != nil {
+		return errors.New("failed to update user password: " + err.Error())
+	}
+	log.Printf("Updated user password for user with ID: %d", userId)
+	return nil
+}
+
+func (d *DB) UpdateUserEmail(ctx context.Context, userId int, email string) error {
+	query := `
+		UPDATE users
+		SET email = $1
+		WHERE id = $2
+	`
+	_, err := d.Pool.Exec(ctx, query, email, userId)
+	if err != nil {
+		return errors.New("failed to update user email: " + err.Error())
+	}
+	log.Printf("Updated user email for user with ID: %d", userId)
+	return nil
+}
+
+func (d *DB) AdminExists(ctx context.Context) (bool, error) {
+	query := `
+		SELECT EXISTS(SELECT 1 FROM users WHERE is_admin = TRUE LIMIT 1)
+	`
+	var exists bool
+	err := d.Pool.QueryRow(ctx, query).Scan(&exists)
+	if err != nil {
+		return false, errors.New("failed to check if admin exists: " + err.Error())
+	}
+	return exists, nil
+}
+
+func (d *DB) UpdateUserIsAdmin(ctx context.Context, userId int, isAdmin bool) error {
+	query := `
+		UPDATE users
+		SET is_admin = $1
+		WHERE id = $2
+	`
+	_, err := d.Pool.Exec(ctx, query, isAdmin, userId)
+	if err != nil {
+		return errors.New("failed to update user is_admin: " + err.Error())
+	}
+	log.Printf("Updated user is_admin for user with ID: %d", userId)
+	return nil
+}
+
+func (d *DB) CreateAdminSettings(ctx context.Context, config *settings.AdminSettings) error {
+	// First create the admin settings with empty config
+	query := `
+		INSERT INTO admin_settings (config)
+		VALUES ($1)
+		RETURNING version
+	`
+	var version int
+	err := d.Pool.QueryRow(ctx, query, config).Scan(&version)
+	if err != nil {
+		return errors.New("failed to initialize admin settings: " + err.Error())
+	}
+
+	log.Printf("Created admin settings with version: %d", version)
+	return nil
+}
+
+func (d *DB) CreateSsoUser(ctx context.Context, email string, ssoUserId string, ssoProviderId int) (*int, error) {
+	// Create a User object with SSO information
+	user := &user.User{
+		Email:         email,
+		PasswordHash:  nil,
+		IsSso:         true,
+		SsoUserID:     &ssoUserId,
+		SsoProviderID: &ssoProviderId,
+		IsAdmin:       false,
+	}
+	id, err := d.CreateUser(ctx, user)
+	if err != nil {
+		return nil, errors.New("failed to create sso user: " + err.Error())
+	}
+	return id, nil
+}
+
+func (d *DB) GetSsoUser(ctx context.Context, ssoProviderId int, ssoUserId string) (*user.User, error) {
+	query := `
+		SELECT id, email, password_hash, is_sso, sso_user_id, sso_provider_id, is_admin, username, ldap_dn
+		FROM users
+		WHERE sso_provider_id = $1 AND sso_user_id = $2
+	`
+	var u user.User
+	err := d.Pool.QueryRow(ctx, query, ssoProviderId, ssoUserId).Scan(
+		&u.ID,
+		&u.Email,
+		&u.PasswordHash,
+		&u.IsSso,
+		&u.SsoUserID,
+		&u.SsoProviderID,
+		&u.IsAdmin,
+		&u.Username,
+		&u.LdapDN,
+	)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrUserNotFound
+	}
+	if err != nil {
+		return nil, errors.New("failed to get sso user: " + err.Error())
+	}
+	return &u, nil
+}
+
+func (d *DB) LinkSsoUser(ctx context.Context, userId int, ssoUserId string, ssoProviderId int) error {
+	query := `
+		UPDATE users
+		SET is_sso = TRUE, sso_user_id = $1, sso_provider_id = $2
+		WHERE id = $3
+	`
+	_, err := d.Pool.Exec(ctx, query, ssoUserId, ssoProviderId, userId)
+	if err != nil {
+		return errors.New("failed to link sso user: " + err.Error())
+	}
+	log.Printf("Linked user with ID %d to sso provider with ID: %d", userId, ssoProviderId)
+	return nil
+}
+
+func (d *DB) GetUser(ctx context.Context, email *string, id *int) (*user.User, error) {
+	// Check if at least one parameter is provided
+	if email == nil && id == nil {
+		return nil, errors.New("at least one of email or id must be provided")
+	}
+
+	var query string
+	var args []interface{}
+
+	// Build query based on which parameters are provided
+	switch {
+	case email != nil && id != nil:
+		// Both email and id are provided
+		query = `
+			SELECT id, email, password_hash, is_sso, sso_user_id, sso_provider_id, is_admin, username, ldap_dn
+			FROM users
+			WHERE email = $1 OR id = $2
+		`
+		args = []interface{}{email, *id}
+	case email != nil:
+		// Only email is provided
+		query = `
+			SELECT id, email, password_hash, is_sso, sso_user_id, sso_provider_id, is_admin, username, ldap_dn
+			FROM users
+			WHERE email = $1
+		`
+		args = []interface{}{email}
+	case id != nil:
+		// Only id is provided
+		query = `
+			SELECT id, email, password_hash, is_sso, sso_user_id, sso_provider_id, is_admin, username, ldap_dn
+			FROM users
+			WHERE id = $1
+		`
+		args = []interface{}{*id}
+	}
+
+	var u user.User
+	err := d.Pool.QueryRow(ctx, query, args...).Scan(
+		&u.ID,
+		&u.Email,
+		&u.PasswordHash,
+		&u.IsSso,
+		&u.SsoUserID,
+		&u.SsoProviderID,
+		&u.IsAdmin,
+		&u.Username,
+		&u.LdapDN,
+	)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrUserNotFound
+	}
+	if err != nil {
+		return nil, errors.New("failed to get user: " + err.Error())
+	}
+	return &u, nil
+}
+
+func (d *DB) GetUsers(ctx context.Context) ([]*user.User, error) {
+	query := `
+		SELECT id, email, password_hash, is_sso, sso_user_id, sso_provider_id, is_admin, username, ldap_dn
+		FROM users
+	`
+	rows, err := d.Pool.Query(ctx, query)
+	if err != nil {
+		return nil, errors.New("failed to get users: " + err.Error())
+	}
+	defer rows.Close()
+
+	var users []*user.User
+	for rows.Next() {
+		u := &user.User{}
+		err := rows.Scan(
+			&u.ID,
+			&u.Email,
+			&u.PasswordHash,
+			&u.IsSso,
+			&u.SsoUserID,
+			&u.SsoProviderID,
+			&u.IsAdmin,
+			&u.Username,
+			&u.LdapDN,
+		)
+		if err != nil {
+			return nil, errors.New("failed to scan user: " + err.Error())
+		}
+		users = append(users, u)
+	}
+	return users, nil
+}
+
+func (d *DB) CreateUserApikey(ctx context.Context, user *user.User, apikey string) error {
+	query := `
+		INSERT INTO user_apikeys (user_id, api_key_encrypt)
+		VALUES ($1, $2)
+	`
+	_, err := d.Pool.Exec(ctx, query, user.ID, apikey)
+	if err != nil {
+		return errors.New("failed to create user apikey: " + err.Error())
+	}
+	return nil
+}
+
+func (d *DB) GetUserByApikey(ctx context.Context, apikey_encrypt string) (int, error) {
+	query := `
+		SELECT user_id
+		FROM user_apikeys
+		WHERE api_key_encrypt = $1
+	`
+	var apikey int
+	err := d.Pool.QueryRow(ctx, query, apikey_encrypt).Scan(&apikey)
+	if err != nil {
+		return -1, errors.New("failed to get user apikey: " + err.Error())
+	}
+	return apikey, nil
+}
+
+func (d *DB) GetUserApikeys(ctx context.Context, user *user.User) ([]string, error) {
+	query := `
+		SELECT api_key_encrypt
+		FROM user_apikeys
+		WHERE user_id = $1
+	`
+	var apikeys []string
+	rows, err := d.Pool.Query(ctx, query, user.ID)
+	if err != nil {
+		return nil, errors.New("failed to get user apikeys: " + err.Error())
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var apikey string
+		err := rows.Scan(&apikey)
+		if err != nil {
+			return nil, errors.New("failed to scan user apikey: " + err.Error())
+		}
+		apikeys = append(apikeys, apikey)
+	}
+	return apikeys, nil
+}
+
+func (d *DB) DeleteUserApikey(ctx context.Context, user *user.User, apikey_encrypt string) error {
+	query := `
+		DELETE FROM user_apikeys
+		WHERE user_id = $1 AND api_key_encrypt = $2
+	`
+	_, err := d.Pool.Exec(ctx, query, user.ID, apikey_encrypt)
+	if err != nil {
+		return errors.New("failed to delete user apikey: " + err.Error())
+	}
+	return nil
+}
+
+// CreateRefreshToken creates a new refresh token for a user
+func (d *DB) CreateRefreshToken(ctx context.Context, userId int, token string, expiresAt time.Time) error {
+	query := `
+		INSERT INTO refresh_tokens (user_id, token, expires_at)
+		VALUES ($1, $2, $3)
+	`
+	_, err := d.Pool.Exec(ctx, query, userId, token, expiresAt)
+	if err != nil {
+		return errors.New("failed to create refresh token: " + err.Error())
+	}
+	return nil
+}
+
+// GetRefreshToken retrieves a refresh token and validates it's not expired
+func (d *DB) GetRefreshToken(ctx context.Context, token string) (int, error) {
+	query := `
+		SELECT user_id, expires_at
+		FROM refresh_tokens
+		WHERE token = $1
+	`
+	var userId int
+	var expiresAt time.Time
+	err := d.Pool.QueryRow(ctx, query, token).Scan(&userId, &expiresAt)
+	if err != nil {
+		return 0, errors.New("refresh token not found: " + err.Error())
+	}
+
+	// Check if token is expired
+	if time.Now().After(expiresAt) {
+		// Delete expired token
+		_ = d.DeleteRefreshToken(ctx, token)
+		return 0, errors.New("refresh token expired")
+	}
+
+	return userId, nil
+}
+
+// DeleteRefreshToken removes a refresh token
+func (d *DB) DeleteRefreshToken(ctx context.Context, token string) error {
+	query := `
+		DELETE FROM refresh_tokens
+		WHERE token = $1
+	`
+	_, err := d.Pool.Exec(ctx, query, token)
+	if err != nil {
+		return errors.New("failed to delete refresh token: " + err.Error())
+	}
+	return nil
+}
+
+// DeleteUserRefreshTokens removes all refresh tokens for a user
+func (d *DB) DeleteUserRefreshTokens(ctx context.Context, userId int) error {
+	query := `
+		DELETE FROM refresh_tokens
+		WHERE user_id = $1
+	`
+	_, err := d.Pool.Exec(ctx, query, userId)
+	if err != nil {
+		return errors.New("failed to delete user refresh tokens: " + err.Error())
+	}
+	return nil
+}
+
+// UpdateUserUsername updates a user's username
+func (d *DB) UpdateUserUsername(ctx context.Context, userID int, username string) error {
+	query := `
+		UPDATE users
+		SET username = $1
+		WHERE id = $2
+	`
+	_, err := d.Pool.Exec(ctx, query, username, userID)
+	if err != nil {
+		return errors.New("failed to update username: " + err.Error())
+	}
+	return nil
+}
+
+// SetUserTOTPSecret starts a new, disabled TOTP enrollment for a user
+func (d *DB) SetUserTOTPSecret(ctx context.Context, userId int, secretEncrypt string) error {
+	query := `
+		INSERT INTO user_totp (user_id, secret_encrypt)
+		VALUES ($1, $2)
+		ON CONFLICT (user_id) DO UPDATE
+		SET secret_encrypt = EXCLUDED.secret_encrypt, enabled = FALSE, last_used_step = 0,
+			failed_attempts = 0, last_failed_at = NULL, challenge_nonce = NULL, created_at = CURRENT_TIMESTAMP
+	`
+	_, err := d.Pool.Exec(ctx, query, userId, secretEncrypt)
+	if err != nil {
+		return errors.New("failed to set user totp secret: " + err.Error())
+	}
+	return nil
+}
+
+// GetUserTOTP returns the TOTP enrollment of a user
+func (d *DB) GetUserTOTP(ctx context.Context, userId int) (*user.TOTP, error) {
+	query := `
+		SELECT user_id, secret_encrypt, enabled, last_used_step, failed_attempts, last_failed_at, challenge_nonce
+		FROM user_totp
+		WHERE user_id = $1
+	`
+	var totp user.TOTP
+	err := d.Pool.QueryRow(ctx, query, userId).Scan(
+		&totp.UserID, &totp.Secret, &totp.Enabled, &totp.LastUsedStep, &totp.FailedAttempts, &totp.LastFailedAt, &totp.ChallengeNonce)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrTOTPNotFound
+	}
+	if err != nil {
+		return nil, errors.New("failed to get user totp: " + err.Error())
+	}
+	return &totp, nil
+}
+
+// EnableUserTOTP enables the pending TOTP enrollment of a user and replaces the recovery codes
+func (d *DB) EnableUserTOTP(ctx context.Context, userId int, lastUsedStep int64, recoveryCodeHashes []string) error {
+	tx, err := d.Pool.Begin(ctx)
+	if err != nil {
+		return errors.New("failed to enable user totp: " + err.Error())
+	}
+	defer tx.Rollback(ctx)
+
+	query := `
+		UPDATE user_totp
+		SET enabled = TRUE, last_used_step = $1, failed_attempts = 0, last_failed_at = NULL
+		WHERE user_id = $2 AND enabled = FALSE
+	`
+	tag, err := tx.Exec(ctx, query, lastUsedStep, userId)
+	if err != nil {
+		return errors.New("failed to enable user totp: " + err.Error())
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrTOTPNotFound
+	}
+	if err := replaceRecoveryCodes(ctx, tx, userId, recoveryCodeHashes); err != nil {
+		return err
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return errors.New("failed to enable user totp: " + err.Error())
+	}
+	return nil
+}
+
+// UpdateUserTOTPAttempts records the last accepted code and the failed codes since
+func (d *DB) UpdateUserTOTPAttempts(ctx context.Context, userId int, lastUsedStep int64, failedAttempts int, lastFailedAt *time.Time) error {
+	query := `
+		UPDATE user_totp
+		SET last_used_step = $1, failed_attempts = $2, last_failed_at = $3
+		WHERE user_id = $4
+	`
+	_, err := d.Pool.Exec(ctx, query, lastUsedStep, failedAttempts, lastFailedAt, userId)
+	if err != nil {
+		return errors.New("failed to update user totp attempts: " + err.Error())
+	}
+	return nil
+}
+
+// SetUserTOTPChallengeNonce stores the nonce of the login challenge of a user that can be completed
+func (d *DB) SetUserTOTPChallengeNonce(ctx context.Context, userId int, nonce string) error {
+	tag, err := d.Pool.Exec(ctx, "UPDATE user_totp SET challenge_nonce = $1 WHERE user_id = $2", nonce, userId)
+	if err != nil {
+		return errors.New("failed to set user totp challenge nonce: " + err.Error())
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrTOTPNotFound
+	}
+	return nil
+}
+
+// ClaimUserTOTPChallengeNonce stores the nonce of a login challenge of a user
+// when no other one is stored, and reports whether it did
+func (d *DB) ClaimUserTOTPChallengeNonce(ctx context.Context, userId int, nonce string) (bool, error) {
+	tag, err := d.Pool.Exec(ctx,
+		"UPDATE user_totp SET challenge_nonce = $1 WHERE user_id = $2 AND challenge_nonce IS NULL", nonce, userId)
+	if err != nil {
+		return false, errors.New("failed to claim user totp challenge nonce: " + err.Error())
+	}
+	return tag.RowsAffected() > 0, nil
+}
+
+// ConsumeUserTOTPChallengeNonce clears the login challenge nonce of a user and reports whether it matched
+func (d *DB) ConsumeUserTOTPChallengeNonce(ctx context.Context, userId int, nonce string) (bool, error) {
+	tag, err := d.Pool.Exec(ctx,
+		"UPDATE user_totp SET challenge_nonce = NULL WHERE user_id = $1 AND challenge_nonce = $2", userId, nonce)
+	if err != nil {
+		return false, errors.New("failed to consume user totp challenge nonce: " + err.Error())
+	}
+	return tag.RowsAffected() > 0, nil
+}
+
+// DeleteUserTOTP removes the TOTP enrollment and the recovery codes of a user
+func (d *DB) DeleteUserTOTP(ctx context.Context, userId int) error {
+	tx, err := d.Pool.Begin(ctx)
+	if err != nil {
+		return errors.New("failed to delete user totp: " + err.Error())
+	}
+	defer tx.Rollback(ctx)
+
+	if _, err := tx.Exec(ctx, "DELETE FROM user_recovery_codes WHERE user_id = $1", userId); err != nil {
+		return errors.New("failed to delete recovery codes: " + err.Error())
+	}
+	if _, err := tx.Exec(ctx, "DELETE FROM user_totp WHERE user_id = $1", userId); err != nil {
+		return errors.New("failed to delete user totp: " + err.Error())
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return errors.New("failed to delete user totp: " + err.Error())
+	}
+	return nil
+}
+
+// ReplaceRecoveryCodes replaces the recovery codes of a user
+func (d *DB) ReplaceRecoveryCodes(ctx context.Context, userId int, codeHashes []string) error {
+	tx, err := d.Pool.Begin(ctx)
+	if err != nil {
+		return errors.New("failed to replace recovery codes: " + err.Error())
+	}
+	defer tx.Rollback(ctx)
+
+	if err := replaceRecoveryCodes(ctx, tx, userId, codeHashes); err != nil {
+		return err
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return errors.New("failed to replace recovery codes: " + err.Error())
+	}
+	return nil
+}
+
+func replaceRecoveryCodes(ctx context.Context, tx pgx.Tx, userId int, codeHashes []string) error {
+	if _, err := tx.Exec(ctx, "DELETE FROM user_recovery_codes WHERE user_id = $1", userId); err != nil {
+		return errors.New("failed to delete recovery codes: " + err.Error())
+	}
+	for _, codeHash := range codeHashes {
+		if _, err := tx.Exec(ctx, "INSERT INTO user_recovery_codes (user_id, code_hash) VALUES ($1, $2)", userId, codeHash); err != nil {
+			return errors.New("failed to create recovery code: " + err.Error())
+		}
+	}
+	return nil
+}
+
+// UseRecoveryCode deletes a recovery code of a user and reports whether it existed
+func (d *DB) UseRecoveryCode(ctx context.Context, userId int, codeHash string) (bool, error) {
+	tag, err := d.Pool.Exec(ctx, "DELETE FROM user_recovery_codes WHERE user_id = $1 AND code_hash = $2", userId, codeHash)
+	if err != nil {
+		return false, errors.New("failed to use recovery code: " + err.Error())
+	}
+	return tag.RowsAffected() > 0, nil
+}
+
+// CountRecoveryCodes returns the number of unused recovery codes of a user
+func (d *DB) CountRecoveryCodes(ctx context.Context, userId int) (int, error) {
+	var count int
+	err := d.Pool.QueryRow(ctx, "SELECT COUNT(*) FROM user_recovery_codes WHERE user_id = $1", userId).Scan(&count)
+	if err != nil {
+		return 0, errors.New("failed to count recovery codes: " + err.Error())
+	}
+	return count, nil
+}
+
+// passkeyColumns are the passkeys columns read by scanPasskey
+const passkeyColumns = "id, user_id, credential_id, name, credential, created_at, last_used_at"
+
+// CreatePasskey stores a new passkey of a user
+func (d *DB) CreatePasskey(ctx context.Context, passkey *user.Passkey) (*int, error) {
+	query := `
+		INSERT INTO passkeys (user_id, credential_id, name, credential)
+		VALUES ($1, $2, $3, $4)
+		RETURNING id
+	`
+	var id int
+	err := d.Pool.QueryRow(ctx, query, passkey.UserID, passkey.CredentialID, passkey.Name, passkey.Credential).Scan(&id)
+	if err != nil {
+		return nil, errors.New("failed to create passkey: " + err.Error())
+	}
+	log.Printf("Created passkey %d for user %d", id, passkey.UserID)
+	return &id, nil
+}
+
+// GetPasskeys returns the passkeys of a user, oldest first
+func (d *DB) GetPasskeys(ctx context.Context, userId int) ([]*user.Passkey, error) {
+	rows, err := d.Pool.Query(ctx, `SELECT `+passkeyColumns+` FROM passkeys WHERE user_id = $1 ORDER BY id`, userId)
+	if err != nil {
+		return nil, errors.New("failed to get passkeys: " + err.Error())
+	}
+	defer rows.Close()
+
+	var passkeys []*user.Passkey
+	for rows.Next() {
+		passkey, err := scanPasskey(rows)
+		if err != nil {
+			return nil, errors.New("failed to get passkeys: " + err.Error())
+		}
+		passkeys = append(passkeys, passkey)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, errors.New("failed to get passkeys: " + err.Error())
+	}
+	return passkeys, nil
+}
+
+// GetPasskeyByCredentialID returns the passkey with the given credential ID
+func (d *DB) GetPasskeyByCredentialID(ctx context.Context, credentialId string) (*user.Passkey, error) {
+	passkey, err := scanPasskey(d.Pool.QueryRow(ctx, `SELECT `+passkeyColumns+` FROM passkeys WHERE credential_id = $1`, credentialId))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrPasskeyNotFound
+	}
+	if err != nil {
+		return nil, errors.New("failed to get passkey: " + err.Error())
+	}
+	return passkey, nil
+}
+
+// scanPasskey reads a passkeys row selected with passkeyColumns
+func scanPasskey(row pgx.Row) (*user.Passkey, error) {
+	var passkey user.Passkey
+	err := row.Scan(&passkey.ID, &passkey.UserID, &passkey.CredentialID, &passkey.Name, &passkey.Credential, &passkey.CreatedAt, &passkey.LastUsedAt)
+	if err != nil {
+		return nil, err
+	}
+	return &passkey, nil
+}
+
+// UpdatePasskeyUsage stores the credential of a passkey after a login
+func (d *DB) UpdatePasskeyUsage(ctx context.Context, passkeyId int, credential string, lastUsedAt time.Time) error {
+	_, err := d.Pool.Exec(ctx, "UPDATE passkeys SET credential = $1, last_used_at = $2 WHERE id = $3", credential, lastUsedAt, passkeyId)
+	if err != nil {
+		return errors.New("failed to update passkey usage: " + err.Error())
+	}
+	return nil
+}
+
+// RenamePasskey renames a passkey of a user
+func (d *DB) RenamePasskey(ctx context.Context, userId int, passkeyId int, name string) error {
+	tag, err := d.Pool.Exec(ctx, "UPDATE passkeys SET name = $1 WHERE id = $2 AND user_id = $3", name, passkeyId, userId)
+	if err != nil {
+		return errors.New("failed to rename passkey: " + err.Error())
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrPasskeyNotFound
+	}
+	return nil
+}
+
+// DeletePasskey revokes a passkey of a user
+func (d *DB) DeletePasskey(ctx context.Context, userId int, passkeyId int) error {
+	tag, err := d.Pool.Exec(ctx, "DELETE FROM passkeys WHERE id = $1 AND user_id = $2", passkeyId, userId)
+	if err != nil {
+		return errors.New("failed to delete passkey: " + err.Error())
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrPasskeyNotFound
+	}
+	log.Printf("Deleted passkey %d of user %d", passkeyId, userId)
+	return nil
+}
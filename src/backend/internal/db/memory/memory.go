@@ -0,0 +1,978 @@
+// Package memory implements db.Store in memory. It follows the constraints
+// and cascades of the Postgres schema so tests can run without a database.
+package memory
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"slices"
+	"sort"
+	"sync"
+	"time"
+
+	"gitlab.cherkaoui.ch/quillium-ai/quillium/src/backend/internal/chats"
+	"gitlab.cherkaoui.ch/quillium-ai/quillium/src/backend/internal/db"
+	"gitlab.cherkaoui.ch/quillium-ai/quillium/src/backend/internal/settings"
+	"gitlab.cherkaoui.ch/quillium-ai/quillium/src/backend/internal/sso"
+	"gitlab.cherkaoui.ch/quillium-ai/quillium/src/backend/internal/user"
+)
+
+// errNoRows matches the message pgx returns when a row lookup finds nothing
+const errNoRows = "no rows in result set"
+
+var ssoAuthTypes = map[string]bool{"OAuth2": true, "SAML": true, "OIDC": true}
+
+type chatRecord struct {
+	userID  int
+	content string
+	sources []byte
+}
+
+type apiKeyRecord struct {
+	userID  int
+	encrypt string
+}
+
+type refreshTokenRecord struct {
+	userID    int
+	expiresAt time.Time
+}
+
+// Store is an in-memory db.Store, safe for concurrent use
+type Store struct {
+	mu sync.Mutex
+
+	nextUserID  int
+	nextSsoID   int
+	nextChatID  int
+	nextPasskey int
+	users       map[int]*user.User
+	ssoLogins   map[int]*sso.SsoProvider
+	chats       map[int]*chatRecord
+	userConfigs map[int][]byte
+	adminConfig [][]byte
+	apiKeys     []apiKeyRecord
+	tokens      map[string]refreshTokenRecord
+	totp        map[int]*user.TOTP
+	codes       map[int][]string // Recovery code hashes by user
+	passkeys    map[int]*user.Passkey
+}
+
+var _ db.Store = (*Store)(nil)
+
+// New creates an empty store
+func New() *Store {
+	return &Store{
+		users:       make(map[int]*user.User),
+		ssoLogins:   make(map[int]*sso.SsoProvider),
+		chats:       make(map[int]*chatRecord),
+		userConfigs: make(map[int][]byte),
+		tokens:      make(map[string]refreshTokenRecord),
+		totp:        make(map[int]*user.TOTP),
+		codes:       make(map[int][]string),
+		passkeys:    make(map[int]*user.Passkey),
+	}
+}
+
+func (s *Store) Close() {}
+
+// copyUser returns a copy of u that shares no pointers with it
+func copyUser(u *user.User) *user.User {
+	c := *u
+	if u.ID != nil {
+		id := *u.ID
+		c.ID = &id
+	}
+	if u.PasswordHash != nil {
+		hash := *u.PasswordHash
+		c.PasswordHash = &hash
+	}
+	if u.SsoUserID != nil {
+		ssoUserID := *u.SsoUserID
+		c.SsoUserID = &ssoUserID
+	}
+	if u.SsoProviderID != nil {
+		providerID := *u.SsoProviderID
+		c.SsoProviderID = &providerID
+	}
+	if u.LdapDN != nil {
+		dn := *u.LdapDN
+		c.LdapDN = &dn
+	}
+	return &c
+}
+
+// emailTaken reports whether another user than exceptID uses email. Caller holds s.mu.
+func (s *Store) emailTaken(email string, exceptID int) bool {
+	for id, u := range s.users {
+		if id != exceptID && u.Email == email {
+			return true
+		}
+	}
+	return false
+}
+
+// ssoIdentityTaken reports whether another user than exceptID is linked to the
+// same provider subject. Empty subjects await re-linking and never collide. Caller holds s.mu.
+func (s *Store) ssoIdentityTaken(ssoUserId string, ssoProviderId int, exceptID int) bool {
+	for id, u := range s.users {
+		if id != exceptID && u.SsoUserID != nil && u.SsoProviderID != nil && ssoUserId != "" &&
+			*u.SsoUserID == ssoUserId && *u.SsoProviderID == ssoProviderId {
+			return true
+		}
+	}
+	return false
+}
+
+// deleteUser removes a user and everything that references it. Caller holds s.mu.
+func (s *Store) deleteUser(userId int) {
+	delete(s.users, userId)
+	delete(s.userConfigs, userId)
+	for id, chat := range s.chats {
+		if chat.userID == userId {
+			delete(s.chats, id)
+		}
+	}
+	keys := s.apiKeys[:0]
+	for _, key := range s.apiKeys {
+		if key.userID != userId {
+			keys = append(keys, key)
+		}
+	}
+	s.apiKeys = keys
+	for token, record := range s.tokens {
+		if record.userID == userId {
+			delete(s.tokens, token)
+		}
+	}
+	delete(s.totp, userId)
+	delete(s.codes, userId)
+	for id, passkey := range s.passkeys {
+		if passkey.UserID == userId {
+			delete(s.passkeys, id)
+		}
+	}
+}
+
+func (s *Store) CreateUser(ctx context.Context, u *user.User) (*int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	switch {
+	case s.emailTaken(u.Email, 0):
+		return nil, errors.New("failed to create user: duplicate key value violates unique constraint \"users_email_key\"")
+	case u.IsSso && u.SsoProviderID == nil, !u.IsSso && u.SsoProviderID != nil:
+		return nil, errors.New("failed to create user: violates check constraint \"chk_sso_provider_id\"")
+	case u.IsSso && u.SsoUserID == nil:
+		return nil, errors.New("failed to create user: violates check constraint \"chk_sso_user_id\"")
+	case !u.IsSso && u.PasswordHash == nil:
+		return nil, errors.New("failed to create user: violates check constraint \"chk_password_hash\"")
+	case u.SsoUserID != nil && u.SsoProviderID != nil && s.ssoIdentityTaken(*u.SsoUserID, *u.SsoProviderID, 0):
+		return nil, errors.New("failed to create user: duplicate key value violates unique constraint \"idx_users_sso_identity\"")
+	}
+	if u.SsoProviderID != nil {
+		if _, ok := s.ssoLogins[*u.SsoProviderID]; !ok {
+			return nil, errors.New("failed to create user: violates foreign key constraint on sso_provider_id")
+		}
+	}
+
+	s.nextUserID++
+	id := s.nextUserID
+	stored := copyUser(u)
+	stored.ID = &id
+	s.users[id] = stored
+	s.userConfigs[id] = []byte("{}")
+
+	result := id
+	return &result, nil
+}
+
+func (s *Store) CreateSsoUser(ctx context.Context, email string, ssoUserId string, ssoProviderId int) (*int, error) {
+	id, err := s.CreateUser(ctx, &user.User{
+		Email:         email,
+		IsSso:         true,
+		SsoUserID:     &ssoUserId,
+		SsoProviderID: &ssoProviderId,
+	})
+	if err != nil {
+		return nil, errors.New("failed to create sso user: " + err.Error())
+	}
+	return id, nil
+}
+
+func (s *Store) GetUser(ctx context.Context, email *string, id *int) (*user.User, error) {
+	if email == nil && id == nil {
+		return nil, errors.New("at least one of email or id must be provided")
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var found *user.User
+	for userID, u := range s.users {
+		if (email != nil && u.Email == *email) || (id != nil && userID == *id) {
+			if found == nil || userID < *found.ID {
+				found = u
+			}
+		}
+	}
+	if found == nil {
+		return nil, db.ErrUserNotFound
+	}
+	return copyUser(found), nil
+}
+
+func (s *Store) GetSsoUser(ctx context.Context, ssoProviderId int, ssoUserId string) (*user.User, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, u := range s.users {
+		if u.SsoProviderID != nil && *u.SsoProviderID == ssoProviderId && u.SsoUserID != nil && *u.SsoUserID == ssoUserId {
+			return copyUser(u), nil
+		}
+	}
+	return nil, db.ErrUserNotFound
+}
+
+func (s *Store) LinkSsoUser(ctx context.Context, userId int, ssoUserId string, ssoProviderId int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.ssoLogins[ssoProviderId]; !ok {
+		return errors.New("failed to link sso user: violates foreign key constraint on sso_provider_id")
+	}
+	if s.ssoIdentityTaken(ssoUserId, ssoProviderId, userId) {
+		return errors.New("failed to link sso user: duplicate key value violates unique constraint \"idx_users_sso_identity\"")
+	}
+	if u, ok := s.users[userId]; ok {
+		u.IsSso = true
+		u.SsoUserID = &ssoUserId
+		u.SsoProviderID = &ssoProviderId
+	}
+	return nil
+}
+
+func (s *Store) GetUsers(ctx context.Context) ([]*user.User, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var users []*user.User
+	for _, u := range s.users {
+		users = append(users, copyUser(u))
+	}
+	sort.Slice(users, func(i, j int) bool {
+		return *users[i].ID < *users[j].ID
+	})
+	return users, nil
+}
+
+func (s *Store) DeleteUser(ctx context.Context, userId int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.deleteUser(userId)
+	return nil
+}
+
+// updateUser applies update to the user if it exists; like an UPDATE matching
+// no rows, a missing user is not an error
+func (s *Store) updateUser(userId int, update func(u *user.User)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if u, ok := s.users[userId]; ok {
+		update(u)
+	}
+}
+
+func (s *Store) UpdateUserPassword(ctx context.Context, userId int, passwordHash string) error {
+	s.updateUser(userId, func(u *user.User) {
+		u.PasswordHash = &passwordHash
+	})
+	return nil
+}
+
+func (s *Store) UpdateUserEmail(ctx context.Context, userId int, email string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.emailTaken(email, userId) {
+		return errors.New("failed to update user email: duplicate key value violates unique constraint \"users_email_key\"")
+	}
+	if u, ok := s.users[userId]; ok {
+		u.Email = email
+	}
+	return nil
+}
+
+func (s *Store) UpdateUserUsername(ctx context.Context, userID int, username string) error {
+	s.updateUser(userID, func(u *user.User) {
+		u.Username = username
+	})
+	return nil
+}
+
+func (s *Store) UpdateUserIsAdmin(ctx context.Context, userId int, isAdmin bool) error {
+	s.updateUser(userId, func(u *user.User) {
+		u.IsAdmin = isAdmin
+	})
+	return nil
+}
+
+func (s *Store) AdminExists(ctx context.Context) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, u := range s.users {
+		if u.IsAdmin {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// checkSsoProvider enforces the sso_logins constraints for a provider stored
+// under id. Caller holds s.mu.
+func (s *Store) checkSsoProvider(ssoProvider *sso.SsoProvider, id int) error {
+	if !ssoAuthTypes[ssoProvider.AuthType] {
+		return errors.New("violates check constraint on sso_auth_type")
+	}
+	for existingID, existing := range s.ssoLogins {
+		if existingID != id && existing.Provider == ssoProvider.Provider {
+			return errors.New("duplicate key value violates unique constraint \"sso_logins_sso_provider_key\"")
+		}
+	}
+	return nil
+}
+
+// copySsoProvider returns a copy of the provider stored under id
+func copySsoProvider(p *sso.SsoProvider, id int) *sso.SsoProvider {
+	c := *p
+	c.ID = &id
+	c.AllowedDomains = slices.Clone(p.AllowedDomains)
+	return &c
+}
+
+func (s *Store) CreateSsoProvider(ctx context.Context, ssoProvider *sso.SsoProvider) (*int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.checkSsoProvider(ssoProvider, 0); err != nil {
+		return nil, errors.New("failed to create sso provider: " + err.Error())
+	}
+
+	s.nextSsoID++
+	id := s.nextSsoID
+	s.ssoLogins[id] = copySsoProvider(ssoProvider, id)
+
+	result := id
+	return &result, nil
+}
+
+func (s *Store) GetSsoProvider(ctx context.Context, provider string) (*sso.SsoProvider, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for id, p := range s.ssoLogins {
+		if p.Provider == provider {
+			return copySsoProvider(p, id), nil
+		}
+	}
+	return nil, db.ErrSsoProviderNotFound
+}
+
+func (s *Store) GetSsoProviderByID(ctx context.Context, ssoProviderId int) (*sso.SsoProvider, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	p, ok := s.ssoLogins[ssoProviderId]
+	if !ok {
+		return nil, db.ErrSsoProviderNotFound
+	}
+	return copySsoProvider(p, ssoProviderId), nil
+}
+
+func (s *Store) GetSsoProviders(ctx context.Context) ([]*sso.SsoProvider, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var providers []*sso.SsoProvider
+	for id, p := range s.ssoLogins {
+		providers = append(providers, copySsoProvider(p, id))
+	}
+	sort.Slice(providers, func(i, j int) bool {
+		return *providers[i].ID < *providers[j].ID
+	})
+	return providers, nil
+}
+
+func (s *Store) UpdateSsoProvider(ctx context.Context, ssoProvider *sso.SsoProvider) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	id := *ssoProvider.ID
+	if err := s.checkSsoProvider(ssoProvider, id); err != nil {
+		return errors.New("failed to update sso provider: " + err.Error())
+	}
+	if _, ok := s.ssoLogins[id]; ok {
+		s.ssoLogins[id] = copySsoProvider(ssoProvider, id)
+	}
+	return nil
+}
+
+func (s *Store) CountSsoProviderUsers(ctx context.Context, ssoProviderId int) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	count := 0
+	for _, u := range s.users {
+		if u.SsoProviderID != nil && *u.SsoProviderID == ssoProviderId {
+			count++
+		}
+	}
+	return count, nil
+}
+
+func (s *Store) MigrateSsoProviderUsers(ctx context.Context, fromProviderId int, toProviderId int) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.migrateSsoProviderUsers(fromProviderId, toProviderId)
+}
+
+// migrateSsoProviderUsers moves the users of a provider to another one and clears the
+// subjects the old provider issued. Caller holds s.mu.
+func (s *Store) migrateSsoProviderUsers(fromProviderId int, toProviderId int) (int, error) {
+	if _, ok := s.ssoLogins[toProviderId]; !ok {
+		return 0, errors.New("failed to migrate sso provider users: violates foreign key constraint on sso_provider_id")
+	}
+	migrated := 0
+	for _, u := range s.users {
+		if u.SsoProviderID != nil && *u.SsoProviderID == fromProviderId {
+			providerID, subject := toProviderId, ""
+			u.SsoProviderID = &providerID
+			u.SsoUserID = &subject
+			migrated++
+		}
+	}
+	return migrated, nil
+}
+
+func (s *Store) DeleteSsoProvider(ctx context.Context, ssoProviderId int, migrateToId *int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.ssoLogins[ssoProviderId]; !ok {
+		return db.ErrSsoProviderNotFound
+	}
+	for _, u := range s.users {
+		if u.SsoProviderID != nil && *u.SsoProviderID == ssoProviderId {
+			if migrateToId == nil {
+				return db.ErrSsoProviderInUse
+			}
+			if _, err := s.migrateSsoProviderUsers(ssoProviderId, *migrateToId); err != nil {
+				return err
+			}
+			break
+		}
+	}
+	delete(s.ssoLogins, ssoProviderId)
+	return nil
+}
+
+func (s *Store) CreateChat(ctx context.Context, userId int, chatContent *chats.ChatContent) (*int, error) {
+	jsonStr, err := chatContent.ToJSON()
+	if err != nil {
+		return nil, errors.New("failed to convert chat content to JSON: " + err.Error())
+	}
+	sourcesJSON, err := json.Marshal(chatContent.Sources)
+	if err != nil {
+		return nil, errors.New("failed to convert sources to JSON: " + err.Error())
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.users[userId]; !ok {
+		return nil, errors.New("failed to create chat: violates foreign key constraint on user_id")
+	}
+	s.nextChatID++
+	id := s.nextChatID
+	s.chats[id] = &chatRecord{userID: userId, content: jsonStr, sources: sourcesJSON}
+	return &id, nil
+}
+
+func (s *Store) GetChats(ctx context.Context, userId int) ([]int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var ids []int
+	for id, chat := range s.chats {
+		if chat.userID == userId {
+			ids = append(ids, id)
+		}
+	}
+	sort.Ints(ids)
+	return ids, nil
+}
+
+func (s *Store) GetChatContent(ctx context.Context, chatId int) (*chats.ChatContent, error) {
+	s.mu.Lock()
+	chat, ok := s.chats[chatId]
+	var content string
+	var sourcesJSON []byte
+	if ok {
+		content, sourcesJSON = chat.content, chat.sources
+	}
+	s.mu.Unlock()
+	if !ok {
+		return nil, errors.New("failed to get chat content: " + errNoRows)
+	}
+
+	var empty chats.ChatContent
+	chatContent, err := empty.FromJSON(content)
+	if err != nil {
+		return nil, errors.New("failed to parse chat content: " + err.Error())
+	}
+	var sources []chats.Source
+	if err := json.Unmarshal(sourcesJSON, &sources); err != nil {
+		return nil, errors.New("failed to parse sources: " + err.Error())
+	}
+	chatContent.Sources = sources
+	return chatContent, nil
+}
+
+func (s *Store) VerifyChatOwnership(ctx context.Context, chatId int, userId int) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	chat, ok := s.chats[chatId]
+	return ok && chat.userID == userId, nil
+}
+
+// UpdateChatContent replaces the title and messages. Sources are kept, as
+// in the Postgres implementation.
+func (s *Store) UpdateChatContent(ctx context.Context, chatId int, chatContent *chats.ChatContent) error {
+	jsonStr, err := chatContent.ToJSON()
+	if err != nil {
+		return errors.New("failed to convert chat content to JSON: " + err.Error())
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if chat, ok := s.chats[chatId]; ok {
+		chat.content = jsonStr
+	}
+	return nil
+}
+
+func (s *Store) DeleteChat(ctx context.Context, chatId int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.chats, chatId)
+	return nil
+}
+
+func (s *Store) GetUserSettings(ctx context.Context, userId int) (*settings.UserSettings, error) {
+	s.mu.Lock()
+	config, ok := s.userConfigs[userId]
+	s.mu.Unlock()
+	if !ok {
+		return nil, errors.New("failed to get user settings: " + errNoRows)
+	}
+
+	var userSettings settings.UserSettings
+	if err := json.Unmarshal(config, &userSettings); err != nil {
+		return nil, errors.New("failed to get user settings: " + err.Error())
+	}
+	return &userSettings, nil
+}
+
+func (s *Store) UpdateUserSettings(ctx context.Context, userId int, config *settings.UserSettings) error {
+	configJSON, err := json.Marshal(config)
+	if err != nil {
+		return errors.New("failed to update user settings: " + err.Error())
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.userConfigs[userId]; ok {
+		s.userConfigs[userId] = configJSON
+	}
+	return nil
+}
+
+func (s *Store) GetAdminSettings(ctx context.Context) (*settings.AdminSettings, error) {
+	s.mu.Lock()
+	var config []byte
+	if len(s.adminConfig) > 0 {
+		config = s.adminConfig[len(s.adminConfig)-1]
+	}
+	s.mu.Unlock()
+	if config == nil {
+		return nil, errors.New("failed to get admin settings: " + errNoRows)
+	}
+
+	var adminSettings settings.AdminSettings
+	if err := json.Unmarshal(config, &adminSettings); err != nil {
+		return nil, errors.New("failed to get admin settings: " + err.Error())
+	}
+	return &adminSettings, nil
+}
+
+func (s *Store) CreateAdminSettings(ctx context.Context, config *settings.AdminSettings) error {
+	configJSON, err := json.Marshal(config)
+	if err != nil {
+		return errors.New("failed to initialize admin settings: " + err.Error())
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.adminConfig = append(s.adminConfig, configJSON)
+	return nil
+}
+
+func (s *Store) CreateUserApikey(ctx context.Context, u *user.User, apikey string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if u.ID == nil {
+		return errors.New("failed to create user apikey: null value in column \"user_id\"")
+	}
+	if _, ok := s.users[*u.ID]; !ok {
+		return errors.New("failed to create user apikey: violates foreign key constraint on user_id")
+	}
+	for _, key := range s.apiKeys {
+		if key.encrypt == apikey {
+			return errors.New("failed to create user apikey: duplicate key value violates unique constraint \"user_apikeys_api_key_encrypt_key\"")
+		}
+	}
+	s.apiKeys = append(s.apiKeys, apiKeyRecord{userID: *u.ID, encrypt: apikey})
+	return nil
+}
+
+func (s *Store) GetUserByApikey(ctx context.Context, apikey_encrypt string) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, key := range s.apiKeys {
+		if key.encrypt == apikey_encrypt {
+			return key.userID, nil
+		}
+	}
+	return -1, errors.New("failed to get user apikey: " + errNoRows)
+}
+
+func (s *Store) GetUserApikeys(ctx context.Context, u *user.User) ([]string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var apikeys []string
+	for _, key := range s.apiKeys {
+		if u.ID != nil && key.userID == *u.ID {
+			apikeys = append(apikeys, key.encrypt)
+		}
+	}
+	return apikeys, nil
+}
+
+func (s *Store) DeleteUserApikey(ctx context.Context, u *user.User, apikey_encrypt string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	keys := s.apiKeys[:0]
+	for _, key := range s.apiKeys {
+		if u.ID == nil || key.userID != *u.ID || key.encrypt != apikey_encrypt {
+			keys = append(keys, key)
+		}
+	}
+	s.apiKeys = keys
+	return nil
+}
+
+func (s *Store) CreateRefreshToken(ctx context.Context, userId int, token string, expiresAt time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.users[userId]; !ok {
+		return errors.New("failed to create refresh token: violates foreign key constraint on user_id")
+	}
+	if _, ok := s.tokens[token]; ok {
+		return errors.New("failed to create refresh token: duplicate key value violates unique constraint \"refresh_tokens_token_key\"")
+	}
+	s.tokens[token] = refreshTokenRecord{userID: userId, expiresAt: expiresAt}
+	return nil
+}
+
+func (s *Store) GetRefreshToken(ctx context.Context, token string) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	record, ok := s.tokens[token]
+	if !ok {
+		return 0, errors.New("refresh token not found: " + errNoRows)
+	}
+	if time.Now().After(record.expiresAt) {
+		delete(s.tokens, token)
+		return 0, errors.New("refresh token expired")
+	}
+	return record.userID, nil
+}
+
+func (s *Store) DeleteRefreshToken(ctx context.Context, token string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.tokens, token)
+	return nil
+}
+
+func (s *Store) DeleteUserRefreshTokens(ctx context.Context, userId int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for token, record := range s.tokens {
+		if record.userID == userId {
+			delete(s.tokens, token)
+		}
+	}
+	return nil
+}
+
+func (s *Store) SetUserTOTPSecret(ctx context.Context, userId int, secretEncrypt string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.users[userId]; !ok {
+		return errors.New("failed to set user totp secret: violates foreign key constraint on user_id")
+	}
+	s.totp[userId] = &user.TOTP{UserID: userId, Secret: secretEncrypt}
+	return nil
+}
+
+func (s *Store) GetUserTOTP(ctx context.Context, userId int) (*user.TOTP, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	totp, ok := s.totp[userId]
+	if !ok {
+		return nil, db.ErrTOTPNotFound
+	}
+	c := *totp
+	if totp.LastFailedAt != nil {
+		lastFailedAt := *totp.LastFailedAt
+		c.LastFailedAt = &lastFailedAt
+	}
+	if totp.ChallengeNonce != nil {
+		nonce := *totp.ChallengeNonce
+		c.ChallengeNonce = &nonce
+	}
+	return &c, nil
+}
+
+func (s *Store) EnableUserTOTP(ctx context.Context, userId int, lastUsedStep int64, recoveryCodeHashes []string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	totp, ok := s.totp[userId]
+	if !ok || totp.Enabled {
+		return db.ErrTOTPNotFound
+	}
+	totp.Enabled = true
+	totp.LastUsedStep = lastUsedStep
+	totp.FailedAttempts = 0
+	totp.LastFailedAt = nil
+	s.codes[userId] = slices.Clone(recoveryCodeHashes)
+	return nil
+}
+
+func (s *Store) UpdateUserTOTPAttempts(ctx context.Context, userId int, lastUsedStep int64, failedAttempts int, lastFailedAt *time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if totp, ok := s.totp[userId]; ok {
+		totp.LastUsedStep = lastUsedStep
+		totp.FailedAttempts = failedAttempts
+		totp.LastFailedAt = nil
+		if lastFailedAt != nil {
+			failedAt := *lastFailedAt
+			totp.LastFailedAt = &failedAt
+		}
+	}
+	return nil
+}
+
+func (s *Store) SetUserTOTPChallengeNonce(ctx context.Context, userId int, nonce string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	totp, ok := s.totp[userId]
+	if !ok {
+		return db.ErrTOTPNotFound
+	}
+	totp.ChallengeNonce = &nonce
+	return nil
+}
+
+func (s *Store) ClaimUserTOTPChallengeNonce(ctx context.Context, userId int, nonce string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	totp, ok := s.totp[userId]
+	if !ok || totp.ChallengeNonce != nil {
+		return false, nil
+	}
+	totp.ChallengeNonce = &nonce
+	return true, nil
+}
+
+func (s *Store) ConsumeUserTOTPChallengeNonce(ctx context.Context, userId int, nonce string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	totp, ok := s.totp[userId]
+	if !ok || totp.ChallengeNonce == nil || *totp.ChallengeNonce != nonce {
+		return false, nil
+	}
+	totp.ChallengeNonce = nil
+	return true, nil
+}
+
+func (s *Store) DeleteUserTOTP(ctx context.Context, userId int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.totp, userId)
+	delete(s.codes, userId)
+	return nil
+}
+
+func (s *Store) ReplaceRecoveryCodes(ctx context.Context, userId int, codeHashes []string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.users[userId]; !ok {
+		return errors.New("failed to create recovery code: violates foreign key constraint on user_id")
+	}
+	s.codes[userId] = slices.Clone(codeHashes)
+	return nil
+}
+
+func (s *Store) UseRecoveryCode(ctx context.Context, userId int, codeHash string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	index := slices.Index(s.codes[userId], codeHash)
+	if index < 0 {
+		return false, nil
+	}
+	s.codes[userId] = slices.Delete(s.codes[userId], index, index+1)
+	return true, nil
+}
+
+func (s *Store) CountRecoveryCodes(ctx context.Context, userId int) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return len(s.codes[userId]), nil
+}
+
+func (s *Store) CreatePasskey(ctx context.Context, passkey *user.Passkey) (*int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.users[passkey.UserID]; !ok {
+		return nil, errors.New("failed to create passkey: violates foreign key constraint on user_id")
+	}
+	for _, existing := range s.passkeys {
+		if existing.CredentialID == passkey.CredentialID {
+			return nil, errors.New("failed to create passkey: duplicate key value violates unique constraint on credential_id")
+		}
+	}
+	s.nextPasskey++
+	id := s.nextPasskey
+	s.passkeys[id] = &user.Passkey{
+		ID:           id,
+		UserID:       passkey.UserID,
+		CredentialID: passkey.CredentialID,
+		Name:         passkey.Name,
+		Credential:   passkey.Credential,
+		CreatedAt:    time.Now(),
+	}
+	return &id, nil
+}
+
+func (s *Store) GetPasskeys(ctx context.Context, userId int) ([]*user.Passkey, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var passkeys []*user.Passkey
+	for _, passkey := range s.passkeys {
+		if passkey.UserID == userId {
+			passkeys = append(passkeys, copyPasskey(passkey))
+		}
+	}
+	sort.Slice(passkeys, func(i, j int) bool { return passkeys[i].ID < passkeys[j].ID })
+	return passkeys, nil
+}
+
+func (s *Store) GetPasskeyByCredentialID(ctx context.Context, credentialId string) (*user.Passkey, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, passkey := range s.passkeys {
+		if passkey.CredentialID == credentialId {
+			return copyPasskey(passkey), nil
+		}
+	}
+	return nil, db.ErrPasskeyNotFound
+}
+
+func copyPasskey(passkey *user.Passkey) *user.Passkey {
+	c := *passkey
+	if passkey.LastUsedAt != nil {
+		lastUsedAt := *passkey.LastUsedAt
+		c.LastUsedAt = &lastUsedAt
+	}
+	return &c
+}
+
+func (s *Store) UpdatePasskeyUsage(ctx context.Context, passkeyId int, credential string, lastUsedAt time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if passkey, ok := s.passkeys[passkeyId]; ok {
+		passkey.Credential = credential
+		passkey.LastUsedAt = &lastUsedAt
+	}
+	return nil
+}
+
+func (s *Store) RenamePasskey(ctx context.Context, userId int, passkeyId int, name string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	passkey, ok := s.passkeys[passkeyId]
+	if !ok || passkey.UserID != userId {
+		return db.ErrPasskeyNotFound
+	}
+	passkey.Name = name
+	return nil
+}
+
+func (s *Store) DeletePasskey(ctx context.Context, userId int, passkeyId int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	passkey, ok := s.passkeys[passkeyId]
+	if !ok || passkey.UserID != userId {
+		return db.ErrPasskeyNotFound
+	}
+	delete(s.passkeys, passkeyId)
+	return nil
+}
@@ -0,0 +1,119 @@
+package memory
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"gitlab.cherkaoui.ch/quillium-ai/quillium/src/backend/internal/chats"
+	"gitlab.cherkaoui.ch/quillium-ai/quillium/src/backend/internal/db"
+	"gitlab.cherkaoui.ch/quillium-ai/quillium/src/backend/internal/user"
+)
+
+func createTestUser(t *testing.T, store *Store, email string) int {
+	t.Helper()
+	passwordHash := "hashedpassword"
+	id, err := store.CreateUser(context.Background(), &user.User{Email: email, PasswordHash: &passwordHash})
+	if err != nil {
+		t.Fatalf("Failed to create user: %v", err)
+	}
+	return *id
+}
+
+// TestUserConstraints tests that the schema constraints on users are enforced
+func TestUserConstraints(t *testing.T) {
+	ctx := context.Background()
+	store := New()
+	createTestUser(t, store, "user@example.com")
+
+	passwordHash := "hashedpassword"
+	if _, err := store.CreateUser(ctx, &user.User{Email: "user@example.com", PasswordHash: &passwordHash}); err == nil {
+		t.Error("Expected an error for a duplicate email")
+	}
+	if _, err := store.CreateUser(ctx, &user.User{Email: "nopassword@example.com"}); err == nil {
+		t.Error("Expected an error for a password user without a password hash")
+	}
+	if _, err := store.CreateSsoUser(ctx, "sso@example.com", "sso-id", 42); err == nil {
+		t.Error("Expected an error for an unknown SSO provider")
+	}
+
+	email := "missing@example.com"
+	if _, err := store.GetUser(ctx, &email, nil); !errors.Is(err, db.ErrUserNotFound) {
+		t.Errorf("Expected ErrUserNotFound, got %v", err)
+	}
+}
+
+// TestDeleteUserCascades tests that deleting a user removes the rows referencing it
+func TestDeleteUserCascades(t *testing.T) {
+	ctx := context.Background()
+	store := New()
+	userID := createTestUser(t, store, "cascade@example.com")
+	u, err := store.GetUser(ctx, nil, &userID)
+	if err != nil {
+		t.Fatalf("Failed to get user: %v", err)
+	}
+
+	if _, err := store.CreateChat(ctx, userID, &chats.ChatContent{Title: "Chat"}); err != nil {
+		t.Fatalf("Failed to create chat: %v", err)
+	}
+	if err := store.CreateUserApikey(ctx, u, "encrypted-key"); err != nil {
+		t.Fatalf("Failed to create API key: %v", err)
+	}
+	if err := store.CreateRefreshToken(ctx, userID, "token", time.Now().Add(time.Hour)); err != nil {
+		t.Fatalf("Failed to create refresh token: %v", err)
+	}
+
+	if err := store.SetUserTOTPSecret(ctx, userID, "encrypted-secret"); err != nil {
+		t.Fatalf("Failed to set TOTP secret: %v", err)
+	}
+	if err := store.EnableUserTOTP(ctx, userID, 1, []string{"code-hash"}); err != nil {
+		t.Fatalf("Failed to enable TOTP: %v", err)
+	}
+	if _, err := store.CreatePasskey(ctx, &user.Passkey{UserID: userID, CredentialID: "credential", Name: "Laptop", Credential: "{}"}); err != nil {
+		t.Fatalf("Failed to create passkey: %v", err)
+	}
+
+	if err := store.DeleteUser(ctx, userID); err != nil {
+		t.Fatalf("Failed to delete user: %v", err)
+	}
+
+	if ids, _ := store.GetChats(ctx, userID); len(ids) != 0 {
+		t.Errorf("Expected chats to be deleted, got %v", ids)
+	}
+	if _, err := store.GetUserByApikey(ctx, "encrypted-key"); err == nil {
+		t.Error("Expected API key to be deleted")
+	}
+	if _, err := store.GetRefreshToken(ctx, "token"); err == nil {
+		t.Error("Expected refresh token to be deleted")
+	}
+	if _, err := store.GetUserSettings(ctx, userID); err == nil {
+		t.Error("Expected user settings to be deleted")
+	}
+	if _, err := store.GetUserTOTP(ctx, userID); !errors.Is(err, db.ErrTOTPNotFound) {
+		t.Errorf("Expected TOTP enrollment to be deleted, got %v", err)
+	}
+	if count, _ := store.CountRecoveryCodes(ctx, userID); count != 0 {
+		t.Errorf("Expected recovery codes to be deleted, got %d", count)
+	}
+	if _, err := store.GetPasskeyByCredentialID(ctx, "credential"); !errors.Is(err, db.ErrPasskeyNotFound) {
+		t.Errorf("Expected passkey to be deleted, got %v", err)
+	}
+}
+
+// TestRefreshTokenExpiry tests that expired refresh tokens are rejected and removed
+func TestRefreshTokenExpiry(t *testing.T) {
+	ctx := context.Background()
+	store := New()
+	userID := createTestUser(t, store, "token@example.com")
+
+	if err := store.CreateRefreshToken(ctx, userID, "expired", time.Now().Add(-time.Minute)); err != nil {
+		t.Fatalf("Failed to create refresh token: %v", err)
+	}
+	if _, err := store.GetRefreshToken(ctx, "expired"); err == nil {
+		t.Fatal("Expected an error for an expired refresh token")
+	}
+	if _, ok := store.tokens["expired"]; ok {
+		t.Error("Expected the expired refresh token to be deleted")
+	}
+}
@@ -0,0 +1,469 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"embed"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"regexp"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+//go:embed migrations/postgres/*.sql migrations/sqlite/*.sql
+var migrationFiles embed.FS
+
+// Dialects with their own migration directory
+const (
+	DialectPostgres = "postgres"
+	DialectSQLite   = "sqlite"
+)
+
+// migrationLockID is the advisory lock key held while the schema is changed,
+// so replicas starting at the same time apply each migration only once
+const migrationLockID int64 = 0x7175696c6c69756d
+
+var migrationFilePattern = regexp.MustCompile(`^(\d+)_([a-z0-9_]+)\.(up|down)\.sql$`)
+
+// Migration is a numbered schema change with the SQL to apply and revert it
+type Migration struct {
+	Version int
+	Name    string
+	Up      string
+	Down    string
+}
+
+// MigrationState reports whether a migration has been applied.
+// AppliedAt is nil for pending migrations.
+type MigrationState struct {
+	Version   int
+	Name      string
+	AppliedAt *time.Time
+}
+
+// Migrations returns the migrations of a dialect embedded in the binary, ordered by version
+func Migrations(dialect string) ([]Migration, error) {
+	dir, err := fs.Sub(migrationFiles, "migrations/"+dialect)
+	if err != nil {
+		return nil, errors.New("failed to read migrations: " + err.Error())
+	}
+	return loadMigrations(dir)
+}
+
+// loadMigrations parses <version>_<name>.up.sql and <version>_<name>.down.sql
+// pairs from the root of fsys
+func loadMigrations(fsys fs.FS) ([]Migration, error) {
+	entries, err := fs.ReadDir(fsys, ".")
+	if err != nil {
+		return nil, errors.New("failed to read migrations: " + err.Error())
+	}
+
+	byVersion := make(map[int]*Migration)
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+		match := migrationFilePattern.FindStringSubmatch(entry.Name())
+		if match == nil {
+			return nil, fmt.Errorf("invalid migration file name: %s", entry.Name())
+		}
+		version, err := strconv.Atoi(match[1])
+		if err != nil || version <= 0 {
+			return nil, fmt.Errorf("invalid migration version: %s", entry.Name())
+		}
+
+		content, err := fs.ReadFile(fsys, entry.Name())
+		if err != nil {
+			return nil, errors.New("failed to read migration: " + err.Error())
+		}
+
+		migration, ok := byVersion[version]
+		if !ok {
+			migration = &Migration{Version: version, Name: match[2]}
+			byVersion[version] = migration
+		} else if migration.Name != match[2] {
+			return nil, fmt.Errorf("migration %d has conflicting names %q and %q", version, migration.Name, match[2])
+		}
+
+		if match[3] == "up" {
+			migration.Up = string(content)
+		} else {
+			migration.Down = string(content)
+		}
+	}
+
+	migrations := make([]Migration, 0, len(byVersion))
+	for _, migration := range byVersion {
+		if migration.Up == "" || migration.Down == "" {
+			return nil, fmt.Errorf("migration %d_%s needs both an up and a down file", migration.Version, migration.Name)
+		}
+		migrations = append(migrations, *migration)
+	}
+	sort.Slice(migrations, func(i, j int) bool {
+		return migrations[i].Version < migrations[j].Version
+	})
+
+	return migrations, nil
+}
+
+type appliedMigration struct {
+	name      string
+	appliedAt time.Time
+}
+
+// migrationRunner reads and changes the schema of one database
+type migrationRunner interface {
+	// applied returns the rows of schema_migrations keyed by version
+	applied(ctx context.Context) (map[int]appliedMigration, error)
+	// apply runs the up script and records the migration in one transaction
+	apply(ctx context.Context, migration Migration) error
+	// revert runs the down script and removes the record in one transaction
+	revert(ctx context.Context, migration Migration) error
+}
+
+// applyMigrations applies every pending migration in order and returns how many were applied
+func applyMigrations(ctx context.Context, runner migrationRunner, migrations []Migration) (int, error) {
+	applied, err := runner.applied(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	count := 0
+	latest := 0
+	for _, migration := range migrations {
+		latest = migration.Version
+		if _, ok := applied[migration.Version]; ok {
+			continue
+		}
+		if err := runner.apply(ctx, migration); err != nil {
+			return count, fmt.Errorf("failed to apply migration %04d_%s: %s", migration.Version, migration.Name, err.Error())
+		}
+		log.Printf("Applied migration %04d_%s", migration.Version, migration.Name)
+		count++
+	}
+
+	for version := range applied {
+		if version > latest {
+			log.Printf("Warning: database has migration %04d applied, which this binary does not know about", version)
+		}
+	}
+	return count, nil
+}
+
+// rollbackMigrations reverts the most recently applied migrations, at most
+// steps of them, and returns how many were reverted
+func rollbackMigrations(ctx context.Context, runner migrationRunner, migrations []Migration, steps int) (int, error) {
+	known := make(map[int]Migration, len(migrations))
+	for _, migration := range migrations {
+		known[migration.Version] = migration
+	}
+
+	applied, err := runner.applied(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	versions := make([]int, 0, len(applied))
+	for version := range applied {
+		versions = append(versions, version)
+	}
+	sort.Sort(sort.Reverse(sort.IntSlice(versions)))
+
+	count := 0
+	for _, version := range versions {
+		if count == steps {
+			break
+		}
+		migration, ok := known[version]
+		if !ok {
+			return count, fmt.Errorf("cannot roll back migration %04d: it is not embedded in this binary", version)
+		}
+		if err := runner.revert(ctx, migration); err != nil {
+			return count, fmt.Errorf("failed to roll back migration %04d_%s: %s", migration.Version, migration.Name, err.Error())
+		}
+		log.Printf("Rolled back migration %04d_%s", migration.Version, migration.Name)
+		count++
+	}
+	return count, nil
+}
+
+// migrationStates lists every known or applied migration ordered by version
+func migrationStates(ctx context.Context, runner migrationRunner, migrations []Migration) ([]MigrationState, error) {
+	applied, err := runner.applied(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var states []MigrationState
+	for _, migration := range migrations {
+		state := MigrationState{Version: migration.Version, Name: migration.Name}
+		if record, ok := applied[migration.Version]; ok {
+			state.AppliedAt = &record.appliedAt
+			delete(applied, migration.Version)
+		}
+		states = append(states, state)
+	}
+	// Migrations applied by a newer binary are still reported
+	for version, record := range applied {
+		appliedAt := record.appliedAt
+		states = append(states, MigrationState{Version: version, Name: record.name, AppliedAt: &appliedAt})
+	}
+
+	sort.Slice(states, func(i, j int) bool {
+		return states[i].Version < states[j].Version
+	})
+	return states, nil
+}
+
+// Migrate applies every pending migration in order and returns how many were applied
+func (d *DB) Migrate(ctx context.Context) (int, error) {
+	migrations, err := Migrations(DialectPostgres)
+	if err != nil {
+		return 0, err
+	}
+
+	count := 0
+	err = d.withMigrationLock(ctx, func(runner migrationRunner) error {
+		count, err = applyMigrations(ctx, runner, migrations)
+		return err
+	})
+	return count, err
+}
+
+// Rollback reverts the most recently applied migrations, at most steps of them,
+// and returns how many were reverted
+func (d *DB) Rollback(ctx context.Context, steps int) (int, error) {
+	if steps <= 0 {
+		return 0, errors.New("rollback steps must be positive")
+	}
+	migrations, err := Migrations(DialectPostgres)
+	if err != nil {
+		return 0, err
+	}
+
+	count := 0
+	err = d.withMigrationLock(ctx, func(runner migrationRunner) error {
+		count, err = rollbackMigrations(ctx, runner, migrations, steps)
+		return err
+	})
+	return count, err
+}
+
+// MigrationStatus lists every known or applied migration ordered by version
+func (d *DB) MigrationStatus(ctx context.Context) ([]MigrationState, error) {
+	migrations, err := Migrations(DialectPostgres)
+	if err != nil {
+		return nil, err
+	}
+
+	var states []MigrationState
+	err = d.withMigrationLock(ctx, func(runner migrationRunner) error {
+		states, err = migrationStates(ctx, runner, migrations)
+		return err
+	})
+	return states, err
+}
+
+// withMigrationLock runs fn on a single connection holding the migration
+// advisory lock, creating the schema_migrations table if needed
+func (d *DB) withMigrationLock(ctx context.Context, fn func(runner migrationRunner) error) error {
+	conn, err := d.Pool.Acquire(ctx)
+	if err != nil {
+		return errors.New("failed to acquire connection: " + err.Error())
+	}
+	defer conn.Release()
+
+	// Session-level advisory locks belong to the connection, so the lock is
+	// taken and released on the same connection the migrations run on
+	if _, err := conn.Exec(ctx, "SELECT pg_advisory_lock($1)", migrationLockID); err != nil {
+		return errors.New("failed to acquire migration lock: " + err.Error())
+	}
+	defer func() {
+		if _, err := conn.Exec(context.Background(), "SELECT pg_advisory_unlock($1)", migrationLockID); err != nil {
+			log.Printf("Error releasing migration lock: %v", err)
+		}
+	}()
+
+	_, err = conn.Exec(ctx, `
+		CREATE TABLE IF NOT EXISTS schema_migrations (
+			version INT PRIMARY KEY,
+			name VARCHAR(255) NOT NULL,
+			applied_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+		)
+	`)
+	if err != nil {
+		return errors.New("failed to create schema_migrations table: " + err.Error())
+	}
+
+	return fn(postgresMigrationRunner{conn: conn})
+}
+
+// postgresMigrationRunner runs migrations on a connection holding the migration lock
+type postgresMigrationRunner struct {
+	conn *pgxpool.Conn
+}
+
+func (r postgresMigrationRunner) applied(ctx context.Context) (map[int]appliedMigration, error) {
+	rows, err := r.conn.Query(ctx, "SELECT version, name, applied_at FROM schema_migrations")
+	if err != nil {
+		return nil, errors.New("failed to read schema_migrations: " + err.Error())
+	}
+	defer rows.Close()
+
+	applied := make(map[int]appliedMigration)
+	for rows.Next() {
+		var version int
+		var record appliedMigration
+		if err := rows.Scan(&version, &record.name, &record.appliedAt); err != nil {
+			return nil, errors.New("failed to read schema_migrations: " + err.Error())
+		}
+		applied[version] = record
+	}
+	if err := rows.Err(); err != nil {
+		return nil, errors.New("failed to read schema_migrations: " + err.Error())
+	}
+	return applied, nil
+}
+
+func (r postgresMigrationRunner) apply(ctx context.Context, migration Migration) error {
+	return r.run(ctx, migration.Up, "INSERT INTO schema_migrations (version, name) VALUES ($1, $2)", migration.Version, migration.Name)
+}
+
+func (r postgresMigrationRunner) revert(ctx context.Context, migration Migration) error {
+	return r.run(ctx, migration.Down, "DELETE FROM schema_migrations WHERE version = $1", migration.Version)
+}
+
+// run executes a migration script and its bookkeeping statement in one transaction
+func (r postgresMigrationRunner) run(ctx context.Context, script string, bookkeeping string, args ...any) error {
+	tx, err := r.conn.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	if _, err := tx.Exec(ctx, script); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(ctx, bookkeeping, args...); err != nil {
+		return err
+	}
+	return tx.Commit(ctx)
+}
+
+// Migrate applies every pending migration in order and returns how many were applied
+func (d *SQLiteDB) Migrate(ctx context.Context) (int, error) {
+	migrations, err := Migrations(DialectSQLite)
+	if err != nil {
+		return 0, err
+	}
+	runner, err := d.migrationRunner(ctx)
+	if err != nil {
+		return 0, err
+	}
+	return applyMigrations(ctx, runner, migrations)
+}
+
+// Rollback reverts the most recently applied migrations, at most steps of them,
+// and returns how many were reverted
+func (d *SQLiteDB) Rollback(ctx context.Context, steps int) (int, error) {
+	if steps <= 0 {
+		return 0, errors.New("rollback steps must be positive")
+	}
+	migrations, err := Migrations(DialectSQLite)
+	if err != nil {
+		return 0, err
+	}
+	runner, err := d.migrationRunner(ctx)
+	if err != nil {
+		return 0, err
+	}
+	return rollbackMigrations(ctx, runner, migrations, steps)
+}
+
+// MigrationStatus lists every known or applied migration ordered by version
+func (d *SQLiteDB) MigrationStatus(ctx context.Context) ([]MigrationState, error) {
+	migrations, err := Migrations(DialectSQLite)
+	if err != nil {
+		return nil, err
+	}
+	runner, err := d.migrationRunner(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return migrationStates(ctx, runner, migrations)
+}
+
+// migrationRunner creates the schema_migrations table if needed. SQLite
+// serializes writers on the database file, and the version primary key makes
+// a migration applied concurrently by another process fail and roll back.
+func (d *SQLiteDB) migrationRunner(ctx context.Context) (migrationRunner, error) {
+	_, err := d.DB.ExecContext(ctx, `
+		CREATE TABLE IF NOT EXISTS schema_migrations (
+			version INTEGER PRIMARY KEY,
+			name VARCHAR(255) NOT NULL,
+			applied_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+		)
+	`)
+	if err != nil {
+		return nil, errors.New("failed to create schema_migrations table: " + err.Error())
+	}
+	return sqliteMigrationRunner{db: d.DB}, nil
+}
+
+// sqliteMigrationRunner runs migrations on a SQLite database
+type sqliteMigrationRunner struct {
+	db *sql.DB
+}
+
+func (r sqliteMigrationRunner) applied(ctx context.Context) (map[int]appliedMigration, error) {
+	rows, err := r.db.QueryContext(ctx, "SELECT version, name, applied_at FROM schema_migrations")
+	if err != nil {
+		return nil, errors.New("failed to read schema_migrations: " + err.Error())
+	}
+	defer rows.Close()
+
+	applied := make(map[int]appliedMigration)
+	for rows.Next() {
+		var version int
+		var record appliedMigration
+		if err := rows.Scan(&version, &record.name, &record.appliedAt); err != nil {
+			return nil, errors.New("failed to read schema_migrations: " + err.Error())
+		}
+		applied[version] = record
+	}
+	if err := rows.Err(); err != nil {
+		return nil, errors.New("failed to read schema_migrations: " + err.Error())
+	}
+	return applied, nil
+}
+
+func (r sqliteMigrationRunner) apply(ctx context.Context, migration Migration) error {
+	return r.run(ctx, migration.Up, "INSERT INTO schema_migrations (version, name) VALUES (?, ?)", migration.Version, migration.Name)
+}
+
+func (r sqliteMigrationRunner) revert(ctx context.Context, migration Migration) error {
+	return r.run(ctx, migration.Down, "DELETE FROM schema_migrations WHERE version = ?", migration.Version)
+}
+
+// run executes a migration script and its bookkeeping statement in one transaction
+func (r sqliteMigrationRunner) run(ctx context.Context, script string, bookkeeping string, args ...any) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, script); err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, bookkeeping, args...); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
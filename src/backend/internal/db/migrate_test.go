@@ -0,0 +1,143 @@
+package db
+
+import (
+	"context"
+	"testing"
+	"testing/fstest"
+)
+
+// TestEmbeddedMigrations checks that the migrations shipped in the binary parse
+// and that every dialect has the same versions
+func TestEmbeddedMigrations(t *testing.T) {
+	postgres, err := Migrations(DialectPostgres)
+	if err != nil {
+		t.Fatalf("Failed to load Postgres migrations: %v", err)
+	}
+	if len(postgres) == 0 {
+		t.Fatal("Expected at least one embedded migration")
+	}
+	if postgres[0].Version != 1 || postgres[0].Name != "initial_schema" {
+		t.Errorf("Expected first migration to be 0001_initial_schema, got %04d_%s", postgres[0].Version, postgres[0].Name)
+	}
+	for i := 1; i < len(postgres); i++ {
+		if postgres[i].Version <= postgres[i-1].Version {
+			t.Errorf("Migrations are not ordered: %d follows %d", postgres[i].Version, postgres[i-1].Version)
+		}
+	}
+
+	sqlite, err := Migrations(DialectSQLite)
+	if err != nil {
+		t.Fatalf("Failed to load SQLite migrations: %v", err)
+	}
+	if len(sqlite) != len(postgres) {
+		t.Fatalf("Expected %d SQLite migrations, got %d", len(postgres), len(sqlite))
+	}
+	for i := range postgres {
+		if sqlite[i].Version != postgres[i].Version || sqlite[i].Name != postgres[i].Name {
+			t.Errorf("SQLite migration %04d_%s does not match Postgres migration %04d_%s",
+				sqlite[i].Version, sqlite[i].Name, postgres[i].Version, postgres[i].Name)
+		}
+	}
+}
+
+// TestLoadMigrations tests parsing of migration directories
+func TestLoadMigrations(t *testing.T) {
+	t.Run("ordered pairs", func(t *testing.T) {
+		fsys := fstest.MapFS{
+			"0010_add_index.up.sql":   {Data: []byte("CREATE INDEX a ON t(c);")},
+			"0010_add_index.down.sql": {Data: []byte("DROP INDEX a;")},
+			"0002_create_t.up.sql":    {Data: []byte("CREATE TABLE t (c INT);")},
+			"0002_create_t.down.sql":  {Data: []byte("DROP TABLE t;")},
+		}
+		migrations, err := loadMigrations(fsys)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if len(migrations) != 2 {
+			t.Fatalf("Expected 2 migrations, got %d", len(migrations))
+		}
+		if migrations[0].Version != 2 || migrations[1].Version != 10 {
+			t.Errorf("Expected versions 2 and 10, got %d and %d", migrations[0].Version, migrations[1].Version)
+		}
+		if migrations[0].Up != "CREATE TABLE t (c INT);" || migrations[0].Down != "DROP TABLE t;" {
+			t.Errorf("Unexpected scripts for migration 2: %+v", migrations[0])
+		}
+	})
+
+	tests := []struct {
+		name string
+		fsys fstest.MapFS
+	}{
+		{"missing down", fstest.MapFS{
+			"0001_init.up.sql": {Data: []byte("SELECT 1;")},
+		}},
+		{"invalid name", fstest.MapFS{
+			"init.sql": {Data: []byte("SELECT 1;")},
+		}},
+		{"zero version", fstest.MapFS{
+			"0000_init.up.sql":   {Data: []byte("SELECT 1;")},
+			"0000_init.down.sql": {Data: []byte("SELECT 1;")},
+		}},
+		{"conflicting names", fstest.MapFS{
+			"0001_init.up.sql":    {Data: []byte("SELECT 1;")},
+			"0001_other.down.sql": {Data: []byte("SELECT 1;")},
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := loadMigrations(tt.fsys); err == nil {
+				t.Error("Expected an error, got nil")
+			}
+		})
+	}
+}
+
+// TestMigrateAndRollback tests applying, reverting and re-applying migrations
+func TestMigrateAndRollback(t *testing.T) {
+	if !shouldRunDBTests(t) {
+		return
+	}
+	db := setupTestDB(t)
+	ctx := context.Background()
+
+	migrations, err := Migrations(DialectPostgres)
+	if err != nil {
+		t.Fatalf("Failed to load migrations: %v", err)
+	}
+
+	states, err := db.MigrationStatus(ctx)
+	if err != nil {
+		t.Fatalf("Failed to get migration status: %v", err)
+	}
+	for _, state := range states {
+		if state.AppliedAt == nil {
+			t.Errorf("Expected migration %04d_%s to be applied", state.Version, state.Name)
+		}
+	}
+
+	rolledBack, err := db.Rollback(ctx, len(migrations))
+	if err != nil {
+		t.Fatalf("Failed to roll back: %v", err)
+	}
+	if rolledBack != len(migrations) {
+		t.Errorf("Expected %d migrations rolled back, got %d", len(migrations), rolledBack)
+	}
+
+	states, err = db.MigrationStatus(ctx)
+	if err != nil {
+		t.Fatalf("Failed to get migration status: %v", err)
+	}
+	for _, state := range states {
+		if state.AppliedAt != nil {
+			t.Errorf("Expected migration %04d_%s to be pending", state.Version, state.Name)
+		}
+	}
+
+	applied, err := db.Migrate(ctx)
+	if err != nil {
+		t.Fatalf("Failed to migrate: %v", err)
+	}
+	if applied != len(migrations) {
+		t.Errorf("Expected %d migrations applied, got %d", len(migrations), applied)
+	}
+}
@@ -0,0 +1,7 @@
+DROP TABLE IF EXISTS refresh_tokens;
+DROP TABLE IF EXISTS user_apikeys;
+DROP TABLE IF EXISTS user_settings;
+DROP TABLE IF EXISTS admin_settings;
+DROP TABLE IF EXISTS chat_contents;
+DROP TABLE IF EXISTS users;
+DROP TABLE IF EXISTS sso_logins;
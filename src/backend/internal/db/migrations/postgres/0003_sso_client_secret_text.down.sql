@@ -0,0 +1 @@
+ALTER TABLE sso_logins ALTER COLUMN sso_client_secret TYPE VARCHAR(255);
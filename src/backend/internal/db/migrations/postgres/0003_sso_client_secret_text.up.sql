@@ -0,0 +1,3 @@
+-- Client secrets are stored encrypted, which outgrows VARCHAR(255) for long secrets.
+
+ALTER TABLE sso_logins ALTER COLUMN sso_client_secret TYPE TEXT;
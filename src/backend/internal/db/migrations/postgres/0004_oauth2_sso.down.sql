@@ -0,0 +1,9 @@
+ALTER TABLE sso_logins DROP COLUMN IF EXISTS sso_allowed_domains;
+ALTER TABLE sso_logins DROP COLUMN IF EXISTS sso_username_field;
+ALTER TABLE sso_logins DROP COLUMN IF EXISTS sso_email_verified_field;
+ALTER TABLE sso_logins DROP COLUMN IF EXISTS sso_email_field;
+ALTER TABLE sso_logins DROP COLUMN IF EXISTS sso_subject_field;
+ALTER TABLE sso_logins DROP COLUMN IF EXISTS sso_scopes;
+ALTER TABLE sso_logins DROP COLUMN IF EXISTS sso_userinfo_url;
+ALTER TABLE sso_logins DROP COLUMN IF EXISTS sso_token_url;
+ALTER TABLE sso_logins DROP COLUMN IF EXISTS sso_auth_url;
@@ -0,0 +1,13 @@
+-- Generic OAuth2 providers have no discovery, so their endpoints and the
+-- userinfo fields holding the user's identity are configured per provider.
+-- Allowed domains restrict which email domains may sign up through a provider.
+
+ALTER TABLE sso_logins ADD COLUMN IF NOT EXISTS sso_auth_url VARCHAR(255) NULL;
+ALTER TABLE sso_logins ADD COLUMN IF NOT EXISTS sso_token_url VARCHAR(255) NULL;
+ALTER TABLE sso_logins ADD COLUMN IF NOT EXISTS sso_userinfo_url VARCHAR(255) NULL;
+ALTER TABLE sso_logins ADD COLUMN IF NOT EXISTS sso_scopes VARCHAR(255) NULL;
+ALTER TABLE sso_logins ADD COLUMN IF NOT EXISTS sso_subject_field VARCHAR(255) NULL;
+ALTER TABLE sso_logins ADD COLUMN IF NOT EXISTS sso_email_field VARCHAR(255) NULL;
+ALTER TABLE sso_logins ADD COLUMN IF NOT EXISTS sso_email_verified_field VARCHAR(255) NULL;
+ALTER TABLE sso_logins ADD COLUMN IF NOT EXISTS sso_username_field VARCHAR(255) NULL;
+ALTER TABLE sso_logins ADD COLUMN IF NOT EXISTS sso_allowed_domains TEXT NULL;
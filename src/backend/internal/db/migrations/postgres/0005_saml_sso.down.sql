@@ -0,0 +1,3 @@
+ALTER TABLE sso_logins DROP COLUMN IF EXISTS sso_admin_value;
+ALTER TABLE sso_logins DROP COLUMN IF EXISTS sso_admin_field;
+ALTER TABLE sso_logins DROP COLUMN IF EXISTS sso_idp_metadata;
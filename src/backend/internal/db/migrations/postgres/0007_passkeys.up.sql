@@ -0,0 +1,15 @@
+-- Passkeys are WebAuthn credentials users sign in with instead of a password.
+-- The credential is stored as JSON, its ID as unpadded base64url for lookups.
+
+CREATE TABLE IF NOT EXISTS passkeys (
+	id SERIAL PRIMARY KEY,
+	user_id INT NOT NULL,
+	credential_id TEXT NOT NULL UNIQUE,
+	name VARCHAR(255) NOT NULL,
+	credential TEXT NOT NULL,
+	created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	last_used_at TIMESTAMP NULL,
+	FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_passkeys_user_id ON passkeys(user_id);
@@ -0,0 +1,5 @@
+-- Login challenges carry a nonce that is stored with the TOTP enrollment and
+-- cleared once the challenge is completed, so a challenge token cannot be
+-- replayed. Setup challenges store theirs when they start the enrollment.
+
+ALTER TABLE user_totp ADD COLUMN IF NOT EXISTS challenge_nonce TEXT NULL;
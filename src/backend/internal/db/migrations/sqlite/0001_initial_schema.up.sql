@@ -0,0 +1,84 @@
+-- SQLite version of the initial schema. JSONB columns are stored as JSON text
+-- and SERIAL keys become AUTOINCREMENT integer keys.
+
+CREATE TABLE IF NOT EXISTS sso_logins (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	sso_client_id VARCHAR(255) NOT NULL,
+	sso_client_secret VARCHAR(255) NOT NULL,
+	sso_provider VARCHAR(255) NOT NULL UNIQUE,
+	sso_redirect_url VARCHAR(255) NOT NULL,
+	sso_auth_type VARCHAR(255) NOT NULL CHECK (sso_auth_type IN ('OAuth2', 'SAML', 'OIDC')),
+	created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS users (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	email VARCHAR(255) NOT NULL UNIQUE,
+	password_hash TEXT NULL,
+	sso_user_id TEXT NULL,
+	username VARCHAR(255) NOT NULL,
+	is_sso BOOLEAN NOT NULL DEFAULT FALSE,
+	sso_provider_id INTEGER NULL,
+	is_admin BOOLEAN NOT NULL DEFAULT FALSE,
+	created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	FOREIGN KEY (sso_provider_id) REFERENCES sso_logins(id) ON DELETE CASCADE,
+	CONSTRAINT chk_sso_provider_id CHECK (
+		(is_sso = TRUE AND sso_provider_id IS NOT NULL) OR
+		(is_sso = FALSE AND sso_provider_id IS NULL)
+	),
+	CONSTRAINT chk_sso_user_id CHECK (
+		(is_sso = TRUE AND sso_user_id IS NOT NULL) OR
+		(is_sso = FALSE)
+	),
+	CONSTRAINT chk_password_hash CHECK (
+		(is_sso = FALSE AND password_hash IS NOT NULL) OR
+		(is_sso = TRUE)
+	)
+);
+CREATE INDEX IF NOT EXISTS idx_users_sso_provider_id ON users(sso_provider_id);
+
+CREATE TABLE IF NOT EXISTS chat_contents (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	user_id INTEGER NOT NULL,
+	content TEXT NOT NULL CHECK (json_valid(content)),
+	sources TEXT NOT NULL CHECK (json_valid(sources)),
+	is_public BOOLEAN NOT NULL DEFAULT FALSE,
+	public_uuid VARCHAR(255) NULL UNIQUE,
+	created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+CREATE INDEX IF NOT EXISTS idx_chat_contents_user_id ON chat_contents(user_id);
+CREATE INDEX IF NOT EXISTS idx_chat_contents_is_public ON chat_contents(is_public) WHERE is_public = TRUE;
+
+CREATE TABLE IF NOT EXISTS admin_settings (
+	version INTEGER PRIMARY KEY AUTOINCREMENT,
+	config TEXT NOT NULL CHECK (json_valid(config)),
+	created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS user_settings (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	user_id INTEGER NOT NULL UNIQUE,
+	config TEXT NOT NULL CHECK (json_valid(config)),
+	created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+CREATE TABLE IF NOT EXISTS user_apikeys (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	user_id INTEGER NOT NULL,
+	api_key_encrypt TEXT NOT NULL UNIQUE,
+	created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+CREATE INDEX IF NOT EXISTS idx_user_apikeys_user_id ON user_apikeys(user_id);
+
+CREATE TABLE IF NOT EXISTS refresh_tokens (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	user_id INTEGER NOT NULL,
+	token TEXT NOT NULL UNIQUE,
+	expires_at TIMESTAMP NOT NULL,
+	created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+CREATE INDEX IF NOT EXISTS idx_refresh_tokens_user_id ON refresh_tokens(user_id);
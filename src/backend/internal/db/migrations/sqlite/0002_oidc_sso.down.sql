@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS idx_users_sso_identity;
+
+ALTER TABLE sso_logins DROP COLUMN sso_issuer_url;
@@ -0,0 +1,6 @@
+-- OIDC providers are discovered from their issuer URL, and SSO logins look
+-- users up by the subject their provider assigned them.
+
+ALTER TABLE sso_logins ADD COLUMN sso_issuer_url VARCHAR(255) NULL;
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_users_sso_identity ON users(sso_provider_id, sso_user_id) WHERE sso_user_id IS NOT NULL;
@@ -0,0 +1,4 @@
+-- Client secrets are stored encrypted. SQLite does not enforce VARCHAR lengths,
+-- so unlike Postgres the column needs no change.
+
+SELECT 1;
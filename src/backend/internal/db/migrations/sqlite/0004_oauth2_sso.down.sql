@@ -0,0 +1,9 @@
+ALTER TABLE sso_logins DROP COLUMN sso_allowed_domains;
+ALTER TABLE sso_logins DROP COLUMN sso_username_field;
+ALTER TABLE sso_logins DROP COLUMN sso_email_verified_field;
+ALTER TABLE sso_logins DROP COLUMN sso_email_field;
+ALTER TABLE sso_logins DROP COLUMN sso_subject_field;
+ALTER TABLE sso_logins DROP COLUMN sso_scopes;
+ALTER TABLE sso_logins DROP COLUMN sso_userinfo_url;
+ALTER TABLE sso_logins DROP COLUMN sso_token_url;
+ALTER TABLE sso_logins DROP COLUMN sso_auth_url;
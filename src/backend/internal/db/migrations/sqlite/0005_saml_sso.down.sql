@@ -0,0 +1,3 @@
+ALTER TABLE sso_logins DROP COLUMN sso_admin_value;
+ALTER TABLE sso_logins DROP COLUMN sso_admin_field;
+ALTER TABLE sso_logins DROP COLUMN sso_idp_metadata;
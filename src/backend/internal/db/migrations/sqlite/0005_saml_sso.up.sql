@@ -0,0 +1,6 @@
+-- SAML providers are configured with the metadata XML of the identity
+-- provider. An attribute of the assertion can grant the admin role.
+
+ALTER TABLE sso_logins ADD COLUMN sso_idp_metadata TEXT NULL;
+ALTER TABLE sso_logins ADD COLUMN sso_admin_field VARCHAR(255) NULL;
+ALTER TABLE sso_logins ADD COLUMN sso_admin_value VARCHAR(255) NULL;
@@ -0,0 +1,6 @@
+-- Fails while several users of a provider still await re-linking, as their
+-- empty subjects collide.
+
+DROP INDEX IF EXISTS idx_users_sso_identity;
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_users_sso_identity ON users(sso_provider_id, sso_user_id) WHERE sso_user_id IS NOT NULL;
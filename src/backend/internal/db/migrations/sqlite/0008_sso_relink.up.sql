@@ -0,0 +1,7 @@
+-- Users moved to another SSO provider keep an empty subject until they sign in
+-- again and are linked by their verified email, so the subject index only
+-- covers linked identities.
+
+DROP INDEX IF EXISTS idx_users_sso_identity;
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_users_sso_identity ON users(sso_provider_id, sso_user_id) WHERE sso_user_id IS NOT NULL AND sso_user_id <> '';
@@ -0,0 +1,5 @@
+-- Users created by an LDAP login record their directory entry. Only these
+-- accounts can be signed in to with directory credentials, so a directory
+-- entry cannot take over a password or SSO account with the same email.
+
+ALTER TABLE users ADD COLUMN ldap_dn TEXT NULL;
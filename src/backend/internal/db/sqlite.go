@@ -0,0 +1,979 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	_ "github.com/mattn/go-sqlite3"
+	"gitlab.cherkaoui.ch/quillium-ai/quillium/src/backend/internal/chats"
+	"gitlab.cherkaoui.ch/quillium-ai/quillium/src/backend/internal/settings"
+	"gitlab.cherkaoui.ch/quillium-ai/quillium/src/backend/internal/sso"
+	"gitlab.cherkaoui.ch/quillium-ai/quillium/src/backend/internal/user"
+)
+
+// sqliteOptions enables foreign keys for the ON DELETE CASCADE clauses, waits
+// for locks instead of failing and lets readers run alongside the writer
+const sqliteOptions = "_foreign_keys=on&_busy_timeout=5000&_journal_mode=WAL&_txlock=immediate"
+
+// SQLiteDB stores everything in a local SQLite file, for single-user installs
+type SQLiteDB struct {
+	*sql.DB
+}
+
+func (d *SQLiteDB) Close() {
+	if err := d.DB.Close(); err != nil {
+		log.Printf("Error closing SQLite database: %v", err)
+	}
+}
+
+// sqlitePath returns the file path of a sqlite:// database URL
+func sqlitePath(databaseURL string) (string, bool) {
+	for _, prefix := range []string{"sqlite://", "sqlite:"} {
+		if strings.HasPrefix(databaseURL, prefix) {
+			return strings.TrimPrefix(databaseURL, prefix), true
+		}
+	}
+	return "", false
+}
+
+// connectSQLite opens the SQLite database at path, creating the file and its directory if needed
+func connectSQLite(ctx context.Context, path string) (*SQLiteDB, error) {
+	if path == "" {
+		return nil, errors.New("failed to parse database URL: missing SQLite file path")
+	}
+	inMemory := strings.HasPrefix(path, ":memory:")
+	if !inMemory {
+		if err := os.MkdirAll(filepath.Dir(path), 0o750); err != nil {
+			return nil, errors.New("failed to create database directory: " + err.Error())
+		}
+	}
+
+	separator := "?"
+	if strings.Contains(path, "?") {
+		separator = "&"
+	}
+	database, err := sql.Open("sqlite3", "file:"+path+separator+sqliteOptions)
+	if err != nil {
+		return nil, errors.New("failed to open database: " + err.Error())
+	}
+	// Every connection to :memory: is a separate database
+	if inMemory {
+		database.SetMaxOpenConns(1)
+	}
+	if err := database.PingContext(ctx); err != nil {
+		database.Close()
+		return nil, errors.New("failed to open database: " + err.Error())
+	}
+
+	return &SQLiteDB{DB: database}, nil
+}
+
+func (d *SQLiteDB) CreateUser(ctx context.Context, user *user.User) (*int, error) {
+	query := `
+		INSERT INTO users (email, password_hash, is_sso, sso_user_id, sso_provider_id, is_admin, username, ldap_dn)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+		RETURNING id
+	`
+	querySettings := `
+		INSERT INTO user_settings (user_id, config)
+		VALUES (?, '{}')
+	`
+	var id int
+	err := d.DB.QueryRowContext(ctx, query, user.Email, user.PasswordHash, user.IsSso, user.SsoUserID, user.SsoProviderID, user.IsAdmin, user.Username, user.LdapDN).Scan(&id)
+	if err != nil {
+		return nil, errors.New("failed to create user: " + err.Error())
+	}
+	_, err = d.DB.ExecContext(ctx, querySettings, id)
+	if err != nil {
+		return nil, errors.New("failed to create user settings: " + err.Error())
+	}
+	log.Printf("Created user with ID: %d", id)
+	return &id, nil
+}
+
+func (d *SQLiteDB) CreateSsoProvider(ctx context.Context, ssoProvider *sso.SsoProvider) (*int, error) {
+	query := `
+		INSERT INTO sso_logins (` + ssoProviderWriteColumns + `)
+		VALUES (?, ?, ?, ?, ?, NULLIF(?, ''), NULLIF(?, ''), NULLIF(?, ''), NULLIF(?, ''), NULLIF(?, ''),
+			NULLIF(?, ''), NULLIF(?, ''), NULLIF(?, ''), NULLIF(?, ''), NULLIF(?, ''),
+			NULLIF(?, ''), NULLIF(?, ''), NULLIF(?, ''))
+		RETURNING id
+	`
+	var id int
+	err := d.DB.QueryRowContext(ctx, query, ssoProviderValues(ssoProvider)...).Scan(&id)
+	if err != nil {
+		return nil, errors.New("failed to create sso provider: " + err.Error())
+	}
+	log.Printf("Created sso provider with ID: %d", id)
+	return &id, nil
+}
+
+func (d *SQLiteDB) GetSsoProvider(ctx context.Context, provider string) (*sso.SsoProvider, error) {
+	row := d.DB.QueryRowContext(ctx, "SELECT "+ssoProviderColumns+" FROM sso_logins WHERE sso_provider = ?", provider)
+	return scanSQLiteSsoProvider(row)
+}
+
+func (d *SQLiteDB) GetSsoProviderByID(ctx context.Context, ssoProviderId int) (*sso.SsoProvider, error) {
+	row := d.DB.QueryRowContext(ctx, "SELECT "+ssoProviderColumns+" FROM sso_logins WHERE id = ?", ssoProviderId)
+	return scanSQLiteSsoProvider(row)
+}
+
+// scanSQLiteSsoProvider reads an sso_logins row selected with ssoProviderColumns
+func scanSQLiteSsoProvider(row rowScanner) (*sso.SsoProvider, error) {
+	p, err := scanSsoProviderRow(row)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrSsoProviderNotFound
+	}
+	if err != nil {
+		return nil, errors.New("failed to get sso provider: " + err.Error())
+	}
+	return p, nil
+}
+
+func (d *SQLiteDB) GetSsoProviders(ctx context.Context) ([]*sso.SsoProvider, error) {
+	rows, err := d.DB.QueryContext(ctx, "SELECT "+ssoProviderColumns+" FROM sso_logins ORDER BY id")
+	if err != nil {
+		return nil, errors.New("failed to get sso providers: " + err.Error())
+	}
+	defer rows.Close()
+
+	var providers []*sso.SsoProvider
+	for rows.Next() {
+		p, err := scanSQLiteSsoProvider(rows)
+		if err != nil {
+			return nil, err
+		}
+		providers = append(providers, p)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, errors.New("failed to get sso providers: " + err.Error())
+	}
+	return providers, nil
+}
+
+func (d *SQLiteDB) UpdateSsoProvider(ctx context.Context, ssoProvider *sso.SsoProvider) error {
+	query := `
+		UPDATE sso_logins
+		SET (` + ssoProviderWriteColumns + `) =
+			(?, ?, ?, ?, ?, NULLIF(?, ''), NULLIF(?, ''), NULLIF(?, ''), NULLIF(?, ''), NULLIF(?, ''),
+			NULLIF(?, ''), NULLIF(?, ''), NULLIF(?, ''), NULLIF(?, ''), NULLIF(?, ''),
+			NULLIF(?, ''), NULLIF(?, ''), NULLIF(?, ''))
+		WHERE id = ?
+	`
+	args := append(ssoProviderValues(ssoProvider), *ssoProvider.ID)
+	_, err := d.DB.ExecContext(ctx, query, args...)
+	if err != nil {
+		return errors.New("failed to update sso provider: " + err.Error())
+	}
+	log.Printf("Updated sso provider with ID: %d", *ssoProvider.ID)
+	return nil
+}
+
+func (d *SQLiteDB) CountSsoProviderUsers(ctx context.Context, ssoProviderId int) (int, error) {
+	var count int
+	err := d.DB.QueryRowContext(ctx, "SELECT COUNT(*) FROM users WHERE sso_provider_id = ?", ssoProviderId).Scan(&count)
+	if err != nil {
+		return 0, errors.New("failed to count sso provider users: " + err.Error())
+	}
+	return count, nil
+}
+
+// MigrateSsoProviderUsers moves the users of a provider to another one. Their subjects were
+// issued by the old provider, so they are cleared and the users are linked again by their
+// verified email on their next login.
+func (d *SQLiteDB) MigrateSsoProviderUsers(ctx context.Context, fromProviderId int, toProviderId int) (int, error) {
+	tx, err := d.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, errors.New("failed to migrate sso provider users: " + err.Error())
+	}
+	defer tx.Rollback()
+
+	migrated, err := migrateSQLiteSsoProviderUsers(ctx, tx, fromProviderId, toProviderId)
+	if err != nil {
+		return 0, err
+	}
+	if err := tx.Commit(); err != nil {
+		return 0, errors.New("failed to migrate sso provider users: " + err.Error())
+	}
+	return migrated, nil
+}
+
+func migrateSQLiteSsoProviderUsers(ctx context.Context, tx *sql.Tx, fromProviderId int, toProviderId int) (int, error) {
+	result, err := tx.ExecContext(ctx, "UPDATE users SET sso_provider_id = ?, sso_user_id = '' WHERE sso_provider_id = ?", toProviderId, fromProviderId)
+	if err != nil {
+		return 0, errors.New("failed to migrate sso provider users: " + err.Error())
+	}
+	migrated, err := result.RowsAffected()
+	if err != nil {
+		return 0, errors.New("failed to migrate sso provider users: " + err.Error())
+	}
+	log.Printf("Migrated %d users from sso provider %d to %d", migrated, fromProviderId, toProviderId)
+	return int(migrated), nil
+}
+
+func (d *SQLiteDB) CreateChat(ctx context.Context, userId int, chatContent *chats.ChatContent) (*int, error) {
+	jsonStr, err := chatContent.ToJSON()
+	if err != nil {
+		return nil, errors.New("failed to convert chat content to JSON: " + err.Error())
+	}
+
+	// Extract sources from chatContent and convert to JSON
+	sourcesJSON, err := json.Marshal(chatContent.Sources)
+	if err != nil {
+		return nil, errors.New("failed to convert sources to JSON: " + err.Error())
+	}
+
+	query := `
+		INSERT INTO chat_contents (user_id, content, sources)
+		VALUES (?, ?, ?)
+		RETURNING id
+	`
+	var id int
+	err = d.DB.QueryRowContext(ctx, query, userId, jsonStr, string(sourcesJSON)).Scan(&id)
+	if err != nil {
+		return nil, errors.New("failed to create chat: " + err.Error())
+	}
+	log.Printf("Created chat with ID: %d", id)
+	return &id, nil
+}
+
+func (d *SQLiteDB) GetChats(ctx context.Context, userId int) ([]int, error) {
+	query := `
+		SELECT id FROM chat_contents WHERE user_id = ?
+	`
+	rows, err := d.DB.QueryContext(ctx, query, userId)
+	if err != nil {
+		return nil, errors.New("failed to get chats: " + err.Error())
+	}
+	defer rows.Close()
+
+	var ids []int
+	for rows.Next() {
+		var id int
+		err = rows.Scan(&id)
+		if err != nil {
+			return nil, errors.New("failed to get chats: " + err.Error())
+		}
+		ids = append(ids, id)
+	}
+
+	return ids, rows.Err()
+}
+
+func (d *SQLiteDB) GetChatContent(ctx context.Context, chatId int) (*chats.ChatContent, error) {
+	query := `
+		SELECT content, sources FROM chat_contents WHERE id = ?
+	`
+	var jsonContentStr string
+	var jsonSourcesStr string
+	err := d.DB.QueryRowContext(ctx, query, chatId).Scan(&jsonContentStr, &jsonSourcesStr)
+	if err != nil {
+		return nil, errors.New("failed to get chat content: " + err.Error())
+	}
+
+	var empty chats.ChatContent
+	chatContent, err := empty.FromJSON(jsonContentStr)
+	if err != nil {
+		return nil, errors.New("failed to parse chat content: " + err.Error())
+	}
+
+	var sources []chats.Source
+	err = json.Unmarshal([]byte(jsonSourcesStr), &sources)
+	if err != nil {
+		return nil, errors.New("failed to parse sources: " + err.Error())
+	}
+	chatContent.Sources = sources
+
+	return chatContent, nil
+}
+
+// VerifyChatOwnership checks if a chat belongs to a specific user
+func (d *SQLiteDB) VerifyChatOwnership(ctx context.Context, chatId int, userId int) (bool, error) {
+	query := `
+		SELECT COUNT(*) FROM chat_contents WHERE id = ? AND user_id = ?
+	`
+	var count int
+	err := d.DB.QueryRowContext(ctx, query, chatId, userId).Scan(&count)
+	if err != nil {
+		return false, errors.New("failed to verify chat ownership: " + err.Error())
+	}
+	return count > 0, nil
+}
+
+func (d *SQLiteDB) DeleteChat(ctx context.Context, chatId int) error {
+	_, err := d.DB.ExecContext(ctx, "DELETE FROM chat_contents WHERE id = ?", chatId)
+	if err != nil {
+		return errors.New("failed to delete chat: " + err.Error())
+	}
+	log.Printf("Deleted chat with ID: %d", chatId)
+	return nil
+}
+
+func (d *SQLiteDB) DeleteUser(ctx context.Context, userId int) error {
+	_, err := d.DB.ExecContext(ctx, "DELETE FROM users WHERE id = ?", userId)
+	if err != nil {
+		return errors.New("failed to delete user: " + err.Error())
+	}
+	log.Printf("Deleted user with ID: %d", userId)
+	return nil
+}
+
+// DeleteSsoProvider deletes a provider, its users are moved to migrateToId first. Without a
+// provider to move them to, ErrSsoProviderInUse is returned while users remain, as deleting
+// the provider would delete them too.
+func (d *SQLiteDB) DeleteSsoProvider(ctx context.Context, ssoProviderId int, migrateToId *int) error {
+	// Transactions take the write lock when they begin, no user is created between counting and deleting
+	tx, err := d.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return errors.New("failed to delete sso provider: " + err.Error())
+	}
+	defer tx.Rollback()
+
+	var userCount int
+	if err := tx.QueryRowContext(ctx, "SELECT COUNT(*) FROM users WHERE sso_provider_id = ?", ssoProviderId).Scan(&userCount); err != nil {
+		return errors.New("failed to count sso provider users: " + err.Error())
+	}
+	if userCount > 0 {
+		if migrateToId == nil {
+			return ErrSsoProviderInUse
+		}
+		if _, err := migrateSQLiteSsoProviderUsers(ctx, tx, ssoProviderId, *migrateToId); err != nil {
+			return err
+		}
+	}
+
+	result, err := tx.ExecContext(ctx, "DELETE FROM sso_logins WHERE id = ?", ssoProviderId)
+	if err != nil {
+		return errors.New("failed to delete sso provider: " + err.Error())
+	}
+	if rows, err := result.RowsAffected(); err == nil && rows == 0 {
+		return ErrSsoProviderNotFound
+	}
+	if err := tx.Commit(); err != nil {
+		return errors.New("failed to delete sso provider: " + err.Error())
+	}
+	log.Printf("Deleted sso provider with ID: %d", ssoProviderId)
+	return nil
+}
+
+func (d *SQLiteDB) UpdateUserSettings(ctx context.Context, userId int, config *settings.UserSettings) error {
+	configJSON, err := json.Marshal(config)
+	if err != nil {
+		return errors.New("failed to update user settings: " + err.Error())
+	}
+	_, err = d.DB.ExecContext(ctx, "UPDATE user_settings SET config = ? WHERE user_id = ?", string(configJSON), userId)
+	if err != nil {
+		return errors.New("failed to update user settings: " + err.Error())
+	}
+	log.Printf("Updated user settings for user with ID: %d", userId)
+	return nil
+}
+
+func (d *SQLiteDB) GetUserSettings(ctx context.Context, userId int) (*settings.UserSettings, error) {
+	var configJSON string
+	err := d.DB.QueryRowContext(ctx, "SELECT config FROM user_settings WHERE user_id = ?", userId).Scan(&configJSON)
+	if err != nil {
+		return nil, errors.New("failed to get user settings: " + err.Error())
+	}
+	var config settings.UserSettings
+	if err := json.Unmarshal([]byte(configJSON), &config); err != nil {
+		return nil, errors.New("failed to get user settings: " + err.Error())
+	}
+	return &config, nil
+}
+
+func (d *SQLiteDB) GetAdminSettings(ctx context.Context) (*settings.AdminSettings, error) {
+	query := `
+		SELECT config FROM admin_settings
+		WHERE version = (SELECT MAX(version) FROM admin_settings)
+	`
+	var configJSON string
+	err := d.DB.QueryRowContext(ctx, query).Scan(&configJSON)
+	if err != nil {
+		return nil, errors.New("failed to get admin settings: " + err.Error())
+	}
+	var config settings.AdminSettings
+	if err := json.Unmarshal([]byte(configJSON), &config); err != nil {
+		return nil, errors.New("failed to get admin settings: " + err.Error())
+	}
+	return &config, nil
+}
+
+func (d *SQLiteDB) UpdateChatContent(ctx context.Context, chatId int, chatContent *chats.ChatContent) error {
+	jsonStr, err := chatContent.ToJSON()
+	if err != nil {
+		return errors.New("failed to convert chat content to JSON: " + err.Error())
+	}
+	_, err = d.DB.ExecContext(ctx, "UPDATE chat_contents SET content = ? WHERE id = ?", jsonStr, chatId)
+	if err != nil {
+		return errors.New("failed to update chat content: " + err.Error())
+	}
+	log.Printf("Updated chat content for chat with ID: %d", chatId)
+	return nil
+}
+
+func (d *SQLiteDB) UpdateUserPassword(ctx context.Context, userId int, passwordHash string) error {
+	_, err := d.DB.ExecContext(ctx, "UPDATE users SET password_hash = ? WHERE id = ?", passwordHash, userId)
+	if err != nil {
+		return errors.New("failed to update user password: " + err.Error())
+	}
+	log.Printf("Updated user password for user with ID: %d", userId)
+	return nil
+}
+
+func (d *SQLiteDB) UpdateUserEmail(ctx context.Context, userId int, email string) error {
+	_, err := d.DB.ExecContext(ctx, "UPDATE users SET email = ? WHERE id = ?", email, userId)
+	if err != nil {
+		return errors.New("failed to update user email: " + err.Error())
+	}
+	log.Printf("Updated user email for user with ID: %d", userId)
+	return nil
+}
+
+func (d *SQLiteDB) AdminExists(ctx context.Context) (bool, error) {
+	var exists bool
+	err := d.DB.QueryRowContext(ctx, "SELECT EXISTS(SELECT 1 FROM users WHERE is_admin = TRUE LIMIT 1)").Scan(&exists)
+	if err != nil {
+		return false, errors.New("failed to check if admin exists: " + err.Error())
+	}
+	return exists, nil
+}
+
+func (d *SQLiteDB) UpdateUserIsAdmin(ctx context.Context, userId int, isAdmin bool) error {
+	_, err := d.DB.ExecContext(ctx, "UPDATE users SET is_admin = ? WHERE id = ?", isAdmin, userId)
+	if err != nil {
+		return errors.New("failed to update user is_admin: " + err.Error())
+	}
+	log.Printf("Updated user is_admin for user with ID: %d", userId)
+	return nil
+}
+
+func (d *SQLiteDB) CreateAdminSettings(ctx context.Context, config *settings.AdminSettings) error {
+	configJSON, err := json.Marshal(config)
+	if err != nil {
+		return errors.New("failed to initialize admin settings: " + err.Error())
+	}
+	var version int
+	err = d.DB.QueryRowContext(ctx, "INSERT INTO admin_settings (config) VALUES (?) RETURNING version", string(configJSON)).Scan(&version)
+	if err != nil {
+		return errors.New("failed to initialize admin settings: " + err.Error())
+	}
+
+	log.Printf("Created admin settings with version: %d", version)
+	return nil
+}
+
+func (d *SQLiteDB) CreateSsoUser(ctx context.Context, email string, ssoUserId string, ssoProviderId int) (*int, error) {
+	user := &user.User{
+		Email:         email,
+		PasswordHash:  nil,
+		IsSso:         true,
+		SsoUserID:     &ssoUserId,
+		SsoProviderID: &ssoProviderId,
+		IsAdmin:       false,
+	}
+	id, err := d.CreateUser(ctx, user)
+	if err != nil {
+		return nil, errors.New("failed to create sso user: " + err.Error())
+	}
+	return id, nil
+}
+
+func (d *SQLiteDB) GetSsoUser(ctx context.Context, ssoProviderId int, ssoUserId string) (*user.User, error) {
+	query := `
+		SELECT id, email, password_hash, is_sso, sso_user_id, sso_provider_id, is_admin, username, ldap_dn
+		FROM users
+		WHERE sso_provider_id = ? AND sso_user_id = ?
+	`
+	var u user.User
+	err := d.DB.QueryRowContext(ctx, query, ssoProviderId, ssoUserId).Scan(
+		&u.ID,
+		&u.Email,
+		&u.PasswordHash,
+		&u.IsSso,
+		&u.SsoUserID,
+		&u.SsoProviderID,
+		&u.IsAdmin,
+		&u.Username,
+		&u.LdapDN,
+	)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrUserNotFound
+	}
+	if err != nil {
+		return nil, errors.New("failed to get sso user: " + err.Error())
+	}
+	return &u, nil
+}
+
+func (d *SQLiteDB) LinkSsoUser(ctx context.Context, userId int, ssoUserId string, ssoProviderId int) error {
+	_, err := d.DB.ExecContext(ctx, "UPDATE users SET is_sso = TRUE, sso_user_id = ?, sso_provider_id = ? WHERE id = ?", ssoUserId, ssoProviderId, userId)
+	if err != nil {
+		return errors.New("failed to link sso user: " + err.Error())
+	}
+	log.Printf("Linked user with ID %d to sso provider with ID: %d", userId, ssoProviderId)
+	return nil
+}
+
+func (d *SQLiteDB) GetUser(ctx context.Context, email *string, id *int) (*user.User, error) {
+	if email == nil && id == nil {
+		return nil, errors.New("at least one of email or id must be provided")
+	}
+
+	query := `
+		SELECT id, email, password_hash, is_sso, sso_user_id, sso_provider_id, is_admin, username, ldap_dn
+		FROM users
+	`
+	var args []interface{}
+	switch {
+	case email != nil && id != nil:
+		query += "WHERE email = ? OR id = ?"
+		args = []interface{}{*email, *id}
+	case email != nil:
+		query += "WHERE email = ?"
+		args = []interface{}{*email}
+	case id != nil:
+		query += "WHERE id = ?"
+		args = []interface{}{*id}
+	}
+
+	var u user.User
+	err := d.DB.QueryRowContext(ctx, query, args...).Scan(
+		&u.ID,
+		&u.Email,
+		&u.PasswordHash,
+		&u.IsSso,
+		&u.SsoUserID,
+		&u.SsoProviderID,
+		&u.IsAdmin,
+		&u.Username,
+		&u.LdapDN,
+	)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrUserNotFound
+	}
+	if err != nil {
+		return nil, errors.New("failed to get user: " + err.Error())
+	}
+	return &u, nil
+}
+
+func (d *SQLiteDB) GetUsers(ctx context.Context) ([]*user.User, error) {
+	query := `
+		SELECT id, email, password_hash, is_sso, sso_user_id, sso_provider_id, is_admin, username, ldap_dn
+		FROM users
+	`
+	rows, err := d.DB.QueryContext(ctx, query)
+	if err != nil {
+		return nil, errors.New("failed to get users: " + err.Error())
+	}
+	defer rows.Close()
+
+	var users []*user.User
+	for rows.Next() {
+		u := &user.User{}
+		err := rows.Scan(
+			&u.ID,
+			&u.Email,
+			&u.PasswordHash,
+			&u.IsSso,
+			&u.SsoUserID,
+			&u.SsoProviderID,
+			&u.IsAdmin,
+			&u.Username,
+			&u.LdapDN,
+		)
+		if err != nil {
+			return nil, errors.New("failed to scan user: " + err.Error())
+		}
+		users = append(users, u)
+	}
+	return users, rows.Err()
+}
+
+func (d *SQLiteDB) CreateUserApikey(ctx context.Context, user *user.User, apikey string) error {
+	_, err := d.DB.ExecContext(ctx, "INSERT INTO user_apikeys (user_id, api_key_encrypt) VALUES (?, ?)", user.ID, apikey)
+	if err != nil {
+		return errors.New("failed to create user apikey: " + err.Error())
+	}
+	return nil
+}
+
+func (d *SQLiteDB) GetUserByApikey(ctx context.Context, apikey_encrypt string) (int, error) {
+	var userId int
+	err := d.DB.QueryRowContext(ctx, "SELECT user_id FROM user_apikeys WHERE api_key_encrypt = ?", apikey_encrypt).Scan(&userId)
+	if err != nil {
+		return -1, errors.New("failed to get user apikey: " + err.Error())
+	}
+	return userId, nil
+}
+
+func (d *SQLiteDB) GetUserApikeys(ctx context.Context, user *user.User) ([]string, error) {
+	rows, err := d.DB.QueryContext(ctx, "SELECT api_key_encrypt FROM user_apikeys WHERE user_id = ?", user.ID)
+	if err != nil {
+		return nil, errors.New("failed to get user apikeys: " + err.Error())
+	}
+	defer rows.Close()
+
+	var apikeys []string
+	for rows.Next() {
+		var apikey string
+		err := rows.Scan(&apikey)
+		if err != nil {
+			return nil, errors.New("failed to scan user apikey: " + err.Error())
+		}
+		apikeys = append(apikeys, apikey)
+	}
+	return apikeys, rows.Err()
+}
+
+func (d *SQLiteDB) DeleteUserApikey(ctx context.Context, user *user.User, apikey_encrypt string) error {
+	_, err := d.DB.ExecContext(ctx, "DELETE FROM user_apikeys WHERE user_id = ? AND api_key_encrypt = ?", user.ID, apikey_encrypt)
+	if err != nil {
+		return errors.New("failed to delete user apikey: " + err.Error())
+	}
+	return nil
+}
+
+// CreateRefreshToken creates a new refresh token for a user
+func (d *SQLiteDB) CreateRefreshToken(ctx context.Context, userId int, token string, expiresAt time.Time) error {
+	_, err := d.DB.ExecContext(ctx, "INSERT INTO refresh_tokens (user_id, token, expires_at) VALUES (?, ?, ?)", userId, token, expiresAt.UTC())
+	if err != nil {
+		return errors.New("failed to create refresh token: " + err.Error())
+	}
+	return nil
+}
+
+// GetRefreshToken retrieves a refresh token and validates it's not expired
+func (d *SQLiteDB) GetRefreshToken(ctx context.Context, token string) (int, error) {
+	var userId int
+	var expiresAt time.Time
+	err := d.DB.QueryRowContext(ctx, "SELECT user_id, expires_at FROM refresh_tokens WHERE token = ?", token).Scan(&userId, &expiresAt)
+	if err != nil {
+		return 0, errors.New("refresh token not found: " + err.Error())
+	}
+
+	if time.Now().After(expiresAt) {
+		_ = d.DeleteRefreshToken(ctx, token)
+		return 0, errors.New("refresh token expired")
+	}
+
+	return userId, nil
+}
+
+// DeleteRefreshToken removes a refresh token
+func (d *SQLiteDB) DeleteRefreshToken(ctx context.Context, token string) error {
+	_, err := d.DB.ExecContext(ctx, "DELETE FROM refresh_tokens WHERE token = ?", token)
+	if err != nil {
+		return errors.New("failed to delete refresh token: " + err.Error())
+	}
+	return nil
+}
+
+// DeleteUserRefreshTokens removes all refresh tokens for a user
+func (d *SQLiteDB) DeleteUserRefreshTokens(ctx context.Context, userId int) error {
+	_, err := d.DB.ExecContext(ctx, "DELETE FROM refresh_tokens WHERE user_id = ?", userId)
+	if err != nil {
+		return errors.New("failed to delete user refresh tokens: " + err.Error())
+	}
+	return nil
+}
+
+// UpdateUserUsername updates a user's username
+func (d *SQLiteDB) UpdateUserUsername(ctx context.Context, userID int, username string) error {
+	_, err := d.DB.ExecContext(ctx, "UPDATE users SET username = ? WHERE id = ?", username, userID)
+	if err != nil {
+		return errors.New("failed to update username: " + err.Error())
+	}
+	return nil
+}
+
+// SetUserTOTPSecret starts a new, disabled TOTP enrollment for a user
+func (d *SQLiteDB) SetUserTOTPSecret(ctx context.Context, userId int, secretEncrypt string) error {
+	query := `
+		INSERT INTO user_totp (user_id, secret_encrypt)
+		VALUES (?, ?)
+		ON CONFLICT (user_id) DO UPDATE
+		SET secret_encrypt = excluded.secret_encrypt, enabled = FALSE, last_used_step = 0,
+			failed_attempts = 0, last_failed_at = NULL, challenge_nonce = NULL, created_at = CURRENT_TIMESTAMP
+	`
+	_, err := d.DB.ExecContext(ctx, query, userId, secretEncrypt)
+	if err != nil {
+		return errors.New("failed to set user totp secret: " + err.Error())
+	}
+	return nil
+}
+
+// GetUserTOTP returns the TOTP enrollment of a user
+func (d *SQLiteDB) GetUserTOTP(ctx context.Context, userId int) (*user.TOTP, error) {
+	query := `
+		SELECT user_id, secret_encrypt, enabled, last_used_step, failed_attempts, last_failed_at, challenge_nonce
+		FROM user_totp
+		WHERE user_id = ?
+	`
+	var totp user.TOTP
+	err := d.DB.QueryRowContext(ctx, query, userId).Scan(
+		&totp.UserID, &totp.Secret, &totp.Enabled, &totp.LastUsedStep, &totp.FailedAttempts, &totp.LastFailedAt, &totp.ChallengeNonce)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrTOTPNotFound
+	}
+	if err != nil {
+		return nil, errors.New("failed to get user totp: " + err.Error())
+	}
+	return &totp, nil
+}
+
+// EnableUserTOTP enables the pending TOTP enrollment of a user and replaces the recovery codes
+func (d *SQLiteDB) EnableUserTOTP(ctx context.Context, userId int, lastUsedStep int64, recoveryCodeHashes []string) error {
+	tx, err := d.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return errors.New("failed to enable user totp: " + err.Error())
+	}
+	defer tx.Rollback()
+
+	result, err := tx.ExecContext(ctx,
+		"UPDATE user_totp SET enabled = TRUE, last_used_step = ?, failed_attempts = 0, last_failed_at = NULL WHERE user_id = ? AND enabled = FALSE",
+		lastUsedStep, userId)
+	if err != nil {
+		return errors.New("failed to enable user totp: " + err.Error())
+	}
+	if rows, err := result.RowsAffected(); err == nil && rows == 0 {
+		return ErrTOTPNotFound
+	}
+	if err := replaceSQLiteRecoveryCodes(ctx, tx, userId, recoveryCodeHashes); err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return errors.New("failed to enable user totp: " + err.Error())
+	}
+	return nil
+}
+
+// UpdateUserTOTPAttempts records the last accepted code and the failed codes since
+func (d *SQLiteDB) UpdateUserTOTPAttempts(ctx context.Context, userId int, lastUsedStep int64, failedAttempts int, lastFailedAt *time.Time) error {
+	var failedAt any
+	if lastFailedAt != nil {
+		failedAt = lastFailedAt.UTC()
+	}
+	_, err := d.DB.ExecContext(ctx,
+		"UPDATE user_totp SET last_used_step = ?, failed_attempts = ?, last_failed_at = ? WHERE user_id = ?",
+		lastUsedStep, failedAttempts, failedAt, userId)
+	if err != nil {
+		return errors.New("failed to update user totp attempts: " + err.Error())
+	}
+	return nil
+}
+
+// SetUserTOTPChallengeNonce stores the nonce of the login challenge of a user that can be completed
+func (d *SQLiteDB) SetUserTOTPChallengeNonce(ctx context.Context, userId int, nonce string) error {
+	result, err := d.DB.ExecContext(ctx, "UPDATE user_totp SET challenge_nonce = ? WHERE user_id = ?", nonce, userId)
+	if err != nil {
+		return errors.New("failed to set user totp challenge nonce: " + err.Error())
+	}
+	if rows, err := result.RowsAffected(); err == nil && rows == 0 {
+		return ErrTOTPNotFound
+	}
+	return nil
+}
+
+// ClaimUserTOTPChallengeNonce stores the nonce of a login challenge of a user
+// when no other one is stored, and reports whether it did
+func (d *SQLiteDB) ClaimUserTOTPChallengeNonce(ctx context.Context, userId int, nonce string) (bool, error) {
+	result, err := d.DB.ExecContext(ctx,
+		"UPDATE user_totp SET challenge_nonce = ? WHERE user_id = ? AND challenge_nonce IS NULL", nonce, userId)
+	if err != nil {
+		return false, errors.New("failed to claim user totp challenge nonce: " + err.Error())
+	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return false, errors.New("failed to claim user totp challenge nonce: " + err.Error())
+	}
+	return rows > 0, nil
+}
+
+// ConsumeUserTOTPChallengeNonce clears the login challenge nonce of a user and reports whether it matched
+func (d *SQLiteDB) ConsumeUserTOTPChallengeNonce(ctx context.Context, userId int, nonce string) (bool, error) {
+	result, err := d.DB.ExecContext(ctx,
+		"UPDATE user_totp SET challenge_nonce = NULL WHERE user_id = ? AND challenge_nonce = ?", userId, nonce)
+	if err != nil {
+		return false, errors.New("failed to consume user totp challenge nonce: " + err.Error())
+	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return false, errors.New("failed to consume user totp challenge nonce: " + err.Error())
+	}
+	return rows > 0, nil
+}
+
+// DeleteUserTOTP removes the TOTP enrollment and the recovery codes of a user
+func (d *SQLiteDB) DeleteUserTOTP(ctx context.Context, userId int) error {
+	tx, err := d.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return errors.New("failed to delete user totp: " + err.Error())
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, "DELETE FROM user_recovery_codes WHERE user_id = ?", userId); err != nil {
+		return errors.New("failed to delete recovery codes: " + err.Error())
+	}
+	if _, err := tx.ExecContext(ctx, "DELETE FROM user_totp WHERE user_id = ?", userId); err != nil {
+		return errors.New("failed to delete user totp: " + err.Error())
+	}
+	if err := tx.Commit(); err != nil {
+		return errors.New("failed to delete user totp: " + err.Error())
+	}
+	return nil
+}
+
+// ReplaceRecoveryCodes replaces the recovery codes of a user
+func (d *SQLiteDB) ReplaceRecoveryCodes(ctx context.Context, userId int, codeHashes []string) error {
+	tx, err := d.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return errors.New("failed to replace recovery codes: " + err.Error())
+	}
+	defer tx.Rollback()
+
+	if err := replaceSQLiteRecoveryCodes(ctx, tx, userId, codeHashes); err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return errors.New("failed to replace recovery codes: " + err.Error())
+	}
+	return nil
+}
+
+func replaceSQLiteRecoveryCodes(ctx context.Context, tx *sql.Tx, userId int, codeHashes []string) error {
+	if _, err := tx.ExecContext(ctx, "DELETE FROM user_recovery_codes WHERE user_id = ?", userId); err != nil {
+		return errors.New("failed to delete recovery codes: " + err.Error())
+	}
+	for _, codeHash := range codeHashes {
+		if _, err := tx.ExecContext(ctx, "INSERT INTO user_recovery_codes (user_id, code_hash) VALUES (?, ?)", userId, codeHash); err != nil {
+			return errors.New("failed to create recovery code: " + err.Error())
+		}
+	}
+	return nil
+}
+
+// UseRecoveryCode deletes a recovery code of a user and reports whether it existed
+func (d *SQLiteDB) UseRecoveryCode(ctx context.Context, userId int, codeHash string) (bool, error) {
+	result, err := d.DB.ExecContext(ctx, "DELETE FROM user_recovery_codes WHERE user_id = ? AND code_hash = ?", userId, codeHash)
+	if err != nil {
+		return false, errors.New("failed to use recovery code: " + err.Error())
+	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return false, errors.New("failed to use recovery code: " + err.Error())
+	}
+	return rows > 0, nil
+}
+
+// CountRecoveryCodes returns the number of unused recovery codes of a user
+func (d *SQLiteDB) CountRecoveryCodes(ctx context.Context, userId int) (int, error) {
+	var count int
+	err := d.DB.QueryRowContext(ctx, "SELECT COUNT(*) FROM user_recovery_codes WHERE user_id = ?", userId).Scan(&count)
+	if err != nil {
+		return 0, errors.New("failed to count recovery codes: " + err.Error())
+	}
+	return count, nil
+}
+
+// CreatePasskey stores a new passkey of a user
+func (d *SQLiteDB) CreatePasskey(ctx context.Context, passkey *user.Passkey) (*int, error) {
+	query := `
+		INSERT INTO passkeys (user_id, credential_id, name, credential)
+		VALUES (?, ?, ?, ?)
+		RETURNING id
+	`
+	var id int
+	err := d.DB.QueryRowContext(ctx, query, passkey.UserID, passkey.CredentialID, passkey.Name, passkey.Credential).Scan(&id)
+	if err != nil {
+		return nil, errors.New("failed to create passkey: " + err.Error())
+	}
+	log.Printf("Created passkey %d for user %d", id, passkey.UserID)
+	return &id, nil
+}
+
+// GetPasskeys returns the passkeys of a user, oldest first
+func (d *SQLiteDB) GetPasskeys(ctx context.Context, userId int) ([]*user.Passkey, error) {
+	rows, err := d.DB.QueryContext(ctx, `SELECT `+passkeyColumns+` FROM passkeys WHERE user_id = ? ORDER BY id`, userId)
+	if err != nil {
+		return nil, errors.New("failed to get passkeys: " + err.Error())
+	}
+	defer rows.Close()
+
+	var passkeys []*user.Passkey
+	for rows.Next() {
+		passkey, err := scanSQLitePasskey(rows)
+		if err != nil {
+			return nil, errors.New("failed to get passkeys: " + err.Error())
+		}
+		passkeys = append(passkeys, passkey)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, errors.New("failed to get passkeys: " + err.Error())
+	}
+	return passkeys, nil
+}
+
+// GetPasskeyByCredentialID returns the passkey with the given credential ID
+func (d *SQLiteDB) GetPasskeyByCredentialID(ctx context.Context, credentialId string) (*user.Passkey, error) {
+	passkey, err := scanSQLitePasskey(d.DB.QueryRowContext(ctx, `SELECT `+passkeyColumns+` FROM passkeys WHERE credential_id = ?`, credentialId))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrPasskeyNotFound
+	}
+	if err != nil {
+		return nil, errors.New("failed to get passkey: " + err.Error())
+	}
+	return passkey, nil
+}
+
+// scanSQLitePasskey reads a passkeys row selected with passkeyColumns
+func scanSQLitePasskey(row rowScanner) (*user.Passkey, error) {
+	var passkey user.Passkey
+	err := row.Scan(&passkey.ID, &passkey.UserID, &passkey.CredentialID, &passkey.Name, &passkey.Credential, &passkey.CreatedAt, &passkey.LastUsedAt)
+	if err != nil {
+		return nil, err
+	}
+	return &passkey, nil
+}
+
+// UpdatePasskeyUsage stores the credential of a passkey after a login
+func (d *SQLiteDB) UpdatePasskeyUsage(ctx context.Context, passkeyId int, credential string, lastUsedAt time.Time) error {
+	_, err := d.DB.ExecContext(ctx, "UPDATE passkeys SET credential = ?, last_used_at = ? WHERE id = ?", credential, lastUsedAt.UTC(), passkeyId)
+	if err != nil {
+		return errors.New("failed to update passkey usage: " + err.Error())
+	}
+	return nil
+}
+
+// RenamePasskey renames a passkey of a user
+func (d *SQLiteDB) RenamePasskey(ctx context.Context, userId int, passkeyId int, name string) error {
+	result, err := d.DB.ExecContext(ctx, "UPDATE passkeys SET name = ? WHERE id = ? AND user_id = ?", name, passkeyId, userId)
+	if err != nil {
+		return errors.New("failed to rename passkey: " + err.Error())
+	}
+	if rows, err := result.RowsAffected(); err == nil && rows == 0 {
+		return ErrPasskeyNotFound
+	}
+	return nil
+}
+
+// DeletePasskey revokes a passkey of a user
+func (d *SQLiteDB) DeletePasskey(ctx context.Context, userId int, passkeyId int) error {
+	result, err := d.DB.ExecContext(ctx, "DELETE FROM passkeys WHERE id = ? AND user_id = ?", passkeyId, userId)
+	if err != nil {
+		return errors.New("failed to delete passkey: " + err.Error())
+	}
+	if rows, err := result.RowsAffected(); err == nil && rows == 0 {
+		return ErrPasskeyNotFound
+	}
+	log.Printf("Deleted passkey %d of user %d", passkeyId, userId)
+	return nil
+}
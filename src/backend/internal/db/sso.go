@@ -0,0 +1,69 @@
+package db
+
+import (
+	"strings"
+
+	"gitlab.cherkaoui.ch/quillium-ai/quillium/src/backend/internal/sso"
+)
+
+// ssoProviderColumns are the sso_logins columns read by scanSsoProviderRow.
+// The optional columns are NULL when empty.
+const ssoProviderColumns = `id, sso_client_id, sso_client_secret, sso_provider, sso_redirect_url, sso_auth_type,
+	COALESCE(sso_issuer_url, ''), COALESCE(sso_auth_url, ''), COALESCE(sso_token_url, ''), COALESCE(sso_userinfo_url, ''),
+	COALESCE(sso_scopes, ''), COALESCE(sso_subject_field, ''), COALESCE(sso_email_field, ''),
+	COALESCE(sso_email_verified_field, ''), COALESCE(sso_username_field, ''), COALESCE(sso_allowed_domains, ''),
+	COALESCE(sso_idp_metadata, ''), COALESCE(sso_admin_field, ''), COALESCE(sso_admin_value, '')`
+
+// ssoProviderWriteColumns are the sso_logins columns written from ssoProviderValues
+const ssoProviderWriteColumns = `sso_client_id, sso_client_secret, sso_provider, sso_redirect_url, sso_auth_type,
+	sso_issuer_url, sso_auth_url, sso_token_url, sso_userinfo_url, sso_scopes, sso_subject_field, sso_email_field,
+	sso_email_verified_field, sso_username_field, sso_allowed_domains, sso_idp_metadata, sso_admin_field, sso_admin_value`
+
+// ssoProviderValues returns the values of ssoProviderWriteColumns, the
+// queries store empty optional values as NULL
+func ssoProviderValues(p *sso.SsoProvider) []interface{} {
+	return []interface{}{
+		p.ClientID, p.ClientSecret, p.Provider, p.RedirectURL, p.AuthType,
+		p.IssuerURL, p.AuthURL, p.TokenURL, p.UserInfoURL, p.Scopes, p.SubjectField, p.EmailField,
+		p.EmailVerifiedField, p.UsernameField, strings.Join(p.AllowedDomains, ","), p.IdPMetadata, p.AdminField, p.AdminValue,
+	}
+}
+
+// rowScanner is a single row of pgx or database/sql
+type rowScanner interface {
+	Scan(dest ...any) error
+}
+
+// scanSsoProviderRow reads a row selected with ssoProviderColumns
+func scanSsoProviderRow(row rowScanner) (*sso.SsoProvider, error) {
+	var p sso.SsoProvider
+	var allowedDomains string
+	err := row.Scan(
+		&p.ID,
+		&p.ClientID,
+		&p.ClientSecret,
+		&p.Provider,
+		&p.RedirectURL,
+		&p.AuthType,
+		&p.IssuerURL,
+		&p.AuthURL,
+		&p.TokenURL,
+		&p.UserInfoURL,
+		&p.Scopes,
+		&p.SubjectField,
+		&p.EmailField,
+		&p.EmailVerifiedField,
+		&p.UsernameField,
+		&allowedDomains,
+		&p.IdPMetadata,
+		&p.AdminField,
+		&p.AdminValue,
+	)
+	if err != nil {
+		return nil, err
+	}
+	if allowedDomains != "" {
+		p.AllowedDomains = strings.Split(allowedDomains, ",")
+	}
+	return &p, nil
+}
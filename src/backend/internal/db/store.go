@@ -0,0 +1,151 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"gitlab.cherkaoui.ch/quillium-ai/quillium/src/backend/internal/chats"
+	"gitlab.cherkaoui.ch/quillium-ai/quillium/src/backend/internal/settings"
+	"gitlab.cherkaoui.ch/quillium-ai/quillium/src/backend/internal/sso"
+	"gitlab.cherkaoui.ch/quillium-ai/quillium/src/backend/internal/user"
+)
+
+// ErrUserNotFound is returned by GetUser when no user matches
+var ErrUserNotFound = errors.New("user not found")
+
+// ErrTOTPNotFound is returned by GetUserTOTP when the user has not enrolled TOTP
+var ErrTOTPNotFound = errors.New("totp not found")
+
+// ErrPasskeyNotFound is returned by the passkey lookups when no passkey of the user matches
+var ErrPasskeyNotFound = errors.New("passkey not found")
+
+// ErrSsoProviderNotFound is returned by the SSO provider lookups when no provider matches
+var ErrSsoProviderNotFound = errors.New("sso provider not found")
+
+// ErrSsoProviderInUse is returned when deleting an SSO provider users still sign in through
+var ErrSsoProviderInUse = errors.New("sso provider still has users")
+
+// UserRepository stores user accounts
+type UserRepository interface {
+	CreateUser(ctx context.Context, user *user.User) (*int, error)
+	CreateSsoUser(ctx context.Context, email string, ssoUserId string, ssoProviderId int) (*int, error)
+	GetUser(ctx context.Context, email *string, id *int) (*user.User, error)
+	GetSsoUser(ctx context.Context, ssoProviderId int, ssoUserId string) (*user.User, error)
+	LinkSsoUser(ctx context.Context, userId int, ssoUserId string, ssoProviderId int) error
+	GetUsers(ctx context.Context) ([]*user.User, error)
+	DeleteUser(ctx context.Context, userId int) error
+	UpdateUserPassword(ctx context.Context, userId int, passwordHash string) error
+	UpdateUserEmail(ctx context.Context, userId int, email string) error
+	UpdateUserUsername(ctx context.Context, userID int, username string) error
+	UpdateUserIsAdmin(ctx context.Context, userId int, isAdmin bool) error
+	AdminExists(ctx context.Context) (bool, error)
+}
+
+// SsoProviderRepository stores SSO provider configurations
+type SsoProviderRepository interface {
+	CreateSsoProvider(ctx context.Context, ssoProvider *sso.SsoProvider) (*int, error)
+	GetSsoProvider(ctx context.Context, provider string) (*sso.SsoProvider, error)
+	GetSsoProviderByID(ctx context.Context, ssoProviderId int) (*sso.SsoProvider, error)
+	GetSsoProviders(ctx context.Context) ([]*sso.SsoProvider, error)
+	UpdateSsoProvider(ctx context.Context, ssoProvider *sso.SsoProvider) error
+	DeleteSsoProvider(ctx context.Context, ssoProviderId int, migrateToId *int) error
+	CountSsoProviderUsers(ctx context.Context, ssoProviderId int) (int, error)
+	MigrateSsoProviderUsers(ctx context.Context, fromProviderId int, toProviderId int) (int, error)
+}
+
+// ChatRepository stores chat contents
+type ChatRepository interface {
+	CreateChat(ctx context.Context, userId int, chatContent *chats.ChatContent) (*int, error)
+	GetChats(ctx context.Context, userId int) ([]int, error)
+	GetChatContent(ctx context.Context, chatId int) (*chats.ChatContent, error)
+	VerifyChatOwnership(ctx context.Context, chatId int, userId int) (bool, error)
+	UpdateChatContent(ctx context.Context, chatId int, chatContent *chats.ChatContent) error
+	DeleteChat(ctx context.Context, chatId int) error
+}
+
+// SettingsRepository stores user settings and the versioned admin settings
+type SettingsRepository interface {
+	GetUserSettings(ctx context.Context, userId int) (*settings.UserSettings, error)
+	UpdateUserSettings(ctx context.Context, userId int, config *settings.UserSettings) error
+	GetAdminSettings(ctx context.Context) (*settings.AdminSettings, error)
+	CreateAdminSettings(ctx context.Context, config *settings.AdminSettings) error
+}
+
+// APIKeyRepository stores encrypted user API keys
+type APIKeyRepository interface {
+	CreateUserApikey(ctx context.Context, user *user.User, apikey string) error
+	GetUserByApikey(ctx context.Context, apikey_encrypt string) (int, error)
+	GetUserApikeys(ctx context.Context, user *user.User) ([]string, error)
+	DeleteUserApikey(ctx context.Context, user *user.User, apikey_encrypt string) error
+}
+
+// RefreshTokenRepository stores refresh tokens
+type RefreshTokenRepository interface {
+	CreateRefreshToken(ctx context.Context, userId int, token string, expiresAt time.Time) error
+	GetRefreshToken(ctx context.Context, token string) (int, error)
+	DeleteRefreshToken(ctx context.Context, token string) error
+	DeleteUserRefreshTokens(ctx context.Context, userId int) error
+}
+
+// TwoFactorRepository stores TOTP enrollments and recovery codes
+type TwoFactorRepository interface {
+	// SetUserTOTPSecret starts a new, disabled enrollment with an encrypted secret
+	SetUserTOTPSecret(ctx context.Context, userId int, secretEncrypt string) error
+	GetUserTOTP(ctx context.Context, userId int) (*user.TOTP, error)
+	// EnableUserTOTP enables a pending enrollment and replaces the recovery
+	// codes, or returns ErrTOTPNotFound when none is pending
+	EnableUserTOTP(ctx context.Context, userId int, lastUsedStep int64, recoveryCodeHashes []string) error
+	UpdateUserTOTPAttempts(ctx context.Context, userId int, lastUsedStep int64, failedAttempts int, lastFailedAt *time.Time) error
+	// SetUserTOTPChallengeNonce makes the login challenge with the nonce the one that can be completed
+	SetUserTOTPChallengeNonce(ctx context.Context, userId int, nonce string) error
+	// ClaimUserTOTPChallengeNonce stores the nonce unless another one is stored
+	// and reports whether it did
+	ClaimUserTOTPChallengeNonce(ctx context.Context, userId int, nonce string) (bool, error)
+	// ConsumeUserTOTPChallengeNonce clears the nonce and reports whether it was the stored one
+	ConsumeUserTOTPChallengeNonce(ctx context.Context, userId int, nonce string) (bool, error)
+	// DeleteUserTOTP removes the enrollment and the recovery codes
+	DeleteUserTOTP(ctx context.Context, userId int) error
+	ReplaceRecoveryCodes(ctx context.Context, userId int, codeHashes []string) error
+	// UseRecoveryCode deletes the recovery code and reports whether it existed
+	UseRecoveryCode(ctx context.Context, userId int, codeHash string) (bool, error)
+	CountRecoveryCodes(ctx context.Context, userId int) (int, error)
+}
+
+// PasskeyRepository stores the WebAuthn credentials of users
+type PasskeyRepository interface {
+	CreatePasskey(ctx context.Context, passkey *user.Passkey) (*int, error)
+	GetPasskeys(ctx context.Context, userId int) ([]*user.Passkey, error)
+	GetPasskeyByCredentialID(ctx context.Context, credentialId string) (*user.Passkey, error)
+	// UpdatePasskeyUsage stores the credential after a login, with its new signature counter
+	UpdatePasskeyUsage(ctx context.Context, passkeyId int, credential string, lastUsedAt time.Time) error
+	RenamePasskey(ctx context.Context, userId int, passkeyId int, name string) error
+	DeletePasskey(ctx context.Context, userId int, passkeyId int) error
+}
+
+// Store is the storage used by the API. *DB implements it on Postgres,
+// *SQLiteDB on a local file and the memory package in memory for tests.
+type Store interface {
+	UserRepository
+	SsoProviderRepository
+	ChatRepository
+	SettingsRepository
+	APIKeyRepository
+	RefreshTokenRepository
+	TwoFactorRepository
+	PasskeyRepository
+	Close()
+}
+
+// Database is a Store whose schema is managed by the embedded migrations
+type Database interface {
+	Store
+	Migrate(ctx context.Context) (int, error)
+	Rollback(ctx context.Context, steps int) (int, error)
+	MigrationStatus(ctx context.Context) ([]MigrationState, error)
+}
+
+var (
+	_ Database = (*DB)(nil)
+	_ Database = (*SQLiteDB)(nil)
+)
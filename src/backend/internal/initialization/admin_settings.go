@@ -1,6 +1,7 @@
 package initialization
 
 import (
+	"context"
 	"log"
 	"os"
 
@@ -10,11 +11,11 @@ import (
 )
 
 // InitializeAdminSettings initializes or updates admin settings with environment variables
-func InitializeAdminSettings(dbConn *db.DB) error {
+func InitializeAdminSettings(ctx context.Context, dbConn db.Store) error {
 	log.Println("Checking admin settings...")
 
 	// Get existing admin settings from database
-	adminSettings, err := dbConn.GetAdminSettings()
+	adminSettings, err := dbConn.GetAdminSettings(ctx)
 	var settingsUpdated bool
 	var envOverrides []string
 
@@ -24,17 +25,29 @@ func InitializeAdminSettings(dbConn *db.DB) error {
 
 		// Create default settings
 		adminSettings = &settings.AdminSettings{
-			OpenAIBaseURL:         "https://api.openai.com",
-			LLMProfileSpeed:       "gpt-3.5-turbo",
-			LLMProfileBalanced:    "gpt-4o",
-			LLMProfileQuality:     "gpt-4o",
-			EnableSignUps:         true,
-			WebcrawlerURL:         "",
-			ElasticsearchURL:      "",
-			ElasticsearchUsername: "",
-			ElasticsearchPassword: "",
-			EnvOverrides:          []string{},
-
+			OpenAIBaseURL:            "https://api.openai.com",
+			LLMProfileSpeed:          "gpt-3.5-turbo",
+			LLMProfileBalanced:       "gpt-4o",
+			LLMProfileQuality:        "gpt-4o",
+			LLMProviderSpeed:         settings.DefaultProviderName,
+			LLMProviderBalanced:      settings.DefaultProviderName,
+			LLMProviderQuality:       settings.DefaultProviderName,
+			LLMProviders:             []settings.LLMProvider{},
+			LLMModelMetadata:         []settings.ModelMetadata{},
+			RetrievalProfileSpeed:    settings.DefaultRetrievalProfile(settings.QualityProfileSpeed),
+			RetrievalProfileBalanced: settings.DefaultRetrievalProfile(settings.QualityProfileBalanced),
+			RetrievalProfileQuality:  settings.DefaultRetrievalProfile(settings.QualityProfileQuality),
+			GenerationLimitsSpeed:    settings.DefaultGenerationLimits(),
+			GenerationLimitsBalanced: settings.DefaultGenerationLimits(),
+			GenerationLimitsQuality:  settings.DefaultGenerationLimits(),
+			EnableSignUps:            true,
+			WebcrawlerURL:            "",
+			WebcrawlerIndexPages:     true,
+			ElasticsearchURL:         "",
+			ElasticsearchUsername:    "",
+			ElasticsearchPassword:    "",
+			ElasticsearchIndex:       "quillium",
+			EnvOverrides:             []string{},
 		}
 		settingsUpdated = true
 	}
@@ -90,6 +103,34 @@ func InitializeAdminSettings(dbConn *db.DB) error {
 		log.Println("Updated LLM quality profile model from environment variable")
 	}
 
+	// LLM Profile Providers
+	// Speed profile provider
+	llmProviderSpeed := os.Getenv("LLM_PROVIDER_SPEED")
+	if llmProviderSpeed != "" {
+		adminSettings.LLMProviderSpeed = llmProviderSpeed
+		settingsUpdated = true
+		envOverrides = append(envOverrides, "LLM_PROVIDER_SPEED")
+		log.Println("Updated LLM speed profile provider from environment variable")
+	}
+
+	// Balanced profile provider
+	llmProviderBalanced := os.Getenv("LLM_PROVIDER_BALANCED")
+	if llmProviderBalanced != "" {
+		adminSettings.LLMProviderBalanced = llmProviderBalanced
+		settingsUpdated = true
+		envOverrides = append(envOverrides, "LLM_PROVIDER_BALANCED")
+		log.Println("Updated LLM balanced profile provider from environment variable")
+	}
+
+	// Quality profile provider
+	llmProviderQuality := os.Getenv("LLM_PROVIDER_QUALITY")
+	if llmProviderQuality != "" {
+		adminSettings.LLMProviderQuality = llmProviderQuality
+		settingsUpdated = true
+		envOverrides = append(envOverrides, "LLM_PROVIDER_QUALITY")
+		log.Println("Updated LLM quality profile provider from environment variable")
+	}
+
 	// Enable Signups setting
 	enableSignUps := os.Getenv("ENABLE_SIGNUPS")
 	if enableSignUps != "" {
@@ -110,6 +151,16 @@ func InitializeAdminSettings(dbConn *db.DB) error {
 		log.Println("Updated Webcrawler URL from environment variable")
 	}
 
+	// Webcrawler index pages setting
+	webcrawlerIndexPages := os.Getenv("WEBCRAWLER_INDEX_PAGES")
+	if webcrawlerIndexPages != "" {
+		// Convert string to bool (treat "true" or "1" as true)
+		adminSettings.WebcrawlerIndexPages = webcrawlerIndexPages == "true" || webcrawlerIndexPages == "1"
+		settingsUpdated = true
+		envOverrides = append(envOverrides, "WEBCRAWLER_INDEX_PAGES")
+		log.Println("Updated webcrawler index pages setting from environment variable")
+	}
+
 	// Elasticsearch URL
 	elasticsearchURL := os.Getenv("ELASTICSEARCH_URL")
 	if elasticsearchURL != "" {
@@ -137,12 +188,21 @@ func InitializeAdminSettings(dbConn *db.DB) error {
 		log.Println("Updated Elasticsearch password from environment variable")
 	}
 
+	// Elasticsearch Index
+	elasticsearchIndex := os.Getenv("ELASTICSEARCH_INDEX")
+	if elasticsearchIndex != "" {
+		adminSettings.ElasticsearchIndex = elasticsearchIndex
+		settingsUpdated = true
+		envOverrides = append(envOverrides, "ELASTICSEARCH_INDEX")
+		log.Println("Updated Elasticsearch index from environment variable")
+	}
+
 	// Set environment overrides
 	adminSettings.EnvOverrides = envOverrides
 
 	// Save settings if they were updated
 	if settingsUpdated {
-		if err := dbConn.CreateAdminSettings(adminSettings); err != nil {
+		if err := dbConn.CreateAdminSettings(ctx, adminSettings); err != nil {
 			log.Printf("Warning: Failed to save admin settings: %v", err)
 			return err
 		} else {
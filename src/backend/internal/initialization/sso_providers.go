@@ -0,0 +1,38 @@
+package initialization
+
+import (
+	"context"
+	"log"
+
+	"gitlab.cherkaoui.ch/quillium-ai/quillium/src/backend/internal/db"
+	"gitlab.cherkaoui.ch/quillium-ai/quillium/src/backend/internal/security"
+)
+
+// EncryptSsoProviderSecrets encrypts client secrets that were stored in plain
+// text before secrets were encrypted. Secrets that decrypt are left untouched.
+func EncryptSsoProviderSecrets(ctx context.Context, dbConn db.Store) error {
+	providers, err := dbConn.GetSsoProviders(ctx)
+	if err != nil {
+		return err
+	}
+
+	for _, provider := range providers {
+		if provider.ClientSecret == "" {
+			continue
+		}
+		if _, err := security.DecryptPassword(provider.ClientSecret); err == nil {
+			continue
+		}
+
+		encrypted, err := security.EncryptPassword(provider.ClientSecret)
+		if err != nil {
+			return err
+		}
+		provider.ClientSecret = *encrypted
+		if err := dbConn.UpdateSsoProvider(ctx, provider); err != nil {
+			return err
+		}
+		log.Printf("Encrypted the client secret of SSO provider %s", provider.Provider)
+	}
+	return nil
+}
@@ -0,0 +1,152 @@
+package ldapauth
+
+import (
+	"crypto/tls"
+	"errors"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-ldap/ldap/v3"
+	"gitlab.cherkaoui.ch/quillium-ai/quillium/src/backend/internal/settings"
+)
+
+// timeout bounds the connection and every request to the directory
+const timeout = 10 * time.Second
+
+// Authenticate binds to the directory as the user and reads the user's entry
+// and groups. Logins and passwords the directory rejects return
+// ErrInvalidCredentials, other errors mean the directory is unavailable or
+// misconfigured.
+func Authenticate(config *settings.LDAPSettings, username, password string) (*Identity, error) {
+	if !config.Enabled {
+		return nil, errors.New("LDAP authentication is disabled")
+	}
+	// An empty password is an unauthenticated bind, which most directories
+	// accept for any DN
+	if strings.TrimSpace(username) == "" || password == "" {
+		return nil, ErrInvalidCredentials
+	}
+
+	conn, err := dial(config)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	bindDN := strings.ReplaceAll(config.BindDN, "{username}", ldap.EscapeDN(username))
+	if err := conn.Bind(bindDN, password); err != nil {
+		if ldap.IsErrorWithCode(err, ldap.LDAPResultInvalidCredentials) {
+			return nil, ErrInvalidCredentials
+		}
+		return nil, errors.New("failed to bind to LDAP server: " + err.Error())
+	}
+
+	emailAttribute := valueOrDefault(config.EmailAttribute, settings.DefaultLDAPEmailAttribute)
+	usernameAttribute := valueOrDefault(config.UsernameAttribute, settings.DefaultLDAPUsernameAttribute)
+	userFilter := strings.ReplaceAll(valueOrDefault(config.UserFilter, settings.DefaultLDAPUserFilter), "{username}", ldap.EscapeFilter(username))
+
+	result, err := conn.Search(ldap.NewSearchRequest(
+		config.BaseDN, ldap.ScopeWholeSubtree, ldap.NeverDerefAliases, 2, int(timeout.Seconds()), false,
+		userFilter, []string{emailAttribute, usernameAttribute, "memberOf"}, nil,
+	))
+	if err != nil {
+		return nil, errors.New("failed to search LDAP user: " + err.Error())
+	}
+	if len(result.Entries) != 1 {
+		// The bind DN and the user filter do not describe the same user
+		return nil, errors.New("LDAP user filter matched " + strconv.Itoa(len(result.Entries)) + " entries for " + username)
+	}
+	entry := result.Entries[0]
+
+	identity := &Identity{
+		DN:       entry.DN,
+		Email:    entry.GetEqualFoldAttributeValue(emailAttribute),
+		Username: entry.GetEqualFoldAttributeValue(usernameAttribute),
+		Groups:   entry.GetEqualFoldAttributeValues("memberOf"),
+	}
+	if config.GroupFilter != "" {
+		identity.Groups, err = searchGroups(conn, config, entry.DN)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if config.AdminGroup != "" {
+		isAdmin := containsDN(identity.Groups, config.AdminGroup)
+		identity.IsAdmin = &isAdmin
+	}
+	return identity, nil
+}
+
+// dial connects to the configured server, upgrading with StartTLS if enabled
+func dial(config *settings.LDAPSettings) (*ldap.Conn, error) {
+	serverURL, err := url.Parse(config.URL)
+	if err != nil {
+		return nil, errors.New("invalid LDAP server URL: " + err.Error())
+	}
+	tlsConfig := &tls.Config{ServerName: serverURL.Hostname(), MinVersion: tls.VersionTLS12}
+
+	conn, err := ldap.DialURL(config.URL,
+		ldap.DialWithDialer(&net.Dialer{Timeout: timeout}),
+		ldap.DialWithTLSConfig(tlsConfig),
+	)
+	if err != nil {
+		return nil, errors.New("failed to connect to LDAP server: " + err.Error())
+	}
+	conn.SetTimeout(timeout)
+
+	if config.StartTLS {
+		if err := conn.StartTLS(tlsConfig); err != nil {
+			conn.Close()
+			return nil, errors.New("failed to start TLS with LDAP server: " + err.Error())
+		}
+	}
+	return conn, nil
+}
+
+// searchGroups returns the DNs of the groups matching the group filter for the user
+func searchGroups(conn *ldap.Conn, config *settings.LDAPSettings, userDN string) ([]string, error) {
+	groupFilter := strings.ReplaceAll(config.GroupFilter, "{dn}", ldap.EscapeFilter(userDN))
+	result, err := conn.Search(ldap.NewSearchRequest(
+		config.BaseDN, ldap.ScopeWholeSubtree, ldap.NeverDerefAliases, 0, int(timeout.Seconds()), false,
+		groupFilter, []string{"1.1"}, nil, // 1.1 requests no attributes
+	))
+	if err != nil {
+		return nil, errors.New("failed to search LDAP groups: " + err.Error())
+	}
+
+	groups := make([]string, 0, len(result.Entries))
+	for _, entry := range result.Entries {
+		groups = append(groups, entry.DN)
+	}
+	return groups, nil
+}
+
+// containsDN reports whether groups contains the DN, ignoring case and spacing
+func containsDN(groups []string, dn string) bool {
+	for _, group := range groups {
+		if SameDN(group, dn) {
+			return true
+		}
+	}
+	return false
+}
+
+// SameDN reports whether two DNs name the same entry, ignoring case and spacing
+func SameDN(a, b string) bool {
+	parsedA, err := ldap.ParseDN(a)
+	if err != nil {
+		return false
+	}
+	parsedB, err := ldap.ParseDN(b)
+	return err == nil && parsedA.EqualFold(parsedB)
+}
+
+func valueOrDefault(value, defaultValue string) string {
+	if value == "" {
+		return defaultValue
+	}
+	return value
+}
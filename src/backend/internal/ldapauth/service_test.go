@@ -0,0 +1,152 @@
+package ldapauth_test
+
+import (
+	"errors"
+	"net"
+	"slices"
+	"testing"
+
+	"gitlab.cherkaoui.ch/quillium-ai/quillium/src/backend/internal/api/restapi/handlers/testutils"
+	"gitlab.cherkaoui.ch/quillium-ai/quillium/src/backend/internal/ldapauth"
+	"gitlab.cherkaoui.ch/quillium-ai/quillium/src/backend/internal/settings"
+)
+
+// newActiveDirectory serves a user who binds with a user principal name and
+// whose groups are listed in memberOf
+func newActiveDirectory(t *testing.T) *settings.LDAPSettings {
+	directory := testutils.NewMockLDAPServer(t,
+		testutils.MockLDAPEntry{
+			DN:       "CN=Jane Doe,OU=Staff,DC=corp,DC=example,DC=com",
+			Password: "Secret123",
+			Attributes: map[string][]string{
+				"userPrincipalName": {"jane@corp.example.com"},
+				"sAMAccountName":    {"jane"},
+				"mail":              {"jane.doe@example.com"},
+				"memberOf":          {"CN=Staff,OU=Groups,DC=corp,DC=example,DC=com", "CN=Quillium Admins,OU=Groups,DC=corp,DC=example,DC=com"},
+			},
+		},
+	)
+	return &settings.LDAPSettings{
+		Enabled:           true,
+		URL:               directory.URL,
+		BindDN:            "{username}@corp.example.com",
+		BaseDN:            "DC=corp,DC=example,DC=com",
+		UserFilter:        "(sAMAccountName={username})",
+		UsernameAttribute: "sAMAccountName",
+		AdminGroup:        "cn=quillium admins,ou=groups,dc=corp,dc=example,dc=com",
+	}
+}
+
+func TestAuthenticateActiveDirectory(t *testing.T) {
+	config := newActiveDirectory(t)
+
+	identity, err := ldapauth.Authenticate(config, "jane", "Secret123")
+	if err != nil {
+		t.Fatalf("Expected authentication to succeed, got %v", err)
+	}
+	if identity.Email != "jane.doe@example.com" || identity.Username != "jane" || len(identity.Groups) != 2 {
+		t.Errorf("Unexpected identity: %+v", identity)
+	}
+	// Group DNs are compared ignoring case
+	if identity.IsAdmin == nil || !*identity.IsAdmin {
+		t.Error("Expected the admin group to grant the admin role")
+	}
+
+	config.AdminGroup = "CN=Other,OU=Groups,DC=corp,DC=example,DC=com"
+	identity, err = ldapauth.Authenticate(config, "jane", "Secret123")
+	if err != nil || identity.IsAdmin == nil || *identity.IsAdmin {
+		t.Errorf("Expected the admin role to be denied, got %+v, %v", identity, err)
+	}
+
+	config.AdminGroup = ""
+	identity, err = ldapauth.Authenticate(config, "jane", "Secret123")
+	if err != nil || identity.IsAdmin != nil {
+		t.Errorf("Expected the admin role to be left unset, got %+v, %v", identity, err)
+	}
+}
+
+func TestAuthenticateErrors(t *testing.T) {
+	config := newActiveDirectory(t)
+
+	for _, password := range []string{"wrong", ""} {
+		if _, err := ldapauth.Authenticate(config, "jane", password); !errors.Is(err, ldapauth.ErrInvalidCredentials) {
+			t.Errorf("Expected invalid credentials for password %q, got %v", password, err)
+		}
+	}
+
+	// The bound user must match the user filter
+	mismatched := *config
+	mismatched.UserFilter = "(sAMAccountName=someone-else-{username})"
+	if _, err := ldapauth.Authenticate(&mismatched, "jane", "Secret123"); err == nil || errors.Is(err, ldapauth.ErrInvalidCredentials) {
+		t.Errorf("Expected a configuration error, got %v", err)
+	}
+
+	// An unreachable directory is not a credentials error
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to reserve a port: %v", err)
+	}
+	unreachable := *config
+	unreachable.URL = "ldap://" + listener.Addr().String()
+	listener.Close()
+	if _, err := ldapauth.Authenticate(&unreachable, "jane", "Secret123"); err == nil || errors.Is(err, ldapauth.ErrInvalidCredentials) {
+		t.Errorf("Expected a connection error, got %v", err)
+	}
+
+	disabled := *config
+	disabled.Enabled = false
+	if _, err := ldapauth.Authenticate(&disabled, "jane", "Secret123"); err == nil {
+		t.Error("Expected disabled settings to be rejected")
+	}
+}
+
+func TestAuthenticateGroupFilter(t *testing.T) {
+	userDN := "uid=jo (admin),ou=people,dc=example,dc=com"
+	directory := testutils.NewMockLDAPServer(t,
+		testutils.MockLDAPEntry{
+			DN:         userDN,
+			Password:   "Secret123",
+			Attributes: map[string][]string{"uid": {"jo (admin)"}, "mail": {"jo@example.com"}},
+		},
+		testutils.MockLDAPEntry{
+			DN:         "cn=writers,ou=groups,dc=example,dc=com",
+			Attributes: map[string][]string{"objectClass": {"groupOfNames"}, "member": {userDN}},
+		},
+		testutils.MockLDAPEntry{
+			DN:         "cn=readers,ou=groups,dc=example,dc=com",
+			Attributes: map[string][]string{"objectClass": {"groupOfNames"}, "member": {"uid=other,ou=people,dc=example,dc=com"}},
+		},
+	)
+
+	// Parentheses in the login and the DN are escaped in the filters
+	identity, err := ldapauth.Authenticate(&settings.LDAPSettings{
+		Enabled:     true,
+		URL:         directory.URL,
+		BindDN:      "uid={username},ou=people,dc=example,dc=com",
+		BaseDN:      "dc=example,dc=com",
+		GroupFilter: "(&(objectClass=groupOfNames)(member={dn}))",
+	}, "jo (admin)", "Secret123")
+	if err != nil {
+		t.Fatalf("Expected authentication to succeed, got %v", err)
+	}
+	if identity.Username != "jo (admin)" || !slices.Equal(identity.Groups, []string{"cn=writers,ou=groups,dc=example,dc=com"}) {
+		t.Errorf("Unexpected identity: %+v", identity)
+	}
+}
+
+func TestSameDN(t *testing.T) {
+	tests := []struct {
+		a, b string
+		same bool
+	}{
+		{"uid=jdoe,ou=people,dc=example,dc=com", "UID=JDoe, OU=People, DC=example, DC=com", true},
+		{"uid=jdoe,ou=people,dc=example,dc=com", "uid=jsmith,ou=people,dc=example,dc=com", false},
+		{"uid=jdoe,ou=people,dc=example,dc=com", "uid=jdoe,dc=example,dc=com", false},
+		{"not a dn", "not a dn", false},
+	}
+	for _, tt := range tests {
+		if same := ldapauth.SameDN(tt.a, tt.b); same != tt.same {
+			t.Errorf("SameDN(%q, %q) = %t, expected %t", tt.a, tt.b, same, tt.same)
+		}
+	}
+}
@@ -0,0 +1,15 @@
+package ldapauth
+
+import "errors"
+
+// ErrInvalidCredentials is returned when the directory rejects the login
+var ErrInvalidCredentials = errors.New("invalid LDAP credentials")
+
+// Identity is the directory entry of a user who authenticated with LDAP
+type Identity struct {
+	DN       string
+	Email    string
+	Username string
+	Groups   []string // DNs of the groups of the user
+	IsAdmin  *bool    // Set when an admin group is configured
+}
@@ -0,0 +1,231 @@
+package llmproviders
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+)
+
+// anthropicVersion is the Messages API version sent with every request
+const anthropicVersion = "2023-06-01"
+
+// anthropicMaxTokens is the completion limit used when the request sets none, the API requires one
+const anthropicMaxTokens = 4096
+
+// errStreamDone stops reading the event stream once message_stop was received
+var errStreamDone = errors.New("stream done")
+
+// anthropicEvent is the data of a Messages API stream event.
+// Only the fields needed to build stream responses are decoded.
+type anthropicEvent struct {
+	Type  string `json:"type"`
+	Delta struct {
+		Type string `json:"type"`
+		Text string `json:"text"`
+	} `json:"delta"`
+	Error struct {
+		Type    string `json:"type"`
+		Message string `json:"message"`
+	} `json:"error"`
+}
+
+// NewAnthropicProvider creates a provider for the Anthropic Messages API.
+// baseURL includes the version prefix, e.g. https://api.anthropic.com/v1
+func NewAnthropicProvider(name string, baseURL string, apiKey string) *AnthropicProvider {
+	return &AnthropicProvider{
+		name:       name,
+		baseURL:    strings.TrimRight(baseURL, "/"),
+		apiKey:     apiKey,
+		httpClient: &http.Client{},
+	}
+}
+
+// Name returns the name the provider is registered under
+func (p *AnthropicProvider) Name() string {
+	return p.name
+}
+
+// Capabilities describes the features of the Messages API
+func (p *AnthropicProvider) Capabilities() Capabilities {
+	return Capabilities{Streaming: true, ModelListing: true}
+}
+
+// ChatStream streams a response from the Messages API.
+// content_block_delta events are forwarded as chunks and message_stop ends the stream.
+func (p *AnthropicProvider) ChatStream(ctx context.Context, chatReq ChatRequest, callback func(StreamResponse)) error {
+	log.Printf("Sending streaming request to Anthropic API")
+	resp, err := p.post(ctx, "/messages", p.payload(chatReq, true))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	stopped := false
+	err = readSSE(resp.Body, func(eventType string, data string) error {
+		var event anthropicEvent
+		if err := json.Unmarshal([]byte(data), &event); err != nil {
+			log.Printf("Error parsing Anthropic event %s: %v", eventType, err)
+			return nil
+		}
+
+		switch event.Type {
+		case "message_start":
+			log.Printf("Streaming response started from Anthropic API")
+		case "content_block_delta":
+			if event.Delta.Type == "text_delta" && event.Delta.Text != "" {
+				callback(StreamResponse{Content: event.Delta.Text})
+			}
+		case "message_stop":
+			stopped = true
+			return errStreamDone
+		case "error":
+			return fmt.Errorf("Anthropic API error: %s: %s", event.Error.Type, event.Error.Message)
+		}
+		// ping, content_block_start, content_block_stop and message_delta carry no text
+		return nil
+	})
+	if err != nil && !errors.Is(err, errStreamDone) {
+		log.Printf("Error reading Anthropic stream: %v", err)
+		callback(StreamResponse{Error: err})
+		return err
+	}
+	if !stopped {
+		err := errors.New("Anthropic stream ended without message_stop")
+		callback(StreamResponse{Error: err})
+		return err
+	}
+
+	log.Println("Anthropic stream completed")
+	callback(StreamResponse{Done: true})
+	return nil
+}
+
+// Complete sends a non-streaming Messages API request and returns the generated text
+func (p *AnthropicProvider) Complete(ctx context.Context, chatReq ChatRequest) (string, error) {
+	resp, err := p.post(ctx, "/messages", p.payload(chatReq, false))
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	var message struct {
+		Content []struct {
+			Type string `json:"type"`
+			Text string `json:"text"`
+		} `json:"content"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&message); err != nil {
+		return "", err
+	}
+
+	var content strings.Builder
+	for _, block := range message.Content {
+		if block.Type == "text" {
+			content.WriteString(block.Text)
+		}
+	}
+	return content.String(), nil
+}
+
+// ListModels returns the models available to the API key
+func (p *AnthropicProvider) ListModels(ctx context.Context) ([]Model, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, p.baseURL+"/models", nil)
+	if err != nil {
+		return nil, err
+	}
+	p.setHeaders(req)
+
+	resp, err := p.httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("Anthropic API error: %s", resp.Status)
+	}
+
+	var modelList struct {
+		Data []Model `json:"data"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&modelList); err != nil {
+		return nil, err
+	}
+	return modelList.Data, nil
+}
+
+// payload builds a Messages API request body.
+// System messages are moved to the top level system field as the API expects.
+func (p *AnthropicProvider) payload(chatReq ChatRequest, stream bool) map[string]interface{} {
+	var system []string
+	messages := make([]Message, 0, len(chatReq.Messages))
+	for _, message := range chatReq.Messages {
+		if message.Role == "system" {
+			system = append(system, message.Content)
+			continue
+		}
+		messages = append(messages, message)
+	}
+
+	maxTokens := chatReq.MaxTokens
+	if maxTokens <= 0 {
+		maxTokens = anthropicMaxTokens
+	}
+
+	payload := map[string]interface{}{
+		"model":      chatReq.Model,
+		"max_tokens": maxTokens,
+		"messages":   messages,
+		"stream":     stream,
+	}
+	if chatReq.Temperature != nil {
+		payload["temperature"] = *chatReq.Temperature
+	}
+	if len(system) > 0 {
+		payload["system"] = strings.Join(system, "\n\n")
+	}
+	return payload
+}
+
+// post sends a JSON request and returns the response when the status is 200 OK
+func (p *AnthropicProvider) post(ctx context.Context, path string, payload interface{}) (*http.Response, error) {
+	jsonPayload, err := json.Marshal(payload)
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, p.baseURL+path, bytes.NewBuffer(jsonPayload))
+	if err != nil {
+		return nil, err
+	}
+	p.setHeaders(req)
+
+	resp, err := p.httpClient.Do(req)
+	if err != nil {
+		log.Printf("Error making HTTP request: %v", err)
+		return nil, err
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		log.Printf("Anthropic API error: %s", string(body))
+		return nil, fmt.Errorf("Anthropic API error: %s", resp.Status)
+	}
+	return resp, nil
+}
+
+// setHeaders adds the content type, version and API key headers
+func (p *AnthropicProvider) setHeaders(req *http.Request) {
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("anthropic-version", anthropicVersion)
+	if p.apiKey != "" {
+		req.Header.Set("x-api-key", p.apiKey)
+	}
+}
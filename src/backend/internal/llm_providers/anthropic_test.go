@@ -0,0 +1,190 @@
+package llmproviders
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+)
+
+// newTestAnthropicServer starts a stand-in for the Messages API replaying a recorded SSE stream
+func newTestAnthropicServer(t *testing.T, streamFile string) *httptest.Server {
+	recorded, err := os.ReadFile(streamFile)
+	if err != nil {
+		t.Fatalf("Failed to read recorded stream: %v", err)
+	}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("x-api-key") != "test-key" || r.Header.Get("anthropic-version") == "" {
+			w.WriteHeader(http.StatusUnauthorized)
+			w.Write([]byte(`{"type":"error","error":{"type":"authentication_error","message":"invalid x-api-key"}}`))
+			return
+		}
+
+		switch r.URL.Path {
+		case "/v1/messages":
+			var body struct {
+				Model     string    `json:"model"`
+				MaxTokens int       `json:"max_tokens"`
+				System    string    `json:"system"`
+				Messages  []Message `json:"messages"`
+				Stream    bool      `json:"stream"`
+			}
+			if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+				t.Errorf("Failed to decode request: %v", err)
+			}
+			if body.MaxTokens <= 0 {
+				t.Error("Expected max_tokens to be set")
+			}
+			if !strings.HasPrefix(body.System, "You are Quillium") {
+				t.Errorf("Expected the system prompt in the system field, got '%s'", body.System)
+			}
+			for _, message := range body.Messages {
+				if message.Role == "system" {
+					t.Error("System messages must not be sent in the messages list")
+				}
+			}
+
+			if body.Stream {
+				w.Header().Set("Content-Type", "text/event-stream")
+				w.Write(recorded)
+				return
+			}
+			w.Header().Set("Content-Type", "application/json")
+			w.Write([]byte(`{"id":"msg_01","type":"message","role":"assistant","content":[{"type":"text","text":"Go modules"},{"type":"text","text":" manage dependencies."}]}`))
+		case "/v1/models":
+			w.Header().Set("Content-Type", "application/json")
+			w.Write([]byte(`{"data":[{"type":"model","id":"claude-test","display_name":"Claude Test"}],"has_more":false}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestAnthropicChatStream(t *testing.T) {
+	server := newTestAnthropicServer(t, "testdata/anthropic_stream.txt")
+	provider := NewAnthropicProvider("claude", server.URL+"/v1", "test-key")
+
+	var chunks []string
+	doneCount := 0
+	err := provider.ChatStream(context.Background(), ChatRequest{
+		Model:    "claude-test",
+		Messages: BuildMessages("what are go modules?", []string{"[1] Go Modules (https://go.dev/ref/mod)"}, nil, 0),
+	}, func(resp StreamResponse) {
+		if resp.Error != nil {
+			t.Errorf("Unexpected stream error: %v", resp.Error)
+		}
+		if resp.Done {
+			doneCount++
+			return
+		}
+		chunks = append(chunks, resp.Content)
+	})
+	if err != nil {
+		t.Fatalf("ChatStream failed: %v", err)
+	}
+
+	if len(chunks) != 2 || strings.Join(chunks, "") != "Go modules manage dependencies [1]." {
+		t.Errorf("Unexpected chunks: %q", chunks)
+	}
+	if doneCount != 1 {
+		t.Errorf("Expected exactly one done chunk, got %d", doneCount)
+	}
+}
+
+func TestAnthropicChatStreamError(t *testing.T) {
+	server := newTestAnthropicServer(t, "testdata/anthropic_stream_error.txt")
+	provider := NewAnthropicProvider("claude", server.URL+"/v1", "test-key")
+
+	var streamErr error
+	var content strings.Builder
+	err := provider.ChatStream(context.Background(), ChatRequest{
+		Model:    "claude-test",
+		Messages: BuildMessages("what are go modules?", nil, nil, 0),
+	}, func(resp StreamResponse) {
+		if resp.Done {
+			t.Error("A failed stream must not be marked as done")
+		}
+		if resp.Error != nil {
+			streamErr = resp.Error
+		}
+		content.WriteString(resp.Content)
+	})
+
+	if err == nil || !strings.Contains(err.Error(), "overloaded_error") {
+		t.Errorf("Expected an overloaded error, got %v", err)
+	}
+	if streamErr == nil {
+		t.Error("Expected the error to be passed to the callback")
+	}
+	if content.String() != "Go" {
+		t.Errorf("Expected content before the error to be streamed, got '%s'", content.String())
+	}
+}
+
+func TestAnthropicUnauthorized(t *testing.T) {
+	server := newTestAnthropicServer(t, "testdata/anthropic_stream.txt")
+	provider := NewAnthropicProvider("claude", server.URL+"/v1", "wrong-key")
+
+	_, err := provider.Complete(context.Background(), ChatRequest{Model: "claude-test"})
+	if err == nil || !strings.Contains(err.Error(), "401") {
+		t.Errorf("Expected an unauthorized error, got %v", err)
+	}
+}
+
+func TestAnthropicComplete(t *testing.T) {
+	server := newTestAnthropicServer(t, "testdata/anthropic_stream.txt")
+	provider := NewAnthropicProvider("claude", server.URL+"/v1", "test-key")
+
+	content, err := provider.Complete(context.Background(), ChatRequest{
+		Model:    "claude-test",
+		Messages: BuildMessages("what are go modules?", nil, nil, 0),
+	})
+	if err != nil {
+		t.Fatalf("Complete failed: %v", err)
+	}
+	if content != "Go modules manage dependencies." {
+		t.Errorf("Unexpected content: '%s'", content)
+	}
+}
+
+func TestAnthropicListModels(t *testing.T) {
+	server := newTestAnthropicServer(t, "testdata/anthropic_stream.txt")
+	provider := NewAnthropicProvider("claude", server.URL+"/v1", "test-key")
+
+	models, err := provider.ListModels(context.Background())
+	if err != nil {
+		t.Fatalf("ListModels failed: %v", err)
+	}
+	if len(models) != 1 || models[0].ID != "claude-test" {
+		t.Errorf("Unexpected models: %+v", models)
+	}
+}
+
+func TestReadSSE(t *testing.T) {
+	stream := ": comment\nevent: first\ndata: line one\ndata: line two\n\ndata: unnamed\r\n\r\nevent: last\ndata: no trailing blank line"
+
+	var events []string
+	err := readSSE(strings.NewReader(stream), func(event string, data string) error {
+		events = append(events, event+"="+data)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("readSSE failed: %v", err)
+	}
+
+	expected := []string{"first=line one\nline two", "message=unnamed", "last=no trailing blank line"}
+	if len(events) != len(expected) {
+		t.Fatalf("Expected %d events, got %d: %q", len(expected), len(events), events)
+	}
+	for i := range expected {
+		if events[i] != expected[i] {
+			t.Errorf("Expected event %q, got %q", expected[i], events[i])
+		}
+	}
+}
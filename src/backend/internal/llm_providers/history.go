@@ -0,0 +1,45 @@
+package llmproviders
+
+import (
+	"fmt"
+	"unicode/utf8"
+)
+
+// charsPerToken is the average number of characters per token used to estimate prompt sizes
+const charsPerToken = 4
+
+// messageOverheadTokens accounts for the role and separators every message adds to the prompt
+const messageOverheadTokens = 4
+
+// EstimateTokens approximates the number of tokens a message uses in the prompt.
+// Tokenizers differ between models, so the estimate errs on the high side.
+func EstimateTokens(message Message) int {
+	return (utf8.RuneCountInString(message.Content)+charsPerToken-1)/charsPerToken + messageOverheadTokens
+}
+
+// TrimHistory keeps the most recent turns of a conversation that fit into budget tokens.
+// Whole messages are dropped starting with the oldest, and the result always starts with a user
+// message because some providers reject conversations starting with the assistant.
+// A budget of 0 or less keeps nothing.
+func TrimHistory(history []Message, budget int) []Message {
+	start := len(history)
+	used := 0
+	for i := len(history) - 1; i >= 0; i-- {
+		tokens := EstimateTokens(history[i])
+		if used+tokens > budget {
+			break
+		}
+		used += tokens
+		start = i
+	}
+
+	for start < len(history) && history[start].Role != "user" {
+		start++
+	}
+	return history[start:]
+}
+
+// omittedHistoryNote tells the model that older turns of the conversation are not included
+func omittedHistoryNote(omitted int) string {
+	return fmt.Sprintf("%d earlier messages of this conversation were omitted to fit the context window.", omitted)
+}
@@ -0,0 +1,88 @@
+package llmproviders
+
+import (
+	"strings"
+	"testing"
+)
+
+// testConversation returns alternating user and assistant messages of roughly 100 tokens each
+func testConversation(turns int) []Message {
+	var history []Message
+	for i := 0; i < turns; i++ {
+		history = append(history,
+			Message{Role: "user", Content: strings.Repeat("q", 384)},
+			Message{Role: "assistant", Content: strings.Repeat("a", 384)},
+		)
+	}
+	return history
+}
+
+func TestEstimateTokens(t *testing.T) {
+	if tokens := EstimateTokens(Message{Content: ""}); tokens != messageOverheadTokens {
+		t.Errorf("Expected %d tokens for an empty message, got %d", messageOverheadTokens, tokens)
+	}
+	if tokens := EstimateTokens(Message{Content: "abcde"}); tokens != 2+messageOverheadTokens {
+		t.Errorf("Expected partial tokens to be rounded up, got %d", tokens)
+	}
+	// Multi-byte characters are counted once
+	if tokens := EstimateTokens(Message{Content: "éééé"}); tokens != 1+messageOverheadTokens {
+		t.Errorf("Expected runes to be counted instead of bytes, got %d", tokens)
+	}
+}
+
+func TestTrimHistory(t *testing.T) {
+	history := testConversation(3) // 6 messages of 100 tokens
+
+	if trimmed := TrimHistory(history, 1000); len(trimmed) != 6 {
+		t.Errorf("Expected the whole history to fit, got %d messages", len(trimmed))
+	}
+
+	// 350 tokens fit three messages, but the result has to start with a user message
+	trimmed := TrimHistory(history, 350)
+	if len(trimmed) != 2 {
+		t.Fatalf("Expected the last turn only, got %d messages", len(trimmed))
+	}
+	if trimmed[0].Role != "user" || trimmed[0].Content != history[4].Content {
+		t.Errorf("Expected the most recent user message first, got %+v", trimmed[0])
+	}
+
+	if trimmed := TrimHistory(history, 0); len(trimmed) != 0 {
+		t.Errorf("Expected no history without budget, got %d messages", len(trimmed))
+	}
+}
+
+func TestBuildMessagesWithHistory(t *testing.T) {
+	history := testConversation(10)
+
+	// Without a budget the whole conversation is sent
+	messages := BuildMessages("follow up", []string{"[1] Source"}, history, 0)
+	if len(messages) != len(history)+2 {
+		t.Fatalf("Expected %d messages, got %d", len(history)+2, len(messages))
+	}
+	if messages[0].Role != "system" || messages[len(messages)-1].Role != "user" {
+		t.Error("Expected the system prompt first and the question last")
+	}
+	if !strings.Contains(messages[len(messages)-1].Content, "follow up") {
+		t.Error("Expected the question in the last message")
+	}
+
+	// With a budget older turns are left out and the model is told about it
+	budget := 1000
+	messages = BuildMessages("follow up", []string{"[1] Source"}, history, budget)
+	total := 0
+	for _, message := range messages {
+		total += EstimateTokens(message)
+	}
+	if total > budget {
+		t.Errorf("Expected at most %d tokens, got %d", budget, total)
+	}
+	if len(messages) <= 2 || len(messages) >= len(history)+2 {
+		t.Errorf("Expected a partial history, got %d messages", len(messages))
+	}
+	if messages[1].Role != "user" {
+		t.Errorf("Expected the history to start with a user message, got %s", messages[1].Role)
+	}
+	if !strings.Contains(messages[0].Content, "earlier messages of this conversation were omitted") {
+		t.Error("Expected a note about the omitted messages")
+	}
+}
@@ -0,0 +1,195 @@
+package llmproviders
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+)
+
+// ollamaChunk is one line of the newline-delimited JSON stream returned by /api/chat
+type ollamaChunk struct {
+	Message struct {
+		Role    string `json:"role"`
+		Content string `json:"content"`
+	} `json:"message"`
+	Done  bool   `json:"done"`
+	Error string `json:"error"`
+}
+
+// NewOllamaProvider creates a provider for the native Ollama API.
+// baseURL is the address of the Ollama host, e.g. http://localhost:11434
+func NewOllamaProvider(name string, baseURL string, apiKey string) *OllamaProvider {
+	return &OllamaProvider{
+		name:       name,
+		baseURL:    strings.TrimRight(baseURL, "/"),
+		apiKey:     apiKey,
+		httpClient: &http.Client{},
+	}
+}
+
+// Name returns the name the provider is registered under
+func (p *OllamaProvider) Name() string {
+	return p.name
+}
+
+// Capabilities describes the features of the Ollama API
+func (p *OllamaProvider) Capabilities() Capabilities {
+	return Capabilities{Streaming: true, ModelListing: true}
+}
+
+// ChatStream streams a response from /api/chat, which sends one JSON object per line
+func (p *OllamaProvider) ChatStream(ctx context.Context, chatReq ChatRequest, callback func(StreamResponse)) error {
+	log.Printf("Sending streaming request to Ollama API")
+	resp, err := p.post(ctx, "/api/chat", p.payload(chatReq, true))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	decoder := json.NewDecoder(resp.Body)
+	for {
+		var chunk ollamaChunk
+		if err := decoder.Decode(&chunk); err != nil {
+			if errors.Is(err, io.EOF) {
+				err = errors.New("Ollama stream ended before the response was done")
+			}
+			log.Printf("Error reading Ollama stream: %v", err)
+			callback(StreamResponse{Error: err})
+			return err
+		}
+
+		if chunk.Error != "" {
+			err := fmt.Errorf("Ollama API error: %s", chunk.Error)
+			callback(StreamResponse{Error: err})
+			return err
+		}
+
+		if chunk.Message.Content != "" {
+			callback(StreamResponse{Content: chunk.Message.Content})
+		}
+
+		if chunk.Done {
+			break
+		}
+	}
+
+	log.Println("Ollama stream completed")
+	callback(StreamResponse{Done: true})
+	return nil
+}
+
+// Complete sends a non-streaming /api/chat request and returns the generated text
+func (p *OllamaProvider) Complete(ctx context.Context, chatReq ChatRequest) (string, error) {
+	resp, err := p.post(ctx, "/api/chat", p.payload(chatReq, false))
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	var chunk ollamaChunk
+	if err := json.NewDecoder(resp.Body).Decode(&chunk); err != nil {
+		return "", err
+	}
+	if chunk.Error != "" {
+		return "", fmt.Errorf("Ollama API error: %s", chunk.Error)
+	}
+	return chunk.Message.Content, nil
+}
+
+// ListModels returns the models installed on the Ollama host
+func (p *OllamaProvider) ListModels(ctx context.Context) ([]Model, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, p.baseURL+"/api/tags", nil)
+	if err != nil {
+		return nil, err
+	}
+	p.setHeaders(req)
+
+	resp, err := p.httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("Ollama API error: %s", resp.Status)
+	}
+
+	var tags struct {
+		Models []struct {
+			Name string `json:"name"`
+		} `json:"models"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&tags); err != nil {
+		return nil, err
+	}
+
+	models := make([]Model, 0, len(tags.Models))
+	for _, model := range tags.Models {
+		models = append(models, Model{ID: model.Name})
+	}
+	return models, nil
+}
+
+// payload builds an /api/chat request body
+func (p *OllamaProvider) payload(chatReq ChatRequest, stream bool) map[string]interface{} {
+	payload := map[string]interface{}{
+		"model":    chatReq.Model,
+		"messages": chatReq.Messages,
+		"stream":   stream,
+	}
+
+	// Sampling parameters are passed as model options
+	options := map[string]interface{}{}
+	if chatReq.Temperature != nil {
+		options["temperature"] = *chatReq.Temperature
+	}
+	if chatReq.MaxTokens > 0 {
+		options["num_predict"] = chatReq.MaxTokens
+	}
+	if len(options) > 0 {
+		payload["options"] = options
+	}
+	return payload
+}
+
+// post sends a JSON request and returns the response when the status is 200 OK
+func (p *OllamaProvider) post(ctx context.Context, path string, payload interface{}) (*http.Response, error) {
+	jsonPayload, err := json.Marshal(payload)
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, p.baseURL+path, bytes.NewBuffer(jsonPayload))
+	if err != nil {
+		return nil, err
+	}
+	p.setHeaders(req)
+
+	resp, err := p.httpClient.Do(req)
+	if err != nil {
+		log.Printf("Error making HTTP request: %v", err)
+		return nil, err
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		log.Printf("Ollama API error: %s", string(body))
+		return nil, fmt.Errorf("Ollama API error: %s", resp.Status)
+	}
+	return resp, nil
+}
+
+// setHeaders adds the content type header, and the API key for hosts behind an authenticating proxy
+func (p *OllamaProvider) setHeaders(req *http.Request) {
+	req.Header.Set("Content-Type", "application/json")
+	if p.apiKey != "" {
+		req.Header.Set("Authorization", "Bearer "+p.apiKey)
+	}
+}
@@ -0,0 +1,144 @@
+package llmproviders
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// newTestOllamaServer starts a stand-in for the Ollama API writing the given lines to /api/chat
+func newTestOllamaServer(t *testing.T, chatLines []string) *httptest.Server {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/api/chat":
+			var body struct {
+				Model    string    `json:"model"`
+				Messages []Message `json:"messages"`
+				Stream   bool      `json:"stream"`
+			}
+			if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+				t.Errorf("Failed to decode request: %v", err)
+			}
+			if body.Model != "llama3:latest" {
+				t.Errorf("Unexpected model: %s", body.Model)
+			}
+
+			w.Header().Set("Content-Type", "application/x-ndjson")
+			if !body.Stream {
+				w.Write([]byte(`{"model":"llama3:latest","message":{"role":"assistant","content":"go modules"},"done":true}`))
+				return
+			}
+			for _, line := range chatLines {
+				w.Write([]byte(line + "\n"))
+				w.(http.Flusher).Flush()
+			}
+		case "/api/tags":
+			w.Header().Set("Content-Type", "application/json")
+			w.Write([]byte(`{"models":[{"name":"llama3:latest","model":"llama3:latest","size":4661224676},{"name":"mistral:7b","model":"mistral:7b","size":4109865159}]}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestOllamaChatStream(t *testing.T) {
+	server := newTestOllamaServer(t, []string{
+		`{"model":"llama3:latest","message":{"role":"assistant","content":"Go"},"done":false}`,
+		`{"model":"llama3:latest","message":{"role":"assistant","content":" modules"},"done":false}`,
+		`{"model":"llama3:latest","message":{"role":"assistant","content":""},"done":true,"done_reason":"stop","eval_count":2}`,
+	})
+	provider := NewOllamaProvider("local", server.URL, "")
+
+	var content strings.Builder
+	doneCount := 0
+	err := provider.ChatStream(context.Background(), ChatRequest{
+		Model:    "llama3:latest",
+		Messages: BuildMessages("what are go modules?", nil, nil, 0),
+	}, func(resp StreamResponse) {
+		if resp.Error != nil {
+			t.Errorf("Unexpected stream error: %v", resp.Error)
+		}
+		if resp.Done {
+			doneCount++
+			return
+		}
+		content.WriteString(resp.Content)
+	})
+	if err != nil {
+		t.Fatalf("ChatStream failed: %v", err)
+	}
+
+	if content.String() != "Go modules" {
+		t.Errorf("Expected 'Go modules', got '%s'", content.String())
+	}
+	if doneCount != 1 {
+		t.Errorf("Expected exactly one done chunk, got %d", doneCount)
+	}
+}
+
+func TestOllamaChatStreamError(t *testing.T) {
+	server := newTestOllamaServer(t, []string{
+		`{"model":"llama3:latest","message":{"role":"assistant","content":"Go"},"done":false}`,
+		`{"error":"model runner has unexpectedly stopped"}`,
+	})
+	provider := NewOllamaProvider("local", server.URL, "")
+
+	var streamErr error
+	err := provider.ChatStream(context.Background(), ChatRequest{Model: "llama3:latest"}, func(resp StreamResponse) {
+		if resp.Done {
+			t.Error("A failed stream must not be marked as done")
+		}
+		if resp.Error != nil {
+			streamErr = resp.Error
+		}
+	})
+	if err == nil || !strings.Contains(err.Error(), "unexpectedly stopped") {
+		t.Errorf("Expected the Ollama error, got %v", err)
+	}
+	if streamErr == nil {
+		t.Error("Expected the error to be passed to the callback")
+	}
+}
+
+func TestOllamaChatStreamTruncated(t *testing.T) {
+	server := newTestOllamaServer(t, []string{
+		`{"model":"llama3:latest","message":{"role":"assistant","content":"Go"},"done":false}`,
+	})
+	provider := NewOllamaProvider("local", server.URL, "")
+
+	err := provider.ChatStream(context.Background(), ChatRequest{Model: "llama3:latest"}, func(StreamResponse) {})
+	if err == nil {
+		t.Error("Expected an error for a stream without a done message")
+	}
+}
+
+func TestOllamaComplete(t *testing.T) {
+	server := newTestOllamaServer(t, nil)
+	provider := NewOllamaProvider("local", server.URL, "")
+
+	content, err := provider.Complete(context.Background(), ChatRequest{Model: "llama3:latest"})
+	if err != nil {
+		t.Fatalf("Complete failed: %v", err)
+	}
+	if content != "go modules" {
+		t.Errorf("Unexpected content: '%s'", content)
+	}
+}
+
+func TestOllamaListModels(t *testing.T) {
+	server := newTestOllamaServer(t, nil)
+	provider := NewOllamaProvider("local", server.URL+"/", "")
+
+	models, err := provider.ListModels(context.Background())
+	if err != nil {
+		t.Fatalf("ListModels failed: %v", err)
+	}
+	if len(models) != 2 || models[0].ID != "llama3:latest" || models[1].ID != "mistral:7b" {
+		t.Errorf("Unexpected models: %+v", models)
+	}
+}
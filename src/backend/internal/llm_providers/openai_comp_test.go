@@ -0,0 +1,122 @@
+package llmproviders
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// newTestOpenAIServer starts a stand-in for the OpenAI chat completions and models API
+func newTestOpenAIServer(t *testing.T) *httptest.Server {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer test-key" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		switch r.URL.Path {
+		case "/v1/chat/completions":
+			var body struct {
+				Model    string    `json:"model"`
+				Messages []Message `json:"messages"`
+				Stream   bool      `json:"stream"`
+			}
+			if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+				t.Errorf("Failed to decode request: %v", err)
+			}
+			if body.Model != "gpt-test" || len(body.Messages) != 2 {
+				t.Errorf("Unexpected request: %+v", body)
+			}
+
+			if body.Stream {
+				w.Header().Set("Content-Type", "text/event-stream")
+				w.Write([]byte("data: {\"choices\":[{\"delta\":{\"role\":\"assistant\"}}]}\n\n"))
+				w.Write([]byte("data: {\"choices\":[{\"delta\":{\"content\":\"Hello\"}}]}\n\n"))
+				w.Write([]byte("data: {\"choices\":[{\"delta\":{\"content\":\" world\"}}]}\n\n"))
+				w.Write([]byte("data: [DONE]\n\n"))
+				return
+			}
+			w.Header().Set("Content-Type", "application/json")
+			w.Write([]byte(`{"choices":[{"message":{"role":"assistant","content":"go modules\ngo.mod file"}}]}`))
+		case "/v1/models":
+			w.Header().Set("Content-Type", "application/json")
+			w.Write([]byte(`{"data":[{"id":"gpt-test","owned_by":"tests"},{"id":"gpt-other"}]}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestOpenAIChatStream(t *testing.T) {
+	server := newTestOpenAIServer(t)
+	provider := NewOpenAIProvider("openai", server.URL+"/v1/", "test-key")
+
+	var content strings.Builder
+	doneCount := 0
+	err := provider.ChatStream(context.Background(), ChatRequest{
+		Model:    "gpt-test",
+		Messages: BuildMessages("hello?", []string{"[1] Greeting (https://example.com)"}, nil, 0),
+	}, func(resp StreamResponse) {
+		if resp.Error != nil {
+			t.Errorf("Unexpected stream error: %v", resp.Error)
+		}
+		if resp.Done {
+			doneCount++
+			return
+		}
+		content.WriteString(resp.Content)
+	})
+	if err != nil {
+		t.Fatalf("ChatStream failed: %v", err)
+	}
+
+	if content.String() != "Hello world" {
+		t.Errorf("Expected 'Hello world', got '%s'", content.String())
+	}
+	if doneCount != 1 {
+		t.Errorf("Expected exactly one done chunk, got %d", doneCount)
+	}
+}
+
+func TestOpenAIChatStreamError(t *testing.T) {
+	server := newTestOpenAIServer(t)
+	provider := NewOpenAIProvider("openai", server.URL+"/v1", "wrong-key")
+
+	err := provider.ChatStream(context.Background(), ChatRequest{Model: "gpt-test"}, func(StreamResponse) {
+		t.Error("Callback should not be called when the request fails")
+	})
+	if err == nil || !strings.Contains(err.Error(), "401") {
+		t.Errorf("Expected an unauthorized error, got %v", err)
+	}
+}
+
+func TestOpenAIListModels(t *testing.T) {
+	server := newTestOpenAIServer(t)
+	provider := NewOpenAIProvider("openai", server.URL+"/v1", "test-key")
+
+	models, err := provider.ListModels(context.Background())
+	if err != nil {
+		t.Fatalf("ListModels failed: %v", err)
+	}
+	if len(models) != 2 || models[0].ID != "gpt-test" || models[0].OwnedBy != "tests" {
+		t.Errorf("Unexpected models: %+v", models)
+	}
+}
+
+func TestGenerateSearchQueries(t *testing.T) {
+	server := newTestOpenAIServer(t)
+	provider := NewOpenAIProvider("openai", server.URL+"/v1", "test-key")
+
+	queries, err := GenerateSearchQueries(context.Background(), provider, "gpt-test", "how do go modules work", 2)
+	if err != nil {
+		t.Fatalf("GenerateSearchQueries failed: %v", err)
+	}
+	if len(queries) != 2 || queries[0] != "go modules" || queries[1] != "go.mod file" {
+		t.Errorf("Unexpected queries: %v", queries)
+	}
+}
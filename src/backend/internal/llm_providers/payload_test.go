@@ -0,0 +1,47 @@
+package llmproviders
+
+import (
+	"testing"
+)
+
+func TestPayloadSamplingOptions(t *testing.T) {
+	temperature := 0.2
+	withOptions := ChatRequest{Model: "test", Temperature: &temperature, MaxTokens: 256}
+	withoutOptions := ChatRequest{Model: "test"}
+
+	// OpenAI compatible APIs take the options at the top level
+	openAI := NewOpenAIProvider("openai", "http://localhost", "")
+	payload := openAI.payload(withOptions, true)
+	if payload["temperature"] != 0.2 || payload["max_tokens"] != 256 {
+		t.Errorf("Unexpected OpenAI payload: %v", payload)
+	}
+	payload = openAI.payload(withoutOptions, true)
+	if _, ok := payload["temperature"]; ok {
+		t.Error("Expected no temperature when the provider default is used")
+	}
+	if _, ok := payload["max_tokens"]; ok {
+		t.Error("Expected no max_tokens when the provider default is used")
+	}
+
+	// The Messages API always needs max_tokens
+	anthropic := NewAnthropicProvider("anthropic", "http://localhost", "")
+	payload = anthropic.payload(withOptions, true)
+	if payload["temperature"] != 0.2 || payload["max_tokens"] != 256 {
+		t.Errorf("Unexpected Anthropic payload: %v", payload)
+	}
+	payload = anthropic.payload(withoutOptions, true)
+	if payload["max_tokens"] != anthropicMaxTokens {
+		t.Errorf("Expected default max_tokens, got %v", payload["max_tokens"])
+	}
+
+	// Ollama takes sampling parameters as model options
+	ollama := NewOllamaProvider("ollama", "http://localhost", "")
+	payload = ollama.payload(withOptions, true)
+	options, ok := payload["options"].(map[string]interface{})
+	if !ok || options["temperature"] != 0.2 || options["num_predict"] != 256 {
+		t.Errorf("Unexpected Ollama payload: %v", payload)
+	}
+	if _, ok := ollama.payload(withoutOptions, true)["options"]; ok {
+		t.Error("Expected no options when the provider defaults are used")
+	}
+}
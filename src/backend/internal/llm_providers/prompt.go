@@ -0,0 +1,49 @@
+package llmproviders
+
+import (
+	"fmt"
+	"strings"
+)
+
+// systemPrompt instructs the model to answer from the search results and cite them
+const systemPrompt = `You are Quillium, an AI assistant. Your purpose is to answer user questions by searching and summarizing relevant information from trusted sources.
+
+Follow these rules when generating responses:
+
+1. Be accurate. If you are unsure or information is unavailable, say so clearly.
+2. Keep your answers concise and focused on the user's question.
+3. Reference sources frequently throughout your response using numbered brackets like [1], [2], etc.
+4. Use MULTIPLE sources whenever possible - aim to reference at least 3-5 different sources in your response.
+5. Prioritize information from the provided sources over your own knowledge.
+6. Structure your response clearly using paragraphs, bullet points, or sections when needed.
+7. Do not speculate or generate information that cannot be supported by the sources.
+
+Always behave like a helpful, knowledgeable, and trustworthy research assistant who thoroughly cites multiple sources.`
+
+// BuildMessages creates the messages sent to the model for a query, its search results and the
+// previous turns of the conversation. When the conversation does not fit into contextBudget tokens,
+// the oldest turns are left out, not summarized, and the system prompt tells the model how many.
+// A contextBudget of 0 or less sends the whole history.
+func BuildMessages(query string, indexResults []string, history []Message, contextBudget int) []Message {
+	userMessageContent := fmt.Sprintf("Here is the Users Query: %s\n\nHere are the index results related to the query: %s",
+		query, strings.Join(indexResults, "\n"))
+
+	system := Message{Role: "system", Content: systemPrompt}
+	user := Message{Role: "user", Content: userMessageContent}
+
+	if contextBudget > 0 {
+		// The omitted history note is counted up front so that adding it never exceeds the budget
+		note := Message{Role: "system", Content: omittedHistoryNote(len(history))}
+		remaining := contextBudget - EstimateTokens(system) - EstimateTokens(user) - EstimateTokens(note)
+		trimmed := TrimHistory(history, remaining)
+		if omitted := len(history) - len(trimmed); omitted > 0 {
+			system.Content += "\n\n" + omittedHistoryNote(omitted)
+		}
+		history = trimmed
+	}
+
+	messages := make([]Message, 0, len(history)+2)
+	messages = append(messages, system)
+	messages = append(messages, history...)
+	return append(messages, user)
+}
@@ -0,0 +1,58 @@
+package llmproviders
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// listMarker matches bullets and numbering that models like to prefix lines with
+var listMarker = regexp.MustCompile(`^(?:[-*•]|\d+[.)])\s*`)
+
+const queryGenerationPrompt = `You generate web search queries for a search engine.
+Given a user question, reply with search queries that would find documents answering it.
+Reply with one query per line, without numbering, quotes or any other text.`
+
+// GenerateSearchQueries asks the model for up to n search queries for the user's question
+func GenerateSearchQueries(ctx context.Context, provider Provider, model string, query string, n int) ([]string, error) {
+	if n <= 0 {
+		return []string{}, nil
+	}
+
+	userPrompt := fmt.Sprintf("Write %d different search queries for this question: %s", n, query)
+	if n == 1 {
+		userPrompt = fmt.Sprintf("Rewrite this question as a single concise search query: %s", query)
+	}
+
+	content, err := provider.Complete(ctx, ChatRequest{
+		Model: model,
+		Messages: []Message{
+			{Role: "system", Content: queryGenerationPrompt},
+			{Role: "user", Content: userPrompt},
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return parseQueries(content, n), nil
+}
+
+// parseQueries extracts one query per line, removing list markers and quotes
+func parseQueries(content string, n int) []string {
+	queries := []string{}
+	for _, line := range strings.Split(content, "\n") {
+		line = strings.TrimSpace(line)
+		line = listMarker.ReplaceAllString(line, "")
+		line = strings.Trim(line, "\"'` ")
+		if line == "" {
+			continue
+		}
+		queries = append(queries, line)
+		if len(queries) == n {
+			break
+		}
+	}
+	return queries
+}
@@ -0,0 +1,82 @@
+package llmproviders
+
+import (
+	"errors"
+	"fmt"
+	"log"
+
+	"gitlab.cherkaoui.ch/quillium-ai/quillium/src/backend/internal/security"
+	"gitlab.cherkaoui.ch/quillium-ai/quillium/src/backend/internal/settings"
+)
+
+// NewRegistry creates an empty provider registry
+func NewRegistry() *Registry {
+	return &Registry{providers: make(map[string]Provider)}
+}
+
+// NewRegistryFromSettings creates a registry with every provider configured in the admin settings.
+// Providers whose API key cannot be decrypted are skipped so that the others stay usable.
+func NewRegistryFromSettings(adminSettings *settings.AdminSettings) (*Registry, error) {
+	if adminSettings == nil {
+		return nil, errors.New("admin settings are required")
+	}
+
+	registry := NewRegistry()
+	for _, config := range adminSettings.GetLLMProviders() {
+		apiKey := ""
+		if config.APIKey_encrypt != "" {
+			decrypted, err := security.DecryptPassword(config.APIKey_encrypt)
+			if err != nil {
+				log.Printf("Skipping LLM provider %s: failed to decrypt API key: %v", config.Name, err)
+				continue
+			}
+			apiKey = *decrypted
+		}
+
+		provider, err := NewProvider(config, apiKey)
+		if err != nil {
+			log.Printf("Skipping LLM provider %s: %v", config.Name, err)
+			continue
+		}
+		registry.Register(provider)
+	}
+	return registry, nil
+}
+
+// NewProvider creates the provider implementation matching the configured type
+func NewProvider(config settings.LLMProvider, apiKey string) (Provider, error) {
+	switch config.Type {
+	case settings.ProviderTypeOpenAI:
+		return NewOpenAIProvider(config.Name, config.BaseURL, apiKey), nil
+	case settings.ProviderTypeAnthropic:
+		return NewAnthropicProvider(config.Name, config.BaseURL, apiKey), nil
+	case settings.ProviderTypeOllama:
+		return NewOllamaProvider(config.Name, config.BaseURL, apiKey), nil
+	default:
+		return nil, fmt.Errorf("unsupported LLM provider type: %s", config.Type)
+	}
+}
+
+// Register adds a provider, replacing any provider with the same name
+func (r *Registry) Register(provider Provider) {
+	if _, exists := r.providers[provider.Name()]; !exists {
+		r.names = append(r.names, provider.Name())
+	}
+	r.providers[provider.Name()] = provider
+}
+
+// Get returns the provider registered under name
+func (r *Registry) Get(name string) (Provider, error) {
+	provider, ok := r.providers[name]
+	if !ok {
+		return nil, fmt.Errorf("LLM provider %s is not configured", name)
+	}
+	return provider, nil
+}
+
+// Names returns the names of all registered providers in registration order
+func (r *Registry) Names() []string {
+	names := make([]string, len(r.names))
+	copy(names, r.names)
+	return names
+}
@@ -0,0 +1,73 @@
+package llmproviders
+
+import (
+	"testing"
+
+	"gitlab.cherkaoui.ch/quillium-ai/quillium/src/backend/internal/security"
+	"gitlab.cherkaoui.ch/quillium-ai/quillium/src/backend/internal/settings"
+)
+
+func TestNewRegistryFromSettings(t *testing.T) {
+	if err := security.InitEncryption([]byte("0123456789abcdef0123456789abcdef")); err != nil {
+		t.Fatalf("Failed to initialize encryption: %v", err)
+	}
+	encryptedKey, err := security.EncryptPassword("local-key")
+	if err != nil {
+		t.Fatalf("Failed to encrypt key: %v", err)
+	}
+
+	adminSettings := &settings.AdminSettings{
+		OpenAIBaseURL: "https://api.openai.com/v1",
+		LLMProviders: []settings.LLMProvider{
+			{Name: "local", Type: settings.ProviderTypeOpenAI, BaseURL: "http://localhost:8000/v1", APIKey_encrypt: *encryptedKey},
+			{Name: "broken", Type: settings.ProviderTypeOpenAI, BaseURL: "http://localhost:9000/v1", APIKey_encrypt: "not-encrypted"},
+		},
+	}
+
+	registry, err := NewRegistryFromSettings(adminSettings)
+	if err != nil {
+		t.Fatalf("NewRegistryFromSettings failed: %v", err)
+	}
+
+	// The legacy settings provide the default provider, the broken key is skipped
+	names := registry.Names()
+	if len(names) != 2 || names[0] != settings.DefaultProviderName || names[1] != "local" {
+		t.Fatalf("Unexpected providers: %v", names)
+	}
+
+	provider, err := registry.Get("local")
+	if err != nil {
+		t.Fatalf("Expected local provider, got %v", err)
+	}
+	openAIProvider, ok := provider.(*OpenAIProvider)
+	if !ok {
+		t.Fatalf("Expected an OpenAI provider, got %T", provider)
+	}
+	if openAIProvider.apiKey != "local-key" {
+		t.Errorf("Expected the decrypted API key, got '%s'", openAIProvider.apiKey)
+	}
+
+	if _, err := registry.Get("broken"); err == nil {
+		t.Error("Expected provider with an invalid key to be skipped")
+	}
+}
+
+func TestNewProviderUnknownType(t *testing.T) {
+	_, err := NewProvider(settings.LLMProvider{Name: "x", Type: "unknown", BaseURL: "http://localhost"}, "")
+	if err == nil {
+		t.Error("Expected an error for an unknown provider type")
+	}
+}
+
+func TestNewProviderAnthropic(t *testing.T) {
+	provider, err := NewProvider(settings.LLMProvider{Name: "claude", Type: settings.ProviderTypeAnthropic, BaseURL: "https://api.anthropic.com/v1"}, "key")
+	if err != nil {
+		t.Fatalf("NewProvider failed: %v", err)
+	}
+	if _, ok := provider.(*AnthropicProvider); !ok {
+		t.Errorf("Expected an Anthropic provider, got %T", provider)
+	}
+	if provider.Name() != "claude" {
+		t.Errorf("Expected name 'claude', got '%s'", provider.Name())
+	}
+}
@@ -0,0 +1,65 @@
+package llmproviders
+
+import (
+	"bufio"
+	"io"
+	"strings"
+)
+
+// readSSE reads a server-sent events stream and calls handle with the type and data of every event.
+// Events without an explicit type are reported as "message". Reading stops when handle returns an error.
+func readSSE(r io.Reader, handle func(event string, data string) error) error {
+	scanner := bufio.NewScanner(r)
+
+	// Increase the scanner buffer size to handle large events
+	buf := make([]byte, 64*1024)   // 64KB buffer
+	scanner.Buffer(buf, 1024*1024) // Allow up to 1MB lines
+
+	var event string
+	var data []string
+	dispatch := func() error {
+		if len(data) == 0 {
+			event = ""
+			return nil
+		}
+		if event == "" {
+			event = "message"
+		}
+		err := handle(event, strings.Join(data, "\n"))
+		event = ""
+		data = nil
+		return err
+	}
+
+	for scanner.Scan() {
+		line := strings.TrimSuffix(scanner.Text(), "\r")
+
+		// A blank line ends the current event
+		if line == "" {
+			if err := dispatch(); err != nil {
+				return err
+			}
+			continue
+		}
+
+		// Lines starting with a colon are comments
+		if strings.HasPrefix(line, ":") {
+			continue
+		}
+
+		field, value, _ := strings.Cut(line, ":")
+		value = strings.TrimPrefix(value, " ")
+		switch field {
+		case "event":
+			event = value
+		case "data":
+			data = append(data, value)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+
+	// Dispatch a final event that was not followed by a blank line
+	return dispatch()
+}
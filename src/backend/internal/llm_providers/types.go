@@ -1,16 +1,84 @@
-package llmproviders
-
-import "gitlab.cherkaoui.ch/quillium-ai/quillium/src/backend/internal/chats"
-
-// ChatResponse represents the structured response from the Chat function
-type ChatResponse struct {
-	Content string
-}
-
-// StreamResponse represents a chunk of streaming response from the OpenAI API
-type StreamResponse struct {
-	Content string         // Content chunk
-	Done    bool           // Whether this is the final chunk
-	Sources []chats.Source // Sources for the response, only in final chunk
-	Error   error          // Any error that occurred during streaming
-}
+package llmproviders
+
+import (
+	"context"
+	"net/http"
+)
+
+// Provider is an LLM backend able to generate chat completions
+type Provider interface {
+	// Name returns the name the provider is registered under
+	Name() string
+	// Capabilities describes the optional features supported by the provider
+	Capabilities() Capabilities
+	// ChatStream generates a completion and calls callback for each chunk.
+	// A final chunk with Done set is sent once the completion is finished.
+	ChatStream(ctx context.Context, req ChatRequest, callback func(StreamResponse)) error
+	// Complete generates a completion and returns the full text
+	Complete(ctx context.Context, req ChatRequest) (string, error)
+	// ListModels returns the models available on the provider
+	ListModels(ctx context.Context) ([]Model, error)
+}
+
+// Capabilities are the optional features of a provider
+type Capabilities struct {
+	Streaming    bool `json:"streaming"`     // Responses can be streamed chunk by chunk
+	ModelListing bool `json:"model_listing"` // Available models can be listed
+}
+
+// Message is a single message of a chat completion request
+type Message struct {
+	Role    string `json:"role"` // system, user or assistant
+	Content string `json:"content"`
+}
+
+// ChatRequest is a provider independent chat completion request
+type ChatRequest struct {
+	Model       string
+	Messages    []Message
+	Temperature *float64 // Sampling temperature, the provider default is used when nil
+	MaxTokens   int      // Maximum number of generated tokens, the provider default is used when 0
+}
+
+// Model describes a model available on a provider
+type Model struct {
+	ID      string `json:"id"`
+	OwnedBy string `json:"owned_by,omitempty"`
+}
+
+// StreamResponse represents a chunk of a streaming response
+type StreamResponse struct {
+	Content string // Content chunk
+	Done    bool   // Whether this is the final chunk
+	Error   error  // Any error that occurred during streaming
+}
+
+// Registry holds the configured providers by name
+type Registry struct {
+	providers map[string]Provider
+	names     []string
+}
+
+// OpenAIProvider talks to any server implementing the OpenAI chat completions API
+type OpenAIProvider struct {
+	name       string
+	baseURL    string
+	apiKey     string
+	httpClient *http.Client
+}
+
+// AnthropicProvider talks to the Anthropic Messages API
+type AnthropicProvider struct {
+	name       string
+	baseURL    string
+	apiKey     string
+	httpClient *http.Client
+}
+
+// OllamaProvider talks to the native Ollama API
+type OllamaProvider struct {
+	name       string
+	baseURL    string
+	apiKey     string
+	httpClient *http.Client
+}
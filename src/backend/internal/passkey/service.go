@@ -0,0 +1,138 @@
+// Package passkey runs WebAuthn ceremonies for users and their stored passkeys.
+package passkey
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-webauthn/webauthn/protocol"
+	"github.com/go-webauthn/webauthn/webauthn"
+	"gitlab.cherkaoui.ch/quillium-ai/quillium/src/backend/internal/user"
+)
+
+// RPDisplayName is the relying party name shown by authenticators
+const RPDisplayName = "Quillium"
+
+// CeremonyTimeout is how long a user has to complete a registration or login
+const CeremonyTimeout = 5 * time.Minute
+
+// New returns the WebAuthn relying party for the frontend origin. The relying
+// party ID defaults to the host of the origin, otherwise it must be that host
+// or one of its parent domains.
+func New(origin, rpID string) (*webauthn.WebAuthn, error) {
+	parsed, err := url.Parse(origin)
+	if err != nil || parsed.Hostname() == "" {
+		return nil, errors.New("invalid WebAuthn origin " + origin)
+	}
+	host := parsed.Hostname()
+	if rpID == "" {
+		rpID = host
+	}
+	if host != rpID && !strings.HasSuffix(host, "."+rpID) {
+		return nil, errors.New("WebAuthn relying party ID " + rpID + " does not match origin " + origin)
+	}
+
+	timeout := webauthn.TimeoutConfig{Enforce: true, Timeout: CeremonyTimeout, TimeoutUVD: CeremonyTimeout}
+	relyingParty, err := webauthn.New(&webauthn.Config{
+		RPID:          rpID,
+		RPDisplayName: RPDisplayName,
+		RPOrigins:     []string{origin},
+		AuthenticatorSelection: protocol.AuthenticatorSelection{
+			ResidentKey:        protocol.ResidentKeyRequirementRequired,
+			RequireResidentKey: protocol.ResidentKeyRequired(),
+			UserVerification:   protocol.VerificationRequired,
+		},
+		Timeouts: webauthn.TimeoutsConfig{Login: timeout, Registration: timeout},
+	})
+	if err != nil {
+		return nil, errors.New("failed to configure WebAuthn: " + err.Error())
+	}
+	return relyingParty, nil
+}
+
+// Account is a user with their passkeys, as the WebAuthn ceremonies see them
+type Account struct {
+	User        *user.User
+	Passkeys    []*user.Passkey
+	credentials []webauthn.Credential
+}
+
+var _ webauthn.User = (*Account)(nil)
+
+// NewAccount decodes the stored credentials of the user's passkeys
+func NewAccount(userData *user.User, passkeys []*user.Passkey) (*Account, error) {
+	account := &Account{User: userData, Passkeys: passkeys}
+	for _, passkey := range passkeys {
+		var credential webauthn.Credential
+		if err := json.Unmarshal([]byte(passkey.Credential), &credential); err != nil {
+			return nil, errors.New("failed to decode passkey " + strconv.Itoa(passkey.ID) + ": " + err.Error())
+		}
+		account.credentials = append(account.credentials, credential)
+	}
+	return account, nil
+}
+
+// Passkey returns the passkey of the account with the given credential ID
+func (a *Account) Passkey(credentialID []byte) *user.Passkey {
+	encoded := EncodeCredentialID(credentialID)
+	for _, passkey := range a.Passkeys {
+		if passkey.CredentialID == encoded {
+			return passkey
+		}
+	}
+	return nil
+}
+
+// WebAuthnID returns the user handle, which is the user ID
+func (a *Account) WebAuthnID() []byte {
+	return UserHandle(*a.User.ID)
+}
+
+// WebAuthnName returns the email the passkey is saved under
+func (a *Account) WebAuthnName() string {
+	return a.User.Email
+}
+
+// WebAuthnDisplayName returns the username
+func (a *Account) WebAuthnDisplayName() string {
+	return a.User.Username
+}
+
+// WebAuthnCredentials returns the credentials of the passkeys
+func (a *Account) WebAuthnCredentials() []webauthn.Credential {
+	return a.credentials
+}
+
+// UserHandle returns the WebAuthn user handle of a user. It carries no
+// personal information, only the user ID.
+func UserHandle(userID int) []byte {
+	return []byte(strconv.Itoa(userID))
+}
+
+// ParseUserHandle returns the user ID of a user handle
+func ParseUserHandle(handle []byte) (int, error) {
+	userID, err := strconv.Atoi(string(handle))
+	if err != nil {
+		return 0, errors.New("invalid user handle")
+	}
+	return userID, nil
+}
+
+// EncodeCredentialID returns the credential ID a passkey is stored under
+func EncodeCredentialID(credentialID []byte) string {
+	return base64.RawURLEncoding.EncodeToString(credentialID)
+}
+
+// EncodeCredential returns the JSON a credential is stored as
+func EncodeCredential(credential *webauthn.Credential) (string, error) {
+	credentialJSON, err := json.Marshal(credential)
+	if err != nil {
+		return "", errors.New("failed to encode passkey: " + err.Error())
+	}
+	return string(credentialJSON), nil
+}
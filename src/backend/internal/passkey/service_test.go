@@ -0,0 +1,69 @@
+package passkey_test
+
+import (
+	"testing"
+
+	"github.com/go-webauthn/webauthn/webauthn"
+	"gitlab.cherkaoui.ch/quillium-ai/quillium/src/backend/internal/passkey"
+	"gitlab.cherkaoui.ch/quillium-ai/quillium/src/backend/internal/user"
+)
+
+func TestNew(t *testing.T) {
+	relyingParty, err := passkey.New("https://chat.example.com:8443", "")
+	if err != nil {
+		t.Fatalf("Failed to configure relying party: %v", err)
+	}
+	if relyingParty.Config.RPID != "chat.example.com" {
+		t.Errorf("Expected the relying party ID to default to the host, got %q", relyingParty.Config.RPID)
+	}
+
+	relyingParty, err = passkey.New("https://chat.example.com", "example.com")
+	if err != nil || relyingParty.Config.RPID != "example.com" {
+		t.Errorf("Expected the configured relying party ID, got %v", err)
+	}
+
+	// The relying party ID must be a registrable suffix of the origin
+	if _, err := passkey.New("https://chat.example.com", "other.com"); err == nil {
+		t.Error("Expected a foreign relying party ID to be rejected")
+	}
+	if _, err := passkey.New("not a url", ""); err == nil {
+		t.Error("Expected an invalid origin to be rejected")
+	}
+}
+
+func TestAccount(t *testing.T) {
+	userID := 42
+	credential := &webauthn.Credential{ID: []byte{0xfb, 0xff, 0x01}, PublicKey: []byte{1, 2, 3}}
+	credentialJSON, err := passkey.EncodeCredential(credential)
+	if err != nil {
+		t.Fatalf("Failed to encode credential: %v", err)
+	}
+	stored := &user.Passkey{ID: 7, UserID: userID, CredentialID: passkey.EncodeCredentialID(credential.ID), Credential: credentialJSON}
+	if stored.CredentialID != "-_8B" {
+		t.Errorf("Expected an unpadded base64url credential ID, got %q", stored.CredentialID)
+	}
+
+	account, err := passkey.NewAccount(&user.User{ID: &userID, Email: "user@example.com", Username: "user"}, []*user.Passkey{stored})
+	if err != nil {
+		t.Fatalf("Failed to create account: %v", err)
+	}
+	if len(account.WebAuthnCredentials()) != 1 || string(account.WebAuthnCredentials()[0].PublicKey) != string(credential.PublicKey) {
+		t.Errorf("Unexpected credentials: %+v", account.WebAuthnCredentials())
+	}
+	if account.Passkey(credential.ID) != stored || account.Passkey([]byte("other")) != nil {
+		t.Error("Expected passkeys to be found by credential ID")
+	}
+
+	handledID, err := passkey.ParseUserHandle(account.WebAuthnID())
+	if err != nil || handledID != userID {
+		t.Errorf("Expected the user handle to carry user ID %d, got %d, %v", userID, handledID, err)
+	}
+	if _, err := passkey.ParseUserHandle([]byte("user@example.com")); err == nil {
+		t.Error("Expected an invalid user handle to be rejected")
+	}
+
+	stored.Credential = "{"
+	if _, err := passkey.NewAccount(account.User, []*user.Passkey{stored}); err == nil {
+		t.Error("Expected a corrupt credential to be rejected")
+	}
+}
@@ -0,0 +1,191 @@
+package search
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"gitlab.cherkaoui.ch/quillium-ai/quillium/src/backend/internal/chats"
+	"gitlab.cherkaoui.ch/quillium-ai/quillium/src/backend/internal/settings"
+)
+
+// maxSnippetLength is the maximum number of characters kept from a document
+// when no highlight is available
+const maxSnippetLength = 500
+
+// NewClient creates a new Elasticsearch client for the given index
+func NewClient(baseURL string, username string, password string, index string) *Client {
+	if index == "" {
+		index = DefaultIndex
+	}
+	return &Client{
+		baseURL:    strings.TrimRight(baseURL, "/"),
+		username:   username,
+		password:   password,
+		index:      index,
+		httpClient: &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+// NewClientFromSettings creates a client using the Elasticsearch configuration in the admin settings
+func NewClientFromSettings(adminSettings *settings.AdminSettings) (*Client, error) {
+	if adminSettings == nil || adminSettings.ElasticsearchURL == "" {
+		return nil, errors.New("elasticsearch is not configured")
+	}
+	return NewClient(
+		adminSettings.ElasticsearchURL,
+		adminSettings.ElasticsearchUsername,
+		adminSettings.ElasticsearchPassword,
+		adminSettings.ElasticsearchIndex,
+	), nil
+}
+
+// Search runs a full text query against the index and returns up to size results
+func (c *Client) Search(ctx context.Context, query string, size int) ([]Result, error) {
+	if strings.TrimSpace(query) == "" {
+		return []Result{}, nil
+	}
+	if size <= 0 {
+		size = 5
+	}
+
+	body := map[string]interface{}{
+		"size": size,
+		"query": map[string]interface{}{
+			"multi_match": map[string]interface{}{
+				"query":  query,
+				"fields": []string{"title^3", "description^2", "content"},
+			},
+		},
+		"highlight": map[string]interface{}{
+			"fields": map[string]interface{}{
+				"content": map[string]interface{}{
+					"fragment_size":       200,
+					"number_of_fragments": 3,
+				},
+			},
+		},
+	}
+
+	var resp searchResponse
+	if err := c.do(ctx, http.MethodPost, "/"+url.PathEscape(c.index)+"/_search", body, &resp); err != nil {
+		return nil, err
+	}
+
+	results := make([]Result, 0, len(resp.Hits.Hits))
+	for _, hit := range resp.Hits.Hits {
+		results = append(results, Result{
+			ID:          hit.ID,
+			Title:       hit.Source.Title,
+			URL:         hit.Source.URL,
+			Description: hit.Source.Description,
+			Snippet:     buildSnippet(hit.Source, hit.Highlight["content"]),
+			Score:       hit.Score,
+		})
+	}
+	return results, nil
+}
+
+// IndexDocument stores a document under the given ID, replacing any previous version
+func (c *Client) IndexDocument(ctx context.Context, id string, doc Document) error {
+	return c.do(ctx, http.MethodPut, "/"+url.PathEscape(c.index)+"/_doc/"+url.PathEscape(id), doc, nil)
+}
+
+// do sends a JSON request to Elasticsearch and decodes the JSON response into out
+func (c *Client) do(ctx context.Context, method string, path string, body interface{}, out interface{}) error {
+	var reader io.Reader
+	if body != nil {
+		payload, err := json.Marshal(body)
+		if err != nil {
+			return fmt.Errorf("failed to encode elasticsearch request: %w", err)
+		}
+		reader = bytes.NewReader(payload)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, c.baseURL+path, reader)
+	if err != nil {
+		return fmt.Errorf("failed to create elasticsearch request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "application/json")
+	if c.username != "" || c.password != "" {
+		req.SetBasicAuth(c.username, c.password)
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("elasticsearch request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		respBody, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		return fmt.Errorf("elasticsearch error: %s: %s", resp.Status, strings.TrimSpace(string(respBody)))
+	}
+
+	if out == nil {
+		return nil
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("failed to decode elasticsearch response: %w", err)
+	}
+	return nil
+}
+
+// buildSnippet picks the most relevant text passage of a document
+func buildSnippet(doc Document, highlights []string) string {
+	if len(highlights) > 0 {
+		snippet := strings.Join(highlights, " ... ")
+		snippet = strings.ReplaceAll(snippet, "<em>", "")
+		return strings.ReplaceAll(snippet, "</em>", "")
+	}
+	text := doc.Content
+	if text == "" {
+		text = doc.Description
+	}
+	return truncate(strings.Join(strings.Fields(text), " "), maxSnippetLength)
+}
+
+// truncate shortens s to at most max characters without splitting a rune
+func truncate(s string, max int) string {
+	runes := []rune(s)
+	if len(runes) <= max {
+		return s
+	}
+	return string(runes[:max]) + "..."
+}
+
+// ToSources converts search results into chat sources for the given message number
+func ToSources(results []Result, msgNum int) []chats.Source {
+	sources := make([]chats.Source, 0, len(results))
+	for _, result := range results {
+		description := result.Description
+		if description == "" {
+			description = truncate(result.Snippet, 200)
+		}
+		sources = append(sources, chats.Source{
+			Title:       result.Title,
+			URL:         result.URL,
+			Description: description,
+			MsgNum:      msgNum,
+		})
+	}
+	return sources
+}
+
+// ToIndexResults formats search results as numbered text passages for the LLM.
+// The numbers match the position of the corresponding source so the model can cite them.
+func ToIndexResults(results []Result) []string {
+	indexResults := make([]string, 0, len(results))
+	for i, result := range results {
+		indexResults = append(indexResults, fmt.Sprintf("[%d] %s (%s)\n%s", i+1, result.Title, result.URL, result.Snippet))
+	}
+	return indexResults
+}
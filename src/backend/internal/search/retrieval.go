@@ -0,0 +1,213 @@
+package search
+
+import (
+	"context"
+	"log"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"unicode"
+
+	"gitlab.cherkaoui.ch/quillium-ai/quillium/src/backend/internal/settings"
+)
+
+// stopWords are dropped when turning a question into a keyword query
+var stopWords = map[string]bool{
+	"a": true, "an": true, "and": true, "are": true, "as": true, "at": true, "be": true,
+	"by": true, "can": true, "could": true, "did": true, "do": true, "does": true, "for": true,
+	"from": true, "how": true, "i": true, "in": true, "is": true, "it": true, "me": true,
+	"of": true, "on": true, "or": true, "please": true, "should": true, "tell": true, "the": true,
+	"this": true, "to": true, "was": true, "what": true, "when": true, "where": true, "which": true,
+	"who": true, "why": true, "will": true, "with": true, "would": true, "you": true,
+}
+
+// KeywordQuery reduces a natural language question to its significant terms
+func KeywordQuery(query string) string {
+	terms := queryTerms(query)
+	if len(terms) == 0 {
+		return strings.TrimSpace(query)
+	}
+	return strings.Join(terms, " ")
+}
+
+// queryTerms splits a query into lowercase terms without punctuation or stop words
+func queryTerms(query string) []string {
+	words := strings.FieldsFunc(strings.ToLower(query), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsNumber(r)
+	})
+	terms := make([]string, 0, len(words))
+	for _, word := range words {
+		if !stopWords[word] {
+			terms = append(terms, word)
+		}
+	}
+	return terms
+}
+
+// Retrieve runs the retrieval strategy described by the profile.
+// Without query rewriting the question is reduced to a keyword query. With query rewriting
+// the generator produces a search query, and with sub-queries it produces additional queries
+// whose results are merged. Results are always deduplicated by URL and reranked when the
+// profile asks for it. The generator may be nil, in which case the keyword query is used.
+func Retrieve(ctx context.Context, searcher Searcher, query string, profile settings.RetrievalProfile, generate QueryGenerator) ([]Result, error) {
+	queries := buildQueries(ctx, query, profile, generate)
+	log.Printf("Retrieving with %d queries: %q", len(queries), queries)
+
+	// Search all queries concurrently, the first query keeps priority when merging
+	resultSets := make([][]Result, len(queries))
+	errs := make([]error, len(queries))
+	var wg sync.WaitGroup
+	for i, q := range queries {
+		wg.Add(1)
+		go func(i int, q string) {
+			defer wg.Done()
+			resultSets[i], errs[i] = searcher.Search(ctx, q, profile.MaxResults)
+		}(i, q)
+	}
+	wg.Wait()
+
+	var merged []Result
+	var firstErr error
+	for i, results := range resultSets {
+		if errs[i] != nil {
+			log.Printf("Error searching for %q: %v", queries[i], errs[i])
+			if firstErr == nil {
+				firstErr = errs[i]
+			}
+			continue
+		}
+		merged = append(merged, results...)
+	}
+
+	// Only fail when every query failed
+	if len(merged) == 0 && firstErr != nil {
+		return nil, firstErr
+	}
+
+	results := Deduplicate(merged)
+	if profile.Rerank {
+		results = Rerank(query, results)
+	}
+	if len(results) > profile.MaxResults {
+		results = results[:profile.MaxResults]
+	}
+	return results, nil
+}
+
+// buildQueries returns the search queries to run for the profile
+func buildQueries(ctx context.Context, query string, profile settings.RetrievalProfile, generate QueryGenerator) []string {
+	primary := KeywordQuery(query)
+	if generate == nil {
+		return []string{primary}
+	}
+
+	if profile.QueryRewrite {
+		rewritten, err := generate(ctx, query, 1)
+		if err != nil {
+			log.Printf("Error rewriting query, using keywords instead: %v", err)
+		} else if len(rewritten) > 0 {
+			primary = rewritten[0]
+		}
+	}
+
+	queries := []string{primary}
+	if profile.SubQueries > 0 {
+		expanded, err := generate(ctx, query, profile.SubQueries)
+		if err != nil {
+			log.Printf("Error expanding query: %v", err)
+		}
+		for _, q := range expanded {
+			if !containsFold(queries, q) {
+				queries = append(queries, q)
+			}
+		}
+	}
+	return queries
+}
+
+// containsFold reports whether list contains s, ignoring case
+func containsFold(list []string, s string) bool {
+	for _, item := range list {
+		if strings.EqualFold(item, s) {
+			return true
+		}
+	}
+	return false
+}
+
+// Deduplicate removes results pointing to the same page, keeping the first occurrence
+func Deduplicate(results []Result) []Result {
+	seen := make(map[string]bool, len(results))
+	unique := make([]Result, 0, len(results))
+	for _, result := range results {
+		key := normalizeURL(result.URL)
+		if key == "" {
+			key = "id:" + result.ID
+		}
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+		unique = append(unique, result)
+	}
+	return unique
+}
+
+// normalizeURL returns a comparable form of a URL, ignoring scheme, fragment and trailing slash
+func normalizeURL(rawURL string) string {
+	parsed, err := url.Parse(strings.TrimSpace(rawURL))
+	if err != nil || parsed.Host == "" {
+		return strings.ToLower(strings.TrimSpace(rawURL))
+	}
+	host := strings.TrimPrefix(strings.ToLower(parsed.Host), "www.")
+	path := strings.TrimRight(parsed.EscapedPath(), "/")
+	normalized := host + path
+	if parsed.RawQuery != "" {
+		normalized += "?" + parsed.RawQuery
+	}
+	return normalized
+}
+
+// Rerank orders results by how well they cover the terms of the original question.
+// The Elasticsearch score is kept as a tie breaker since scores from different
+// queries are not directly comparable.
+func Rerank(query string, results []Result) []Result {
+	terms := queryTerms(query)
+	if len(terms) == 0 {
+		return results
+	}
+
+	type scored struct {
+		result   Result
+		coverage float64
+	}
+	scoredResults := make([]scored, len(results))
+	for i, result := range results {
+		title := strings.ToLower(result.Title)
+		body := strings.ToLower(result.Description + " " + result.Snippet)
+		var coverage float64
+		for _, term := range terms {
+			if strings.Contains(title, term) {
+				coverage += 2
+			}
+			if strings.Contains(body, term) {
+				coverage++
+			}
+		}
+		scoredResults[i] = scored{result: result, coverage: coverage / float64(3*len(terms))}
+	}
+
+	sort.SliceStable(scoredResults, func(i, j int) bool {
+		if scoredResults[i].coverage != scoredResults[j].coverage {
+			return scoredResults[i].coverage > scoredResults[j].coverage
+		}
+		return scoredResults[i].result.Score > scoredResults[j].result.Score
+	})
+
+	reranked := make([]Result, len(scoredResults))
+	for i, s := range scoredResults {
+		reranked[i] = s.result
+	}
+	return reranked
+}
@@ -0,0 +1,301 @@
+package search
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"gitlab.cherkaoui.ch/quillium-ai/quillium/src/backend/internal/settings"
+)
+
+// newTestElasticsearch starts a stand-in for the Elasticsearch _search API
+func newTestElasticsearch(t *testing.T, handler func(t *testing.T, body map[string]interface{}) string) *httptest.Server {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost || r.URL.Path != "/quillium/_search" {
+			t.Errorf("Unexpected request: %s %s", r.Method, r.URL.Path)
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+
+		username, password, ok := r.BasicAuth()
+		if !ok || username != "elastic" || password != "changeme" {
+			w.WriteHeader(http.StatusUnauthorized)
+			w.Write([]byte(`{"error":"security_exception"}`))
+			return
+		}
+
+		var body map[string]interface{}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			t.Errorf("Failed to decode search request: %v", err)
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(handler(t, body)))
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestSearch(t *testing.T) {
+	server := newTestElasticsearch(t, func(t *testing.T, body map[string]interface{}) string {
+		if body["size"] != float64(3) {
+			t.Errorf("Expected size 3, got %v", body["size"])
+		}
+		query := body["query"].(map[string]interface{})["multi_match"].(map[string]interface{})
+		if query["query"] != "what is go" {
+			t.Errorf("Expected query 'what is go', got %v", query["query"])
+		}
+		return `{
+			"hits": {
+				"hits": [
+					{
+						"_id": "1",
+						"_score": 3.2,
+						"_source": {"title": "Go", "url": "https://go.dev", "description": "The Go language", "content": "Go is an open source programming language."},
+						"highlight": {"content": ["<em>Go</em> is an open source programming language."]}
+					},
+					{
+						"_id": "2",
+						"_score": 1.5,
+						"_source": {"title": "Go FAQ", "url": "https://go.dev/doc/faq", "description": "", "content": "Frequently asked questions about Go."}
+					}
+				]
+			}
+		}`
+	})
+
+	client := NewClient(server.URL, "elastic", "changeme", "")
+	results, err := client.Search(context.Background(), "what is go", 3)
+	if err != nil {
+		t.Fatalf("Search failed: %v", err)
+	}
+
+	if len(results) != 2 {
+		t.Fatalf("Expected 2 results, got %d", len(results))
+	}
+	if results[0].Title != "Go" || results[0].URL != "https://go.dev" {
+		t.Errorf("Unexpected first result: %+v", results[0])
+	}
+	if results[0].Snippet != "Go is an open source programming language." {
+		t.Errorf("Expected highlight to be used as snippet without markup, got %q", results[0].Snippet)
+	}
+	if results[1].Snippet != "Frequently asked questions about Go." {
+		t.Errorf("Expected content to be used as snippet, got %q", results[1].Snippet)
+	}
+}
+
+func TestSearchError(t *testing.T) {
+	server := newTestElasticsearch(t, func(t *testing.T, body map[string]interface{}) string {
+		return `{}`
+	})
+
+	client := NewClient(server.URL, "elastic", "wrong", "")
+	_, err := client.Search(context.Background(), "what is go", 3)
+	if err == nil {
+		t.Fatal("Expected an error for invalid credentials, got nil")
+	}
+	if !strings.Contains(err.Error(), "401") {
+		t.Errorf("Expected error to contain the status code, got %v", err)
+	}
+}
+
+func TestIndexDocument(t *testing.T) {
+	var received Document
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPut || r.URL.Path != "/pages/_doc/abc123" {
+			t.Errorf("Unexpected request: %s %s", r.Method, r.URL.Path)
+		}
+		if err := json.NewDecoder(r.Body).Decode(&received); err != nil {
+			t.Errorf("Failed to decode document: %v", err)
+		}
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte(`{"result":"created"}`))
+	}))
+	defer server.Close()
+
+	client := NewClient(server.URL, "", "", "pages")
+	doc := Document{Title: "Go", URL: "https://go.dev", Description: "The Go language", Content: "Build simple software"}
+	if err := client.IndexDocument(context.Background(), "abc123", doc); err != nil {
+		t.Fatalf("IndexDocument failed: %v", err)
+	}
+	if received != doc {
+		t.Errorf("Expected %+v to be indexed, got %+v", doc, received)
+	}
+}
+
+func TestNewClientFromSettings(t *testing.T) {
+	_, err := NewClientFromSettings(&settings.AdminSettings{})
+	if err == nil {
+		t.Error("Expected an error when Elasticsearch is not configured")
+	}
+
+	client, err := NewClientFromSettings(&settings.AdminSettings{
+		ElasticsearchURL:      "http://localhost:9200/",
+		ElasticsearchUsername: "elastic",
+		ElasticsearchPassword: "changeme",
+	})
+	if err != nil {
+		t.Fatalf("Failed to create client: %v", err)
+	}
+	if client.baseURL != "http://localhost:9200" {
+		t.Errorf("Expected trailing slash to be trimmed, got %s", client.baseURL)
+	}
+	if client.index != DefaultIndex {
+		t.Errorf("Expected default index %s, got %s", DefaultIndex, client.index)
+	}
+}
+
+func TestToSourcesAndIndexResults(t *testing.T) {
+	results := []Result{
+		{Title: "Go", URL: "https://go.dev", Description: "The Go language", Snippet: "Go is fast."},
+		{Title: "Rust", URL: "https://rust-lang.org", Snippet: "Rust is safe."},
+	}
+
+	sources := ToSources(results, 2)
+	if len(sources) != 2 {
+		t.Fatalf("Expected 2 sources, got %d", len(sources))
+	}
+	if sources[0].MsgNum != 2 || sources[0].Description != "The Go language" {
+		t.Errorf("Unexpected first source: %+v", sources[0])
+	}
+	if sources[1].Description != "Rust is safe." {
+		t.Errorf("Expected snippet as fallback description, got %q", sources[1].Description)
+	}
+
+	indexResults := ToIndexResults(results)
+	if len(indexResults) != 2 {
+		t.Fatalf("Expected 2 index results, got %d", len(indexResults))
+	}
+	if !strings.HasPrefix(indexResults[1], "[2] Rust (https://rust-lang.org)") {
+		t.Errorf("Expected numbered index result, got %q", indexResults[1])
+	}
+}
+
+// fakeSearcher returns canned results per query and records the queries it received
+type fakeSearcher struct {
+	mu      sync.Mutex
+	results map[string][]Result
+	queries []string
+}
+
+func (f *fakeSearcher) Search(ctx context.Context, query string, size int) ([]Result, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.queries = append(f.queries, query)
+	results := f.results[query]
+	if len(results) > size {
+		results = results[:size]
+	}
+	return results, nil
+}
+
+func TestKeywordQuery(t *testing.T) {
+	keywords := KeywordQuery("What is the capital of France?")
+	if keywords != "capital france" {
+		t.Errorf("Expected 'capital france', got %q", keywords)
+	}
+
+	// A query made only of stop words is kept as is
+	if KeywordQuery("who is it") != "who is it" {
+		t.Errorf("Expected query to be kept when it has no keywords")
+	}
+}
+
+func TestRetrieveSpeedProfile(t *testing.T) {
+	searcher := &fakeSearcher{results: map[string][]Result{
+		"capital france": {
+			{Title: "Paris", URL: "https://example.com/paris"},
+			{Title: "France", URL: "https://example.com/france"},
+			{Title: "Lyon", URL: "https://example.com/lyon"},
+		},
+	}}
+	generatorCalled := false
+	generate := func(ctx context.Context, question string, n int) ([]string, error) {
+		generatorCalled = true
+		return nil, nil
+	}
+
+	profile := settings.RetrievalProfile{MaxResults: 2}
+	results, err := Retrieve(context.Background(), searcher, "What is the capital of France?", profile, generate)
+	if err != nil {
+		t.Fatalf("Retrieve failed: %v", err)
+	}
+
+	if generatorCalled {
+		t.Error("Speed profile should not call the query generator")
+	}
+	if len(searcher.queries) != 1 || searcher.queries[0] != "capital france" {
+		t.Errorf("Expected a single keyword query, got %q", searcher.queries)
+	}
+	if len(results) != 2 {
+		t.Errorf("Expected 2 results, got %d", len(results))
+	}
+}
+
+func TestRetrieveQualityProfile(t *testing.T) {
+	searcher := &fakeSearcher{results: map[string][]Result{
+		"capital of france": {
+			{Title: "Lyon", URL: "https://example.com/lyon", Snippet: "A city in France", Score: 5},
+			{Title: "Paris", URL: "https://example.com/paris", Snippet: "The capital of France", Score: 2},
+		},
+		"paris capital city": {
+			{Title: "Paris", URL: "https://www.example.com/paris/", Snippet: "Paris is the capital", Score: 9},
+		},
+		"france government seat": {
+			{Title: "Capital of France", URL: "https://example.com/capital", Snippet: "The capital of France is Paris", Score: 1},
+		},
+	}}
+	generate := func(ctx context.Context, question string, n int) ([]string, error) {
+		if n == 1 {
+			return []string{"capital of france"}, nil
+		}
+		return []string{"paris capital city", "france government seat", "Capital of France"}, nil
+	}
+
+	profile := settings.RetrievalProfile{MaxResults: 10, QueryRewrite: true, SubQueries: 3, Rerank: true}
+	results, err := Retrieve(context.Background(), searcher, "What is the capital of France?", profile, generate)
+	if err != nil {
+		t.Fatalf("Retrieve failed: %v", err)
+	}
+
+	// The duplicated expansion query is only searched once
+	if len(searcher.queries) != 3 {
+		t.Errorf("Expected 3 distinct queries, got %q", searcher.queries)
+	}
+
+	// The Paris page is returned by two queries with different URL forms
+	if len(results) != 3 {
+		t.Fatalf("Expected 3 deduplicated results, got %d: %+v", len(results), results)
+	}
+
+	// Results covering the question terms in the title come first
+	if results[0].Title != "Capital of France" {
+		t.Errorf("Expected 'Capital of France' to be ranked first, got %q", results[0].Title)
+	}
+	if results[len(results)-1].Title != "Lyon" {
+		t.Errorf("Expected 'Lyon' to be ranked last, got %q", results[len(results)-1].Title)
+	}
+}
+
+func TestRetrieveGeneratorError(t *testing.T) {
+	searcher := &fakeSearcher{results: map[string][]Result{
+		"capital france": {{Title: "Paris", URL: "https://example.com/paris"}},
+	}}
+	generate := func(ctx context.Context, question string, n int) ([]string, error) {
+		return nil, errors.New("model unavailable")
+	}
+
+	profile := settings.RetrievalProfile{MaxResults: 5, QueryRewrite: true, SubQueries: 2}
+	results, err := Retrieve(context.Background(), searcher, "What is the capital of France?", profile, generate)
+	if err != nil {
+		t.Fatalf("Retrieve failed: %v", err)
+	}
+	if len(results) != 1 {
+		t.Errorf("Expected fallback to the keyword query, got %d results", len(results))
+	}
+}
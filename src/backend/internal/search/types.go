@@ -0,0 +1,57 @@
+package search
+
+import (
+	"context"
+	"net/http"
+)
+
+// DefaultIndex is the Elasticsearch index queried when none is configured
+const DefaultIndex = "quillium"
+
+// Client queries an Elasticsearch index through its REST API
+type Client struct {
+	baseURL    string
+	username   string
+	password   string
+	index      string
+	httpClient *http.Client
+}
+
+// Searcher is implemented by anything that can look up documents for a query
+type Searcher interface {
+	Search(ctx context.Context, query string, size int) ([]Result, error)
+}
+
+// QueryGenerator produces up to n search queries for a user question.
+// It is used for query rewriting (n = 1) and multi-query expansion.
+type QueryGenerator func(ctx context.Context, question string, n int) ([]string, error)
+
+// Result represents a single document returned by the index
+type Result struct {
+	ID          string  // Elasticsearch document ID
+	Title       string  // Title of the page
+	URL         string  // URL of the page
+	Description string  // Short description of the page
+	Snippet     string  // Text passage relevant to the query
+	Score       float64 // Relevance score reported by Elasticsearch
+}
+
+// Document represents the fields stored for each page in the index
+type Document struct {
+	Title       string `json:"title"`
+	URL         string `json:"url"`
+	Description string `json:"description"`
+	Content     string `json:"content"`
+}
+
+// searchResponse is the subset of the _search response that we use
+type searchResponse struct {
+	Hits struct {
+		Hits []struct {
+			ID        string              `json:"_id"`
+			Score     float64             `json:"_score"`
+			Source    Document            `json:"_source"`
+			Highlight map[string][]string `json:"highlight"`
+		} `json:"hits"`
+	} `json:"hits"`
+}
@@ -1,37 +1,304 @@
-package settings
-
-import "encoding/json"
-
-func (s *UserSettings) ToJSON() (string, error) {
-	jsonStr, err := json.Marshal(s)
-	if err != nil {
-		return "", err
-	}
-	return string(jsonStr), nil
-}
-
-func (s *UserSettings) FromJSON(jsonStr string) (*UserSettings, error) {
-	var settings UserSettings
-	err := json.Unmarshal([]byte(jsonStr), &settings)
-	if err != nil {
-		return nil, err
-	}
-	return &settings, nil
-}
-
-func (s *AdminSettings) ToJSON() (string, error) {
-	jsonStr, err := json.Marshal(s)
-	if err != nil {
-		return "", err
-	}
-	return string(jsonStr), nil
-}
-
-func (s *AdminSettings) FromJSON(jsonStr string) (*AdminSettings, error) {
-	var settings AdminSettings
-	err := json.Unmarshal([]byte(jsonStr), &settings)
-	if err != nil {
-		return nil, err
-	}
-	return &settings, nil
-}
+package settings
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+func (s *UserSettings) ToJSON() (string, error) {
+	jsonStr, err := json.Marshal(s)
+	if err != nil {
+		return "", err
+	}
+	return string(jsonStr), nil
+}
+
+func (s *UserSettings) FromJSON(jsonStr string) (*UserSettings, error) {
+	var settings UserSettings
+	err := json.Unmarshal([]byte(jsonStr), &settings)
+	if err != nil {
+		return nil, err
+	}
+	return &settings, nil
+}
+
+func (s *AdminSettings) ToJSON() (string, error) {
+	jsonStr, err := json.Marshal(s)
+	if err != nil {
+		return "", err
+	}
+	return string(jsonStr), nil
+}
+
+func (s *AdminSettings) FromJSON(jsonStr string) (*AdminSettings, error) {
+	var settings AdminSettings
+	err := json.Unmarshal([]byte(jsonStr), &settings)
+	if err != nil {
+		return nil, err
+	}
+	return &settings, nil
+}
+
+// Context limits used for models without metadata, small enough for most models
+const (
+	DefaultContextWindow   = 8192
+	DefaultMaxOutputTokens = 1024
+)
+
+// DefaultRetrievalProfile returns the built-in retrieval strategy for a quality profile
+func DefaultRetrievalProfile(qualityProfile string) RetrievalProfile {
+	switch qualityProfile {
+	case QualityProfileSpeed:
+		return RetrievalProfile{MaxResults: 3}
+	case QualityProfileQuality:
+		return RetrievalProfile{MaxResults: 10, QueryRewrite: true, SubQueries: 3, Rerank: true}
+	default: // balanced
+		return RetrievalProfile{MaxResults: 6, QueryRewrite: true}
+	}
+}
+
+// GetRetrievalProfile returns the retrieval strategy configured for a quality profile.
+// Profiles that were never configured fall back to the built-in defaults.
+func (s *AdminSettings) GetRetrievalProfile(qualityProfile string) RetrievalProfile {
+	var profile RetrievalProfile
+	switch qualityProfile {
+	case QualityProfileSpeed:
+		profile = s.RetrievalProfileSpeed
+	case QualityProfileQuality:
+		profile = s.RetrievalProfileQuality
+	default: // balanced
+		profile = s.RetrievalProfileBalanced
+	}
+	if profile.MaxResults == 0 {
+		return DefaultRetrievalProfile(qualityProfile)
+	}
+	return profile
+}
+
+// DefaultGenerationLimits returns the built-in sampling limits, shared by all quality profiles
+func DefaultGenerationLimits() GenerationLimits {
+	return GenerationLimits{MinTemperature: 0, MaxTemperature: 1, MinMaxTokens: 16, MaxMaxTokens: 4096}
+}
+
+// GetGenerationLimits returns the sampling limits configured for a quality profile.
+// Profiles that were never configured fall back to the built-in defaults.
+func (s *AdminSettings) GetGenerationLimits(qualityProfile string) GenerationLimits {
+	var limits GenerationLimits
+	switch qualityProfile {
+	case QualityProfileSpeed:
+		limits = s.GenerationLimitsSpeed
+	case QualityProfileQuality:
+		limits = s.GenerationLimitsQuality
+	default: // balanced
+		limits = s.GenerationLimitsBalanced
+	}
+	if limits == (GenerationLimits{}) {
+		return DefaultGenerationLimits()
+	}
+	return limits
+}
+
+// Validate checks that the limits are consistent
+func (l *GenerationLimits) Validate() error {
+	if l.MinTemperature < 0 || l.MaxTemperature > 2 || l.MinTemperature > l.MaxTemperature {
+		return errors.New("temperature limits must satisfy 0 <= min_temperature <= max_temperature <= 2")
+	}
+	if l.MinMaxTokens < 1 || l.MinMaxTokens > l.MaxMaxTokens {
+		return errors.New("token limits must satisfy 1 <= min_max_tokens <= max_max_tokens")
+	}
+	return nil
+}
+
+// CheckTemperature returns an error when a requested temperature is outside the limits
+func (l *GenerationLimits) CheckTemperature(temperature float64) error {
+	if temperature < l.MinTemperature || temperature > l.MaxTemperature {
+		return fmt.Errorf("temperature must be between %g and %g", l.MinTemperature, l.MaxTemperature)
+	}
+	return nil
+}
+
+// CheckMaxTokens returns an error when a requested max_tokens is outside the limits
+func (l *GenerationLimits) CheckMaxTokens(maxTokens int) error {
+	if maxTokens < l.MinMaxTokens || maxTokens > l.MaxMaxTokens {
+		return fmt.Errorf("maxTokens must be between %d and %d", l.MinMaxTokens, l.MaxMaxTokens)
+	}
+	return nil
+}
+
+// GetLLMProfile returns the provider and model configured for a quality profile.
+// Profiles without a provider use the default provider.
+func (s *AdminSettings) GetLLMProfile(qualityProfile string) LLMModel {
+	var model LLMModel
+	switch qualityProfile {
+	case QualityProfileSpeed:
+		model = LLMModel{Provider: s.LLMProviderSpeed, Model: s.LLMProfileSpeed}
+	case QualityProfileQuality:
+		model = LLMModel{Provider: s.LLMProviderQuality, Model: s.LLMProfileQuality}
+	default: // balanced
+		model = LLMModel{Provider: s.LLMProviderBalanced, Model: s.LLMProfileBalanced}
+	}
+	if model.Provider == "" {
+		model.Provider = DefaultProviderName
+	}
+	return model
+}
+
+// GetLLMProviders returns all configured providers.
+// The legacy OpenAI settings are exposed as the default provider unless a provider with that name exists.
+func (s *AdminSettings) GetLLMProviders() []LLMProvider {
+	providers := make([]LLMProvider, 0, len(s.LLMProviders)+1)
+	if s.OpenAIBaseURL != "" && s.findLLMProvider(DefaultProviderName) == nil {
+		providers = append(providers, LLMProvider{
+			Name:           DefaultProviderName,
+			Type:           ProviderTypeOpenAI,
+			BaseURL:        s.OpenAIBaseURL,
+			APIKey_encrypt: s.OpenAIAPIKey_encrypt,
+		})
+	}
+	return append(providers, s.LLMProviders...)
+}
+
+// GetLLMProvider returns the provider with the given name
+func (s *AdminSettings) GetLLMProvider(name string) (*LLMProvider, error) {
+	for _, provider := range s.GetLLMProviders() {
+		if provider.Name == name {
+			return &provider, nil
+		}
+	}
+	return nil, errors.New("unknown LLM provider: " + name)
+}
+
+// findLLMProvider looks up a provider in the configured list only
+func (s *AdminSettings) findLLMProvider(name string) *LLMProvider {
+	for i := range s.LLMProviders {
+		if s.LLMProviders[i].Name == name {
+			return &s.LLMProviders[i]
+		}
+	}
+	return nil
+}
+
+// ValidateLLMProviders checks the provider list and that every LLM profile references an existing provider
+func (s *AdminSettings) ValidateLLMProviders() error {
+	names := make(map[string]bool)
+	for _, provider := range s.LLMProviders {
+		if err := provider.Validate(); err != nil {
+			return err
+		}
+		if names[provider.Name] {
+			return errors.New("duplicate LLM provider name: " + provider.Name)
+		}
+		names[provider.Name] = true
+	}
+
+	for _, qualityProfile := range []string{QualityProfileSpeed, QualityProfileBalanced, QualityProfileQuality} {
+		model := s.GetLLMProfile(qualityProfile)
+		if _, err := s.GetLLMProvider(model.Provider); err != nil {
+			return errors.New("llm profile " + qualityProfile + " references an " + err.Error())
+		}
+	}
+	return nil
+}
+
+// Validate checks that the provider has a name, a known type and a base URL
+func (p *LLMProvider) Validate() error {
+	if p.Name == "" {
+		return errors.New("LLM provider name is required")
+	}
+	switch p.Type {
+	case ProviderTypeOpenAI, ProviderTypeAnthropic, ProviderTypeOllama:
+	default:
+		return errors.New("unsupported LLM provider type: " + p.Type)
+	}
+	if p.BaseURL == "" {
+		return errors.New("base_url is required for LLM provider " + p.Name)
+	}
+	return nil
+}
+
+// GetModelMetadata returns the context limits configured for a model.
+// Models without metadata, or with missing values, use the default limits.
+func (s *AdminSettings) GetModelMetadata(model LLMModel) ModelMetadata {
+	metadata := ModelMetadata{Provider: model.Provider, Model: model.Model}
+	for _, configured := range s.LLMModelMetadata {
+		if configured.Provider == model.Provider && configured.Model == model.Model {
+			metadata = configured
+			break
+		}
+	}
+	if metadata.ContextWindow == 0 {
+		metadata.ContextWindow = DefaultContextWindow
+	}
+	if metadata.MaxOutputTokens == 0 {
+		metadata.MaxOutputTokens = DefaultMaxOutputTokens
+	}
+	return metadata
+}
+
+// ContextBudget returns the number of tokens available for the prompt
+func (m *ModelMetadata) ContextBudget() int {
+	return m.ContextWindow - m.MaxOutputTokens
+}
+
+// Validate checks that the model metadata leaves room for a prompt
+func (m *ModelMetadata) Validate() error {
+	if m.Provider == "" || m.Model == "" {
+		return errors.New("provider and model are required")
+	}
+	if m.ContextWindow < 0 || m.MaxOutputTokens < 0 {
+		return errors.New("context_window and max_output_tokens must not be negative")
+	}
+	if m.ContextWindow > 0 && m.MaxOutputTokens >= m.ContextWindow {
+		return errors.New("max_output_tokens must be smaller than context_window")
+	}
+	return nil
+}
+
+// Validate checks that the retrieval profile values are within sensible bounds
+func (p *RetrievalProfile) Validate() error {
+	if p.MaxResults < 1 || p.MaxResults > 50 {
+		return errors.New("max_results must be between 1 and 50")
+	}
+	if p.SubQueries < 0 || p.SubQueries > 10 {
+		return errors.New("sub_queries must be between 0 and 10")
+	}
+	return nil
+}
+
+// Defaults of the LDAP settings, they match an OpenLDAP inetOrgPerson directory
+const (
+	DefaultLDAPUserFilter        = "(uid={username})"
+	DefaultLDAPEmailAttribute    = "mail"
+	DefaultLDAPUsernameAttribute = "uid"
+)
+
+// Validate checks that enabled LDAP settings can authenticate users
+func (l *LDAPSettings) Validate() error {
+	if !l.Enabled {
+		return nil
+	}
+
+	serverURL, err := url.Parse(l.URL)
+	if err != nil || serverURL.Host == "" || (serverURL.Scheme != "ldap" && serverURL.Scheme != "ldaps") {
+		return errors.New("url must be an ldap:// or ldaps:// URL")
+	}
+	if l.StartTLS && serverURL.Scheme == "ldaps" {
+		return errors.New("start_tls cannot be used with an ldaps:// URL")
+	}
+	if !strings.Contains(l.BindDN, "{username}") {
+		return errors.New("bind_dn must contain {username}")
+	}
+	if l.BaseDN == "" {
+		return errors.New("base_dn is required")
+	}
+	if l.UserFilter != "" && (!strings.HasPrefix(l.UserFilter, "(") || !strings.Contains(l.UserFilter, "{username}")) {
+		return errors.New("user_filter must be a parenthesized filter containing {username}")
+	}
+	if l.GroupFilter != "" && (!strings.HasPrefix(l.GroupFilter, "(") || !strings.Contains(l.GroupFilter, "{dn}")) {
+		return errors.New("group_filter must be a parenthesized filter containing {dn}")
+	}
+	return nil
+}
@@ -137,3 +137,288 @@ func TestUserSettingsFromJSON(t *testing.T) {
 			true, result.IsDarkMode)
 	}
 }
+
+func TestGetRetrievalProfile(t *testing.T) {
+	adminSettings := &AdminSettings{
+		RetrievalProfileQuality: RetrievalProfile{MaxResults: 20, SubQueries: 5, Rerank: true},
+	}
+
+	// Configured profiles are returned as is
+	quality := adminSettings.GetRetrievalProfile(QualityProfileQuality)
+	if quality.MaxResults != 20 || quality.SubQueries != 5 {
+		t.Errorf("Expected configured quality profile, got %+v", quality)
+	}
+
+	// Unconfigured profiles fall back to the defaults
+	speed := adminSettings.GetRetrievalProfile(QualityProfileSpeed)
+	if speed != DefaultRetrievalProfile(QualityProfileSpeed) {
+		t.Errorf("Expected default speed profile, got %+v", speed)
+	}
+
+	// Unknown profiles are treated as balanced
+	unknown := adminSettings.GetRetrievalProfile("unknown")
+	if unknown != DefaultRetrievalProfile(QualityProfileBalanced) {
+		t.Errorf("Expected default balanced profile, got %+v", unknown)
+	}
+}
+
+func TestRetrievalProfileValidate(t *testing.T) {
+	testCases := []struct {
+		name    string
+		profile RetrievalProfile
+		valid   bool
+	}{
+		{"Valid profile", RetrievalProfile{MaxResults: 5, SubQueries: 2}, true},
+		{"No results", RetrievalProfile{MaxResults: 0}, false},
+		{"Too many results", RetrievalProfile{MaxResults: 100}, false},
+		{"Negative sub-queries", RetrievalProfile{MaxResults: 5, SubQueries: -1}, false},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := tc.profile.Validate()
+			if tc.valid && err != nil {
+				t.Errorf("Expected profile to be valid, got %v", err)
+			}
+			if !tc.valid && err == nil {
+				t.Error("Expected profile to be invalid, got nil")
+			}
+		})
+	}
+}
+
+func TestGetLLMProfile(t *testing.T) {
+	adminSettings := &AdminSettings{
+		LLMProfileSpeed:   "llama3",
+		LLMProviderSpeed:  "local",
+		LLMProfileQuality: "gpt-4o",
+	}
+
+	speed := adminSettings.GetLLMProfile(QualityProfileSpeed)
+	if speed.Provider != "local" || speed.Model != "llama3" {
+		t.Errorf("Expected local/llama3, got %+v", speed)
+	}
+
+	// Profiles without a provider use the default provider
+	quality := adminSettings.GetLLMProfile(QualityProfileQuality)
+	if quality.Provider != DefaultProviderName || quality.Model != "gpt-4o" {
+		t.Errorf("Expected %s/gpt-4o, got %+v", DefaultProviderName, quality)
+	}
+}
+
+func TestGetLLMProviders(t *testing.T) {
+	adminSettings := &AdminSettings{
+		OpenAIBaseURL:        "https://api.openai.com/v1",
+		OpenAIAPIKey_encrypt: "encrypted-openai-key",
+		LLMProviders: []LLMProvider{
+			{Name: "local", Type: ProviderTypeOpenAI, BaseURL: "http://localhost:8000/v1"},
+		},
+	}
+
+	// The legacy OpenAI settings are exposed as the default provider
+	providers := adminSettings.GetLLMProviders()
+	if len(providers) != 2 {
+		t.Fatalf("Expected 2 providers, got %d", len(providers))
+	}
+	if providers[0].Name != DefaultProviderName || providers[0].APIKey_encrypt != "encrypted-openai-key" {
+		t.Errorf("Unexpected default provider: %+v", providers[0])
+	}
+
+	// A configured provider with the default name replaces the legacy settings
+	adminSettings.LLMProviders = append(adminSettings.LLMProviders,
+		LLMProvider{Name: DefaultProviderName, Type: ProviderTypeOpenAI, BaseURL: "https://proxy.example.com/v1"})
+	provider, err := adminSettings.GetLLMProvider(DefaultProviderName)
+	if err != nil {
+		t.Fatalf("GetLLMProvider failed: %v", err)
+	}
+	if provider.BaseURL != "https://proxy.example.com/v1" {
+		t.Errorf("Expected configured provider to win, got %s", provider.BaseURL)
+	}
+
+	if _, err := adminSettings.GetLLMProvider("missing"); err == nil {
+		t.Error("Expected an error for an unknown provider")
+	}
+}
+
+func TestValidateLLMProviders(t *testing.T) {
+	testCases := []struct {
+		name     string
+		settings AdminSettings
+		valid    bool
+	}{
+		{"Legacy settings only", AdminSettings{OpenAIBaseURL: "https://api.openai.com/v1"}, true},
+		{"Profile on named provider", AdminSettings{
+			LLMProviderSpeed:    "local",
+			LLMProviderBalanced: "local",
+			LLMProviderQuality:  "local",
+			LLMProviders:        []LLMProvider{{Name: "local", Type: ProviderTypeOpenAI, BaseURL: "http://localhost:8000/v1"}},
+		}, true},
+		{"Unknown profile provider", AdminSettings{OpenAIBaseURL: "https://api.openai.com/v1", LLMProviderSpeed: "missing"}, false},
+		{"Duplicate names", AdminSettings{OpenAIBaseURL: "https://api.openai.com/v1", LLMProviders: []LLMProvider{
+			{Name: "local", Type: ProviderTypeOpenAI, BaseURL: "http://localhost:8000/v1"},
+			{Name: "local", Type: ProviderTypeOpenAI, BaseURL: "http://localhost:8001/v1"},
+		}}, false},
+		{"Unknown type", AdminSettings{OpenAIBaseURL: "https://api.openai.com/v1", LLMProviders: []LLMProvider{
+			{Name: "local", Type: "unknown", BaseURL: "http://localhost:8000/v1"},
+		}}, false},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := tc.settings.ValidateLLMProviders()
+			if tc.valid && err != nil {
+				t.Errorf("Expected settings to be valid, got %v", err)
+			}
+			if !tc.valid && err == nil {
+				t.Error("Expected settings to be invalid, got nil")
+			}
+		})
+	}
+}
+
+func TestGetModelMetadata(t *testing.T) {
+	adminSettings := &AdminSettings{
+		LLMModelMetadata: []ModelMetadata{
+			{Provider: "openai", Model: "gpt-4o", ContextWindow: 128000, MaxOutputTokens: 4096},
+			{Provider: "local", Model: "llama3", ContextWindow: 8192},
+		},
+	}
+
+	metadata := adminSettings.GetModelMetadata(LLMModel{Provider: "openai", Model: "gpt-4o"})
+	if metadata.ContextBudget() != 128000-4096 {
+		t.Errorf("Expected configured budget, got %d", metadata.ContextBudget())
+	}
+
+	// Missing values use the defaults
+	metadata = adminSettings.GetModelMetadata(LLMModel{Provider: "local", Model: "llama3"})
+	if metadata.MaxOutputTokens != DefaultMaxOutputTokens {
+		t.Errorf("Expected default max output tokens, got %d", metadata.MaxOutputTokens)
+	}
+
+	// The same model name on another provider is a different model
+	metadata = adminSettings.GetModelMetadata(LLMModel{Provider: "other", Model: "gpt-4o"})
+	if metadata.ContextWindow != DefaultContextWindow {
+		t.Errorf("Expected default context window, got %d", metadata.ContextWindow)
+	}
+}
+
+func TestModelMetadataValidate(t *testing.T) {
+	testCases := []struct {
+		name     string
+		metadata ModelMetadata
+		valid    bool
+	}{
+		{"Valid metadata", ModelMetadata{Provider: "openai", Model: "gpt-4o", ContextWindow: 128000, MaxOutputTokens: 4096}, true},
+		{"Defaults", ModelMetadata{Provider: "openai", Model: "gpt-4o"}, true},
+		{"Missing model", ModelMetadata{Provider: "openai", ContextWindow: 8192}, false},
+		{"Output exceeds window", ModelMetadata{Provider: "openai", Model: "gpt-4o", ContextWindow: 4096, MaxOutputTokens: 4096}, false},
+		{"Negative window", ModelMetadata{Provider: "openai", Model: "gpt-4o", ContextWindow: -1}, false},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := tc.metadata.Validate()
+			if tc.valid && err != nil {
+				t.Errorf("Expected metadata to be valid, got %v", err)
+			}
+			if !tc.valid && err == nil {
+				t.Error("Expected metadata to be invalid, got nil")
+			}
+		})
+	}
+}
+
+func TestGetGenerationLimits(t *testing.T) {
+	adminSettings := &AdminSettings{
+		GenerationLimitsSpeed: GenerationLimits{MinTemperature: 0, MaxTemperature: 0.5, MinMaxTokens: 16, MaxMaxTokens: 512},
+	}
+
+	speed := adminSettings.GetGenerationLimits(QualityProfileSpeed)
+	if speed.MaxTemperature != 0.5 || speed.MaxMaxTokens != 512 {
+		t.Errorf("Expected configured speed limits, got %+v", speed)
+	}
+	if err := speed.CheckTemperature(0.7); err == nil {
+		t.Error("Expected temperature above the limit to be rejected")
+	}
+	if err := speed.CheckMaxTokens(1024); err == nil {
+		t.Error("Expected max tokens above the limit to be rejected")
+	}
+	if err := speed.CheckMaxTokens(256); err != nil {
+		t.Errorf("Expected max tokens within the limits to be accepted, got %v", err)
+	}
+
+	// Unconfigured profiles fall back to the defaults
+	quality := adminSettings.GetGenerationLimits(QualityProfileQuality)
+	if quality != DefaultGenerationLimits() {
+		t.Errorf("Expected default limits, got %+v", quality)
+	}
+}
+
+func TestGenerationLimitsValidate(t *testing.T) {
+	testCases := []struct {
+		name   string
+		limits GenerationLimits
+		valid  bool
+	}{
+		{"Defaults", DefaultGenerationLimits(), true},
+		{"Min above max temperature", GenerationLimits{MinTemperature: 1, MaxTemperature: 0.5, MinMaxTokens: 1, MaxMaxTokens: 10}, false},
+		{"Temperature above 2", GenerationLimits{MaxTemperature: 3, MinMaxTokens: 1, MaxMaxTokens: 10}, false},
+		{"No tokens", GenerationLimits{MaxTemperature: 1, MinMaxTokens: 0, MaxMaxTokens: 10}, false},
+		{"Min above max tokens", GenerationLimits{MaxTemperature: 1, MinMaxTokens: 100, MaxMaxTokens: 10}, false},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := tc.limits.Validate()
+			if tc.valid && err != nil {
+				t.Errorf("Expected limits to be valid, got %v", err)
+			}
+			if !tc.valid && err == nil {
+				t.Error("Expected limits to be invalid, got nil")
+			}
+		})
+	}
+}
+
+func TestLDAPSettingsValidate(t *testing.T) {
+	valid := LDAPSettings{
+		Enabled: true,
+		URL:     "ldap://ldap.example.com:389",
+		BindDN:  "uid={username},ou=people,dc=example,dc=com",
+		BaseDN:  "dc=example,dc=com",
+	}
+
+	testCases := []struct {
+		name   string
+		modify func(l *LDAPSettings)
+		valid  bool
+	}{
+		{"Valid settings", func(l *LDAPSettings) {}, true},
+		{"Disabled", func(l *LDAPSettings) { *l = LDAPSettings{} }, true},
+		{"Active Directory", func(l *LDAPSettings) {
+			l.URL = "ldaps://dc.corp.example.com"
+			l.BindDN = "{username}@corp.example.com"
+			l.UserFilter = "(userPrincipalName={username}@corp.example.com)"
+		}, true},
+		{"Unsupported scheme", func(l *LDAPSettings) { l.URL = "http://ldap.example.com" }, false},
+		{"StartTLS over ldaps", func(l *LDAPSettings) { l.URL = "ldaps://ldap.example.com"; l.StartTLS = true }, false},
+		{"Bind DN without username", func(l *LDAPSettings) { l.BindDN = "cn=admin,dc=example,dc=com" }, false},
+		{"Missing base DN", func(l *LDAPSettings) { l.BaseDN = "" }, false},
+		{"User filter without username", func(l *LDAPSettings) { l.UserFilter = "(objectClass=person)" }, false},
+		{"Group filter without DN", func(l *LDAPSettings) { l.GroupFilter = "(member=*)" }, false},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			ldapSettings := valid
+			tc.modify(&ldapSettings)
+			err := ldapSettings.Validate()
+			if tc.valid && err != nil {
+				t.Errorf("Expected settings to be valid, got %v", err)
+			}
+			if !tc.valid && err == nil {
+				t.Error("Expected settings to be invalid, got nil")
+			}
+		})
+	}
+}
@@ -1,19 +1,105 @@
-package settings
-
-type UserSettings struct {
-	IsDarkMode bool `json:"is_dark_mode"`
-}
-
-type AdminSettings struct {
-	OpenAIBaseURL         string   `json:"openai_base_url"`
-	OpenAIAPIKey_encrypt  string   `json:"openai_api_key_encrypt"`
-	LLMProfileSpeed       string   `json:"llm_profile_speed"`
-	LLMProfileBalanced    string   `json:"llm_profile_balanced"`
-	LLMProfileQuality     string   `json:"llm_profile_quality"`
-	EnableSignUps         bool     `json:"enable_sign_ups"`
-	WebcrawlerURL         string   `json:"webcrawler_url"`
-	ElasticsearchURL      string   `json:"elasticsearch_url"`
-	ElasticsearchUsername string   `json:"elasticsearch_username"`
-	ElasticsearchPassword string   `json:"elasticsearch_password"`
-	EnvOverrides          []string `json:"env_overrides"`
-}
+package settings
+
+// Quality profiles selectable by the user for a chat request
+const (
+	QualityProfileSpeed    = "speed"
+	QualityProfileBalanced = "balanced"
+	QualityProfileQuality  = "quality"
+)
+
+// Provider types understood by the LLM provider registry
+const (
+	ProviderTypeOpenAI    = "openai"    // Any server implementing the OpenAI chat completions API
+	ProviderTypeAnthropic = "anthropic" // Anthropic Messages API
+	ProviderTypeOllama    = "ollama"    // Native Ollama API
+)
+
+// DefaultProviderName is the name of the provider built from the legacy OpenAI settings
+const DefaultProviderName = "openai"
+
+type UserSettings struct {
+	IsDarkMode bool `json:"is_dark_mode"`
+}
+
+// RetrievalProfile configures how the index is searched for a quality profile
+type RetrievalProfile struct {
+	MaxResults   int  `json:"max_results"`   // Number of results passed to the model
+	QueryRewrite bool `json:"query_rewrite"` // Rewrite the question into a search query with the LLM
+	SubQueries   int  `json:"sub_queries"`   // Number of additional queries generated for multi-query expansion
+	Rerank       bool `json:"rerank"`        // Deduplicate and rerank merged results before generation
+}
+
+// LLMProvider is a named connection to an LLM server
+type LLMProvider struct {
+	Name           string `json:"name"`            // Unique name referenced by the LLM profiles
+	Type           string `json:"type"`            // One of the ProviderType constants
+	BaseURL        string `json:"base_url"`        // Base URL of the provider API
+	APIKey_encrypt string `json:"api_key_encrypt"` // Encrypted API key, empty when the provider needs none
+}
+
+// LLMModel references a model served by a named provider
+type LLMModel struct {
+	Provider string `json:"provider"`
+	Model    string `json:"model"`
+}
+
+// GenerationLimits bounds the sampling options users can request for a quality profile
+type GenerationLimits struct {
+	MinTemperature float64 `json:"min_temperature"`
+	MaxTemperature float64 `json:"max_temperature"`
+	MinMaxTokens   int     `json:"min_max_tokens"` // Smallest max_tokens a user can request
+	MaxMaxTokens   int     `json:"max_max_tokens"` // Largest max_tokens a user can request
+}
+
+// ModelMetadata describes the context limits of a model served by a provider.
+// Conversations longer than the prompt budget are trimmed to their most recent turns.
+type ModelMetadata struct {
+	Provider        string `json:"provider"`
+	Model           string `json:"model"`
+	ContextWindow   int    `json:"context_window"`    // Maximum number of tokens of prompt and completion together
+	MaxOutputTokens int    `json:"max_output_tokens"` // Tokens reserved for the completion
+}
+
+// LDAPSettings configures password logins against an LDAP or Active Directory server.
+// {username} in BindDN and UserFilter is replaced by the escaped login.
+type LDAPSettings struct {
+	Enabled           bool   `json:"enabled"`
+	URL               string `json:"url"`                // ldap:// or ldaps:// URL of the server
+	StartTLS          bool   `json:"start_tls"`          // Upgrade ldap:// connections with StartTLS
+	BindDN            string `json:"bind_dn"`            // DN or user principal name the user binds as
+	BaseDN            string `json:"base_dn"`            // Subtree searched for the user and group entries
+	UserFilter        string `json:"user_filter"`        // Filter finding the user entry after the bind
+	EmailAttribute    string `json:"email_attribute"`    // Attribute holding the email of the local account
+	UsernameAttribute string `json:"username_attribute"` // Attribute holding the username of the local account
+	GroupFilter       string `json:"group_filter"`       // Filter finding the user's groups, {dn} is replaced by the user DN. Empty reads memberOf.
+	AdminGroup        string `json:"admin_group"`        // DN of the group granting the admin role, empty leaves the role to local admins
+}
+
+type AdminSettings struct {
+	OpenAIBaseURL            string           `json:"openai_base_url"`
+	OpenAIAPIKey_encrypt     string           `json:"openai_api_key_encrypt"`
+	LLMProfileSpeed          string           `json:"llm_profile_speed"`
+	LLMProfileBalanced       string           `json:"llm_profile_balanced"`
+	LLMProfileQuality        string           `json:"llm_profile_quality"`
+	LLMProviderSpeed         string           `json:"llm_provider_speed"`
+	LLMProviderBalanced      string           `json:"llm_provider_balanced"`
+	LLMProviderQuality       string           `json:"llm_provider_quality"`
+	LLMProviders             []LLMProvider    `json:"llm_providers"`
+	LLMModelMetadata         []ModelMetadata  `json:"llm_model_metadata"`
+	RetrievalProfileSpeed    RetrievalProfile `json:"retrieval_profile_speed"`
+	RetrievalProfileBalanced RetrievalProfile `json:"retrieval_profile_balanced"`
+	RetrievalProfileQuality  RetrievalProfile `json:"retrieval_profile_quality"`
+	GenerationLimitsSpeed    GenerationLimits `json:"generation_limits_speed"`
+	GenerationLimitsBalanced GenerationLimits `json:"generation_limits_balanced"`
+	GenerationLimitsQuality  GenerationLimits `json:"generation_limits_quality"`
+	EnableSignUps            bool             `json:"enable_sign_ups"`
+	WebcrawlerURL            string           `json:"webcrawler_url"`
+	WebcrawlerIndexPages     bool             `json:"webcrawler_index_pages"`
+	ElasticsearchURL         string           `json:"elasticsearch_url"`
+	ElasticsearchUsername    string           `json:"elasticsearch_username"`
+	ElasticsearchPassword    string           `json:"elasticsearch_password"`
+	ElasticsearchIndex       string           `json:"elasticsearch_index"`
+	LDAP                     LDAPSettings     `json:"ldap"`
+	RequireAdminTwoFactor    bool             `json:"require_admin_two_factor"` // Admins must use TOTP for password logins
+	EnvOverrides             []string         `json:"env_overrides"`
+}
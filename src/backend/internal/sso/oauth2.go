@@ -0,0 +1,175 @@
+package sso
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"golang.org/x/oauth2"
+)
+
+// Default userinfo fields of OAuth2 providers, they match GitLab
+const (
+	DefaultSubjectField  = "id"
+	DefaultEmailField    = "email"
+	DefaultUsernameField = "username"
+)
+
+// maxUserInfoSize limits the userinfo response read from a provider
+const maxUserInfoSize = 1 << 20
+
+// Client runs the authorization code flow of an SSO provider
+type Client interface {
+	// AuthCodeURL returns the provider's login page URL
+	AuthCodeURL(state, nonce, verifier string) string
+	// Exchange redeems an authorization code for the identity of the user
+	Exchange(ctx context.Context, code, verifier, nonce string) (*Identity, error)
+}
+
+// NewClient returns the client for the auth type of the provider
+func NewClient(ctx context.Context, p *SsoProvider) (Client, error) {
+	switch p.AuthType {
+	case "OIDC":
+		client, err := NewOIDCClient(ctx, p)
+		if err != nil {
+			return nil, err
+		}
+		return client, nil
+	case "OAuth2":
+		client, err := NewOAuth2Client(p)
+		if err != nil {
+			return nil, err
+		}
+		return client, nil
+	default:
+		return nil, errors.New("sso provider " + p.Provider + " has no redirect login flow for auth type " + p.AuthType)
+	}
+}
+
+// OAuth2Client runs the authorization code flow with PKCE against a plain
+// OAuth2 provider and reads the identity from its userinfo endpoint
+type OAuth2Client struct {
+	config             oauth2.Config
+	userInfoURL        string
+	subjectField       string
+	emailField         string
+	emailVerifiedField string
+	usernameField      string
+}
+
+// NewOAuth2Client uses the endpoints and field mapping configured on the provider
+func NewOAuth2Client(p *SsoProvider) (*OAuth2Client, error) {
+	if p.AuthType != "OAuth2" {
+		return nil, errors.New("sso provider " + p.Provider + " is not an OAuth2 provider")
+	}
+	if p.AuthURL == "" || p.TokenURL == "" || p.UserInfoURL == "" {
+		return nil, errors.New("sso provider " + p.Provider + " is missing OAuth2 endpoints")
+	}
+
+	clientSecret, err := p.DecryptClientSecret()
+	if err != nil {
+		return nil, err
+	}
+
+	return &OAuth2Client{
+		config: oauth2.Config{
+			ClientID:     p.ClientID,
+			ClientSecret: clientSecret,
+			Endpoint: oauth2.Endpoint{
+				AuthURL:  p.AuthURL,
+				TokenURL: p.TokenURL,
+			},
+			RedirectURL: p.RedirectURL,
+			Scopes:      strings.Fields(p.Scopes),
+		},
+		userInfoURL:        p.UserInfoURL,
+		subjectField:       fieldOrDefault(p.SubjectField, DefaultSubjectField),
+		emailField:         fieldOrDefault(p.EmailField, DefaultEmailField),
+		emailVerifiedField: p.EmailVerifiedField,
+		usernameField:      fieldOrDefault(p.UsernameField, DefaultUsernameField),
+	}, nil
+}
+
+// AuthCodeURL returns the provider's login page URL. OAuth2 has no ID token,
+// so the nonce is not sent.
+func (c *OAuth2Client) AuthCodeURL(state, nonce, verifier string) string {
+	return c.config.AuthCodeURL(state, oauth2.S256ChallengeOption(verifier))
+}
+
+// Exchange redeems an authorization code and maps the userinfo response to an identity
+func (c *OAuth2Client) Exchange(ctx context.Context, code, verifier, nonce string) (*Identity, error) {
+	token, err := c.config.Exchange(ctx, code, oauth2.VerifierOption(verifier))
+	if err != nil {
+		return nil, errors.New("failed to exchange authorization code: " + err.Error())
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.userInfoURL, nil)
+	if err != nil {
+		return nil, errors.New("failed to create userinfo request: " + err.Error())
+	}
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := c.config.Client(ctx, token).Do(req)
+	if err != nil {
+		return nil, errors.New("failed to get userinfo: " + err.Error())
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, errors.New("failed to get userinfo: " + resp.Status)
+	}
+
+	// Numbers are kept as written, numeric IDs must not lose precision
+	var userInfo map[string]interface{}
+	decoder := json.NewDecoder(io.LimitReader(resp.Body, maxUserInfoSize))
+	decoder.UseNumber()
+	if err := decoder.Decode(&userInfo); err != nil {
+		return nil, errors.New("failed to parse userinfo: " + err.Error())
+	}
+
+	// Plain OAuth2 says nothing about the email, it only counts as verified
+	// when the provider reports it in the configured field
+	identity := &Identity{
+		Subject:  fieldString(userInfo, c.subjectField),
+		Email:    fieldString(userInfo, c.emailField),
+		Username: fieldString(userInfo, c.usernameField),
+	}
+	if c.emailVerifiedField != "" {
+		identity.EmailVerified = fieldString(userInfo, c.emailVerifiedField) == "true"
+	}
+	return identity, nil
+}
+
+func fieldOrDefault(field, defaultField string) string {
+	if field == "" {
+		return defaultField
+	}
+	return field
+}
+
+// fieldString returns the value at a dot separated path as a string, empty
+// when the path is missing or does not hold a string, number or boolean
+func fieldString(data map[string]interface{}, path string) string {
+	var value interface{} = data
+	for _, key := range strings.Split(path, ".") {
+		object, ok := value.(map[string]interface{})
+		if !ok {
+			return ""
+		}
+		value = object[key]
+	}
+
+	switch v := value.(type) {
+	case string:
+		return v
+	case json.Number:
+		return v.String()
+	case bool:
+		return strconv.FormatBool(v)
+	default:
+		return ""
+	}
+}
@@ -0,0 +1,104 @@
+package sso
+
+import (
+	"context"
+	"errors"
+	"sync"
+
+	"github.com/coreos/go-oidc/v3/oidc"
+	"golang.org/x/oauth2"
+)
+
+// discovered caches OIDC discovery documents and their key sets by issuer URL
+var discovered sync.Map
+
+// OIDCClient runs the authorization code flow with PKCE against an OIDC provider
+type OIDCClient struct {
+	config   oauth2.Config
+	verifier *oidc.IDTokenVerifier
+}
+
+// NewOIDCClient discovers the provider's endpoints from its issuer URL
+func NewOIDCClient(ctx context.Context, p *SsoProvider) (*OIDCClient, error) {
+	if p.AuthType != "OIDC" {
+		return nil, errors.New("sso provider " + p.Provider + " is not an OIDC provider")
+	}
+	if p.IssuerURL == "" {
+		return nil, errors.New("sso provider " + p.Provider + " has no issuer URL")
+	}
+
+	clientSecret, err := p.DecryptClientSecret()
+	if err != nil {
+		return nil, err
+	}
+
+	provider, ok := discovered.Load(p.IssuerURL)
+	if !ok {
+		// Discovery outlives the request, keys are refreshed in the background
+		fetched, err := oidc.NewProvider(context.WithoutCancel(ctx), p.IssuerURL)
+		if err != nil {
+			return nil, errors.New("failed to discover OIDC provider: " + err.Error())
+		}
+		provider, _ = discovered.LoadOrStore(p.IssuerURL, fetched)
+	}
+	oidcProvider := provider.(*oidc.Provider)
+
+	return &OIDCClient{
+		config: oauth2.Config{
+			ClientID:     p.ClientID,
+			ClientSecret: clientSecret,
+			Endpoint:     oidcProvider.Endpoint(),
+			RedirectURL:  p.RedirectURL,
+			Scopes:       []string{oidc.ScopeOpenID, "email", "profile"},
+		},
+		verifier: oidcProvider.Verifier(&oidc.Config{ClientID: p.ClientID}),
+	}, nil
+}
+
+// AuthCodeURL returns the provider's login page URL. The verifier must be kept
+// until the callback, the provider only sees its S256 challenge.
+func (c *OIDCClient) AuthCodeURL(state, nonce, verifier string) string {
+	return c.config.AuthCodeURL(state, oidc.Nonce(nonce), oauth2.S256ChallengeOption(verifier))
+}
+
+// Exchange redeems an authorization code and validates the returned ID token
+func (c *OIDCClient) Exchange(ctx context.Context, code, verifier, nonce string) (*Identity, error) {
+	token, err := c.config.Exchange(ctx, code, oauth2.VerifierOption(verifier))
+	if err != nil {
+		return nil, errors.New("failed to exchange authorization code: " + err.Error())
+	}
+	rawIDToken, ok := token.Extra("id_token").(string)
+	if !ok || rawIDToken == "" {
+		return nil, errors.New("token response has no id_token")
+	}
+
+	// Checks the signature, issuer, audience and expiry
+	idToken, err := c.verifier.Verify(ctx, rawIDToken)
+	if err != nil {
+		return nil, errors.New("invalid id token: " + err.Error())
+	}
+	if idToken.Nonce != nonce {
+		return nil, errors.New("invalid id token: nonce mismatch")
+	}
+
+	var claims struct {
+		Email             string `json:"email"`
+		EmailVerified     bool   `json:"email_verified"`
+		PreferredUsername string `json:"preferred_username"`
+		Name              string `json:"name"`
+	}
+	if err := idToken.Claims(&claims); err != nil {
+		return nil, errors.New("failed to parse id token claims: " + err.Error())
+	}
+
+	identity := &Identity{
+		Subject:       idToken.Subject,
+		Email:         claims.Email,
+		EmailVerified: claims.EmailVerified,
+		Username:      claims.PreferredUsername,
+	}
+	if identity.Username == "" {
+		identity.Username = claims.Name
+	}
+	return identity, nil
+}
@@ -0,0 +1,213 @@
+package sso
+
+import (
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/xml"
+	"errors"
+	"net/url"
+	"slices"
+	"strings"
+
+	"github.com/crewjam/saml"
+)
+
+// SAMLServiceProvider is Quillium acting as the SAML service provider of an
+// identity provider. Responses are accepted with the HTTP-POST binding only
+// and must be signed by a certificate from the identity provider's metadata.
+type SAMLServiceProvider struct {
+	sp            saml.ServiceProvider
+	subjectField  string
+	emailField    string
+	usernameField string
+	adminField    string
+	adminValue    string
+}
+
+// NewSAMLServiceProvider uses the client ID as the entity ID and the redirect
+// URL as the assertion consumer service URL of the service provider
+func NewSAMLServiceProvider(p *SsoProvider) (*SAMLServiceProvider, error) {
+	if p.AuthType != "SAML" {
+		return nil, errors.New("sso provider " + p.Provider + " is not a SAML provider")
+	}
+	idpMetadata, err := ParseIdPMetadata(p.IdPMetadata)
+	if err != nil {
+		return nil, errors.New("sso provider " + p.Provider + ": " + err.Error())
+	}
+	acsURL, err := url.Parse(p.RedirectURL)
+	if err != nil {
+		return nil, errors.New("sso provider " + p.Provider + " has an invalid redirect URL: " + err.Error())
+	}
+
+	return &SAMLServiceProvider{
+		sp: saml.ServiceProvider{
+			EntityID:    p.ClientID,
+			AcsURL:      *acsURL,
+			IDPMetadata: idpMetadata,
+			// Let the identity provider pick a persistent name ID, a
+			// transient one would change with every login
+			AuthnNameIDFormat: saml.UnspecifiedNameIDFormat,
+		},
+		subjectField:  p.SubjectField,
+		emailField:    fieldOrDefault(p.EmailField, DefaultEmailField),
+		usernameField: fieldOrDefault(p.UsernameField, DefaultUsernameField),
+		adminField:    p.AdminField,
+		adminValue:    p.AdminValue,
+	}, nil
+}
+
+// ParseIdPMetadata parses the metadata XML of an identity provider. It must
+// describe an HTTP-Redirect single sign on service and a signing certificate.
+func ParseIdPMetadata(metadata string) (*saml.EntityDescriptor, error) {
+	if strings.TrimSpace(metadata) == "" {
+		return nil, errors.New("no identity provider metadata")
+	}
+
+	var entity saml.EntityDescriptor
+	if err := xml.Unmarshal([]byte(metadata), &entity); err != nil {
+		// Federations publish a list of entities
+		var entities saml.EntitiesDescriptor
+		if xml.Unmarshal([]byte(metadata), &entities) != nil {
+			return nil, errors.New("invalid identity provider metadata: " + err.Error())
+		}
+		index := slices.IndexFunc(entities.EntityDescriptors, func(e saml.EntityDescriptor) bool {
+			return len(e.IDPSSODescriptors) > 0
+		})
+		if index < 0 {
+			return nil, errors.New("identity provider metadata has no identity provider")
+		}
+		entity = entities.EntityDescriptors[index]
+	}
+
+	sp := saml.ServiceProvider{IDPMetadata: &entity}
+	if sp.GetSSOBindingLocation(saml.HTTPRedirectBinding) == "" {
+		return nil, errors.New("identity provider metadata has no HTTP-Redirect single sign on service")
+	}
+
+	hasCertificate := false
+	for _, descriptor := range entity.IDPSSODescriptors {
+		for _, key := range descriptor.KeyDescriptors {
+			if key.Use != "" && key.Use != "signing" {
+				continue
+			}
+			for _, certificate := range key.KeyInfo.X509Data.X509Certificates {
+				der, err := base64.StdEncoding.DecodeString(strings.Join(strings.Fields(certificate.Data), ""))
+				if err != nil {
+					return nil, errors.New("invalid certificate in identity provider metadata: " + err.Error())
+				}
+				if _, err := x509.ParseCertificate(der); err != nil {
+					return nil, errors.New("invalid certificate in identity provider metadata: " + err.Error())
+				}
+				hasCertificate = true
+			}
+		}
+	}
+	if !hasCertificate {
+		return nil, errors.New("identity provider metadata has no signing certificate")
+	}
+	return &entity, nil
+}
+
+// AuthnRequestURL returns the URL sending the user to the identity provider
+// with an authentication request. The request ID must be kept until the
+// response arrives.
+func (c *SAMLServiceProvider) AuthnRequestURL(relayState string) (authURL string, requestID string, err error) {
+	req, err := c.sp.MakeAuthenticationRequest(
+		c.sp.GetSSOBindingLocation(saml.HTTPRedirectBinding), saml.HTTPRedirectBinding, saml.HTTPPostBinding)
+	if err != nil {
+		return "", "", errors.New("failed to create SAML authentication request: " + err.Error())
+	}
+	redirect, err := req.Redirect(relayState, &c.sp)
+	if err != nil {
+		return "", "", errors.New("failed to create SAML authentication request: " + err.Error())
+	}
+	return redirect.String(), req.ID, nil
+}
+
+// Metadata returns the service provider metadata XML for the identity provider
+func (c *SAMLServiceProvider) Metadata() ([]byte, error) {
+	metadata := c.sp.Metadata()
+	// Only the HTTP-POST binding is handled by the assertion consumer service
+	for i := range metadata.SPSSODescriptors {
+		metadata.SPSSODescriptors[i].AssertionConsumerServices = slices.DeleteFunc(
+			metadata.SPSSODescriptors[i].AssertionConsumerServices,
+			func(endpoint saml.IndexedEndpoint) bool { return endpoint.Binding != saml.HTTPPostBinding },
+		)
+	}
+
+	data, err := xml.MarshalIndent(metadata, "", "  ")
+	if err != nil {
+		return nil, errors.New("failed to marshal SAML metadata: " + err.Error())
+	}
+	return append([]byte(xml.Header), data...), nil
+}
+
+// ParseResponse validates a base64 encoded SAMLResponse answering the request
+// with the given ID and maps its assertion to an identity
+func (c *SAMLServiceProvider) ParseResponse(samlResponse, requestID string) (*Identity, error) {
+	if requestID == "" {
+		return nil, errors.New("no SAML request ID")
+	}
+	decoded, err := base64.StdEncoding.DecodeString(samlResponse)
+	if err != nil {
+		return nil, errors.New("invalid SAML response: " + err.Error())
+	}
+
+	// Checks the signature, issuer, audience, recipient, request ID and validity
+	assertion, err := c.sp.ParseXMLResponse(decoded, []string{requestID})
+	if err != nil {
+		var invalid *saml.InvalidResponseError
+		if errors.As(err, &invalid) && invalid.PrivateErr != nil {
+			err = invalid.PrivateErr
+		}
+		return nil, errors.New("invalid SAML response: " + err.Error())
+	}
+
+	var nameID *saml.NameID
+	if assertion.Subject != nil {
+		nameID = assertion.Subject.NameID
+	}
+
+	identity := &Identity{
+		Email:         firstAttributeValue(assertion, c.emailField),
+		EmailVerified: true, // Asserted by the identity provider
+		Username:      firstAttributeValue(assertion, c.usernameField),
+	}
+	if c.subjectField != "" {
+		identity.Subject = firstAttributeValue(assertion, c.subjectField)
+	} else if nameID != nil {
+		identity.Subject = nameID.Value
+	}
+	if identity.Email == "" && nameID != nil && nameID.Format == string(saml.EmailAddressNameIDFormat) {
+		identity.Email = nameID.Value
+	}
+	if c.adminField != "" {
+		isAdmin := slices.Contains(attributeValues(assertion, c.adminField), c.adminValue)
+		identity.IsAdmin = &isAdmin
+	}
+	return identity, nil
+}
+
+// attributeValues returns the values of the attributes with the given name or friendly name
+func attributeValues(assertion *saml.Assertion, name string) []string {
+	var values []string
+	for _, statement := range assertion.AttributeStatements {
+		for _, attribute := range statement.Attributes {
+			if attribute.Name != name && attribute.FriendlyName != name {
+				continue
+			}
+			for _, value := range attribute.Values {
+				values = append(values, strings.TrimSpace(value.Value))
+			}
+		}
+	}
+	return values
+}
+
+func firstAttributeValue(assertion *saml.Assertion, name string) string {
+	values := attributeValues(assertion, name)
+	if len(values) == 0 {
+		return ""
+	}
+	return values[0]
+}
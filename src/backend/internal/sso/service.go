@@ -1,17 +1,116 @@
-package sso
-
-import "encoding/json"
-
-// ToJSON converts the struct to a JSON string
-func (s *SsoProvider) ToJSON() (string, error) {
-	bytes, err := json.Marshal(s)
-	if err != nil {
-		return "", err
-	}
-	return string(bytes), nil
-}
-
-// FromJSON parses a JSON string into the struct
-func (s *SsoProvider) FromJSON(jsonStr string) error {
-	return json.Unmarshal([]byte(jsonStr), s)
-}
+package sso
+
+import (
+	"encoding/json"
+	"errors"
+	"net/url"
+	"slices"
+	"strings"
+
+	"gitlab.cherkaoui.ch/quillium-ai/quillium/src/backend/internal/security"
+)
+
+// ToJSON converts the struct to a JSON string
+func (s *SsoProvider) ToJSON() (string, error) {
+	bytes, err := json.Marshal(s)
+	if err != nil {
+		return "", err
+	}
+	return string(bytes), nil
+}
+
+// FromJSON parses a JSON string into the struct
+func (s *SsoProvider) FromJSON(jsonStr string) error {
+	return json.Unmarshal([]byte(jsonStr), s)
+}
+
+// AuthTypes are the supported values of AuthType
+var AuthTypes = []string{"OAuth2", "SAML", "OIDC"}
+
+// Validate checks that the configuration is complete for its auth type
+func (s *SsoProvider) Validate() error {
+	if strings.TrimSpace(s.Provider) == "" || len(s.Provider) > 255 {
+		return errors.New("provider name must be between 1 and 255 characters")
+	}
+	if !slices.Contains(AuthTypes, s.AuthType) {
+		return errors.New("auth type must be one of " + strings.Join(AuthTypes, ", "))
+	}
+	if s.ClientID == "" || len(s.ClientID) > 255 {
+		return errors.New("client ID must be between 1 and 255 characters")
+	}
+	if !isHTTPURL(s.RedirectURL) || len(s.RedirectURL) > 255 {
+		return errors.New("redirect URL must be an absolute http(s) URL")
+	}
+	if s.AuthType == "OIDC" && (!isHTTPURL(s.IssuerURL) || len(s.IssuerURL) > 255) {
+		return errors.New("OIDC providers need an absolute http(s) issuer URL")
+	}
+	if s.AuthType == "OAuth2" {
+		for _, endpoint := range []string{s.AuthURL, s.TokenURL, s.UserInfoURL} {
+			if !isHTTPURL(endpoint) || len(endpoint) > 255 {
+				return errors.New("OAuth2 providers need absolute http(s) auth, token and userinfo URLs")
+			}
+		}
+	}
+	if s.AuthType == "SAML" {
+		if _, err := ParseIdPMetadata(s.IdPMetadata); err != nil {
+			return err
+		}
+		if (s.AdminField == "") != (s.AdminValue == "") {
+			return errors.New("admin field and admin value must be set together")
+		}
+	}
+	for _, field := range []string{s.Scopes, s.SubjectField, s.EmailField, s.EmailVerifiedField, s.UsernameField, s.AdminField, s.AdminValue} {
+		if len(field) > 255 {
+			return errors.New("scopes and attribute fields must be at most 255 characters")
+		}
+	}
+	for _, domain := range s.AllowedDomains {
+		if domain == "" || strings.ContainsAny(domain, ",@ ") {
+			return errors.New("allowed domains must be domain names like example.com")
+		}
+	}
+	return nil
+}
+
+// NormalizeDomains lowercases domains and removes blanks, duplicates and a leading @
+func NormalizeDomains(domains []string) []string {
+	normalized := make([]string, 0, len(domains))
+	for _, domain := range domains {
+		domain = strings.ToLower(strings.TrimPrefix(strings.TrimSpace(domain), "@"))
+		if domain != "" && !slices.Contains(normalized, domain) {
+			normalized = append(normalized, domain)
+		}
+	}
+	return normalized
+}
+
+// AllowsEmail reports whether new accounts may be created for the email, any
+// email is allowed when no domains are configured
+func (s *SsoProvider) AllowsEmail(email string) bool {
+	if len(s.AllowedDomains) == 0 {
+		return true
+	}
+	at := strings.LastIndex(email, "@")
+	if at < 0 {
+		return false
+	}
+	return slices.Contains(s.AllowedDomains, strings.ToLower(email[at+1:]))
+}
+
+// isHTTPURL reports whether raw is an absolute http or https URL
+func isHTTPURL(raw string) bool {
+	u, err := url.Parse(raw)
+	return err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Host != ""
+}
+
+// DecryptClientSecret returns the plain client secret, empty for public clients
+func (s *SsoProvider) DecryptClientSecret() (string, error) {
+	if s.ClientSecret == "" {
+		return "", nil
+	}
+	decrypted, err := security.DecryptPassword(s.ClientSecret)
+	if err != nil {
+		return "", errors.New("failed to decrypt client secret of sso provider " + s.Provider + ": " + err.Error())
+	}
+	return *decrypted, nil
+}
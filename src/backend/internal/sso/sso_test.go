@@ -115,3 +115,76 @@ func TestSsoProviderFromJSONInvalid(t *testing.T) {
 		t.Error("Expected error when parsing invalid JSON, but got nil")
 	}
 }
+
+func TestSsoProviderValidate(t *testing.T) {
+	valid := SsoProvider{
+		ClientID:    "client123",
+		Provider:    "company",
+		RedirectURL: "https://example.com/api/auth/sso/callback",
+		AuthType:    "OIDC",
+		IssuerURL:   "https://idp.example.com",
+	}
+	if err := valid.Validate(); err != nil {
+		t.Errorf("Expected a valid provider, got %v", err)
+	}
+
+	tests := []struct {
+		name   string
+		modify func(p *SsoProvider)
+	}{
+		{"missing name", func(p *SsoProvider) { p.Provider = " " }},
+		{"unknown auth type", func(p *SsoProvider) { p.AuthType = "LDAP" }},
+		{"missing client ID", func(p *SsoProvider) { p.ClientID = "" }},
+		{"relative redirect URL", func(p *SsoProvider) { p.RedirectURL = "/callback" }},
+		{"OIDC without issuer", func(p *SsoProvider) { p.IssuerURL = "" }},
+		{"OAuth2 without userinfo URL", func(p *SsoProvider) {
+			p.AuthType = "OAuth2"
+			p.AuthURL = "https://gitlab.example.com/oauth/authorize"
+			p.TokenURL = "https://gitlab.example.com/oauth/token"
+		}},
+		{"allowed domain with @", func(p *SsoProvider) { p.AllowedDomains = []string{"user@example.com"} }},
+		{"SAML without metadata", func(p *SsoProvider) { p.AuthType = "SAML" }},
+		{"SAML with invalid metadata", func(p *SsoProvider) {
+			p.AuthType = "SAML"
+			p.IdPMetadata = `<EntityDescriptor xmlns="urn:oasis:names:tc:SAML:2.0:metadata" entityID="https://idp.example.com"/>`
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			provider := valid
+			tt.modify(&provider)
+			if err := provider.Validate(); err == nil {
+				t.Error("Expected an error, got nil")
+			}
+		})
+	}
+}
+
+func TestSsoProviderAllowsEmail(t *testing.T) {
+	provider := SsoProvider{AllowedDomains: NormalizeDomains([]string{" @Example.com", "corp.example", "", "example.com"})}
+	if len(provider.AllowedDomains) != 2 || provider.AllowedDomains[0] != "example.com" {
+		t.Fatalf("Unexpected normalized domains: %v", provider.AllowedDomains)
+	}
+
+	tests := []struct {
+		email    string
+		expected bool
+	}{
+		{"user@example.com", true},
+		{"user@EXAMPLE.COM", true},
+		{"user@corp.example", true},
+		{"user@sub.example.com", false},
+		{"user@example.com.evil", false},
+		{"example.com", false},
+	}
+	for _, tt := range tests {
+		if got := provider.AllowsEmail(tt.email); got != tt.expected {
+			t.Errorf("AllowsEmail(%q) = %v, expected %v", tt.email, got, tt.expected)
+		}
+	}
+
+	// Any email is allowed without domains
+	if !(&SsoProvider{}).AllowsEmail("user@anywhere.example") {
+		t.Error("Expected any email to be allowed without domains")
+	}
+}
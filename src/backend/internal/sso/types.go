@@ -1,10 +1,45 @@
-package sso
-
-// SsoProvider represents an SSO provider configuration
-type SsoProvider struct {
-	ClientID     string `json:"client_id"`
-	ClientSecret string `json:"client_secret"`
-	Provider     string `json:"provider"`
-	RedirectURL  string `json:"redirect_url"`
-	AuthType     string `json:"auth_type"` // OAuth2, SAML, or OIDC
-}
+package sso
+
+// SsoProvider represents an SSO provider configuration. The client secret is
+// stored encrypted with the security package.
+type SsoProvider struct {
+	ID           *int   `json:"id,omitempty"`
+	ClientID     string `json:"client_id"`
+	ClientSecret string `json:"client_secret"`
+	Provider     string `json:"provider"`
+	RedirectURL  string `json:"redirect_url"`
+	AuthType     string `json:"auth_type"`            // OAuth2, SAML, or OIDC
+	IssuerURL    string `json:"issuer_url,omitempty"` // OIDC only, used for discovery
+
+	// OAuth2 only, the endpoints and scopes of the provider
+	AuthURL     string `json:"auth_url,omitempty"`
+	TokenURL    string `json:"token_url,omitempty"`
+	UserInfoURL string `json:"userinfo_url,omitempty"`
+	Scopes      string `json:"scopes,omitempty"` // Space separated
+
+	// OAuth2 only, the userinfo fields holding the identity. Nested fields are
+	// separated by dots, empty fields use the Default*Field constants.
+	SubjectField       string `json:"subject_field,omitempty"`
+	EmailField         string `json:"email_field,omitempty"`
+	EmailVerifiedField string `json:"email_verified_field,omitempty"` // Emails are never verified when empty
+	UsernameField      string `json:"username_field,omitempty"`
+
+	AllowedDomains []string `json:"allowed_domains,omitempty"` // Email domains allowed to sign up, any when empty
+
+	// SAML only, the metadata XML of the identity provider
+	IdPMetadata string `json:"idp_metadata,omitempty"`
+
+	// SAML only, users are admins when the AdminField attribute has the
+	// AdminValue value. The admin role is not changed when AdminField is empty.
+	AdminField string `json:"admin_field,omitempty"`
+	AdminValue string `json:"admin_value,omitempty"`
+}
+
+// Identity is the user an SSO provider authenticated
+type Identity struct {
+	Subject       string
+	Email         string
+	EmailVerified bool
+	Username      string
+	IsAdmin       *bool // Set when the provider decides the admin role
+}
@@ -0,0 +1,125 @@
+// Package twofactor implements TOTP codes (RFC 6238) and recovery codes for
+// two-factor authentication.
+package twofactor
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base32"
+	"encoding/hex"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/pquerna/otp"
+	"github.com/pquerna/otp/hotp"
+	"github.com/pquerna/otp/totp"
+	"gitlab.cherkaoui.ch/quillium-ai/quillium/src/backend/internal/user"
+)
+
+// Issuer is shown next to the account name in authenticator apps
+const Issuer = "Quillium"
+
+// RecoveryCodeCount is the number of recovery codes generated at once
+const RecoveryCodeCount = 10
+
+// Failed codes lock the second factor for LockoutDuration after MaxFailedAttempts
+const (
+	MaxFailedAttempts = 5
+	LockoutDuration   = 15 * time.Minute
+)
+
+// period is the TOTP time step in seconds, the default of authenticator apps
+const period = 30
+
+// ErrLocked is returned when too many codes failed recently
+var ErrLocked = errors.New("too many failed two-factor codes")
+
+// NewSecret generates a secret for the account and returns it with the
+// otpauth:// provisioning URI authenticator apps import, usually as a QR code
+func NewSecret(accountName string) (secret string, provisioningURI string, err error) {
+	key, err := totp.Generate(totp.GenerateOpts{
+		Issuer:      Issuer,
+		AccountName: accountName,
+		Period:      period,
+		Digits:      otp.DigitsSix,
+		Algorithm:   otp.AlgorithmSHA1,
+	})
+	if err != nil {
+		return "", "", errors.New("failed to generate TOTP secret: " + err.Error())
+	}
+	return key.Secret(), key.URL(), nil
+}
+
+// ValidateCode checks a code against the secret at the given time, allowing
+// one time step of clock drift. Codes of time steps up to lastUsedStep are
+// rejected, so every code is only accepted once. The time step of an
+// accepted code is returned.
+func ValidateCode(secret, code string, lastUsedStep int64, now time.Time) (int64, bool) {
+	code = strings.ReplaceAll(strings.TrimSpace(code), " ", "")
+	current := now.Unix() / period
+	for step := current - 1; step <= current+1; step++ {
+		if step <= lastUsedStep {
+			continue
+		}
+		valid, err := hotp.ValidateCustom(code, uint64(step), secret, hotp.ValidateOpts{
+			Digits:    otp.DigitsSix,
+			Algorithm: otp.AlgorithmSHA1,
+		})
+		if err == nil && valid {
+			return step, true
+		}
+	}
+	return 0, false
+}
+
+// IsTOTPCode reports whether a code has the format of a TOTP code rather than a recovery code
+func IsTOTPCode(code string) bool {
+	code = strings.ReplaceAll(strings.TrimSpace(code), " ", "")
+	if len(code) != otp.DigitsSix.Length() {
+		return false
+	}
+	for _, c := range code {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// NewRecoveryCodes generates one-time recovery codes formatted as xxxxx-xxxxx
+func NewRecoveryCodes() ([]string, error) {
+	encoding := base32.StdEncoding.WithPadding(base32.NoPadding)
+	codes := make([]string, 0, RecoveryCodeCount)
+	for range RecoveryCodeCount {
+		b := make([]byte, 10)
+		if _, err := rand.Read(b); err != nil {
+			return nil, errors.New("failed to generate recovery code: " + err.Error())
+		}
+		code := strings.ToLower(encoding.EncodeToString(b))
+		codes = append(codes, code[:5]+"-"+code[5:10])
+	}
+	return codes, nil
+}
+
+// HashRecoveryCode returns the SHA-256 hash a recovery code is stored as.
+// Case, spaces and dashes are ignored.
+func HashRecoveryCode(code string) string {
+	normalized := strings.ToLower(strings.NewReplacer("-", "", " ", "").Replace(strings.TrimSpace(code)))
+	sum := sha256.Sum256([]byte(normalized))
+	return hex.EncodeToString(sum[:])
+}
+
+// HashRecoveryCodes hashes every recovery code for storage
+func HashRecoveryCodes(codes []string) []string {
+	hashes := make([]string, 0, len(codes))
+	for _, code := range codes {
+		hashes = append(hashes, HashRecoveryCode(code))
+	}
+	return hashes
+}
+
+// IsLocked reports whether the enrollment is locked after too many failed codes
+func IsLocked(t *user.TOTP, now time.Time) bool {
+	return t.FailedAttempts >= MaxFailedAttempts && t.LastFailedAt != nil && now.Before(t.LastFailedAt.Add(LockoutDuration))
+}
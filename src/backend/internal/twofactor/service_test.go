@@ -0,0 +1,94 @@
+package twofactor_test
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pquerna/otp/totp"
+	"gitlab.cherkaoui.ch/quillium-ai/quillium/src/backend/internal/twofactor"
+	"gitlab.cherkaoui.ch/quillium-ai/quillium/src/backend/internal/user"
+)
+
+func TestValidateCode(t *testing.T) {
+	secret, uri, err := twofactor.NewSecret("user@example.com")
+	if err != nil {
+		t.Fatalf("Failed to generate secret: %v", err)
+	}
+	if !strings.HasPrefix(uri, "otpauth://totp/Quillium:user@example.com?") || !strings.Contains(uri, "secret="+secret) {
+		t.Errorf("Unexpected provisioning URI %q", uri)
+	}
+
+	now := time.Now()
+	code, _ := totp.GenerateCode(secret, now)
+	step, ok := twofactor.ValidateCode(secret, code, 0, now)
+	if !ok || step != now.Unix()/30 {
+		t.Fatalf("Expected the current code to be accepted at step %d, got %d, %t", now.Unix()/30, step, ok)
+	}
+
+	// A code is only accepted once
+	if _, ok := twofactor.ValidateCode(secret, code, step, now); ok {
+		t.Error("Expected a used code to be rejected")
+	}
+
+	// One step of clock drift is allowed
+	previous, _ := totp.GenerateCode(secret, now.Add(-30*time.Second))
+	if _, ok := twofactor.ValidateCode(secret, previous, 0, now); !ok {
+		t.Error("Expected the previous code to be accepted")
+	}
+	expired, _ := totp.GenerateCode(secret, now.Add(-2*time.Minute))
+	if _, ok := twofactor.ValidateCode(secret, expired, 0, now); ok {
+		t.Error("Expected an expired code to be rejected")
+	}
+}
+
+func TestRecoveryCodes(t *testing.T) {
+	codes, err := twofactor.NewRecoveryCodes()
+	if err != nil {
+		t.Fatalf("Failed to generate recovery codes: %v", err)
+	}
+	if len(codes) != twofactor.RecoveryCodeCount {
+		t.Fatalf("Expected %d codes, got %d", twofactor.RecoveryCodeCount, len(codes))
+	}
+	seen := map[string]bool{}
+	for _, code := range codes {
+		if len(code) != 11 || code[5] != '-' || twofactor.IsTOTPCode(code) || seen[code] {
+			t.Errorf("Unexpected recovery code %q", code)
+		}
+		seen[code] = true
+	}
+
+	// Case, spaces and dashes are ignored
+	typed := strings.ToUpper(strings.ReplaceAll(codes[0], "-", " "))
+	if twofactor.HashRecoveryCode(typed) != twofactor.HashRecoveryCode(codes[0]) {
+		t.Error("Expected the typed recovery code to match")
+	}
+	if twofactor.HashRecoveryCode(codes[0]) == twofactor.HashRecoveryCode(codes[1]) {
+		t.Error("Expected different codes to have different hashes")
+	}
+}
+
+func TestIsLocked(t *testing.T) {
+	now := time.Now()
+	recent := now.Add(-time.Minute)
+	old := now.Add(-twofactor.LockoutDuration - time.Minute)
+
+	tests := []struct {
+		name   string
+		totp   user.TOTP
+		locked bool
+	}{
+		{"no failures", user.TOTP{}, false},
+		{"below the limit", user.TOTP{FailedAttempts: twofactor.MaxFailedAttempts - 1, LastFailedAt: &recent}, false},
+		{"limit reached", user.TOTP{FailedAttempts: twofactor.MaxFailedAttempts, LastFailedAt: &recent}, true},
+		{"lockout expired", user.TOTP{FailedAttempts: twofactor.MaxFailedAttempts, LastFailedAt: &old}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if locked := twofactor.IsLocked(&tt.totp, now); locked != tt.locked {
+				t.Errorf("Expected locked %t, got %t", tt.locked, locked)
+			}
+		})
+	}
+}
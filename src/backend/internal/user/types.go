@@ -1,13 +1,39 @@
-package user
-
-// User represents a user in the system
-type User struct {
-	ID            *int    `json:"id"`
-	Username      string  `json:"username"`
-	Email         string  `json:"email"`
-	PasswordHash  *string `json:"password_hash"`
-	IsSso         bool    `json:"is_sso"`
-	SsoUserID     *string `json:"sso_user_id"`
-	SsoProviderID *int    `json:"sso_provider_id"`
-	IsAdmin       bool    `json:"is_admin"`
-}
+package user
+
+import "time"
+
+// User represents a user in the system
+type User struct {
+	ID            *int    `json:"id"`
+	Username      string  `json:"username"`
+	Email         string  `json:"email"`
+	PasswordHash  *string `json:"password_hash"`
+	IsSso         bool    `json:"is_sso"`
+	SsoUserID     *string `json:"sso_user_id"`
+	SsoProviderID *int    `json:"sso_provider_id"`
+	IsAdmin       bool    `json:"is_admin"`
+	LdapDN        *string `json:"ldap_dn"` // Directory entry of users created by an LDAP login
+}
+
+// TOTP is the authenticator app enrollment of a user. The secret is stored
+// encrypted, and codes are only asked for at login once it is enabled.
+type TOTP struct {
+	UserID         int
+	Secret         string
+	Enabled        bool
+	LastUsedStep   int64      // Time step of the last accepted code, codes cannot be reused
+	FailedAttempts int        // Failed codes since the last accepted one
+	LastFailedAt   *time.Time // Time of the last failed code
+	ChallengeNonce *string    // Nonce of the login challenge that can be completed
+}
+
+// Passkey is a WebAuthn credential a user signs in with instead of a password
+type Passkey struct {
+	ID           int
+	UserID       int
+	CredentialID string // Unpadded base64url of the credential ID
+	Name         string
+	Credential   string // JSON of the WebAuthn credential, updated after every login
+	CreatedAt    time.Time
+	LastUsedAt   *time.Time
+}